@@ -29,6 +29,15 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
+	// Run the migrate subcommand instead of the servers
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(context.Background(), logger, os.Args[2:]); err != nil {
+			logger.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize proto validator
 	validator, err := protovalidate.New()
 	if err != nil {
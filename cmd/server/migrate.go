@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/fredrikaverpil/go-microservice/internal/server"
+)
+
+const migrateUsage = "usage: server migrate [up | down [steps] | status]"
+
+// migrate runs the migrate subcommand against the SQL user store selected by
+// USER_STORE and USER_STORE_DSN.
+func migrate(ctx context.Context, logger *slog.Logger, args []string) (err error) {
+	migrator, closeDB, err := server.NewUserMigrator(logger)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, closeDB()) }()
+
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch {
+	case command == "up" && len(args) == 0:
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "Migrated database", "applied", applied)
+	case command == "down" && len(args) <= 1:
+		steps := 1
+		if len(args) == 1 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q: %s", args[0], migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "Migrated database", "reverted", reverted)
+	case command == "status" && len(args) == 0:
+		current, latest, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "Database schema version", "current", current, "latest", latest)
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 // Environment values.
 const (
@@ -21,3 +25,265 @@ func GetEnvironment() string {
 func IsDevelopment() bool {
 	return GetEnvironment() == EnvDevelopment
 }
+
+// Defaults for the soft-delete settings.
+const (
+	DefaultUserRetention     = 30 * 24 * time.Hour
+	DefaultUserPurgeInterval = time.Hour
+)
+
+// GetUserRetention returns how long soft-deleted users are kept before they
+// are purged, read from USER_RETENTION (e.g. "720h").
+func GetUserRetention() time.Duration {
+	return getDuration("USER_RETENTION", DefaultUserRetention)
+}
+
+// GetUserPurgeInterval returns how often expired users are purged, read from
+// USER_PURGE_INTERVAL (e.g. "1h").
+func GetUserPurgeInterval() time.Duration {
+	return getDuration("USER_PURGE_INTERVAL", DefaultUserPurgeInterval)
+}
+
+// getDuration returns the duration in the environment variable key, or
+// fallback if it is unset or invalid.
+func getDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
+// User storage backends.
+const (
+	UserStoreMemory   = "memory"
+	UserStoreFile     = "file"
+	UserStoreSQLite   = "sqlite"
+	UserStorePostgres = "postgres"
+)
+
+// Defaults for the file storage backend.
+const (
+	DefaultUserStoreDir              = "data"
+	DefaultUserStoreSync             = "always"
+	DefaultUserStoreSyncInterval     = time.Second
+	DefaultUserStoreSnapshotInterval = 5 * time.Minute
+)
+
+// DefaultUserStoreDSN is the database of the SQL storage backends, which is
+// only usable with SQLite.
+const DefaultUserStoreDSN = "data/users.db"
+
+// GetUserStore returns the storage backend for users, read from USER_STORE
+// ("memory", "file", "sqlite" or "postgres"), defaulting to memory.
+func GetUserStore() string {
+	return getString("USER_STORE", UserStoreMemory)
+}
+
+// DefaultUserStoreShards is the number of shards of the memory backend, where
+// a single shard is a plain in-memory store.
+const DefaultUserStoreShards = 1
+
+// GetUserStoreShards returns the number of shards the memory backend spreads
+// users over, read from USER_STORE_SHARDS.
+func GetUserStoreShards() int {
+	return max(getInt("USER_STORE_SHARDS", DefaultUserStoreShards), 1)
+}
+
+// GetUserStoreDir returns the data directory of the file backend, read from
+// USER_STORE_DIR.
+func GetUserStoreDir() string {
+	return getString("USER_STORE_DIR", DefaultUserStoreDir)
+}
+
+// GetUserStoreSync returns when the file backend fsyncs its log, read from
+// USER_STORE_SYNC ("always", "periodic" or "never").
+func GetUserStoreSync() string {
+	return getString("USER_STORE_SYNC", DefaultUserStoreSync)
+}
+
+// GetUserStoreSyncInterval returns how often the file backend fsyncs its log
+// with the periodic policy, read from USER_STORE_SYNC_INTERVAL (e.g. "1s").
+func GetUserStoreSyncInterval() time.Duration {
+	return getDuration("USER_STORE_SYNC_INTERVAL", DefaultUserStoreSyncInterval)
+}
+
+// GetUserStoreSnapshotInterval returns how often the file backend snapshots
+// and compacts its log, read from USER_STORE_SNAPSHOT_INTERVAL (e.g. "5m").
+func GetUserStoreSnapshotInterval() time.Duration {
+	return getDuration("USER_STORE_SNAPSHOT_INTERVAL", DefaultUserStoreSnapshotInterval)
+}
+
+// GetUserStoreDSN returns the database of the SQL backends, read from
+// USER_STORE_DSN: a file path for SQLite, or a connection string for Postgres.
+func GetUserStoreDSN() string {
+	return getString("USER_STORE_DSN", DefaultUserStoreDSN)
+}
+
+// DefaultUserHistoryWindow is how long past versions of users are kept for
+// reads at a point in time.
+const DefaultUserHistoryWindow = 5 * time.Minute
+
+// GetUserHistoryWindow returns how long past versions of users are kept for
+// reads with a read_time, read from USER_HISTORY_WINDOW (e.g. "5m"). Zero
+// disables reads at a point in time.
+func GetUserHistoryWindow() time.Duration {
+	return getDuration("USER_HISTORY_WINDOW", DefaultUserHistoryWindow)
+}
+
+// DefaultUserRevisionRetention is how long revisions of users are kept after
+// they were replaced.
+const DefaultUserRevisionRetention = 30 * 24 * time.Hour
+
+// GetUserRevisionRetention returns how long revisions of users are kept after
+// they were replaced, read from USER_REVISION_RETENTION (e.g. "720h"). Zero
+// keeps only the current revisions.
+func GetUserRevisionRetention() time.Duration {
+	return getDuration("USER_REVISION_RETENTION", DefaultUserRevisionRetention)
+}
+
+// Defaults for the relay of user events.
+const (
+	DefaultUserEventRelayInterval     = time.Second
+	DefaultUserEventBatchSize         = 100
+	DefaultUserEventSubscriberTimeout = 5 * time.Second
+)
+
+// GetUserEventRelayInterval returns how often the events of changes to users
+// are relayed from the outbox, read from USER_EVENT_RELAY_INTERVAL (e.g. "1s").
+func GetUserEventRelayInterval() time.Duration {
+	return getDuration("USER_EVENT_RELAY_INTERVAL", DefaultUserEventRelayInterval)
+}
+
+// GetUserEventBatchSize returns how many events are relayed at a time, read
+// from USER_EVENT_BATCH_SIZE.
+func GetUserEventBatchSize() int {
+	return max(getInt("USER_EVENT_BATCH_SIZE", DefaultUserEventBatchSize), 1)
+}
+
+// GetUserEventFile returns the file that events are appended to as
+// newline-delimited JSON, read from USER_EVENT_FILE. Empty disables the file.
+func GetUserEventFile() string {
+	return getString("USER_EVENT_FILE", "")
+}
+
+// GetUserEventSubscriberTimeout returns how long in-process subscribers of
+// events may fall behind before they are dropped, read from
+// USER_EVENT_SUBSCRIBER_TIMEOUT (e.g. "5s").
+func GetUserEventSubscriberTimeout() time.Duration {
+	return getDuration("USER_EVENT_SUBSCRIBER_TIMEOUT", DefaultUserEventSubscriberTimeout)
+}
+
+// DefaultUserWatchHistory is how many of the latest changes to users are kept
+// for watches to resume from.
+const DefaultUserWatchHistory = 10000
+
+// GetUserWatchHistory returns how many of the latest changes to users are kept
+// for watches to resume from, read from USER_WATCH_HISTORY.
+func GetUserWatchHistory() int {
+	return max(getInt("USER_WATCH_HISTORY", DefaultUserWatchHistory), 1)
+}
+
+// DefaultUserBatchLimit is how many users a batch method takes at most.
+const DefaultUserBatchLimit = 100
+
+// GetUserBatchLimit returns how many users a batch method takes at most, read
+// from USER_BATCH_LIMIT.
+func GetUserBatchLimit() int {
+	return max(getInt("USER_BATCH_LIMIT", DefaultUserBatchLimit), 1)
+}
+
+// Defaults for the user cache, which is disabled unless given a size.
+const (
+	DefaultUserCacheSize        = 0
+	DefaultUserCacheTTL         = time.Minute
+	DefaultUserCacheNegativeTTL = 5 * time.Second
+)
+
+// GetUserCacheSize returns the maximum number of users cached in front of
+// the user store, read from USER_CACHE_SIZE. Zero disables the cache.
+func GetUserCacheSize() int {
+	return getInt("USER_CACHE_SIZE", DefaultUserCacheSize)
+}
+
+// GetUserCacheTTL returns how long users are cached, read from
+// USER_CACHE_TTL (e.g. "1m").
+func GetUserCacheTTL() time.Duration {
+	return getDuration("USER_CACHE_TTL", DefaultUserCacheTTL)
+}
+
+// GetUserCacheNegativeTTL returns how long users that were not found are
+// cached, read from USER_CACHE_NEGATIVE_TTL (e.g. "5s"). Zero disables
+// negative caching.
+func GetUserCacheNegativeTTL() time.Duration {
+	return getDuration("USER_CACHE_NEGATIVE_TTL", DefaultUserCacheNegativeTTL)
+}
+
+// DefaultOperationConcurrency is how many long-running operations run at a
+// time.
+const DefaultOperationConcurrency = 4
+
+// GetOperationConcurrency returns how many long-running operations run at a
+// time, read from OPERATION_CONCURRENCY. The others wait for their turn.
+func GetOperationConcurrency() int {
+	return max(getInt("OPERATION_CONCURRENCY", DefaultOperationConcurrency), 1)
+}
+
+// DefaultOperationRetention is how long long-running operations are kept
+// once they are done.
+const DefaultOperationRetention = 24 * time.Hour
+
+// GetOperationRetention returns how long long-running operations are kept
+// once they are done, read from OPERATION_RETENTION (e.g. "24h"). They are
+// purged along with expired users. Zero keeps them until they are deleted.
+func GetOperationRetention() time.Duration {
+	return getDuration("OPERATION_RETENTION", DefaultOperationRetention)
+}
+
+// DefaultOperationLease is how long a long-running operation is taken to run
+// after the instance that runs it last renewed its lease.
+const DefaultOperationLease = time.Minute
+
+// GetOperationLease returns how long a long-running operation is taken to
+// run after the instance that runs it last renewed its lease, read from
+// OPERATION_LEASE (e.g. "1m"). Operations whose lease lapsed are failed by
+// the other instances, on startup and along with the purge of expired users.
+// Zero keeps leases from lapsing, for a single instance.
+func GetOperationLease() time.Duration {
+	return getDuration("OPERATION_LEASE", DefaultOperationLease)
+}
+
+// GetInstanceID returns the ID of this instance among the instances that
+// share a store, read from INSTANCE_ID. It defaults to the host name, which
+// is the pod name on Kubernetes.
+func GetInstanceID() string {
+	hostname, _ := os.Hostname()
+	return getString("INSTANCE_ID", hostname)
+}
+
+// GetUserFaults returns the faults to inject into the user store in
+// development, read from USER_FAULTS as JSON, such as
+// {"rules":[{"methods":["GetUser"],"probability":0.5,"error":"unavailable"}]}.
+// They can also be changed at runtime through /debug/faults on the gateway.
+func GetUserFaults() string {
+	return getString("USER_FAULTS", "")
+}
+
+// getInt returns the non-negative integer in the environment variable key,
+// or fallback if it is unset or invalid.
+func getInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// getString returns the value of the environment variable key, or fallback if
+// it is unset.
+func getString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "context"
+
+// actorKey is the context key of the actor making a request.
+type actorKey struct{}
+
+// ContextWithActor returns a context that carries the actor making a request,
+// such as a person or a service account, so that changes can be attributed
+// to it.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor making a request, or an empty string if
+// it is unknown.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -12,12 +12,15 @@ const (
 	Timeout
 	Unavailable
 	ResourceExhausted
+	Conflict
+	FailedPrecondition
 )
 
 type Error struct {
 	Type    ErrorType
 	Message string
 	Err     error
+	Field   string // The offending field, if the error is about a single field.
 }
 
 func (e *Error) Error() string {
@@ -39,6 +42,12 @@ func NewErrorAlreadyExists(message string, err error) error {
 	return &Error{Type: AlreadyExists, Message: message, Err: err}
 }
 
+// NewErrorFieldAlreadyExists returns an AlreadyExists error for a field that
+// must be unique, such as an email address.
+func NewErrorFieldAlreadyExists(field, message string, err error) error {
+	return &Error{Type: AlreadyExists, Message: message, Err: err, Field: field}
+}
+
 func NewErrorInvalidInput(message string, err error) error {
 	return &Error{Type: InvalidInput, Message: message, Err: err}
 }
@@ -58,3 +67,25 @@ func NewErrorUnavailable(message string, err error) error {
 func NewErrorResourceExhausted(message string, err error) error {
 	return &Error{Type: ResourceExhausted, Message: message, Err: err}
 }
+
+func NewErrorConflict(message string, err error) error {
+	return &Error{Type: Conflict, Message: message, Err: err}
+}
+
+func NewErrorFailedPrecondition(message string, err error) error {
+	return &Error{Type: FailedPrecondition, Message: message, Err: err}
+}
+
+// BatchItemError is the error of one item that failed a whole batch.
+type BatchItemError struct {
+	Index int // The index of the item in the batch.
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,81 @@
+package domain
+
+// UserEventType is the kind of change to a user.
+type UserEventType string
+
+const (
+	UserCreated UserEventType = "UserCreated"
+	UserUpdated UserEventType = "UserUpdated"
+	UserDeleted UserEventType = "UserDeleted"
+)
+
+// UserEvent tells other services about a change to a user. Events are
+// delivered at least once, and in order for each user.
+type UserEvent struct {
+	// Sequence is the position of the event in the outbox. The events of a
+	// user are in the order of their changes.
+	Sequence int64
+	// ID tells the event apart from all others, and is the same every time
+	// the event is delivered. It is the name of the revision that the change
+	// created, see AIP-162.
+	ID   string
+	Type UserEventType
+	User *User // The user after the change.
+}
+
+// NewUserEvent returns the event of the change that wrote a version of a
+// user. Changes that create a user start its revisions over, and only a
+// delete leaves a user deleted.
+func NewUserEvent(user *User) UserEvent {
+	eventType := UserUpdated
+	switch {
+	case user.Revision == 1:
+		eventType = UserCreated
+	case !user.DeleteTime.IsZero():
+		eventType = UserDeleted
+	}
+	return UserEvent{
+		ID:   user.Name + "@" + user.RevisionID,
+		Type: eventType,
+		User: user,
+	}
+}
+
+// UserChangeType is the kind of a change sent to a watch of users.
+type UserChangeType string
+
+const (
+	// UserExisting is a user that exists when a watch starts.
+	UserExisting UserChangeType = "existing"
+	// UserSnapshotComplete follows the last existing user.
+	UserSnapshotComplete UserChangeType = "snapshot_complete"
+	UserChangeCreated    UserChangeType = "created"
+	UserChangeUpdated    UserChangeType = "updated"
+	UserChangeDeleted    UserChangeType = "deleted"
+)
+
+// UserChange is sent to a watch of users.
+type UserChange struct {
+	Type UserChangeType
+	User *User // Nil when the snapshot is complete.
+	// ResumeToken continues a watch after the change. It is empty for the
+	// users of the snapshot.
+	ResumeToken string
+}
+
+// NewUserChange returns the change of an event, which a watch resumes after
+// with the given token.
+func NewUserChange(event UserEvent, resumeToken string) UserChange {
+	changeType := UserChangeUpdated
+	switch event.Type { //nolint:exhaustive // Other events are updates.
+	case UserCreated:
+		changeType = UserChangeCreated
+	case UserDeleted:
+		changeType = UserChangeDeleted
+	}
+	return UserChange{
+		Type:        changeType,
+		User:        event.User,
+		ResumeToken: resumeToken,
+	}
+}
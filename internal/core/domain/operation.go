@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// Operation is a long-running operation, see AIP-151. Metadata and Response
+// hold the domain values of the method that started it, such as
+// PurgeUsersMetadata and PurgeUsersResult.
+type Operation struct {
+	Name     string // Format: operations/{operation_id}
+	Metadata any    // The progress of the operation, if any.
+	Done     bool
+	Response any       // The result of the operation, once it is done without error.
+	Error    error     // The error of the operation, once it is done with one.
+	DoneTime time.Time // When the operation was done, zero until it is.
+	Owner    string    // The instance that started the operation.
+	// LeaseExpireTime is until when the owner is known to run the operation.
+	// The owner renews it while the operation runs. Zero if it never lapses.
+	LeaseExpireTime time.Time
+}
+
+// ListOperationsParams holds the parameters of a ListOperations call.
+type ListOperationsParams struct {
+	PageSize  int32
+	PageToken string
+	Filter    string // AIP-160 filter expression over name and done, empty matches all operations.
+}
+
+// PurgeUsersMetadata is the progress of a PurgeUsers operation.
+type PurgeUsersMetadata struct {
+	PurgeCount  int // The number of users that match the filter.
+	PurgedCount int // The number of users purged so far.
+}
+
+// PurgeUsersResult is the result of a PurgeUsers operation.
+type PurgeUsersResult struct {
+	PurgeCount  int      // The number of users purged, or that would be purged.
+	PurgeSample []string // A sample of the names of the users that would be purged.
+}
@@ -1,10 +1,6 @@
 package domain
 
-import (
-	"bytes"
-	"encoding/gob"
-	"time"
-)
+import "time"
 
 type User struct {
 	// TODO: rename 'Name' to 'UserID' and make it into a struct
@@ -14,22 +10,103 @@ type User struct {
 	CreateTime  time.Time
 	UpdateTime  time.Time
 	DeleteTime  time.Time
+	PurgeTime   time.Time
+	Revision    int64  // Incremented by the repository on every write.
+	Etag        string // Derived from the revision, see AIP-154.
+
+	// RevisionID tells the revision apart from all other revisions of users
+	// with the same name, see AIP-162.
+	RevisionID         string
+	RevisionCreateTime time.Time // When the revision was written.
+	RevisionActor      string    // Who wrote the revision, empty if unknown.
+}
+
+// GetUserParams holds the parameters of a GetUser call.
+type GetUserParams struct {
+	ShowDeleted bool      // Return the user even if it is soft deleted.
+	ReadTime    time.Time // Read the user as it was at this time, zero reads the current version.
+	RevisionID  string    // Read this revision of the user, empty reads the current version.
+}
+
+// BatchCreateUsersParams holds the parameters of a BatchCreateUsers call.
+type BatchCreateUsersParams struct {
+	// Atomic creates either all users or none. Otherwise every user that can
+	// be created is, and the others fail on their own.
+	Atomic bool
+}
+
+// BatchGetUsersParams holds the parameters of a BatchGetUsers call.
+type BatchGetUsersParams struct {
+	SkipMissing bool // Leave out missing users instead of failing.
+}
+
+// ImportUsersParams holds the parameters of an ImportUsers call.
+type ImportUsersParams struct {
+	ValidateOnly bool // Check the users against the stored ones without creating them.
+}
+
+// ListUsersParams holds the parameters of a ListUsers call.
+type ListUsersParams struct {
+	PageSize  int32
+	PageToken string
+	Filter    string // AIP-160 filter expression, empty matches all users.
+	OrderBy   string // AIP-132 ordering, empty orders by name.
+
+	ShowDeleted bool      // Include soft-deleted users.
+	ReadTime    time.Time // List the users as they were at this time, zero lists the current versions.
+}
+
+// UpdateUserParams holds the parameters of an UpdateUser call.
+type UpdateUserParams struct {
+	UpdateMask   []string // AIP-134 field mask, "*" replaces all updatable fields.
+	AllowMissing bool     // Create the user if it doesn't exist.
+	Etag         string   // If set, must match the stored user's etag.
+}
+
+// UserUpdate is one update of a BatchUpdateUsers call.
+type UserUpdate struct {
+	User   *User
+	Params UpdateUserParams
 }
 
-func (u *User) Copy() (*User, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	dec := gob.NewDecoder(&buf)
+// DeleteUserParams holds the parameters of a DeleteUser call.
+type DeleteUserParams struct {
+	Retention time.Duration // How long the soft-deleted user is kept before it is purged.
+	Etag      string        // If set, must match the stored user's etag.
+}
 
-	err := enc.Encode(u)
-	if err != nil {
-		return nil, err
-	}
+// UserDeletion is one deletion of a BatchDeleteUsers call.
+type UserDeletion struct {
+	Name   string
+	Params DeleteUserParams
+}
+
+// PurgeUsersParams holds the parameters of a PurgeUsers call.
+type PurgeUsersParams struct {
+	Filter string // AIP-160 filter expression of the soft-deleted users to purge.
+	Force  bool   // Purge the users, otherwise they are only counted.
+}
+
+// ListUserRevisionsParams holds the parameters of a ListUserRevisions call.
+type ListUserRevisionsParams struct {
+	PageSize  int32
+	PageToken string
+}
+
+// RollbackUserParams holds the parameters of a RollbackUser call.
+type RollbackUserParams struct {
+	RevisionID string // The revision to restore.
+	Etag       string // If set, must match the stored user's etag.
+}
+
+// WatchUsersParams holds the parameters of a WatchUsers call.
+type WatchUsersParams struct {
+	ResumeToken string // Resume after this token, empty starts with a snapshot.
+}
 
-	var userCopy User
-	err = dec.Decode(&userCopy)
-	if err != nil {
-		return nil, err
-	}
-	return &userCopy, nil
+// Copy returns a copy of the user. User holds only values, so a shallow copy
+// shares nothing with the original.
+func (u *User) Copy() *User {
+	userCopy := *u
+	return &userCopy
 }
@@ -2,22 +2,175 @@ package port
 
 import (
 	"context"
+	"time"
 
 	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
 )
 
 type UserService interface { //nolint: iface // UserService/UserRepository equal today but may diverge in the future.
 	CreateUser(ctx context.Context, user *domain.User) (*domain.User, error)
-	GetUser(ctx context.Context, name string) (*domain.User, error)
-	ListUsers(ctx context.Context, pageSize int32, pageToken string) ([]*domain.User, string, error)
-	UpdateUser(ctx context.Context, user *domain.User) (*domain.User, error)
-	DeleteUser(ctx context.Context, name string) error
+	// BatchCreateUsers creates users, see UserRepository.BatchCreateUsers.
+	BatchCreateUsers(
+		ctx context.Context,
+		users []*domain.User,
+		params domain.BatchCreateUsersParams,
+	) ([]*domain.User, []error, error)
+	// ImportUsers creates the users of an import each on their own, and
+	// returns the error of every user that couldn't be created, in order.
+	// With params.ValidateOnly nothing is created.
+	ImportUsers(ctx context.Context, users []*domain.User, params domain.ImportUsersParams) ([]error, error)
+	GetUser(ctx context.Context, name string, params domain.GetUserParams) (*domain.User, error)
+	// BatchGetUsers returns the users with the given names, in order.
+	BatchGetUsers(ctx context.Context, names []string, params domain.BatchGetUsersParams) ([]*domain.User, error)
+	ListUsers(ctx context.Context, params domain.ListUsersParams) ([]*domain.User, string, error)
+	UpdateUser(
+		ctx context.Context,
+		user *domain.User,
+		params domain.UpdateUserParams,
+	) (updated *domain.User, created bool, err error)
+	// BatchUpdateUsers updates users, see UserRepository.BatchUpdateUsers.
+	BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error)
+	DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error
+	// BatchDeleteUsers deletes users, see UserRepository.BatchDeleteUsers.
+	BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error
+	UndeleteUser(ctx context.Context, name string) (*domain.User, error)
+	// PurgeUsers permanently removes the soft-deleted users that match the
+	// filter in an operation. Unless params.Force is set, nothing is removed
+	// and the operation is done at once with a preview.
+	PurgeUsers(ctx context.Context, params domain.PurgeUsersParams) (*domain.Operation, error)
+	LookupUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	ListUserRevisions(
+		ctx context.Context,
+		name string,
+		params domain.ListUserRevisionsParams,
+	) ([]*domain.User, string, error)
+	RollbackUser(ctx context.Context, name string, params domain.RollbackUserParams) (*domain.User, error)
+	// WatchUsers sends the users and then their changes to send, until ctx is
+	// done or send fails.
+	WatchUsers(ctx context.Context, params domain.WatchUsersParams, send func(domain.UserChange) error) error
 }
 
 type UserRepository interface { //nolint: iface // UserService/UserRepository equal today but may diverge in the future.
+	// Every write records an event in the outbox, together with the change.
+	UserEventOutbox
 	CreateUser(ctx context.Context, user *domain.User) (*domain.User, error)
-	GetUser(ctx context.Context, name string) (*domain.User, error)
-	ListUsers(ctx context.Context, pageSize int32, pageToken string) ([]*domain.User, string, error)
-	UpdateUser(ctx context.Context, user *domain.User) (*domain.User, error)
-	DeleteUser(ctx context.Context, name string) error
+	// BatchCreateUsers creates users in one write, and returns the created
+	// users and the errors of the users that weren't, at the index of each
+	// user. In atomic mode either all users are created or none, and a user
+	// that fails fails the call with a domain.BatchItemError.
+	BatchCreateUsers(
+		ctx context.Context,
+		users []*domain.User,
+		params domain.BatchCreateUsersParams,
+	) ([]*domain.User, []error, error)
+	GetUser(ctx context.Context, name string, params domain.GetUserParams) (*domain.User, error)
+	// BatchGetUsers returns the named users that exist and aren't deleted,
+	// keyed by name. All of them are read at the same point in time.
+	BatchGetUsers(ctx context.Context, names []string) (map[string]*domain.User, error)
+	ListUsers(ctx context.Context, params domain.ListUsersParams) ([]*domain.User, string, error)
+	UpdateUser(
+		ctx context.Context,
+		user *domain.User,
+		params domain.UpdateUserParams,
+	) (updated *domain.User, created bool, err error)
+	// BatchUpdateUsers applies the updates in one write, and returns the
+	// updated users in order. Either all updates are applied or none, and an
+	// update that fails fails the call with a domain.BatchItemError.
+	BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error)
+	DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error
+	// BatchDeleteUsers soft deletes users in one write. Either all users are
+	// deleted or none, and a deletion that fails fails the call with a
+	// domain.BatchItemError.
+	BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error
+	UndeleteUser(ctx context.Context, name string) (*domain.User, error)
+	LookupUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	// PurgeExpiredUsers permanently removes soft-deleted users whose purge
+	// time is before now, and returns how many were removed.
+	PurgeExpiredUsers(ctx context.Context, now time.Time) (int, error)
+	// PurgeUsers permanently removes the named users that are soft deleted,
+	// whatever their purge time, and returns how many were removed. Users
+	// that don't exist or aren't deleted are skipped.
+	PurgeUsers(ctx context.Context, names []string) (int, error)
+	// SnapshotUsers returns the users as they were at readTime. It fails with
+	// a FailedPrecondition error if readTime is outside the history that the
+	// repository keeps.
+	SnapshotUsers(ctx context.Context, readTime time.Time) (UserSnapshot, error)
+	// ListUserRevisions returns the revisions of a user that are kept, newest
+	// first. Revisions of purged users are kept as well.
+	ListUserRevisions(
+		ctx context.Context,
+		name string,
+		params domain.ListUserRevisionsParams,
+	) ([]*domain.User, string, error)
+	// GetUserRevision returns a revision of a user that is kept.
+	GetUserRevision(ctx context.Context, name, revisionID string) (*domain.User, error)
+	// RollbackUser restores the fields of a revision of a user as a new
+	// revision.
+	RollbackUser(ctx context.Context, name string, params domain.RollbackUserParams) (*domain.User, error)
+}
+
+// UserEventOutbox holds the events of changes to users until they have been
+// published.
+type UserEventOutbox interface {
+	// ReadUserEvents returns up to limit of the oldest events in the outbox,
+	// ordered by sequence.
+	ReadUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error)
+	// AckUserEvents removes events that have been published from the outbox.
+	AckUserEvents(ctx context.Context, events []domain.UserEvent) error
+}
+
+// UserEventSink publishes the events of changes to users. An event may be
+// published more than once, so consumers should tell events apart by ID.
+type UserEventSink interface {
+	PublishUserEvents(ctx context.Context, events []domain.UserEvent) error
+}
+
+// UserEventFeed keeps the latest events of changes to users in the order they
+// were published, so that they can be watched. Watches resume from tokens
+// that the feed hands out.
+type UserEventFeed interface {
+	// UserEventsToken returns a token for the position after the newest
+	// event.
+	UserEventsToken() string
+	// WaitUserChanges returns up to limit of the changes after the token,
+	// waiting for one if there are none yet. It fails with a
+	// FailedPrecondition error if the changes after the token are no longer
+	// kept.
+	WaitUserChanges(ctx context.Context, token string, limit int) ([]domain.UserChange, error)
+}
+
+// UserSnapshot is a read-only view of the users at a point in time. The
+// ReadTime of the params is only used to tell page tokens apart.
+type UserSnapshot interface {
+	GetUser(ctx context.Context, name string, params domain.GetUserParams) (*domain.User, error)
+	ListUsers(ctx context.Context, params domain.ListUsersParams) ([]*domain.User, string, error)
+}
+
+// OperationService manages long-running operations, following AIP-151.
+type OperationService interface {
+	GetOperation(ctx context.Context, name string) (*domain.Operation, error)
+	ListOperations(ctx context.Context, params domain.ListOperationsParams) ([]*domain.Operation, string, error)
+	// CancelOperation asks an operation to stop. The operation is done with a
+	// context.Canceled error once it has stopped, unless it was done already.
+	CancelOperation(ctx context.Context, name string) error
+	// DeleteOperation forgets an operation. It doesn't cancel the operation.
+	DeleteOperation(ctx context.Context, name string) error
+	// WaitOperation returns the operation once it is done, or when timeout
+	// has passed if it is positive.
+	WaitOperation(ctx context.Context, name string, timeout time.Duration) (*domain.Operation, error)
+}
+
+// OperationStore keeps long-running operations, so that they can be polled
+// after they are done.
+type OperationStore interface {
+	// PutOperation creates or replaces an operation.
+	PutOperation(ctx context.Context, op *domain.Operation) error
+	GetOperation(ctx context.Context, name string) (*domain.Operation, error)
+	// ListOperations returns the operations in order of name. A page size of
+	// zero returns all operations.
+	ListOperations(ctx context.Context, params domain.ListOperationsParams) ([]*domain.Operation, string, error)
+	DeleteOperation(ctx context.Context, name string) error
+	// PurgeOperations removes the operations that were done before the given
+	// time, and returns how many.
+	PurgeOperations(ctx context.Context, before time.Time) (int, error)
 }
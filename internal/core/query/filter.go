@@ -0,0 +1,344 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"go.einride.tech/aip/filtering"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// User fields that can be referenced in a filter.
+const (
+	FieldName        = "name"
+	FieldDisplayName = "display_name"
+	FieldEmail       = "email"
+	FieldCreateTime  = "create_time"
+	FieldUpdateTime  = "update_time"
+)
+
+// wildcard matches any sequence of characters in a string literal.
+const wildcard = "*"
+
+// SyntaxError is returned when a filter is malformed.
+type SyntaxError struct {
+	Position filtering.Position
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %s: %s", e.Position, e.Message)
+}
+
+// positionedError is implemented by the lexer and parser errors of the
+// filtering package.
+type positionedError interface {
+	error
+	Position() filtering.Position
+	Message() string
+}
+
+// filterRequest adapts a raw filter string to filtering.Request.
+type filterRequest string
+
+func (f filterRequest) GetFilter() string {
+	return string(f)
+}
+
+func userFilterDeclarations() (*filtering.Declarations, error) {
+	return filtering.NewDeclarations(
+		filtering.DeclareStandardFunctions(),
+		filtering.DeclareIdent(FieldName, filtering.TypeString),
+		filtering.DeclareIdent(FieldDisplayName, filtering.TypeString),
+		filtering.DeclareIdent(FieldEmail, filtering.TypeString),
+		filtering.DeclareIdent(FieldCreateTime, filtering.TypeTimestamp),
+		filtering.DeclareIdent(FieldUpdateTime, filtering.TypeTimestamp),
+	)
+}
+
+// ParseUserFilter parses and type-checks an AIP-160 filter over users.
+//
+// Syntax errors are returned as a *SyntaxError holding the position of the
+// innermost failure.
+func ParseUserFilter(filter string) (filtering.Filter, error) {
+	declarations, err := userFilterDeclarations()
+	if err != nil {
+		return filtering.Filter{}, err
+	}
+	parsed, err := filtering.ParseFilter(filterRequest(filter), declarations)
+	if err != nil {
+		return filtering.Filter{}, toSyntaxError(err)
+	}
+	return parsed, nil
+}
+
+// toSyntaxError flattens the chain of positioned parse errors into the
+// innermost one. Type-check errors carry no position and are returned as is.
+func toSyntaxError(err error) error {
+	var innermost positionedError
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if positioned, ok := e.(positionedError); ok { //nolint:errorlint // walking the chain manually
+			innermost = positioned
+		}
+	}
+	if innermost == nil {
+		return err
+	}
+	message := innermost.Message()
+	if cause := errors.Unwrap(innermost); errors.Is(cause, io.EOF) {
+		message = "unexpected end of filter"
+	} else if cause != nil {
+		message += ": " + cause.Error()
+	}
+	return &SyntaxError{Position: innermost.Position(), Message: message}
+}
+
+// MatchUser reports whether the user matches the filter. An empty filter
+// matches every user.
+//
+// String comparisons with = and != treat * in the literal as a wildcard. The
+// has operator (:) matches when the field contains the value, ignoring case,
+// and field:* matches when the field is set at all.
+func MatchUser(filter filtering.Filter, user *domain.User) (bool, error) {
+	if filter.CheckedExpr == nil {
+		return true, nil
+	}
+	return evalBool(filter.CheckedExpr.GetExpr(), func(field string) (any, error) {
+		return userFieldValue(field, user)
+	})
+}
+
+// fieldFunc returns the value of a field of the resource that a filter is
+// evaluated on.
+type fieldFunc func(field string) (any, error)
+
+func evalBool(e *expr.Expr, fields fieldFunc) (bool, error) {
+	switch kind := e.GetExprKind().(type) {
+	case *expr.Expr_ConstExpr:
+		if b, ok := kind.ConstExpr.GetConstantKind().(*expr.Constant_BoolValue); ok {
+			return b.BoolValue, nil
+		}
+		return false, fmt.Errorf("constant %v is not a bool", kind.ConstExpr)
+	case *expr.Expr_IdentExpr:
+		value, err := fields(kind.IdentExpr.GetName())
+		if err != nil {
+			return false, err
+		}
+		b, ok := value.(bool)
+		if !ok {
+			return false, fmt.Errorf("field %q is not a bool", kind.IdentExpr.GetName())
+		}
+		return b, nil
+	case *expr.Expr_CallExpr:
+		return evalCall(kind.CallExpr, fields)
+	default:
+		return false, fmt.Errorf("unsupported expression %T", kind)
+	}
+}
+
+func evalCall(call *expr.Expr_Call, fields fieldFunc) (bool, error) {
+	args := call.GetArgs()
+	switch call.GetFunction() {
+	case filtering.FunctionAnd:
+		for _, arg := range args {
+			ok, err := evalBool(arg, fields)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case filtering.FunctionOr:
+		for _, arg := range args {
+			ok, err := evalBool(arg, fields)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case filtering.FunctionNot:
+		if len(args) != 1 {
+			return false, errors.New("NOT takes exactly one argument")
+		}
+		ok, err := evalBool(args[0], fields)
+		return !ok, err
+	case filtering.FunctionHas:
+		return evalHas(args, fields)
+	case filtering.FunctionEquals,
+		filtering.FunctionNotEquals,
+		filtering.FunctionLessThan,
+		filtering.FunctionLessEquals,
+		filtering.FunctionGreaterThan,
+		filtering.FunctionGreaterEquals:
+		return evalComparison(call.GetFunction(), args, fields)
+	default:
+		return false, fmt.Errorf("unsupported function %q", call.GetFunction())
+	}
+}
+
+func evalHas(args []*expr.Expr, fields fieldFunc) (bool, error) {
+	if len(args) != 2 { //nolint:mnd // binary operator
+		return false, errors.New("has operator takes exactly two arguments")
+	}
+	lhs, err := evalValue(args[0], fields)
+	if err != nil {
+		return false, err
+	}
+	rhs, err := evalValue(args[1], fields)
+	if err != nil {
+		return false, err
+	}
+	field, ok := lhs.(string)
+	if !ok {
+		return false, fmt.Errorf("has operator not supported for %T", lhs)
+	}
+	value, ok := rhs.(string)
+	if !ok {
+		return false, fmt.Errorf("has operator not supported for %T", rhs)
+	}
+	if value == wildcard {
+		return field != "", nil
+	}
+	return strings.Contains(strings.ToLower(field), strings.ToLower(value)), nil
+}
+
+func evalComparison(function string, args []*expr.Expr, fields fieldFunc) (bool, error) {
+	if len(args) != 2 { //nolint:mnd // binary operator
+		return false, fmt.Errorf("%s takes exactly two arguments", function)
+	}
+	lhs, err := evalValue(args[0], fields)
+	if err != nil {
+		return false, err
+	}
+	rhs, err := evalValue(args[1], fields)
+	if err != nil {
+		return false, err
+	}
+
+	var cmp int
+	switch l := lhs.(type) {
+	case time.Time:
+		r, err := asTime(rhs)
+		if err != nil {
+			return false, err
+		}
+		cmp = l.Compare(r)
+	case string:
+		r, ok := rhs.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare string with %T", rhs)
+		}
+		if strings.Contains(r, wildcard) &&
+			(function == filtering.FunctionEquals || function == filtering.FunctionNotEquals) {
+			return matchWildcard(l, r) == (function == filtering.FunctionEquals), nil
+		}
+		cmp = strings.Compare(l, r)
+	case bool:
+		r, ok := rhs.(bool)
+		if !ok {
+			return false, fmt.Errorf("cannot compare bool with %T", rhs)
+		}
+		if function != filtering.FunctionEquals && function != filtering.FunctionNotEquals {
+			return false, fmt.Errorf("operator %s not supported for bool", function)
+		}
+		return (l == r) == (function == filtering.FunctionEquals), nil
+	default:
+		return false, fmt.Errorf("comparison not supported for %T", lhs)
+	}
+
+	switch function {
+	case filtering.FunctionEquals:
+		return cmp == 0, nil
+	case filtering.FunctionNotEquals:
+		return cmp != 0, nil
+	case filtering.FunctionLessThan:
+		return cmp < 0, nil
+	case filtering.FunctionLessEquals:
+		return cmp <= 0, nil
+	case filtering.FunctionGreaterThan:
+		return cmp > 0, nil
+	default: // filtering.FunctionGreaterEquals
+		return cmp >= 0, nil
+	}
+}
+
+// evalValue evaluates an operand to a string, bool or time.Time.
+func evalValue(e *expr.Expr, fields fieldFunc) (any, error) {
+	switch kind := e.GetExprKind().(type) {
+	case *expr.Expr_IdentExpr:
+		return fields(kind.IdentExpr.GetName())
+	case *expr.Expr_ConstExpr:
+		switch c := kind.ConstExpr.GetConstantKind().(type) {
+		case *expr.Constant_StringValue:
+			return c.StringValue, nil
+		case *expr.Constant_BoolValue:
+			return c.BoolValue, nil
+		default:
+			return nil, fmt.Errorf("unsupported constant %T", c)
+		}
+	case *expr.Expr_CallExpr:
+		if kind.CallExpr.GetFunction() == filtering.FunctionTimestamp && len(kind.CallExpr.GetArgs()) == 1 {
+			arg, err := evalValue(kind.CallExpr.GetArgs()[0], fields)
+			if err != nil {
+				return nil, err
+			}
+			return asTime(arg)
+		}
+		return evalBool(e, fields)
+	default:
+		return nil, fmt.Errorf("unsupported operand %T", kind)
+	}
+}
+
+func userFieldValue(field string, user *domain.User) (any, error) {
+	switch field {
+	case FieldName:
+		return user.Name, nil
+	case FieldDisplayName:
+		return user.DisplayName, nil
+	case FieldEmail:
+		return user.Email, nil
+	case FieldCreateTime:
+		return user.CreateTime, nil
+	case FieldUpdateTime:
+		return user.UpdateTime, nil
+	default:
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+}
+
+func asTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", t, err)
+		}
+		return parsed, nil
+	default:
+		return time.Time{}, fmt.Errorf("cannot use %T as timestamp", v)
+	}
+}
+
+// matchWildcard reports whether s matches pattern, where each * in pattern
+// matches any sequence of characters. The pattern must contain a wildcard.
+func matchWildcard(s, pattern string) bool {
+	parts := strings.Split(pattern, wildcard)
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,86 @@
+package query_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+// TestMatchUser tests filter evaluation following AIP-160 (Filtering).
+func TestMatchUser(t *testing.T) {
+	t.Parallel()
+
+	user := &domain.User{
+		Name:        "users/jane",
+		DisplayName: "Jane Doe",
+		Email:       "jane@example.com",
+		CreateTime:  time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		UpdateTime:  time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	for _, tt := range []struct {
+		filter string
+		want   bool
+	}{
+		{filter: ``, want: true},
+		{filter: `display_name = "Jane Doe"`, want: true},
+		{filter: `display_name = "John Doe"`, want: false},
+		{filter: `display_name != "John Doe"`, want: true},
+		{filter: `email = "*@example.com"`, want: true},
+		{filter: `email = "*@example.org"`, want: false},
+		{filter: `email != "jane@*"`, want: false},
+		{filter: `display_name = "J*e D*"`, want: true},
+		{filter: `display_name:"doe"`, want: true},
+		{filter: `display_name:"smith"`, want: false},
+		{filter: `email:*`, want: true},
+		{filter: `name > "users/a" AND name < "users/z"`, want: true},
+		{filter: `display_name = "John" OR email = "jane@example.com"`, want: true},
+		{filter: `NOT display_name = "Jane Doe"`, want: false},
+		{filter: `-email:"example"`, want: false},
+		{filter: `create_time > "2023-12-31T00:00:00Z"`, want: true},
+		{filter: `create_time >= timestamp("2024-01-01T12:00:00Z")`, want: true},
+		{filter: `update_time < "2024-01-01T00:00:00Z"`, want: false},
+		{filter: `create_time < update_time`, want: true},
+		{filter: `(display_name = "John" OR display_name = "Jane Doe") AND email:"example.com"`, want: true},
+	} {
+		t.Run(tt.filter, func(t *testing.T) {
+			t.Parallel()
+			filter, err := query.ParseUserFilter(tt.filter)
+			assert.NilError(t, err)
+			got, err := query.MatchUser(filter, user)
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+// TestParseUserFilter tests filter validation following AIP-160 (Filtering).
+func TestParseUserFilter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("failure - syntax error reports position", func(t *testing.T) {
+		t.Parallel()
+		_, err := query.ParseUserFilter(`display_name = "Jane" AND (`)
+		var syntaxErr *query.SyntaxError
+		assert.Assert(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, syntaxErr.Position.Column, int32(28))
+		assert.Error(t, err, "syntax error at 1:28: unexpected end of filter")
+	})
+
+	t.Run("failure - unknown field", func(t *testing.T) {
+		t.Parallel()
+		_, err := query.ParseUserFilter(`password = "secret"`)
+		assert.ErrorContains(t, err, "password")
+	})
+
+	t.Run("failure - invalid timestamp", func(t *testing.T) {
+		t.Parallel()
+		_, err := query.ParseUserFilter(`create_time > "yesterday"`)
+		assert.Check(t, is.ErrorContains(err, "RFC3339"))
+	})
+}
@@ -0,0 +1,49 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"go.einride.tech/aip/filtering"
+)
+
+// Operation fields that can be referenced in a filter, next to FieldName.
+const (
+	FieldDone = "done"
+)
+
+// ParseOperationFilter parses and type-checks an AIP-160 filter over
+// operations, see ParseUserFilter.
+func ParseOperationFilter(filter string) (filtering.Filter, error) {
+	declarations, err := filtering.NewDeclarations(
+		filtering.DeclareStandardFunctions(),
+		filtering.DeclareIdent(FieldName, filtering.TypeString),
+		filtering.DeclareIdent(FieldDone, filtering.TypeBool),
+	)
+	if err != nil {
+		return filtering.Filter{}, err
+	}
+	parsed, err := filtering.ParseFilter(filterRequest(filter), declarations)
+	if err != nil {
+		return filtering.Filter{}, toSyntaxError(err)
+	}
+	return parsed, nil
+}
+
+// MatchOperation reports whether the operation matches the filter, with the
+// semantics of MatchUser. An empty filter matches every operation.
+func MatchOperation(filter filtering.Filter, op *domain.Operation) (bool, error) {
+	if filter.CheckedExpr == nil {
+		return true, nil
+	}
+	return evalBool(filter.CheckedExpr.GetExpr(), func(field string) (any, error) {
+		switch field {
+		case FieldName:
+			return op.Name, nil
+		case FieldDone:
+			return op.Done, nil
+		default:
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	})
+}
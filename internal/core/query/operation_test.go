@@ -0,0 +1,43 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"gotest.tools/v3/assert"
+)
+
+// TestMatchOperation tests filter evaluation over operations.
+func TestMatchOperation(t *testing.T) {
+	t.Parallel()
+
+	op := &domain.Operation{Name: "operations/abc", Done: true}
+
+	for _, tt := range []struct {
+		filter string
+		want   bool
+	}{
+		{filter: ``, want: true},
+		{filter: `done`, want: true},
+		{filter: `NOT done`, want: false},
+		{filter: `-done`, want: false},
+		{filter: `name = "operations/a*"`, want: true},
+		{filter: `name = "operations/x*" OR done`, want: true},
+	} {
+		t.Run(tt.filter, func(t *testing.T) {
+			t.Parallel()
+			filter, err := query.ParseOperationFilter(tt.filter)
+			assert.NilError(t, err)
+			got, err := query.MatchOperation(filter, op)
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+
+	t.Run("failure - unknown field", func(t *testing.T) {
+		t.Parallel()
+		_, err := query.ParseOperationFilter(`metadata = "x"`)
+		assert.ErrorContains(t, err, "undeclared identifier")
+	})
+}
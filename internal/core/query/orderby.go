@@ -0,0 +1,114 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"go.einride.tech/aip/ordering"
+)
+
+// SortableUserFields are the user fields that can be used in an order_by.
+//
+//nolint:gochecknoglobals // read-only allow-list
+var SortableUserFields = []string{
+	FieldName,
+	FieldDisplayName,
+	FieldEmail,
+	FieldCreateTime,
+	FieldUpdateTime,
+}
+
+// ParseUserOrderBy parses an AIP-132 order_by over users, such as
+// "create_time desc, display_name", and validates it against
+// SortableUserFields.
+func ParseUserOrderBy(orderBy string) (ordering.OrderBy, error) {
+	var result ordering.OrderBy
+	if err := result.UnmarshalString(orderBy); err != nil {
+		return ordering.OrderBy{}, err
+	}
+	if err := result.ValidateForPaths(SortableUserFields...); err != nil {
+		return ordering.OrderBy{}, err
+	}
+	return result, nil
+}
+
+// CompareUsers compares two users by the given ordering. Users that are equal
+// on all ordering fields are ordered by name, so the result is a total order
+// and suitable for cursor-based pagination.
+func CompareUsers(orderBy ordering.OrderBy, a, b *domain.User) int {
+	for _, field := range orderBy.Fields {
+		cmp := compareField(field.Path, a, b)
+		if field.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func compareField(field string, a, b *domain.User) int {
+	switch field {
+	case FieldDisplayName:
+		return strings.Compare(a.DisplayName, b.DisplayName)
+	case FieldEmail:
+		return strings.Compare(a.Email, b.Email)
+	case FieldCreateTime:
+		return a.CreateTime.Compare(b.CreateTime)
+	case FieldUpdateTime:
+		return a.UpdateTime.Compare(b.UpdateTime)
+	default: // FieldName
+		return strings.Compare(a.Name, b.Name)
+	}
+}
+
+// Cursor returns the position of a user in a listing with the given ordering:
+// the values of the ordering fields followed by the user's name.
+func Cursor(orderBy ordering.OrderBy, user *domain.User) []string {
+	cursor := make([]string, 0, len(orderBy.Fields)+1)
+	for _, field := range orderBy.Fields {
+		switch field.Path {
+		case FieldDisplayName:
+			cursor = append(cursor, user.DisplayName)
+		case FieldEmail:
+			cursor = append(cursor, user.Email)
+		case FieldCreateTime:
+			cursor = append(cursor, user.CreateTime.Format(time.RFC3339Nano))
+		case FieldUpdateTime:
+			cursor = append(cursor, user.UpdateTime.Format(time.RFC3339Nano))
+		default: // FieldName
+			cursor = append(cursor, user.Name)
+		}
+	}
+	return append(cursor, user.Name)
+}
+
+// CursorUser is the inverse of Cursor. It returns a user holding only the
+// fields of the cursor, which can be passed to CompareUsers to find the users
+// that come after it.
+func CursorUser(orderBy ordering.OrderBy, cursor []string) (*domain.User, error) {
+	if len(cursor) != len(orderBy.Fields)+1 {
+		return nil, fmt.Errorf("cursor has %d values, expected %d", len(cursor), len(orderBy.Fields)+1)
+	}
+	user := &domain.User{Name: cursor[len(cursor)-1]}
+	for i, field := range orderBy.Fields {
+		var err error
+		switch field.Path {
+		case FieldDisplayName:
+			user.DisplayName = cursor[i]
+		case FieldEmail:
+			user.Email = cursor[i]
+		case FieldCreateTime:
+			user.CreateTime, err = time.Parse(time.RFC3339Nano, cursor[i])
+		case FieldUpdateTime:
+			user.UpdateTime, err = time.Parse(time.RFC3339Nano, cursor[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor value for %s: %w", field.Path, err)
+		}
+	}
+	return user, nil
+}
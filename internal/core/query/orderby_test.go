@@ -0,0 +1,97 @@
+package query_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"gotest.tools/v3/assert"
+)
+
+// TestParseUserOrderBy tests order_by validation following AIP-132 (Ordering).
+func TestParseUserOrderBy(t *testing.T) {
+	t.Parallel()
+
+	for _, orderBy := range []string{
+		"",
+		"display_name",
+		"create_time desc",
+		"create_time desc, display_name asc",
+		"email,name desc",
+	} {
+		t.Run("success - "+orderBy, func(t *testing.T) {
+			t.Parallel()
+			_, err := query.ParseUserOrderBy(orderBy)
+			assert.NilError(t, err)
+		})
+	}
+
+	for _, orderBy := range []string{
+		"password",
+		"display_name sideways",
+		"display_name desc asc",
+		"display_name;drop",
+	} {
+		t.Run("failure - "+orderBy, func(t *testing.T) {
+			t.Parallel()
+			_, err := query.ParseUserOrderBy(orderBy)
+			assert.Assert(t, err != nil)
+		})
+	}
+}
+
+// TestCompareUsers tests that users are ordered by the order_by fields, with
+// ties broken by name.
+func TestCompareUsers(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := []*domain.User{
+		{Name: "users/a", DisplayName: "Zed", CreateTime: t0},
+		{Name: "users/b", DisplayName: "Amy", CreateTime: t0.Add(time.Hour)},
+		{Name: "users/c", DisplayName: "Amy", CreateTime: t0},
+	}
+
+	sorted := func(orderBy string) []string {
+		ob, err := query.ParseUserOrderBy(orderBy)
+		assert.NilError(t, err)
+		result := slices.Clone(users)
+		slices.SortFunc(result, func(a, b *domain.User) int {
+			return query.CompareUsers(ob, a, b)
+		})
+		names := make([]string, 0, len(result))
+		for _, user := range result {
+			names = append(names, user.Name)
+		}
+		return names
+	}
+
+	assert.DeepEqual(t, sorted(""), []string{"users/a", "users/b", "users/c"})
+	assert.DeepEqual(t, sorted("display_name"), []string{"users/b", "users/c", "users/a"})
+	assert.DeepEqual(t, sorted("create_time desc"), []string{"users/b", "users/a", "users/c"})
+	assert.DeepEqual(t, sorted("display_name, create_time desc"), []string{"users/b", "users/c", "users/a"})
+	assert.DeepEqual(t, sorted("name desc"), []string{"users/c", "users/b", "users/a"})
+}
+
+// TestCursor tests that a cursor round-trips to a user at the same position.
+func TestCursor(t *testing.T) {
+	t.Parallel()
+
+	orderBy, err := query.ParseUserOrderBy("create_time desc, display_name")
+	assert.NilError(t, err)
+	user := &domain.User{
+		Name:        "users/a",
+		DisplayName: "Amy",
+		Email:       "amy@example.com",
+		CreateTime:  time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC),
+	}
+
+	cursorUser, err := query.CursorUser(orderBy, query.Cursor(orderBy, user))
+	assert.NilError(t, err)
+	assert.Equal(t, query.CompareUsers(orderBy, user, cursorUser), 0)
+
+	_, err = query.CursorUser(orderBy, []string{"users/a"})
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"go.einride.tech/aip/resourceid"
+)
+
+// Operations runs long-running operations in the background, following
+// AIP-151. Up to a limit of operations run at a time, and the others wait
+// for their turn. Operations are kept in a store, so that they can be polled.
+//
+// Instances that share a store tell their operations apart by owner. An
+// instance holds a lease on every operation it runs, and renews it until the
+// operation is done. Operations whose lease lapsed are taken to be abandoned.
+type Operations struct {
+	logger    *slog.Logger
+	store     port.OperationStore
+	retention time.Duration   // How long operations are kept once done.
+	owner     string          // The instance that runs the operations.
+	lease     time.Duration   // How long a lease lasts, forever if zero.
+	slots     chan struct{}   // Holds a value for every operation that runs.
+	ctx       context.Context // Cancelled by Close, which stops the running operations.
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mutex   sync.Mutex // Serializes the changes to stored operations.
+	running map[string]*runningOperation
+}
+
+// runningOperation is an operation that isn't done yet.
+type runningOperation struct {
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the operation is done.
+}
+
+// OperationsOptions configures an Operations.
+type OperationsOptions struct {
+	// Concurrency is how many operations run at a time.
+	Concurrency int
+	// Retention is how long operations are kept once done, or until they are
+	// deleted if zero.
+	Retention time.Duration
+	// Owner identifies the instance among those that share the store. An
+	// empty owner takes every operation in the store to be its own.
+	Owner string
+	// Lease is how long an operation is taken to run after its owner last
+	// renewed it. Leases are renewed at a third of it. Zero keeps them from
+	// lapsing, which suits a single instance.
+	Lease time.Duration
+}
+
+// NewOperations returns an Operations that keeps operations in store.
+func NewOperations(logger *slog.Logger, store port.OperationStore, opts OperationsOptions) *Operations {
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &Operations{
+		logger:    logger,
+		store:     store,
+		retention: opts.Retention,
+		owner:     opts.Owner,
+		lease:     opts.Lease,
+		slots:     make(chan struct{}, max(opts.Concurrency, 1)),
+		ctx:       ctx,
+		cancel:    cancel,
+		running:   make(map[string]*runningOperation),
+	}
+	if o.lease > 0 {
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			o.renewLeases()
+		}()
+	}
+	return o
+}
+
+// OperationFunc is the work of an operation. It reports its progress by
+// calling progress with new metadata, and returns the response of the
+// operation. It should stop once ctx is cancelled.
+type OperationFunc func(ctx context.Context, progress func(metadata any)) (response any, err error)
+
+// Start starts an operation with the initial metadata, and returns it while
+// run runs in the background. The operation keeps the values of ctx, but
+// isn't cancelled with it.
+func (o *Operations) Start(ctx context.Context, metadata any, run OperationFunc) (*domain.Operation, error) {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	running := &runningOperation{cancel: cancel, done: make(chan struct{})}
+	op, err := o.add(ctx, &domain.Operation{Metadata: metadata, LeaseExpireTime: o.leaseExpireTime()}, running)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stop := context.AfterFunc(o.ctx, cancel)
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		defer stop()
+		defer cancel()
+		response, err := o.run(runCtx, op.Name, run)
+		switch {
+		case errors.Is(err, context.Canceled):
+			o.logger.InfoContext(runCtx, "operation cancelled", "name", op.Name)
+		case err != nil:
+			o.logger.ErrorContext(runCtx, "operation failed", "error", err, "name", op.Name)
+		}
+		o.update(runCtx, op.Name, func(op *domain.Operation) {
+			op.Done = true
+			op.DoneTime = time.Now().UTC()
+			op.LeaseExpireTime = time.Time{}
+			if err != nil {
+				op.Error = err
+			} else {
+				op.Response = response
+			}
+		})
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		delete(o.running, op.Name)
+		close(running.done)
+	}()
+	return op, nil
+}
+
+// Complete records an operation that is already done, with the metadata and
+// response of work that didn't need to run in the background.
+func (o *Operations) Complete(ctx context.Context, metadata, response any) (*domain.Operation, error) {
+	return o.add(ctx, &domain.Operation{
+		Metadata: metadata,
+		Done:     true,
+		DoneTime: time.Now().UTC(),
+		Response: response,
+	}, nil)
+}
+
+// FailAbandoned fails the stored operations that aren't done but no longer
+// run anywhere, and returns how many. Those are the operations of this
+// instance that it doesn't run, which an earlier process left running, and
+// the operations whose lease lapsed before now. It should be called on
+// startup, and then from time to time.
+func (o *Operations) FailAbandoned(ctx context.Context, now time.Time) (int, error) {
+	var abandoned []string
+	params := domain.ListOperationsParams{Filter: "NOT done"}
+	for {
+		ops, nextPageToken, err := o.store.ListOperations(ctx, params)
+		if err != nil {
+			return 0, err
+		}
+		for _, op := range ops {
+			abandoned = append(abandoned, op.Name)
+		}
+		if nextPageToken == "" {
+			break
+		}
+		params.PageToken = nextPageToken
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var failed int
+	for _, name := range abandoned {
+		// The operation is read again, as its owner may have renewed it since
+		op, err := o.store.GetOperation(ctx, name)
+		var customErr *domain.Error
+		if errors.As(err, &customErr) && customErr.Type == domain.NotFound {
+			continue
+		}
+		if err != nil {
+			return failed, err
+		}
+		if !o.isAbandoned(op, now) {
+			continue
+		}
+		op.Done = true
+		op.DoneTime = now.UTC()
+		op.LeaseExpireTime = time.Time{}
+		op.Error = domain.NewErrorUnavailable("operation was abandoned by the instance that ran it", nil)
+		if err := o.store.PutOperation(ctx, op); err != nil {
+			return failed, err
+		}
+		failed++
+	}
+	if failed > 0 {
+		o.logger.WarnContext(ctx, "failed abandoned operations", "count", failed)
+	}
+	return failed, nil
+}
+
+// isAbandoned reports whether an operation no longer runs anywhere. The
+// caller must hold the mutex.
+func (o *Operations) isAbandoned(op *domain.Operation, now time.Time) bool {
+	if op.Done {
+		return false
+	}
+	// Operations without an owner were stored before operations had one
+	if op.Owner == o.owner || op.Owner == "" || o.owner == "" {
+		_, running := o.running[op.Name]
+		return !running
+	}
+	return !op.LeaseExpireTime.IsZero() && op.LeaseExpireTime.Before(now)
+}
+
+// PurgeExpiredOperations removes the operations that were done longer than
+// the retention before now, and returns how many.
+func (o *Operations) PurgeExpiredOperations(ctx context.Context, now time.Time) (int, error) {
+	if o.retention <= 0 {
+		return 0, nil
+	}
+	return o.store.PurgeOperations(ctx, now.Add(-o.retention))
+}
+
+func (o *Operations) GetOperation(ctx context.Context, name string) (*domain.Operation, error) {
+	return o.store.GetOperation(ctx, name)
+}
+
+func (o *Operations) ListOperations(
+	ctx context.Context,
+	params domain.ListOperationsParams,
+) ([]*domain.Operation, string, error) {
+	return o.store.ListOperations(ctx, params)
+}
+
+func (o *Operations) CancelOperation(ctx context.Context, name string) error {
+	o.mutex.Lock()
+	running, exists := o.running[name]
+	o.mutex.Unlock()
+	if exists {
+		running.cancel()
+		return nil
+	}
+	// Cancelling an operation that is done does nothing
+	_, err := o.store.GetOperation(ctx, name)
+	return err
+}
+
+func (o *Operations) DeleteOperation(ctx context.Context, name string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.store.DeleteOperation(ctx, name)
+}
+
+func (o *Operations) WaitOperation(ctx context.Context, name string, timeout time.Duration) (*domain.Operation, error) {
+	o.mutex.Lock()
+	running, exists := o.running[name]
+	o.mutex.Unlock()
+	if exists {
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case <-running.done:
+		case <-expired:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return o.store.GetOperation(ctx, name)
+}
+
+// Close cancels the running operations and waits for them to stop.
+func (o *Operations) Close() {
+	o.cancel()
+	o.wg.Wait()
+}
+
+// add names an operation and stores it, along with running if the operation
+// isn't done yet. It returns a copy of the operation.
+func (o *Operations) add(
+	ctx context.Context,
+	op *domain.Operation,
+	running *runningOperation,
+) (*domain.Operation, error) {
+	op.Name = "operations/" + resourceid.NewSystemGeneratedBase32()
+	op.Owner = o.owner
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if err := o.store.PutOperation(ctx, op); err != nil {
+		return nil, err
+	}
+	if running != nil {
+		o.running[op.Name] = running
+	}
+	copied := *op
+	return &copied, nil
+}
+
+// leaseExpireTime returns when a lease taken now expires, or zero if leases
+// don't lapse.
+func (o *Operations) leaseExpireTime() time.Time {
+	if o.lease <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(o.lease).UTC()
+}
+
+// renewLeases renews the leases of the running operations at a third of the
+// lease, until Close.
+func (o *Operations) renewLeases() {
+	ticker := time.NewTicker(o.lease / 3) //nolint:mnd // renewed well before it lapses
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		o.mutex.Lock()
+		names := slices.Collect(maps.Keys(o.running))
+		o.mutex.Unlock()
+		for _, name := range names {
+			o.update(o.ctx, name, func(op *domain.Operation) {
+				if !op.Done {
+					op.LeaseExpireTime = o.leaseExpireTime()
+				}
+			})
+		}
+	}
+}
+
+// run waits for a slot, and then runs the work of an operation in it.
+func (o *Operations) run(ctx context.Context, name string, run OperationFunc) (any, error) {
+	select {
+	case o.slots <- struct{}{}:
+		defer func() { <-o.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return run(ctx, func(metadata any) {
+		o.update(ctx, name, func(op *domain.Operation) { op.Metadata = metadata })
+	})
+}
+
+// update changes a stored operation, unless it has been deleted.
+func (o *Operations) update(ctx context.Context, name string, change func(op *domain.Operation)) {
+	// The operation is updated even once it has been cancelled
+	ctx = context.WithoutCancel(ctx)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	op, err := o.store.GetOperation(ctx, name)
+	if err != nil {
+		var customErr *domain.Error
+		if !errors.As(err, &customErr) || customErr.Type != domain.NotFound {
+			o.logger.ErrorContext(ctx, "failed to get operation", "error", err, "name", name)
+		}
+		return
+	}
+	change(op)
+	if err := o.store.PutOperation(ctx, op); err != nil {
+		o.logger.ErrorContext(ctx, "failed to update operation", "error", err, "name", name)
+	}
+}
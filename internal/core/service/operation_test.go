@@ -0,0 +1,290 @@
+package service_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/service"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+)
+
+// blockingOperation returns the work of an operation that reports progress,
+// and then waits for release or for ctx to be cancelled. started receives a
+// value once the work runs.
+func blockingOperation(started chan<- struct{}, release <-chan struct{}) service.OperationFunc {
+	return func(ctx context.Context, progress func(any)) (any, error) {
+		progress("running")
+		started <- struct{}{}
+		select {
+		case <-release:
+			return "released", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestOperations(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, concurrency int) *service.Operations {
+		t.Helper()
+		operations := service.NewOperations(slog.Default(), db.NewMemoryOperationStore(), service.OperationsOptions{
+			Concurrency: concurrency,
+		})
+		t.Cleanup(operations.Close)
+		return operations
+	}
+
+	t.Run("runs operations and tracks their progress", func(t *testing.T) {
+		t.Parallel()
+		operations := setup(t, 1)
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		op, err := operations.Start(t.Context(), "queued", blockingOperation(started, release))
+		assert.NilError(t, err)
+		assert.Equal(t, op.Metadata, "queued")
+		assert.Assert(t, !op.Done)
+
+		<-started
+		op, err = operations.GetOperation(t.Context(), op.Name)
+		assert.NilError(t, err)
+		assert.Equal(t, op.Metadata, "running")
+		assert.Assert(t, !op.Done)
+
+		close(release)
+		op, err = operations.WaitOperation(t.Context(), op.Name, 0)
+		assert.NilError(t, err)
+		assert.Assert(t, op.Done)
+		assert.Equal(t, op.Response, "released")
+		assert.NilError(t, op.Error)
+	})
+
+	t.Run("cancels operations", func(t *testing.T) {
+		t.Parallel()
+		operations := setup(t, 1)
+		started := make(chan struct{}, 1)
+		op, err := operations.Start(t.Context(), nil, blockingOperation(started, nil))
+		assert.NilError(t, err)
+		<-started
+
+		assert.NilError(t, operations.CancelOperation(t.Context(), op.Name))
+		op, err = operations.WaitOperation(t.Context(), op.Name, 0)
+		assert.NilError(t, err)
+		assert.Assert(t, op.Done)
+		assert.ErrorIs(t, op.Error, context.Canceled)
+
+		// Cancelling an operation that is done does nothing
+		assert.NilError(t, operations.CancelOperation(t.Context(), op.Name))
+	})
+
+	t.Run("runs up to the concurrency at a time", func(t *testing.T) {
+		t.Parallel()
+		operations := setup(t, 1)
+		started, release := make(chan struct{}, 2), make(chan struct{})
+		first, err := operations.Start(t.Context(), nil, blockingOperation(started, release))
+		assert.NilError(t, err)
+		second, err := operations.Start(t.Context(), nil, blockingOperation(started, release))
+		assert.NilError(t, err)
+		<-started
+
+		// The second operation waits for the first one
+		waited, err := operations.WaitOperation(t.Context(), second.Name, 10*time.Millisecond)
+		assert.NilError(t, err)
+		assert.Assert(t, !waited.Done)
+		assert.Equal(t, len(started), 0)
+
+		close(release)
+		for _, op := range []*domain.Operation{first, second} {
+			op, err = operations.WaitOperation(t.Context(), op.Name, 0)
+			assert.NilError(t, err)
+			assert.Equal(t, op.Response, "released")
+		}
+	})
+
+	t.Run("stops running operations on close", func(t *testing.T) {
+		t.Parallel()
+		operations := service.NewOperations(slog.Default(), db.NewMemoryOperationStore(), service.OperationsOptions{
+			Concurrency: 1,
+		})
+		started := make(chan struct{}, 1)
+		op, err := operations.Start(t.Context(), nil, blockingOperation(started, nil))
+		assert.NilError(t, err)
+		<-started
+
+		operations.Close()
+		op, err = operations.GetOperation(t.Context(), op.Name)
+		assert.NilError(t, err)
+		assert.ErrorIs(t, op.Error, context.Canceled)
+	})
+
+	t.Run("lists and deletes operations", func(t *testing.T) {
+		t.Parallel()
+		operations := setup(t, 1)
+		started := make(chan struct{}, 1)
+		running, err := operations.Start(t.Context(), nil, blockingOperation(started, nil))
+		assert.NilError(t, err)
+		done, err := operations.Complete(t.Context(), nil, "done")
+		assert.NilError(t, err)
+
+		ops, _, err := operations.ListOperations(t.Context(), domain.ListOperationsParams{Filter: "done"})
+		assert.NilError(t, err)
+		assert.Equal(t, len(ops), 1)
+		assert.Equal(t, ops[0].Name, done.Name)
+
+		// Deleting an operation that runs doesn't cancel it
+		assert.NilError(t, operations.DeleteOperation(t.Context(), running.Name))
+		assert.NilError(t, operations.DeleteOperation(t.Context(), done.Name))
+		ops, _, err = operations.ListOperations(t.Context(), domain.ListOperationsParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(ops), 0)
+	})
+
+	t.Run("purges operations past their retention", func(t *testing.T) {
+		t.Parallel()
+		operations := service.NewOperations(slog.Default(), db.NewMemoryOperationStore(), service.OperationsOptions{
+			Concurrency: 1,
+			Retention:   time.Hour,
+		})
+		t.Cleanup(operations.Close)
+		started := make(chan struct{}, 1)
+		running, err := operations.Start(t.Context(), nil, blockingOperation(started, nil))
+		assert.NilError(t, err)
+		done, err := operations.Complete(t.Context(), nil, "done")
+		assert.NilError(t, err)
+
+		purged, err := operations.PurgeExpiredOperations(t.Context(), time.Now())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 0)
+		purged, err = operations.PurgeExpiredOperations(t.Context(), time.Now().Add(2*time.Hour))
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+		_, err = operations.GetOperation(t.Context(), done.Name)
+		assert.ErrorContains(t, err, "operation not found")
+		_, err = operations.GetOperation(t.Context(), running.Name)
+		assert.NilError(t, err)
+	})
+
+	t.Run("keeps operations without a retention", func(t *testing.T) {
+		t.Parallel()
+		operations := setup(t, 1)
+		_, err := operations.Complete(t.Context(), nil, "done")
+		assert.NilError(t, err)
+		purged, err := operations.PurgeExpiredOperations(t.Context(), time.Now().Add(24*time.Hour))
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 0)
+	})
+
+	t.Run("fails operations that no longer run anywhere", func(t *testing.T) {
+		t.Parallel()
+		now := time.Now()
+		store := db.NewMemoryOperationStore()
+		for _, op := range []*domain.Operation{
+			{Name: "operations/own", Owner: "instance-1", LeaseExpireTime: now.Add(time.Hour)},
+			{Name: "operations/unowned"},
+			{Name: "operations/leased", Owner: "instance-2", LeaseExpireTime: now.Add(time.Hour)},
+			{Name: "operations/lapsed", Owner: "instance-2", LeaseExpireTime: now.Add(-time.Minute)},
+			{Name: "operations/unleased", Owner: "instance-2"},
+			{Name: "operations/done", Owner: "instance-2", Done: true, Response: "done"},
+		} {
+			assert.NilError(t, store.PutOperation(t.Context(), op))
+		}
+		operations := service.NewOperations(slog.Default(), store, service.OperationsOptions{
+			Concurrency: 1,
+			Owner:       "instance-1",
+		})
+		t.Cleanup(operations.Close)
+		// Operations that run in the instance are left alone
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		t.Cleanup(func() { close(release) })
+		running, err := operations.Start(t.Context(), nil, blockingOperation(started, release))
+		assert.NilError(t, err)
+		<-started
+
+		failed, err := operations.FailAbandoned(t.Context(), now)
+		assert.NilError(t, err)
+		assert.Equal(t, failed, 3)
+		for name, wantFailed := range map[string]bool{
+			"operations/own":      true,
+			"operations/unowned":  true,
+			"operations/leased":   false,
+			"operations/lapsed":   true,
+			"operations/unleased": false,
+			"operations/done":     false,
+			running.Name:          false,
+		} {
+			op, err := operations.GetOperation(t.Context(), name)
+			assert.NilError(t, err)
+			if !wantFailed {
+				assert.NilError(t, op.Error, name)
+				continue
+			}
+			assert.Assert(t, op.Done, name)
+			assert.Assert(t, !op.DoneTime.IsZero(), name)
+			assert.Assert(t, op.LeaseExpireTime.IsZero(), name)
+			assert.ErrorContains(t, op.Error, "operation was abandoned", name)
+		}
+	})
+
+	t.Run("renews the leases of running operations", func(t *testing.T) {
+		t.Parallel()
+		store := db.NewMemoryOperationStore()
+		operations := service.NewOperations(slog.Default(), store, service.OperationsOptions{
+			Concurrency: 1,
+			Owner:       "instance-1",
+			Lease:       60 * time.Millisecond,
+		})
+		t.Cleanup(operations.Close)
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		op, err := operations.Start(t.Context(), nil, blockingOperation(started, release))
+		assert.NilError(t, err)
+		assert.Equal(t, op.Owner, "instance-1")
+		assert.Assert(t, !op.LeaseExpireTime.IsZero())
+		<-started
+
+		// The lease is renewed before it lapses, so another instance leaves it
+		leased := op.LeaseExpireTime
+		poll.WaitOn(t, func(poll.LogT) poll.Result {
+			op, err = operations.GetOperation(t.Context(), op.Name)
+			if err != nil {
+				return poll.Error(err)
+			}
+			if op.LeaseExpireTime.After(leased) {
+				return poll.Success()
+			}
+			return poll.Continue("lease not renewed")
+		}, poll.WithDelay(5*time.Millisecond))
+		time.Sleep(100 * time.Millisecond)
+		other := service.NewOperations(slog.Default(), store, service.OperationsOptions{
+			Concurrency: 1,
+			Owner:       "instance-2",
+		})
+		t.Cleanup(other.Close)
+		failed, err := other.FailAbandoned(t.Context(), time.Now())
+		assert.NilError(t, err)
+		assert.Equal(t, failed, 0)
+
+		close(release)
+		op, err = operations.WaitOperation(t.Context(), op.Name, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, op.Response, "released")
+		assert.Assert(t, op.LeaseExpireTime.IsZero())
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		operations := setup(t, 1)
+		for _, err := range []error{
+			func() error { _, err := operations.GetOperation(t.Context(), "operations/missing"); return err }(),
+			operations.CancelOperation(t.Context(), "operations/missing"),
+			operations.DeleteOperation(t.Context(), "operations/missing"),
+			func() error { _, err := operations.WaitOperation(t.Context(), "operations/missing", 0); return err }(),
+		} {
+			assert.ErrorContains(t, err, "operation not found")
+		}
+	})
+}
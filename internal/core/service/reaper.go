@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+)
+
+// UserReaper permanently purges soft-deleted users once their purge time has
+// passed, following AIP-164. Along with them, it purges the long-running
+// operations that are past their retention, and fails the abandoned ones.
+type UserReaper struct {
+	logger     *slog.Logger
+	repo       port.UserRepository
+	operations *Operations
+	interval   time.Duration
+}
+
+func NewUserReaper(
+	logger *slog.Logger,
+	repo port.UserRepository,
+	operations *Operations,
+	interval time.Duration,
+) *UserReaper {
+	return &UserReaper{
+		logger:     logger,
+		repo:       repo,
+		operations: operations,
+		interval:   interval,
+	}
+}
+
+// Run purges expired users every interval until ctx is done.
+func (r *UserReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failures are logged by Reap and retried on the next tick
+			_, _ = r.Reap(ctx)
+		}
+	}
+}
+
+// Reap fails the abandoned operations and purges the expired ones, and then
+// purges the users whose purge time has passed, and returns how many users.
+func (r *UserReaper) Reap(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	if _, err := r.operations.FailAbandoned(ctx, now); err != nil {
+		r.logger.ErrorContext(ctx, "failed to fail abandoned operations", "error", err)
+	}
+	if purged, err := r.operations.PurgeExpiredOperations(ctx, now); err != nil {
+		r.logger.ErrorContext(ctx, "failed to purge expired operations", "error", err)
+	} else if purged > 0 {
+		r.logger.InfoContext(ctx, "purged expired operations", "count", purged)
+	}
+	purged, err := r.repo.PurgeExpiredUsers(ctx, now)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "failed to purge expired users", "error", err)
+		return 0, err
+	}
+	if purged > 0 {
+		r.logger.InfoContext(ctx, "purged expired users", "count", purged)
+	}
+	return purged, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+)
+
+// UserEventRelay publishes the events in the outbox of the user repository to
+// sinks. Events are only removed from the outbox once every sink has published
+// them, and a batch that fails is published again in full, so events are
+// delivered at least once. Batches are published one at a time in the order
+// of the outbox, which keeps the events of every user in order.
+type UserEventRelay struct {
+	logger    *slog.Logger
+	outbox    port.UserEventOutbox
+	sinks     []port.UserEventSink
+	interval  time.Duration
+	batchSize int
+}
+
+func NewUserEventRelay(
+	logger *slog.Logger,
+	outbox port.UserEventOutbox,
+	interval time.Duration,
+	batchSize int,
+	sinks ...port.UserEventSink,
+) *UserEventRelay {
+	return &UserEventRelay{
+		logger:    logger,
+		outbox:    outbox,
+		sinks:     sinks,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run relays the events in the outbox every interval until ctx is done.
+func (r *UserEventRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failures are logged by Relay and retried on the next tick
+			_, _ = r.Relay(ctx)
+		}
+	}
+}
+
+// Relay publishes batches of events until the outbox is empty, and returns
+// how many events were published.
+func (r *UserEventRelay) Relay(ctx context.Context) (int, error) {
+	var relayed int
+	for {
+		events, err := r.outbox.ReadUserEvents(ctx, r.batchSize)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "failed to read user events", "error", err)
+			return relayed, err
+		}
+		if len(events) == 0 {
+			return relayed, nil
+		}
+		for _, sink := range r.sinks {
+			if err := sink.PublishUserEvents(ctx, events); err != nil {
+				r.logger.ErrorContext(ctx, "failed to publish user events", "count", len(events), "error", err)
+				return relayed, err
+			}
+		}
+		if err := r.outbox.AckUserEvents(ctx, events); err != nil {
+			r.logger.ErrorContext(ctx, "failed to acknowledge user events", "count", len(events), "error", err)
+			return relayed, err
+		}
+		relayed += len(events)
+		r.logger.DebugContext(ctx, "relayed user events", "count", len(events))
+	}
+}
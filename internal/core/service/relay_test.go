@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/service"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"gotest.tools/v3/assert"
+)
+
+// recordingSink records the IDs of the events it publishes, and fails while
+// err is set.
+type recordingSink struct {
+	ids []string
+	err error
+}
+
+func (s *recordingSink) PublishUserEvents(_ context.Context, events []domain.UserEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, event := range events {
+		s.ids = append(s.ids, event.ID)
+	}
+	return nil
+}
+
+func TestUserEventRelay(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, ids ...string) (*db.FaultyRepository, []string) {
+		t.Helper()
+		repo := db.NewFaultyRepository(slog.Default(), db.NewMemoryRepository(slog.Default()))
+		eventIDs := make([]string, 0, len(ids))
+		for _, id := range ids {
+			created, err := repo.CreateUser(t.Context(), &domain.User{
+				Name:        "users/" + id,
+				DisplayName: "User " + id,
+				Email:       id + "@example.com",
+			})
+			assert.NilError(t, err)
+			eventIDs = append(eventIDs, created.Name+"@"+created.RevisionID)
+		}
+		return repo, eventIDs
+	}
+
+	t.Run("publishes all events in order", func(t *testing.T) {
+		t.Parallel()
+		repo, want := setup(t, "a", "b", "c")
+		first, second := &recordingSink{}, &recordingSink{}
+		relay := service.NewUserEventRelay(slog.Default(), repo, 0, 2, first, second)
+
+		relayed, err := relay.Relay(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, relayed, 3)
+		assert.DeepEqual(t, first.ids, want)
+		assert.DeepEqual(t, second.ids, want)
+		events, err := repo.ReadUserEvents(t.Context(), 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(events), 0)
+	})
+
+	t.Run("keeps events that a sink failed to publish", func(t *testing.T) {
+		t.Parallel()
+		repo, want := setup(t, "a", "b")
+		ok, failing := &recordingSink{}, &recordingSink{err: errors.New("sink down")}
+		relay := service.NewUserEventRelay(slog.Default(), repo, 0, 10, ok, failing)
+
+		_, err := relay.Relay(t.Context())
+		assert.ErrorContains(t, err, "sink down")
+		failing.err = nil
+		relayed, err := relay.Relay(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, relayed, 2)
+		assert.DeepEqual(t, failing.ids, want)
+		// The sink that succeeded gets the events again
+		assert.DeepEqual(t, ok.ids, append(want, want...))
+	})
+
+	t.Run("publishes again when acknowledging fails", func(t *testing.T) {
+		t.Parallel()
+		repo, want := setup(t, "a")
+		assert.NilError(t, repo.SetFaults(db.FaultConfig{Rules: []db.FaultRule{{
+			Methods: []string{db.MethodAckUserEvents},
+			Script:  []bool{true},
+			Error:   "unavailable",
+		}}}))
+		sink := &recordingSink{}
+		relay := service.NewUserEventRelay(slog.Default(), repo, 0, 10, sink)
+
+		_, err := relay.Relay(t.Context())
+		assertErrorType(t, err, domain.Unavailable)
+		relayed, err := relay.Relay(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, relayed, 1)
+		assert.DeepEqual(t, sink.ids, append(want, want...))
+	})
+}
+
+func assertErrorType(t *testing.T, err error, want domain.ErrorType) {
+	t.Helper()
+	var domainErr *domain.Error
+	assert.Assert(t, errors.As(err, &domainErr), "expected a domain error, got %v", err)
+	assert.Equal(t, domainErr.Type, want)
+}
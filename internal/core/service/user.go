@@ -2,21 +2,50 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
 	"github.com/fredrikaverpil/go-microservice/internal/core/port"
 )
 
+// watchPageSize is how many users a watch reads at a time, both for its
+// snapshot and from the feed.
+const watchPageSize = 100
+
+// purgePageSize is how many users a purge lists and removes at a time.
+const purgePageSize = 100
+
+// purgeSampleSize is how many names a purge preview returns at most.
+const purgeSampleSize = 100
+
 type UserService struct {
-	logger *slog.Logger
-	repo   port.UserRepository
+	logger     *slog.Logger
+	repo       port.UserRepository
+	feed       port.UserEventFeed
+	operations *Operations
+	retention  time.Duration
 }
 
-func NewUserService(logger *slog.Logger, repo port.UserRepository) port.UserService {
+// NewUserService returns a UserService that keeps soft-deleted users for the
+// given retention period before they may be purged. Watches follow the
+// changes to users in feed, and purges run as operations.
+func NewUserService(
+	logger *slog.Logger,
+	repo port.UserRepository,
+	feed port.UserEventFeed,
+	operations *Operations,
+	retention time.Duration,
+) port.UserService {
 	return &UserService{
-		logger: logger,
-		repo:   repo,
+		logger:     logger,
+		repo:       repo,
+		feed:       feed,
+		operations: operations,
+		retention:  retention,
 	}
 }
 
@@ -32,54 +61,465 @@ func (s *UserService) CreateUser(ctx context.Context, user *domain.User) (*domai
 	return createdUser, nil
 }
 
-func (s *UserService) GetUser(ctx context.Context, name string) (*domain.User, error) {
-	user, err := s.repo.GetUser(ctx, name)
+func (s *UserService) BatchCreateUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.BatchCreateUsersParams,
+) ([]*domain.User, []error, error) {
+	created, errs, err := s.repo.BatchCreateUsers(ctx, users, params)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to batch create users",
+			"error", err,
+			"count", len(users),
+			"atomic", params.Atomic,
+		)
+		return nil, nil, err // Propagate the custom error
+	}
+	return created, errs, nil
+}
+
+func (s *UserService) ImportUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.ImportUsersParams,
+) ([]error, error) {
+	if !params.ValidateOnly {
+		_, errs, err := s.BatchCreateUsers(ctx, users, domain.BatchCreateUsersParams{})
+		return errs, err
+	}
+	errs := make([]error, len(users))
+	for i, user := range users {
+		var err error
+		if errs[i], err = s.checkCreate(ctx, user); err != nil {
+			s.logger.ErrorContext(ctx, "failed to validate imported users",
+				"error", err,
+				"count", len(users),
+			)
+			return nil, err // Propagate the custom error
+		}
+	}
+	return errs, nil
+}
+
+// checkCreate returns the error that creating user would fail with, because
+// its name or email is taken. It returns err if the check itself fails.
+func (s *UserService) checkCreate(ctx context.Context, user *domain.User) (createErr, err error) {
+	_, err = s.repo.GetUser(ctx, user.Name, domain.GetUserParams{ShowDeleted: true})
+	if err == nil {
+		return domain.NewErrorAlreadyExists(fmt.Sprintf("user already exists: %s", user.Name), nil), nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+	_, err = s.repo.LookupUserByEmail(ctx, user.Email)
+	if err == nil {
+		return domain.NewErrorFieldAlreadyExists("email", "email is already in use", nil), nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// isNotFound reports whether err is a NotFound error.
+func isNotFound(err error) bool {
+	var customErr *domain.Error
+	return errors.As(err, &customErr) && customErr.Type == domain.NotFound
+}
+
+func (s *UserService) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	var (
+		user *domain.User
+		err  error
+	)
+	if params.RevisionID != "" {
+		user, err = s.repo.GetUserRevision(ctx, name, params.RevisionID)
+	} else {
+		var reader port.UserSnapshot
+		if reader, err = s.reader(ctx, params.ReadTime); err == nil {
+			user, err = reader.GetUser(ctx, name, params)
+		}
+	}
 	if err != nil {
 		s.logger.ErrorContext(ctx, "failed to get user",
 			"error", err,
 			"name", name,
+			"showDeleted", params.ShowDeleted,
+			"readTime", params.ReadTime,
+			"revisionID", params.RevisionID,
 		)
 		return nil, err // Propagate the custom error
 	}
 	return user, nil
 }
 
+func (s *UserService) BatchGetUsers(
+	ctx context.Context,
+	names []string,
+	params domain.BatchGetUsersParams,
+) ([]*domain.User, error) {
+	// All users are read at once, so they are as of the same point in time
+	stored, err := s.repo.BatchGetUsers(ctx, names)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to batch get users",
+			"error", err,
+			"count", len(names),
+			"skipMissing", params.SkipMissing,
+		)
+		return nil, err // Propagate the custom error
+	}
+	users := make([]*domain.User, 0, len(names))
+	for _, name := range names {
+		user, ok := stored[name]
+		if !ok {
+			if params.SkipMissing {
+				continue
+			}
+			// Tell which of the users is missing
+			return nil, domain.NewErrorNotFound(name+" not found", nil)
+		}
+		// Names may repeat, and every user returned is a copy of its own
+		users = append(users, user.Copy())
+	}
+	return users, nil
+}
+
 func (s *UserService) ListUsers(
 	ctx context.Context,
-	pageSize int32,
-	pageToken string,
+	params domain.ListUsersParams,
 ) ([]*domain.User, string, error) {
-	users, nextToken, err := s.repo.ListUsers(ctx, pageSize, pageToken)
+	reader, err := s.reader(ctx, params.ReadTime)
+	var (
+		users     []*domain.User
+		nextToken string
+	)
+	if err == nil {
+		users, nextToken, err = reader.ListUsers(ctx, params)
+	}
 	if err != nil {
 		s.logger.ErrorContext(ctx, "failed to list users",
 			"error", err,
-			"pageSize", pageSize,
-			"pageToken", pageToken,
+			"pageSize", params.PageSize,
+			"pageToken", params.PageToken,
+			"filter", params.Filter,
+			"orderBy", params.OrderBy,
+			"showDeleted", params.ShowDeleted,
+			"readTime", params.ReadTime,
 		)
 		return nil, "", err // Propagate the custom error
 	}
 	return users, nextToken, nil
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
-	updatedUser, err := s.repo.UpdateUser(ctx, user)
+// reader returns what users are read from: the repository, or a snapshot of
+// it if a read time is set.
+func (s *UserService) reader(ctx context.Context, readTime time.Time) (port.UserSnapshot, error) {
+	if readTime.IsZero() {
+		return s.repo, nil
+	}
+	return s.repo.SnapshotUsers(ctx, readTime)
+}
+
+func (s *UserService) UpdateUser(
+	ctx context.Context,
+	user *domain.User,
+	params domain.UpdateUserParams,
+) (*domain.User, bool, error) {
+	updatedUser, created, err := s.repo.UpdateUser(ctx, user, params)
 	if err != nil {
 		s.logger.ErrorContext(ctx, "failed to update user",
 			"error", err,
 			"user", user.Name,
+			"updateMask", params.UpdateMask,
+			"allowMissing", params.AllowMissing,
+			"etag", params.Etag,
+		)
+		return nil, false, err // Propagate the custom error
+	}
+	return updatedUser, created, nil
+}
+
+func (s *UserService) BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error) {
+	updated, err := s.repo.BatchUpdateUsers(ctx, updates)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to batch update users",
+			"error", err,
+			"count", len(updates),
 		)
 		return nil, err // Propagate the custom error
 	}
-	return updatedUser, nil
+	return updated, nil
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, name string) error {
-	if err := s.repo.DeleteUser(ctx, name); err != nil {
+func (s *UserService) DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error {
+	// The retention period is a service policy, not something callers choose
+	params.Retention = s.retention
+	if err := s.repo.DeleteUser(ctx, name, params); err != nil {
 		s.logger.ErrorContext(ctx, "failed to delete user",
 			"error", err,
 			"name", name,
+			"etag", params.Etag,
 		)
 		return err // Propagate the custom error
 	}
 	return nil
 }
+
+func (s *UserService) BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error {
+	// The retention period is a service policy, not something callers choose
+	deletions = slices.Clone(deletions)
+	for i := range deletions {
+		deletions[i].Params.Retention = s.retention
+	}
+	if err := s.repo.BatchDeleteUsers(ctx, deletions); err != nil {
+		s.logger.ErrorContext(ctx, "failed to batch delete users",
+			"error", err,
+			"count", len(deletions),
+		)
+		return err // Propagate the custom error
+	}
+	return nil
+}
+
+func (s *UserService) UndeleteUser(ctx context.Context, name string) (*domain.User, error) {
+	user, err := s.repo.UndeleteUser(ctx, name)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to undelete user",
+			"error", err,
+			"name", name,
+		)
+		return nil, err // Propagate the custom error
+	}
+	return user, nil
+}
+
+// PurgeUsers counts the soft-deleted users that match the filter, and
+// returns an operation that is done at once unless params.Force is set.
+// Otherwise the operation purges the users in the background.
+func (s *UserService) PurgeUsers(ctx context.Context, params domain.PurgeUsersParams) (*domain.Operation, error) {
+	op, err := s.purgeUsers(ctx, params)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to purge users",
+			"error", err,
+			"filter", params.Filter,
+			"force", params.Force,
+		)
+		return nil, err // Propagate the custom error
+	}
+	return op, nil
+}
+
+func (s *UserService) purgeUsers(ctx context.Context, params domain.PurgeUsersParams) (*domain.Operation, error) {
+	if !params.Force {
+		// The preview keeps only a sample of the names, however many match
+		var result domain.PurgeUsersResult
+		err := s.listDeletedUsers(ctx, params.Filter, func(names []string) error {
+			result.PurgeCount += len(names)
+			sampled := min(len(names), purgeSampleSize-len(result.PurgeSample))
+			result.PurgeSample = append(result.PurgeSample, names[:sampled]...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s.operations.Complete(ctx, domain.PurgeUsersMetadata{PurgeCount: result.PurgeCount}, result)
+	}
+
+	// Check the filter before starting, so that an invalid one fails the call
+	_, _, err := s.repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 1, Filter: params.Filter, ShowDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	return s.operations.Start(ctx, domain.PurgeUsersMetadata{}, func(ctx context.Context, progress func(any)) (any, error) {
+		// Count the users first, so that the progress has a total
+		var metadata domain.PurgeUsersMetadata
+		err := s.listDeletedUsers(ctx, params.Filter, func(names []string) error {
+			metadata.PurgeCount += len(names)
+			return ctx.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+		progress(metadata)
+		err = s.listDeletedUsers(ctx, params.Filter, func(names []string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			purged, err := s.repo.PurgeUsers(ctx, names)
+			metadata.PurgedCount += purged
+			progress(metadata)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.logger.InfoContext(ctx, "purged users", "count", metadata.PurgedCount, "filter", params.Filter)
+		return domain.PurgeUsersResult{PurgeCount: metadata.PurgedCount}, nil
+	})
+}
+
+// listDeletedUsers lists the soft-deleted users that match the filter a page
+// at a time, and calls page with the names of each page that has any. The
+// pages continue after the users of the last one, even once they are purged.
+func (s *UserService) listDeletedUsers(ctx context.Context, filter string, page func(names []string) error) error {
+	params := domain.ListUsersParams{PageSize: purgePageSize, Filter: filter, ShowDeleted: true}
+	for {
+		users, nextToken, err := s.repo.ListUsers(ctx, params)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(users))
+		for _, user := range users {
+			if !user.DeleteTime.IsZero() {
+				names = append(names, user.Name)
+			}
+		}
+		if len(names) > 0 {
+			if err := page(names); err != nil {
+				return err
+			}
+		}
+		if nextToken == "" {
+			return nil
+		}
+		params.PageToken = nextToken
+	}
+}
+
+func (s *UserService) LookupUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := s.repo.LookupUserByEmail(ctx, email)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to look up user by email",
+			"error", err,
+		)
+		return nil, err // Propagate the custom error
+	}
+	return user, nil
+}
+
+func (s *UserService) ListUserRevisions(
+	ctx context.Context,
+	name string,
+	params domain.ListUserRevisionsParams,
+) ([]*domain.User, string, error) {
+	revisions, nextToken, err := s.repo.ListUserRevisions(ctx, name, params)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list user revisions",
+			"error", err,
+			"name", name,
+			"pageSize", params.PageSize,
+			"pageToken", params.PageToken,
+		)
+		return nil, "", err // Propagate the custom error
+	}
+	return revisions, nextToken, nil
+}
+
+func (s *UserService) RollbackUser(
+	ctx context.Context,
+	name string,
+	params domain.RollbackUserParams,
+) (*domain.User, error) {
+	user, err := s.repo.RollbackUser(ctx, name, params)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to roll back user",
+			"error", err,
+			"name", name,
+			"revisionID", params.RevisionID,
+			"etag", params.Etag,
+		)
+		return nil, err // Propagate the custom error
+	}
+	return user, nil
+}
+
+func (s *UserService) WatchUsers(
+	ctx context.Context,
+	params domain.WatchUsersParams,
+	send func(domain.UserChange) error,
+) error {
+	err := s.watchUsers(ctx, params, send)
+	// Watches end when the client goes away, which isn't worth logging
+	if err != nil && ctx.Err() == nil {
+		s.logger.ErrorContext(ctx, "failed to watch users",
+			"error", err,
+			"resumeToken", params.ResumeToken,
+		)
+	}
+	return err
+}
+
+func (s *UserService) watchUsers(
+	ctx context.Context,
+	params domain.WatchUsersParams,
+	send func(domain.UserChange) error,
+) error {
+	token := params.ResumeToken
+	var snapshot map[string]*domain.User
+	if token == "" {
+		// Changes made while the snapshot is read are sent after it
+		token = s.feed.UserEventsToken()
+		var err error
+		if snapshot, err = s.sendSnapshot(ctx, send); err != nil {
+			return err
+		}
+		if err := send(domain.UserChange{Type: domain.UserSnapshotComplete, ResumeToken: token}); err != nil {
+			return err
+		}
+	}
+	for {
+		changes, err := s.feed.WaitUserChanges(ctx, token, watchPageSize)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			token = change.ResumeToken
+			if isInSnapshot(snapshot, change.User) {
+				continue
+			}
+			if err := send(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSnapshot sends the users that aren't deleted, and returns them by name.
+func (s *UserService) sendSnapshot(
+	ctx context.Context,
+	send func(domain.UserChange) error,
+) (map[string]*domain.User, error) {
+	snapshot := make(map[string]*domain.User)
+	params := domain.ListUsersParams{PageSize: watchPageSize}
+	for {
+		users, nextToken, err := s.repo.ListUsers(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			snapshot[user.Name] = user
+			if err := send(domain.UserChange{Type: domain.UserExisting, User: user}); err != nil {
+				return nil, err
+			}
+		}
+		if nextToken == "" {
+			return snapshot, nil
+		}
+		params.PageToken = nextToken
+	}
+}
+
+// isInSnapshot reports whether a changed user is already reflected in the
+// snapshot that a watch sent, because the change was published after the
+// snapshot was read.
+func isInSnapshot(snapshot map[string]*domain.User, user *domain.User) bool {
+	sent, ok := snapshot[user.Name]
+	if !ok {
+		return false
+	}
+	return user.RevisionID == sent.RevisionID || user.RevisionCreateTime.Before(sent.RevisionCreateTime)
+}
@@ -0,0 +1,433 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/core/service"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
+	"gotest.tools/v3/assert"
+)
+
+// newUserService returns a service over repo that keeps deleted users for an
+// hour.
+func newUserService(repo port.UserRepository, feed port.UserEventFeed) port.UserService {
+	operations := service.NewOperations(slog.Default(), db.NewMemoryOperationStore(), service.OperationsOptions{
+		Concurrency: 1,
+	})
+	return service.NewUserService(slog.Default(), repo, feed, operations, time.Hour)
+}
+
+// watch runs a watch until the test ends, and returns its changes.
+func watch(t *testing.T, svc port.UserService, resumeToken string) (<-chan domain.UserChange, <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+	changes := make(chan domain.UserChange, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.WatchUsers(ctx, domain.WatchUsersParams{ResumeToken: resumeToken}, func(change domain.UserChange) error {
+			changes <- change
+			return nil
+		})
+	}()
+	return changes, done
+}
+
+// next returns the type and user name of the next change.
+func next(t *testing.T, changes <-chan domain.UserChange) (domain.UserChangeType, string, string) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		var name string
+		if change.User != nil {
+			name = change.User.Name
+		}
+		return change.Type, name, change.ResumeToken
+	case <-time.After(time.Second):
+		t.Fatal("no change")
+		return "", "", ""
+	}
+}
+
+func TestUserService_WatchUsers(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, ids ...string) (port.UserRepository, *service.UserEventRelay, *event.Feed) {
+		t.Helper()
+		repo := db.NewMemoryRepository(slog.Default())
+		for _, id := range ids {
+			_, err := repo.CreateUser(t.Context(), &domain.User{
+				Name:        "users/" + id,
+				DisplayName: "User " + id,
+				Email:       id + "@example.com",
+			})
+			assert.NilError(t, err)
+		}
+		feed := event.NewFeed(10)
+		relay := service.NewUserEventRelay(slog.Default(), repo, time.Second, 10, feed)
+		return repo, relay, feed
+	}
+
+	t.Run("sends a snapshot and then changes", func(t *testing.T) {
+		t.Parallel()
+		repo, relay, feed := setup(t, "a", "b")
+		svc := newUserService(repo, feed)
+		changes, _ := watch(t, svc, "")
+
+		changeType, name, token := next(t, changes)
+		assert.Equal(t, changeType, domain.UserExisting)
+		assert.Equal(t, name, "users/a")
+		assert.Equal(t, token, "")
+		changeType, name, _ = next(t, changes)
+		assert.Equal(t, changeType, domain.UserExisting)
+		assert.Equal(t, name, "users/b")
+		changeType, _, token = next(t, changes)
+		assert.Equal(t, changeType, domain.UserSnapshotComplete)
+		assert.Assert(t, token != "")
+
+		// The events of creating the users are published after the snapshot,
+		// and skipped
+		assert.NilError(t, svc.DeleteUser(t.Context(), "users/a", domain.DeleteUserParams{}))
+		_, err := relay.Relay(t.Context())
+		assert.NilError(t, err)
+		changeType, name, _ = next(t, changes)
+		assert.Equal(t, changeType, domain.UserChangeDeleted)
+		assert.Equal(t, name, "users/a")
+	})
+
+	t.Run("resumes after a token", func(t *testing.T) {
+		t.Parallel()
+		repo, relay, feed := setup(t)
+		svc := newUserService(repo, feed)
+		changes, _ := watch(t, svc, "")
+		changeType, _, token := next(t, changes)
+		assert.Equal(t, changeType, domain.UserSnapshotComplete)
+
+		for _, id := range []string{"a", "b"} {
+			_, err := svc.CreateUser(t.Context(), &domain.User{
+				Name:        "users/" + id,
+				DisplayName: "User " + id,
+				Email:       id + "@example.com",
+			})
+			assert.NilError(t, err)
+		}
+		_, err := relay.Relay(t.Context())
+		assert.NilError(t, err)
+		changeType, name, first := next(t, changes)
+		assert.Equal(t, changeType, domain.UserChangeCreated)
+		assert.Equal(t, name, "users/a")
+		_, _, second := next(t, changes)
+		assert.Assert(t, first != token && second != first)
+
+		resumed, _ := watch(t, svc, first)
+		changeType, name, token = next(t, resumed)
+		assert.Equal(t, changeType, domain.UserChangeCreated)
+		assert.Equal(t, name, "users/b")
+		assert.Equal(t, token, second)
+	})
+
+	t.Run("fails with expired tokens", func(t *testing.T) {
+		t.Parallel()
+		repo, _, feed := setup(t)
+		svc := newUserService(repo, feed)
+		time.Sleep(time.Microsecond)
+		_, done := watch(t, svc, event.NewFeed(10).UserEventsToken())
+		err := <-done
+		var customErr *domain.Error
+		assert.Assert(t, errors.As(err, &customErr), "got %v", err)
+		assert.Equal(t, customErr.Type, domain.FailedPrecondition)
+	})
+}
+
+func TestUserService_BatchGetUsers(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, ids ...string) port.UserService {
+		t.Helper()
+		repo := db.NewMemoryRepository(slog.Default())
+		for _, id := range ids {
+			_, err := repo.CreateUser(t.Context(), &domain.User{
+				Name:        "users/" + id,
+				DisplayName: "User " + id,
+				Email:       id + "@example.com",
+			})
+			assert.NilError(t, err)
+		}
+		return newUserService(repo, event.NewFeed(10))
+	}
+
+	names := func(users []*domain.User) []string {
+		names := make([]string, len(users))
+		for i, user := range users {
+			names[i] = user.Name
+		}
+		return names
+	}
+
+	t.Run("returns users in the order of the names", func(t *testing.T) {
+		t.Parallel()
+		svc := setup(t, "a", "b", "c")
+		users, err := svc.BatchGetUsers(t.Context(), []string{"users/c", "users/a", "users/c"}, domain.BatchGetUsersParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/c", "users/a", "users/c"})
+	})
+
+	t.Run("fails if a user is missing", func(t *testing.T) {
+		t.Parallel()
+		svc := setup(t, "a")
+		assert.NilError(t, svc.DeleteUser(t.Context(), "users/a", domain.DeleteUserParams{}))
+		_, err := svc.BatchGetUsers(t.Context(), []string{"users/a"}, domain.BatchGetUsersParams{})
+		var customErr *domain.Error
+		assert.Assert(t, errors.As(err, &customErr), "got %v", err)
+		assert.Equal(t, customErr.Type, domain.NotFound)
+		assert.Equal(t, customErr.Message, "users/a not found")
+	})
+
+	t.Run("skips missing users if asked to", func(t *testing.T) {
+		t.Parallel()
+		svc := setup(t, "a", "c")
+		users, err := svc.BatchGetUsers(t.Context(), []string{"users/a", "users/b", "users/c"}, domain.BatchGetUsersParams{
+			SkipMissing: true,
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/a", "users/c"})
+	})
+}
+
+func TestUserService_BatchDeleteUsers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("applies the retention of the service", func(t *testing.T) {
+		t.Parallel()
+		repo := db.NewMemoryRepository(slog.Default())
+		svc := newUserService(repo, event.NewFeed(10))
+		for _, id := range []string{"a", "b"} {
+			_, err := svc.CreateUser(t.Context(), &domain.User{
+				Name:        "users/" + id,
+				DisplayName: "User " + id,
+				Email:       id + "@example.com",
+			})
+			assert.NilError(t, err)
+		}
+		deletions := []domain.UserDeletion{
+			{Name: "users/a", Params: domain.DeleteUserParams{Retention: time.Minute}},
+			{Name: "users/b"},
+		}
+		assert.NilError(t, svc.BatchDeleteUsers(t.Context(), deletions))
+		for _, deletion := range deletions {
+			deleted, err := repo.GetUser(t.Context(), deletion.Name, domain.GetUserParams{ShowDeleted: true})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, deleted.PurgeTime, deleted.DeleteTime.Add(time.Hour))
+		}
+	})
+}
+
+func TestUserService_ImportUsers(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (port.UserRepository, port.UserService) {
+		t.Helper()
+		repo := db.NewMemoryRepository(slog.Default())
+		svc := newUserService(repo, event.NewFeed(10))
+		_, err := svc.CreateUser(t.Context(), &domain.User{Name: "users/a", DisplayName: "User a", Email: "a@example.com"})
+		assert.NilError(t, err)
+		assert.NilError(t, svc.DeleteUser(t.Context(), "users/a", domain.DeleteUserParams{}))
+		_, err = svc.CreateUser(t.Context(), &domain.User{Name: "users/b", DisplayName: "User b", Email: "b@example.com"})
+		assert.NilError(t, err)
+		return repo, svc
+	}
+	users := []*domain.User{
+		{Name: "users/c", DisplayName: "User c", Email: "c@example.com"},
+		{Name: "users/a", DisplayName: "User a", Email: "other@example.com"},
+		{Name: "users/d", DisplayName: "User d", Email: "b@example.com"},
+	}
+
+	assertErrors := func(t *testing.T, errs []error) {
+		t.Helper()
+		assert.Equal(t, len(errs), len(users))
+		assert.NilError(t, errs[0])
+		var customErr *domain.Error
+		assert.Assert(t, errors.As(errs[1], &customErr), "got %v", errs[1])
+		assert.Equal(t, customErr.Type, domain.AlreadyExists)
+		assert.Assert(t, errors.As(errs[2], &customErr), "got %v", errs[2])
+		assert.Equal(t, customErr.Type, domain.AlreadyExists)
+		assert.Equal(t, customErr.Field, "email")
+	}
+
+	t.Run("creates the users that can be created", func(t *testing.T) {
+		t.Parallel()
+		repo, svc := setup(t)
+		errs, err := svc.ImportUsers(t.Context(), users, domain.ImportUsersParams{})
+		assert.NilError(t, err)
+		assertErrors(t, errs)
+		_, err = repo.GetUser(t.Context(), "users/c", domain.GetUserParams{})
+		assert.NilError(t, err)
+	})
+
+	t.Run("validates the users without creating them", func(t *testing.T) {
+		t.Parallel()
+		repo, svc := setup(t)
+		errs, err := svc.ImportUsers(t.Context(), users, domain.ImportUsersParams{ValidateOnly: true})
+		assert.NilError(t, err)
+		assertErrors(t, errs)
+		_, err = repo.GetUser(t.Context(), "users/c", domain.GetUserParams{})
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestUserService_PurgeUsers(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (port.UserRepository, *service.Operations, port.UserService) {
+		t.Helper()
+		repo := db.NewMemoryRepository(slog.Default())
+		operations := service.NewOperations(slog.Default(), db.NewMemoryOperationStore(), service.OperationsOptions{
+			Concurrency: 1,
+		})
+		t.Cleanup(operations.Close)
+		svc := service.NewUserService(slog.Default(), repo, event.NewFeed(10), operations, time.Hour)
+		for _, user := range []*domain.User{
+			{Name: "users/a", DisplayName: "User a", Email: "a@example.com"},
+			{Name: "users/b", DisplayName: "User b", Email: "b@example.com"},
+			{Name: "users/c", DisplayName: "User c", Email: "c@example.com"},
+			{Name: "users/d", DisplayName: "User d", Email: "d@example.org"},
+		} {
+			_, err := svc.CreateUser(t.Context(), user)
+			assert.NilError(t, err)
+		}
+		for _, name := range []string{"users/a", "users/b", "users/d"} {
+			assert.NilError(t, svc.DeleteUser(t.Context(), name, domain.DeleteUserParams{}))
+		}
+		return repo, operations, svc
+	}
+	filter := `email = "*@example.com"`
+
+	t.Run("previews the deleted users that match", func(t *testing.T) {
+		t.Parallel()
+		repo, _, svc := setup(t)
+		op, err := svc.PurgeUsers(t.Context(), domain.PurgeUsersParams{Filter: filter})
+		assert.NilError(t, err)
+		assert.Assert(t, op.Done)
+		assert.DeepEqual(t, op.Response, domain.PurgeUsersResult{
+			PurgeCount:  2,
+			PurgeSample: []string{"users/a", "users/b"},
+		})
+		_, err = repo.GetUser(t.Context(), "users/a", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+	})
+
+	t.Run("purges the deleted users that match in an operation", func(t *testing.T) {
+		t.Parallel()
+		repo, operations, svc := setup(t)
+		op, err := svc.PurgeUsers(t.Context(), domain.PurgeUsersParams{Filter: filter, Force: true})
+		assert.NilError(t, err)
+		assert.Assert(t, strings.HasPrefix(op.Name, "operations/"))
+		op, err = operations.WaitOperation(t.Context(), op.Name, 0)
+		assert.NilError(t, err)
+		assert.Assert(t, op.Done)
+		assert.NilError(t, op.Error)
+		assert.DeepEqual(t, op.Metadata, domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 2})
+		assert.DeepEqual(t, op.Response, domain.PurgeUsersResult{PurgeCount: 2})
+		for _, name := range []string{"users/a", "users/b"} {
+			_, err = repo.GetUser(t.Context(), name, domain.GetUserParams{ShowDeleted: true})
+			assert.ErrorContains(t, err, "not found")
+		}
+		// Users that are active or don't match are kept
+		_, err = repo.GetUser(t.Context(), "users/c", domain.GetUserParams{})
+		assert.NilError(t, err)
+		_, err = repo.GetUser(t.Context(), "users/d", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+	})
+
+	t.Run("purges many users a page at a time", func(t *testing.T) {
+		t.Parallel()
+		repo := db.NewMemoryRepository(slog.Default())
+		store := &progressStore{MemoryOperationStore: db.NewMemoryOperationStore()}
+		operations := service.NewOperations(slog.Default(), store, service.OperationsOptions{Concurrency: 1})
+		t.Cleanup(operations.Close)
+		svc := service.NewUserService(slog.Default(), repo, event.NewFeed(10), operations, time.Hour)
+		const count = 250
+		for i := range count {
+			name := fmt.Sprintf("users/user-%03d", i)
+			_, err := svc.CreateUser(t.Context(), &domain.User{
+				Name:        name,
+				DisplayName: "User",
+				Email:       fmt.Sprintf("user-%03d@example.com", i),
+			})
+			assert.NilError(t, err)
+			assert.NilError(t, svc.DeleteUser(t.Context(), name, domain.DeleteUserParams{}))
+		}
+
+		// The preview counts them all, but lists only a sample
+		op, err := svc.PurgeUsers(t.Context(), domain.PurgeUsersParams{Filter: filter})
+		assert.NilError(t, err)
+		result, ok := op.Response.(domain.PurgeUsersResult)
+		assert.Assert(t, ok)
+		assert.Equal(t, result.PurgeCount, count)
+		assert.Equal(t, len(result.PurgeSample), 100)
+		assert.Equal(t, result.PurgeSample[99], "users/user-099")
+
+		op, err = svc.PurgeUsers(t.Context(), domain.PurgeUsersParams{Filter: filter, Force: true})
+		assert.NilError(t, err)
+		op, err = operations.WaitOperation(t.Context(), op.Name, 0)
+		assert.NilError(t, err)
+		assert.NilError(t, op.Error)
+		assert.DeepEqual(t, op.Response, domain.PurgeUsersResult{PurgeCount: count})
+		assert.DeepEqual(t, store.progress(op.Name), []domain.PurgeUsersMetadata{
+			{},
+			{PurgeCount: count},
+			{PurgeCount: count, PurgedCount: 100},
+			{PurgeCount: count, PurgedCount: 200},
+			{PurgeCount: count, PurgedCount: count},
+		})
+		users, _, err := repo.ListUsers(t.Context(), domain.ListUsersParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 0)
+	})
+
+	t.Run("failure - invalid filter", func(t *testing.T) {
+		t.Parallel()
+		_, _, svc := setup(t)
+		_, err := svc.PurgeUsers(t.Context(), domain.PurgeUsersParams{Filter: "password = 1", Force: true})
+		var customErr *domain.Error
+		assert.Assert(t, errors.As(err, &customErr))
+		assert.Equal(t, customErr.Type, domain.InvalidInput)
+	})
+}
+
+// progressStore is an operation store that records the metadata of every
+// operation that is put.
+type progressStore struct {
+	*db.MemoryOperationStore
+	mutex    sync.Mutex
+	metadata map[string][]domain.PurgeUsersMetadata
+}
+
+func (s *progressStore) PutOperation(ctx context.Context, op *domain.Operation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if metadata, ok := op.Metadata.(domain.PurgeUsersMetadata); ok && !op.Done {
+		if s.metadata == nil {
+			s.metadata = make(map[string][]domain.PurgeUsersMetadata)
+		}
+		s.metadata[op.Name] = append(s.metadata[op.Name], metadata)
+	}
+	return s.MemoryOperationStore.PutOperation(ctx, op)
+}
+
+// progress returns the metadata that the operation had before it was done.
+func (s *progressStore) progress(name string) []domain.PurgeUsersMetadata {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.metadata[name]
+}
@@ -8,7 +8,9 @@ package gomicroservicev1
 
 import (
 	_ "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	longrunningpb "cloud.google.com/go/longrunning/autogen/longrunningpb"
 	_ "google.golang.org/genproto/googleapis/api/annotations"
+	status "google.golang.org/genproto/googleapis/rpc/status"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
@@ -26,6 +28,125 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// The formats of imported data.
+type ImportUsersRequest_Format int32
+
+const (
+	// The format is not specified.
+	ImportUsersRequest_FORMAT_UNSPECIFIED ImportUsersRequest_Format = 0
+	// Comma-separated values. The first row names the columns, out of name,
+	// display_name and email. The name column is optional.
+	ImportUsersRequest_CSV ImportUsersRequest_Format = 1
+	// Newline-delimited JSON, with a user on every line.
+	ImportUsersRequest_NDJSON ImportUsersRequest_Format = 2
+)
+
+// Enum value maps for ImportUsersRequest_Format.
+var (
+	ImportUsersRequest_Format_name = map[int32]string{
+		0: "FORMAT_UNSPECIFIED",
+		1: "CSV",
+		2: "NDJSON",
+	}
+	ImportUsersRequest_Format_value = map[string]int32{
+		"FORMAT_UNSPECIFIED": 0,
+		"CSV":                1,
+		"NDJSON":             2,
+	}
+)
+
+func (x ImportUsersRequest_Format) Enum() *ImportUsersRequest_Format {
+	p := new(ImportUsersRequest_Format)
+	*p = x
+	return p
+}
+
+func (x ImportUsersRequest_Format) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ImportUsersRequest_Format) Descriptor() protoreflect.EnumDescriptor {
+	return file_gomicroservice_v1_user_service_proto_enumTypes[0].Descriptor()
+}
+
+func (ImportUsersRequest_Format) Type() protoreflect.EnumType {
+	return &file_gomicroservice_v1_user_service_proto_enumTypes[0]
+}
+
+func (x ImportUsersRequest_Format) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ImportUsersRequest_Format.Descriptor instead.
+func (ImportUsersRequest_Format) EnumDescriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{14, 0}
+}
+
+// The kind of a response.
+type WatchUsersResponse_ChangeType int32
+
+const (
+	// The change type is not specified.
+	WatchUsersResponse_CHANGE_TYPE_UNSPECIFIED WatchUsersResponse_ChangeType = 0
+	// A user that exists when the watch starts.
+	WatchUsersResponse_EXISTING WatchUsersResponse_ChangeType = 1
+	// The snapshot of existing users is complete. Has no user.
+	WatchUsersResponse_SNAPSHOT_COMPLETE WatchUsersResponse_ChangeType = 2
+	// A user was created.
+	WatchUsersResponse_CREATED WatchUsersResponse_ChangeType = 3
+	// A user was updated, undeleted or rolled back.
+	WatchUsersResponse_UPDATED WatchUsersResponse_ChangeType = 4
+	// A user was soft deleted.
+	WatchUsersResponse_DELETED WatchUsersResponse_ChangeType = 5
+)
+
+// Enum value maps for WatchUsersResponse_ChangeType.
+var (
+	WatchUsersResponse_ChangeType_name = map[int32]string{
+		0: "CHANGE_TYPE_UNSPECIFIED",
+		1: "EXISTING",
+		2: "SNAPSHOT_COMPLETE",
+		3: "CREATED",
+		4: "UPDATED",
+		5: "DELETED",
+	}
+	WatchUsersResponse_ChangeType_value = map[string]int32{
+		"CHANGE_TYPE_UNSPECIFIED": 0,
+		"EXISTING":                1,
+		"SNAPSHOT_COMPLETE":       2,
+		"CREATED":                 3,
+		"UPDATED":                 4,
+		"DELETED":                 5,
+	}
+)
+
+func (x WatchUsersResponse_ChangeType) Enum() *WatchUsersResponse_ChangeType {
+	p := new(WatchUsersResponse_ChangeType)
+	*p = x
+	return p
+}
+
+func (x WatchUsersResponse_ChangeType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (WatchUsersResponse_ChangeType) Descriptor() protoreflect.EnumDescriptor {
+	return file_gomicroservice_v1_user_service_proto_enumTypes[1].Descriptor()
+}
+
+func (WatchUsersResponse_ChangeType) Type() protoreflect.EnumType {
+	return &file_gomicroservice_v1_user_service_proto_enumTypes[1]
+}
+
+func (x WatchUsersResponse_ChangeType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use WatchUsersResponse_ChangeType.Descriptor instead.
+func (WatchUsersResponse_ChangeType) EnumDescriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{24, 0}
+}
+
 // A user resource.
 type User struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -39,7 +160,22 @@ type User struct {
 	// The creation time of the user.
 	CreateTime *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
 	// The last update time of the user.
-	UpdateTime    *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=update_time,json=updateTime,proto3" json:"update_time,omitempty"`
+	UpdateTime *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=update_time,json=updateTime,proto3" json:"update_time,omitempty"`
+	// The time the user was soft deleted, if it has been deleted.
+	DeleteTime *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=delete_time,json=deleteTime,proto3" json:"delete_time,omitempty"`
+	// The time a soft-deleted user will be permanently purged.
+	PurgeTime *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=purge_time,json=purgeTime,proto3" json:"purge_time,omitempty"`
+	// A checksum of the user's current revision, following AIP-154.
+	// Pass it back as `etag` on update or delete to detect concurrent changes.
+	// The HTTP gateway also returns it in the `ETag` header.
+	Etag string `protobuf:"bytes,8,opt,name=etag,proto3" json:"etag,omitempty"`
+	// The ID of this revision of the user, following AIP-162.
+	RevisionId string `protobuf:"bytes,9,opt,name=revision_id,json=revisionId,proto3" json:"revision_id,omitempty"`
+	// The time this revision of the user was created.
+	RevisionCreateTime *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=revision_create_time,json=revisionCreateTime,proto3" json:"revision_create_time,omitempty"`
+	// Who made the change that created this revision, as named by the
+	// `x-actor` request header. Empty if it is unknown.
+	RevisionActor string `protobuf:"bytes,11,opt,name=revision_actor,json=revisionActor,proto3" json:"revision_actor,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -109,6 +245,48 @@ func (x *User) GetUpdateTime() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *User) GetDeleteTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DeleteTime
+	}
+	return nil
+}
+
+func (x *User) GetPurgeTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PurgeTime
+	}
+	return nil
+}
+
+func (x *User) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *User) GetRevisionId() string {
+	if x != nil {
+		return x.RevisionId
+	}
+	return ""
+}
+
+func (x *User) GetRevisionCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RevisionCreateTime
+	}
+	return nil
+}
+
+func (x *User) GetRevisionActor() string {
+	if x != nil {
+		return x.RevisionActor
+	}
+	return ""
+}
+
 // Request message for CreateUser method.
 type CreateUserRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -168,8 +346,15 @@ func (x *CreateUserRequest) GetUserId() string {
 type GetUserRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// The resource name of the user to retrieve.
-	// Format: users/{user_id}
-	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Format: users/{user_id}, or users/{user_id}@{revision_id} to retrieve a
+	// revision of the user, following AIP-162.
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// If set to true, a soft-deleted user is returned instead of NOT_FOUND.
+	ShowDeleted bool `protobuf:"varint,2,opt,name=show_deleted,json=showDeleted,proto3" json:"show_deleted,omitempty"`
+	// If set, the user is read as it was at this time. Only a limited window
+	// of history is kept, and times outside of it fail with
+	// FAILED_PRECONDITION. Can't be combined with a revision.
+	ReadTime      *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=read_time,json=readTime,proto3" json:"read_time,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -211,6 +396,236 @@ func (x *GetUserRequest) GetName() string {
 	return ""
 }
 
+func (x *GetUserRequest) GetShowDeleted() bool {
+	if x != nil {
+		return x.ShowDeleted
+	}
+	return false
+}
+
+func (x *GetUserRequest) GetReadTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReadTime
+	}
+	return nil
+}
+
+// Request message for BatchCreateUsers method.
+type BatchCreateUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The requests of the users to create. There is a limit to how many users
+	// can be created at once, 100 by default.
+	Requests []*CreateUserRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	// If set to true, the users that can be created are, even if others fail.
+	BestEffort    bool `protobuf:"varint,2,opt,name=best_effort,json=bestEffort,proto3" json:"best_effort,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCreateUsersRequest) Reset() {
+	*x = BatchCreateUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCreateUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCreateUsersRequest) ProtoMessage() {}
+
+func (x *BatchCreateUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCreateUsersRequest.ProtoReflect.Descriptor instead.
+func (*BatchCreateUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchCreateUsersRequest) GetRequests() []*CreateUserRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+func (x *BatchCreateUsersRequest) GetBestEffort() bool {
+	if x != nil {
+		return x.BestEffort
+	}
+	return false
+}
+
+// Response message for BatchCreateUsers method.
+type BatchCreateUsersResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The created users, in the order of the requests.
+	Users []*User `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	// With best_effort, the status of every request in the order of the
+	// requests. Requests that failed have no user in `users`.
+	Statuses      []*status.Status `protobuf:"bytes,2,rep,name=statuses,proto3" json:"statuses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCreateUsersResponse) Reset() {
+	*x = BatchCreateUsersResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCreateUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCreateUsersResponse) ProtoMessage() {}
+
+func (x *BatchCreateUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCreateUsersResponse.ProtoReflect.Descriptor instead.
+func (*BatchCreateUsersResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchCreateUsersResponse) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+func (x *BatchCreateUsersResponse) GetStatuses() []*status.Status {
+	if x != nil {
+		return x.Statuses
+	}
+	return nil
+}
+
+// Request message for BatchGetUsers method.
+type BatchGetUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The resource names of the users to retrieve. There is a limit to how
+	// many users can be retrieved at once, 100 by default.
+	// Format: users/{user_id}
+	Names []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	// If set to true, missing users are left out of the response instead of
+	// failing the request with NOT_FOUND. Soft-deleted users are missing.
+	SkipMissing   bool `protobuf:"varint,2,opt,name=skip_missing,json=skipMissing,proto3" json:"skip_missing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetUsersRequest) Reset() {
+	*x = BatchGetUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetUsersRequest) ProtoMessage() {}
+
+func (x *BatchGetUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetUsersRequest.ProtoReflect.Descriptor instead.
+func (*BatchGetUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchGetUsersRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+func (x *BatchGetUsersRequest) GetSkipMissing() bool {
+	if x != nil {
+		return x.SkipMissing
+	}
+	return false
+}
+
+// Response message for BatchGetUsers method.
+type BatchGetUsersResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The users, in the order of the requested names.
+	Users         []*User `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetUsersResponse) Reset() {
+	*x = BatchGetUsersResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetUsersResponse) ProtoMessage() {}
+
+func (x *BatchGetUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetUsersResponse.ProtoReflect.Descriptor instead.
+func (*BatchGetUsersResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchGetUsersResponse) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
 // Request message for ListUsers method.
 type ListUsersRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -218,18 +633,31 @@ type ListUsersRequest struct {
 	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
 	// The next_page_token value returned from a previous List request, if any.
 	PageToken string `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
-	// A string value to restrict results based on a specific field.
+	// An AIP-160 filter expression to restrict the returned users.
+	// Supported fields: name, display_name, email, create_time and update_time.
 	// For example:
-	// display_name=John
-	// email=johnexample.com
-	Filter        string `protobuf:"bytes,3,opt,name=filter,proto3" json:"filter,omitempty"`
+	// display_name = "John*"
+	// email:"example.com" AND create_time > "2024-01-01T00:00:00Z"
+	Filter string `protobuf:"bytes,3,opt,name=filter,proto3" json:"filter,omitempty"`
+	// A comma-separated list of fields to order by, following AIP-132.
+	// Append " desc" to a field to sort in descending order.
+	// Sortable fields: name, display_name, email, create_time and update_time.
+	// Defaults to ordering by name.
+	// For example: "create_time desc, display_name"
+	OrderBy string `protobuf:"bytes,4,opt,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	// If set to true, soft-deleted users are included in the results.
+	ShowDeleted bool `protobuf:"varint,5,opt,name=show_deleted,json=showDeleted,proto3" json:"show_deleted,omitempty"`
+	// If set, the users are listed as they were at this time. Only a limited
+	// window of history is kept, and times outside of it fail with
+	// FAILED_PRECONDITION. All pages must be requested with the same read_time.
+	ReadTime      *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=read_time,json=readTime,proto3" json:"read_time,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ListUsersRequest) Reset() {
 	*x = ListUsersRequest{}
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[3]
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -241,7 +669,7 @@ func (x *ListUsersRequest) String() string {
 func (*ListUsersRequest) ProtoMessage() {}
 
 func (x *ListUsersRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[3]
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -254,7 +682,7 @@ func (x *ListUsersRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListUsersRequest.ProtoReflect.Descriptor instead.
 func (*ListUsersRequest) Descriptor() ([]byte, []int) {
-	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{3}
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ListUsersRequest) GetPageSize() int32 {
@@ -278,6 +706,27 @@ func (x *ListUsersRequest) GetFilter() string {
 	return ""
 }
 
+func (x *ListUsersRequest) GetOrderBy() string {
+	if x != nil {
+		return x.OrderBy
+	}
+	return ""
+}
+
+func (x *ListUsersRequest) GetShowDeleted() bool {
+	if x != nil {
+		return x.ShowDeleted
+	}
+	return false
+}
+
+func (x *ListUsersRequest) GetReadTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReadTime
+	}
+	return nil
+}
+
 // Response message for ListUsers method.
 type ListUsersResponse struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -291,7 +740,7 @@ type ListUsersResponse struct {
 
 func (x *ListUsersResponse) Reset() {
 	*x = ListUsersResponse{}
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[4]
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -303,7 +752,7 @@ func (x *ListUsersResponse) String() string {
 func (*ListUsersResponse) ProtoMessage() {}
 
 func (x *ListUsersResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[4]
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -316,7 +765,7 @@ func (x *ListUsersResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListUsersResponse.ProtoReflect.Descriptor instead.
 func (*ListUsersResponse) Descriptor() ([]byte, []int) {
-	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{4}
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *ListUsersResponse) GetUsers() []*User {
@@ -339,14 +788,22 @@ type UpdateUserRequest struct {
 	// The user to update.
 	User *User `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
 	// The list of fields to update.
-	UpdateMask    *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	UpdateMask *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	// If set to true, and the user is not found, a new user is created from the
+	// fields in `update_mask`. The response then carries an `x-created: true`
+	// header, which the HTTP gateway turns into a 201 Created status.
+	AllowMissing bool `protobuf:"varint,3,opt,name=allow_missing,json=allowMissing,proto3" json:"allow_missing,omitempty"`
+	// The etag of the user, as last read by the client.
+	// If set and it doesn't match the current etag, the request fails with
+	// ABORTED. The HTTP gateway also accepts it in the `If-Match` header.
+	Etag          string `protobuf:"bytes,4,opt,name=etag,proto3" json:"etag,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *UpdateUserRequest) Reset() {
 	*x = UpdateUserRequest{}
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[5]
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -358,7 +815,7 @@ func (x *UpdateUserRequest) String() string {
 func (*UpdateUserRequest) ProtoMessage() {}
 
 func (x *UpdateUserRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[5]
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -371,7 +828,7 @@ func (x *UpdateUserRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateUserRequest.ProtoReflect.Descriptor instead.
 func (*UpdateUserRequest) Descriptor() ([]byte, []int) {
-	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{5}
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *UpdateUserRequest) GetUser() *User {
@@ -388,31 +845,550 @@ func (x *UpdateUserRequest) GetUpdateMask() *fieldmaskpb.FieldMask {
 	return nil
 }
 
+func (x *UpdateUserRequest) GetAllowMissing() bool {
+	if x != nil {
+		return x.AllowMissing
+	}
+	return false
+}
+
+func (x *UpdateUserRequest) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
 // Request message for DeleteUser method.
 type DeleteUserRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
-	// The resource name of the user to delete.
+	// The resource name of the user to delete.
+	// Format: users/{user_id}
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The etag of the user, as last read by the client.
+	// If set and it doesn't match the current etag, the request fails with
+	// ABORTED. The HTTP gateway also accepts it in the `If-Match` header.
+	Etag          string `protobuf:"bytes,2,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteUserRequest) Reset() {
+	*x = DeleteUserRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteUserRequest) ProtoMessage() {}
+
+func (x *DeleteUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteUserRequest.ProtoReflect.Descriptor instead.
+func (*DeleteUserRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DeleteUserRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *DeleteUserRequest) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+// Request message for BatchUpdateUsers method.
+type BatchUpdateUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The requests of the users to update. There is a limit to how many users
+	// can be updated at once, 100 by default.
+	Requests      []*UpdateUserRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchUpdateUsersRequest) Reset() {
+	*x = BatchUpdateUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchUpdateUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchUpdateUsersRequest) ProtoMessage() {}
+
+func (x *BatchUpdateUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchUpdateUsersRequest.ProtoReflect.Descriptor instead.
+func (*BatchUpdateUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *BatchUpdateUsersRequest) GetRequests() []*UpdateUserRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+// Response message for BatchUpdateUsers method.
+type BatchUpdateUsersResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The updated users, in the order of the requests.
+	Users         []*User `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchUpdateUsersResponse) Reset() {
+	*x = BatchUpdateUsersResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchUpdateUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchUpdateUsersResponse) ProtoMessage() {}
+
+func (x *BatchUpdateUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchUpdateUsersResponse.ProtoReflect.Descriptor instead.
+func (*BatchUpdateUsersResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *BatchUpdateUsersResponse) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+// Request message for BatchDeleteUsers method.
+type BatchDeleteUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The requests of the users to delete. There is a limit to how many users
+	// can be deleted at once, 100 by default.
+	Requests      []*DeleteUserRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchDeleteUsersRequest) Reset() {
+	*x = BatchDeleteUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchDeleteUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchDeleteUsersRequest) ProtoMessage() {}
+
+func (x *BatchDeleteUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchDeleteUsersRequest.ProtoReflect.Descriptor instead.
+func (*BatchDeleteUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *BatchDeleteUsersRequest) GetRequests() []*DeleteUserRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+// Request message for ImportUsers method.
+type ImportUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The format of the data. Required in the first request.
+	Format ImportUsersRequest_Format `protobuf:"varint,1,opt,name=format,proto3,enum=gomicroservice.v1.ImportUsersRequest_Format" json:"format,omitempty"`
+	// A chunk of the data.
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// If set, the rows are validated and checked against the existing users,
+	// but no user is created.
+	ValidateOnly  bool `protobuf:"varint,3,opt,name=validate_only,json=validateOnly,proto3" json:"validate_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportUsersRequest) Reset() {
+	*x = ImportUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportUsersRequest) ProtoMessage() {}
+
+func (x *ImportUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportUsersRequest.ProtoReflect.Descriptor instead.
+func (*ImportUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ImportUsersRequest) GetFormat() ImportUsersRequest_Format {
+	if x != nil {
+		return x.Format
+	}
+	return ImportUsersRequest_FORMAT_UNSPECIFIED
+}
+
+func (x *ImportUsersRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ImportUsersRequest) GetValidateOnly() bool {
+	if x != nil {
+		return x.ValidateOnly
+	}
+	return false
+}
+
+// Response message for ImportUsers method.
+type ImportUsersResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The number of rows in the data.
+	RowCount int32 `protobuf:"varint,1,opt,name=row_count,json=rowCount,proto3" json:"row_count,omitempty"`
+	// The number of users that were created, or would be with validate_only.
+	ImportedCount int32 `protobuf:"varint,2,opt,name=imported_count,json=importedCount,proto3" json:"imported_count,omitempty"`
+	// The number of rows that couldn't be imported.
+	FailedCount int32 `protobuf:"varint,3,opt,name=failed_count,json=failedCount,proto3" json:"failed_count,omitempty"`
+	// The errors of the rows that couldn't be imported, in the order of the
+	// rows. Only the first 100 errors are listed.
+	Errors        []*ImportUsersResponse_RowError `protobuf:"bytes,4,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportUsersResponse) Reset() {
+	*x = ImportUsersResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportUsersResponse) ProtoMessage() {}
+
+func (x *ImportUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportUsersResponse.ProtoReflect.Descriptor instead.
+func (*ImportUsersResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ImportUsersResponse) GetRowCount() int32 {
+	if x != nil {
+		return x.RowCount
+	}
+	return 0
+}
+
+func (x *ImportUsersResponse) GetImportedCount() int32 {
+	if x != nil {
+		return x.ImportedCount
+	}
+	return 0
+}
+
+func (x *ImportUsersResponse) GetFailedCount() int32 {
+	if x != nil {
+		return x.FailedCount
+	}
+	return 0
+}
+
+func (x *ImportUsersResponse) GetErrors() []*ImportUsersResponse_RowError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+// Request message for PurgeUsers method.
+type PurgeUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// An AIP-160 filter expression of the soft-deleted users to purge, for
+	// example `email = "*@example.com"`.
+	Filter string `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	// Whether to purge the users. If false, the users are only counted.
+	Force         bool `protobuf:"varint,2,opt,name=force,proto3" json:"force,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgeUsersRequest) Reset() {
+	*x = PurgeUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeUsersRequest) ProtoMessage() {}
+
+func (x *PurgeUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeUsersRequest.ProtoReflect.Descriptor instead.
+func (*PurgeUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PurgeUsersRequest) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *PurgeUsersRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+// Response message for PurgeUsers method.
+type PurgeUsersResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The number of users that were purged, or would be purged unless force
+	// is set.
+	PurgeCount int32 `protobuf:"varint,1,opt,name=purge_count,json=purgeCount,proto3" json:"purge_count,omitempty"`
+	// A sample of the resource names of the users that would be purged. Only
+	// set unless force is set.
+	PurgeSample   []string `protobuf:"bytes,2,rep,name=purge_sample,json=purgeSample,proto3" json:"purge_sample,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgeUsersResponse) Reset() {
+	*x = PurgeUsersResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeUsersResponse) ProtoMessage() {}
+
+func (x *PurgeUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeUsersResponse.ProtoReflect.Descriptor instead.
+func (*PurgeUsersResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PurgeUsersResponse) GetPurgeCount() int32 {
+	if x != nil {
+		return x.PurgeCount
+	}
+	return 0
+}
+
+func (x *PurgeUsersResponse) GetPurgeSample() []string {
+	if x != nil {
+		return x.PurgeSample
+	}
+	return nil
+}
+
+// Metadata of the operation of a PurgeUsers method.
+type PurgeUsersMetadata struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The number of users that match the filter.
+	PurgeCount int32 `protobuf:"varint,1,opt,name=purge_count,json=purgeCount,proto3" json:"purge_count,omitempty"`
+	// The number of users that have been purged so far.
+	PurgedCount   int32 `protobuf:"varint,2,opt,name=purged_count,json=purgedCount,proto3" json:"purged_count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgeUsersMetadata) Reset() {
+	*x = PurgeUsersMetadata{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeUsersMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeUsersMetadata) ProtoMessage() {}
+
+func (x *PurgeUsersMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeUsersMetadata.ProtoReflect.Descriptor instead.
+func (*PurgeUsersMetadata) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PurgeUsersMetadata) GetPurgeCount() int32 {
+	if x != nil {
+		return x.PurgeCount
+	}
+	return 0
+}
+
+func (x *PurgeUsersMetadata) GetPurgedCount() int32 {
+	if x != nil {
+		return x.PurgedCount
+	}
+	return 0
+}
+
+// Request message for UndeleteUser method.
+type UndeleteUserRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The resource name of the user to undelete.
 	// Format: users/{user_id}
 	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *DeleteUserRequest) Reset() {
-	*x = DeleteUserRequest{}
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[6]
+func (x *UndeleteUserRequest) Reset() {
+	*x = UndeleteUserRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *DeleteUserRequest) String() string {
+func (x *UndeleteUserRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DeleteUserRequest) ProtoMessage() {}
+func (*UndeleteUserRequest) ProtoMessage() {}
 
-func (x *DeleteUserRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[6]
+func (x *UndeleteUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -423,23 +1399,378 @@ func (x *DeleteUserRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DeleteUserRequest.ProtoReflect.Descriptor instead.
-func (*DeleteUserRequest) Descriptor() ([]byte, []int) {
-	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use UndeleteUserRequest.ProtoReflect.Descriptor instead.
+func (*UndeleteUserRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{19}
 }
 
-func (x *DeleteUserRequest) GetName() string {
+func (x *UndeleteUserRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// Request message for ListUserRevisions method.
+type ListUserRevisionsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The resource name of the user to list the revisions of.
+	// Format: users/{user_id}
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The maximum number of revisions to return.
+	PageSize int32 `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// The next_page_token value returned from a previous List request, if any.
+	PageToken     string `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUserRevisionsRequest) Reset() {
+	*x = ListUserRevisionsRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUserRevisionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUserRevisionsRequest) ProtoMessage() {}
+
+func (x *ListUserRevisionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUserRevisionsRequest.ProtoReflect.Descriptor instead.
+func (*ListUserRevisionsRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ListUserRevisionsRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ListUserRevisionsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListUserRevisionsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+// Response message for ListUserRevisions method.
+type ListUserRevisionsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The revisions of the user, newest first. Their names have the format
+	// users/{user_id}@{revision_id}.
+	Users []*User `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	// A token to retrieve the next page of results, or empty if there are no more results.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUserRevisionsResponse) Reset() {
+	*x = ListUserRevisionsResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUserRevisionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUserRevisionsResponse) ProtoMessage() {}
+
+func (x *ListUserRevisionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUserRevisionsResponse.ProtoReflect.Descriptor instead.
+func (*ListUserRevisionsResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ListUserRevisionsResponse) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+func (x *ListUserRevisionsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+// Request message for RollbackUser method.
+type RollbackUserRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The resource name of the user to roll back.
+	// Format: users/{user_id}
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The ID of the revision to restore.
+	RevisionId string `protobuf:"bytes,2,opt,name=revision_id,json=revisionId,proto3" json:"revision_id,omitempty"`
+	// The etag of the user, as last read by the client.
+	// If set and it doesn't match the current etag, the request fails with
+	// ABORTED.
+	Etag          string `protobuf:"bytes,3,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RollbackUserRequest) Reset() {
+	*x = RollbackUserRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RollbackUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RollbackUserRequest) ProtoMessage() {}
+
+func (x *RollbackUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RollbackUserRequest.ProtoReflect.Descriptor instead.
+func (*RollbackUserRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *RollbackUserRequest) GetName() string {
 	if x != nil {
 		return x.Name
 	}
 	return ""
 }
 
+func (x *RollbackUserRequest) GetRevisionId() string {
+	if x != nil {
+		return x.RevisionId
+	}
+	return ""
+}
+
+func (x *RollbackUserRequest) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+// Request message for WatchUsers method.
+type WatchUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The resume_token of the last response received by an earlier watch. If
+	// set, the watch sends the changes after it instead of a snapshot.
+	ResumeToken   string `protobuf:"bytes,1,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchUsersRequest) Reset() {
+	*x = WatchUsersRequest{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchUsersRequest) ProtoMessage() {}
+
+func (x *WatchUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchUsersRequest.ProtoReflect.Descriptor instead.
+func (*WatchUsersRequest) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *WatchUsersRequest) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+// Response message for WatchUsers method.
+type WatchUsersResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The kind of the response.
+	ChangeType WatchUsersResponse_ChangeType `protobuf:"varint,1,opt,name=change_type,json=changeType,proto3,enum=gomicroservice.v1.WatchUsersResponse_ChangeType" json:"change_type,omitempty"`
+	// The user, after the change.
+	User *User `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	// A token to resume the watch after this response. Empty for the users of
+	// the snapshot, as a watch that ends during the snapshot has to start over.
+	ResumeToken   string `protobuf:"bytes,3,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchUsersResponse) Reset() {
+	*x = WatchUsersResponse{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchUsersResponse) ProtoMessage() {}
+
+func (x *WatchUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchUsersResponse.ProtoReflect.Descriptor instead.
+func (*WatchUsersResponse) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *WatchUsersResponse) GetChangeType() WatchUsersResponse_ChangeType {
+	if x != nil {
+		return x.ChangeType
+	}
+	return WatchUsersResponse_CHANGE_TYPE_UNSPECIFIED
+}
+
+func (x *WatchUsersResponse) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+func (x *WatchUsersResponse) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+// The error of a row that couldn't be imported.
+type ImportUsersResponse_RowError struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The line of the data that the row starts on, counting from 1.
+	Line int32 `protobuf:"varint,1,opt,name=line,proto3" json:"line,omitempty"`
+	// Why the row couldn't be imported, as CreateUser would tell it.
+	Status        *status.Status `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportUsersResponse_RowError) Reset() {
+	*x = ImportUsersResponse_RowError{}
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportUsersResponse_RowError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportUsersResponse_RowError) ProtoMessage() {}
+
+func (x *ImportUsersResponse_RowError) ProtoReflect() protoreflect.Message {
+	mi := &file_gomicroservice_v1_user_service_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportUsersResponse_RowError.ProtoReflect.Descriptor instead.
+func (*ImportUsersResponse_RowError) Descriptor() ([]byte, []int) {
+	return file_gomicroservice_v1_user_service_proto_rawDescGZIP(), []int{15, 0}
+}
+
+func (x *ImportUsersResponse_RowError) GetLine() int32 {
+	if x != nil {
+		return x.Line
+	}
+	return 0
+}
+
+func (x *ImportUsersResponse_RowError) GetStatus() *status.Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
 var File_gomicroservice_v1_user_service_proto protoreflect.FileDescriptor
 
 const file_gomicroservice_v1_user_service_proto_rawDesc = "" +
 	"\n" +
-	"$gomicroservice/v1/user_service.proto\x12\x11gomicroservice.v1\x1a\x1bbuf/validate/validate.proto\x1a\x1cgoogle/api/annotations.proto\x1a\x17google/api/client.proto\x1a\x1fgoogle/api/field_behavior.proto\x1a\x19google/api/resource.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa9\x02\n" +
+	"$gomicroservice/v1/user_service.proto\x12\x11gomicroservice.v1\x1a\x1bbuf/validate/validate.proto\x1a\x1cgoogle/api/annotations.proto\x1a\x17google/api/client.proto\x1a\x1fgoogle/api/field_behavior.proto\x1a\x19google/api/resource.proto\x1a#google/longrunning/operations.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x17google/rpc/status.proto\"\xe9\x04\n" +
 	"\x04User\x12\x17\n" +
 	"\x04name\x18\x01 \x01(\tB\x03\xe0A\bR\x04name\x12-\n" +
 	"\fdisplay_name\x18\x02 \x01(\tB\n" +
@@ -449,38 +1780,149 @@ const file_gomicroservice_v1_user_service_proto_rawDesc = "" +
 	"\vcreate_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x03R\n" +
 	"createTime\x12@\n" +
 	"\vupdate_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x03R\n" +
-	"updateTime:3\xeaA0\n" +
+	"updateTime\x12@\n" +
+	"\vdelete_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x03R\n" +
+	"deleteTime\x12>\n" +
+	"\n" +
+	"purge_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x03R\tpurgeTime\x12\x17\n" +
+	"\x04etag\x18\b \x01(\tB\x03\xe0A\x03R\x04etag\x12$\n" +
+	"\vrevision_id\x18\t \x01(\tB\x03\xe0A\x03R\n" +
+	"revisionId\x12Q\n" +
+	"\x14revision_create_time\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x03R\x12revisionCreateTime\x12*\n" +
+	"\x0erevision_actor\x18\v \x01(\tB\x03\xe0A\x03R\rrevisionActor:3\xeaA0\n" +
 	"\x13gomicroservice/User\x12\fusers/{user}*\x05users2\x04user\"\x92\x01\n" +
 	"\x11CreateUserRequest\x120\n" +
 	"\x04user\x18\x01 \x01(\v2\x17.gomicroservice.v1.UserB\x03\xe0A\x02R\x04user\x12K\n" +
-	"\auser_id\x18\x02 \x01(\tB2\xe0A\x01\xbaH,\xd8\x01\x01r'\x10\x01\x18?2!^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$R\x06userId\"A\n" +
+	"\auser_id\x18\x02 \x01(\tB2\xe0A\x01\xbaH,\xd8\x01\x01r'\x10\x01\x18?2!^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$R\x06userId\"\xa7\x01\n" +
 	"\x0eGetUserRequest\x12/\n" +
 	"\x04name\x18\x01 \x01(\tB\x1b\xe0A\x02\xfaA\x15\n" +
-	"\x13gomicroservice/UserR\x04name\"u\n" +
+	"\x13gomicroservice/UserR\x04name\x12&\n" +
+	"\fshow_deleted\x18\x02 \x01(\bB\x03\xe0A\x01R\vshowDeleted\x12<\n" +
+	"\tread_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x01R\breadTime\"\x86\x01\n" +
+	"\x17BatchCreateUsersRequest\x12E\n" +
+	"\brequests\x18\x01 \x03(\v2$.gomicroservice.v1.CreateUserRequestB\x03\xe0A\x02R\brequests\x12$\n" +
+	"\vbest_effort\x18\x02 \x01(\bB\x03\xe0A\x01R\n" +
+	"bestEffort\"y\n" +
+	"\x18BatchCreateUsersResponse\x12-\n" +
+	"\x05users\x18\x01 \x03(\v2\x17.gomicroservice.v1.UserR\x05users\x12.\n" +
+	"\bstatuses\x18\x02 \x03(\v2\x12.google.rpc.StatusR\bstatuses\"q\n" +
+	"\x14BatchGetUsersRequest\x121\n" +
+	"\x05names\x18\x01 \x03(\tB\x1b\xe0A\x02\xfaA\x15\n" +
+	"\x13gomicroservice/UserR\x05names\x12&\n" +
+	"\fskip_missing\x18\x02 \x01(\bB\x03\xe0A\x01R\vskipMissing\"F\n" +
+	"\x15BatchGetUsersResponse\x12-\n" +
+	"\x05users\x18\x01 \x03(\v2\x17.gomicroservice.v1.UserR\x05users\"\xfb\x01\n" +
 	"\x10ListUsersRequest\x12 \n" +
 	"\tpage_size\x18\x01 \x01(\x05B\x03\xe0A\x01R\bpageSize\x12\"\n" +
 	"\n" +
 	"page_token\x18\x02 \x01(\tB\x03\xe0A\x01R\tpageToken\x12\x1b\n" +
-	"\x06filter\x18\x03 \x01(\tB\x03\xe0A\x01R\x06filter\"j\n" +
+	"\x06filter\x18\x03 \x01(\tB\x03\xe0A\x01R\x06filter\x12\x1e\n" +
+	"\border_by\x18\x04 \x01(\tB\x03\xe0A\x01R\aorderBy\x12&\n" +
+	"\fshow_deleted\x18\x05 \x01(\bB\x03\xe0A\x01R\vshowDeleted\x12<\n" +
+	"\tread_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampB\x03\xe0A\x01R\breadTime\"j\n" +
 	"\x11ListUsersResponse\x12-\n" +
 	"\x05users\x18\x01 \x03(\v2\x17.gomicroservice.v1.UserR\x05users\x12&\n" +
-	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\x87\x01\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xca\x01\n" +
 	"\x11UpdateUserRequest\x120\n" +
 	"\x04user\x18\x01 \x01(\v2\x17.gomicroservice.v1.UserB\x03\xe0A\x01R\x04user\x12@\n" +
 	"\vupdate_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskB\x03\xe0A\x01R\n" +
-	"updateMask\"D\n" +
+	"updateMask\x12(\n" +
+	"\rallow_missing\x18\x03 \x01(\bB\x03\xe0A\x01R\fallowMissing\x12\x17\n" +
+	"\x04etag\x18\x04 \x01(\tB\x03\xe0A\x01R\x04etag\"]\n" +
 	"\x11DeleteUserRequest\x12/\n" +
 	"\x04name\x18\x01 \x01(\tB\x1b\xe0A\x02\xfaA\x15\n" +
-	"\x13gomicroservice/UserR\x04name2\xce\x04\n" +
+	"\x13gomicroservice/UserR\x04name\x12\x17\n" +
+	"\x04etag\x18\x02 \x01(\tB\x03\xe0A\x01R\x04etag\"`\n" +
+	"\x17BatchUpdateUsersRequest\x12E\n" +
+	"\brequests\x18\x01 \x03(\v2$.gomicroservice.v1.UpdateUserRequestB\x03\xe0A\x02R\brequests\"I\n" +
+	"\x18BatchUpdateUsersResponse\x12-\n" +
+	"\x05users\x18\x01 \x03(\v2\x17.gomicroservice.v1.UserR\x05users\"`\n" +
+	"\x17BatchDeleteUsersRequest\x12E\n" +
+	"\brequests\x18\x01 \x03(\v2$.gomicroservice.v1.DeleteUserRequestB\x03\xe0A\x02R\brequests\"\xd9\x01\n" +
+	"\x12ImportUsersRequest\x12I\n" +
+	"\x06format\x18\x01 \x01(\x0e2,.gomicroservice.v1.ImportUsersRequest.FormatB\x03\xe0A\x01R\x06format\x12\x17\n" +
+	"\x04data\x18\x02 \x01(\fB\x03\xe0A\x01R\x04data\x12(\n" +
+	"\rvalidate_only\x18\x03 \x01(\bB\x03\xe0A\x01R\fvalidateOnly\"5\n" +
+	"\x06Format\x12\x16\n" +
+	"\x12FORMAT_UNSPECIFIED\x10\x00\x12\a\n" +
+	"\x03CSV\x10\x01\x12\n" +
+	"\n" +
+	"\x06NDJSON\x10\x02\"\x91\x02\n" +
+	"\x13ImportUsersResponse\x12\x1b\n" +
+	"\trow_count\x18\x01 \x01(\x05R\browCount\x12%\n" +
+	"\x0eimported_count\x18\x02 \x01(\x05R\rimportedCount\x12!\n" +
+	"\ffailed_count\x18\x03 \x01(\x05R\vfailedCount\x12G\n" +
+	"\x06errors\x18\x04 \x03(\v2/.gomicroservice.v1.ImportUsersResponse.RowErrorR\x06errors\x1aJ\n" +
+	"\bRowError\x12\x12\n" +
+	"\x04line\x18\x01 \x01(\x05R\x04line\x12*\n" +
+	"\x06status\x18\x02 \x01(\v2\x12.google.rpc.StatusR\x06status\"K\n" +
+	"\x11PurgeUsersRequest\x12\x1b\n" +
+	"\x06filter\x18\x01 \x01(\tB\x03\xe0A\x02R\x06filter\x12\x19\n" +
+	"\x05force\x18\x02 \x01(\bB\x03\xe0A\x01R\x05force\"X\n" +
+	"\x12PurgeUsersResponse\x12\x1f\n" +
+	"\vpurge_count\x18\x01 \x01(\x05R\n" +
+	"purgeCount\x12!\n" +
+	"\fpurge_sample\x18\x02 \x03(\tR\vpurgeSample\"X\n" +
+	"\x12PurgeUsersMetadata\x12\x1f\n" +
+	"\vpurge_count\x18\x01 \x01(\x05R\n" +
+	"purgeCount\x12!\n" +
+	"\fpurged_count\x18\x02 \x01(\x05R\vpurgedCount\"F\n" +
+	"\x13UndeleteUserRequest\x12/\n" +
+	"\x04name\x18\x01 \x01(\tB\x1b\xe0A\x02\xfaA\x15\n" +
+	"\x13gomicroservice/UserR\x04name\"\x91\x01\n" +
+	"\x18ListUserRevisionsRequest\x12/\n" +
+	"\x04name\x18\x01 \x01(\tB\x1b\xe0A\x02\xfaA\x15\n" +
+	"\x13gomicroservice/UserR\x04name\x12 \n" +
+	"\tpage_size\x18\x02 \x01(\x05B\x03\xe0A\x01R\bpageSize\x12\"\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tB\x03\xe0A\x01R\tpageToken\"r\n" +
+	"\x19ListUserRevisionsResponse\x12-\n" +
+	"\x05users\x18\x01 \x03(\v2\x17.gomicroservice.v1.UserR\x05users\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\x85\x01\n" +
+	"\x13RollbackUserRequest\x12/\n" +
+	"\x04name\x18\x01 \x01(\tB\x1b\xe0A\x02\xfaA\x15\n" +
+	"\x13gomicroservice/UserR\x04name\x12$\n" +
+	"\vrevision_id\x18\x02 \x01(\tB\x03\xe0A\x02R\n" +
+	"revisionId\x12\x17\n" +
+	"\x04etag\x18\x03 \x01(\tB\x03\xe0A\x01R\x04etag\";\n" +
+	"\x11WatchUsersRequest\x12&\n" +
+	"\fresume_token\x18\x01 \x01(\tB\x03\xe0A\x01R\vresumeToken\"\xae\x02\n" +
+	"\x12WatchUsersResponse\x12Q\n" +
+	"\vchange_type\x18\x01 \x01(\x0e20.gomicroservice.v1.WatchUsersResponse.ChangeTypeR\n" +
+	"changeType\x12+\n" +
+	"\x04user\x18\x02 \x01(\v2\x17.gomicroservice.v1.UserR\x04user\x12!\n" +
+	"\fresume_token\x18\x03 \x01(\tR\vresumeToken\"u\n" +
+	"\n" +
+	"ChangeType\x12\x1b\n" +
+	"\x17CHANGE_TYPE_UNSPECIFIED\x10\x00\x12\f\n" +
+	"\bEXISTING\x10\x01\x12\x15\n" +
+	"\x11SNAPSHOT_COMPLETE\x10\x02\x12\v\n" +
+	"\aCREATED\x10\x03\x12\v\n" +
+	"\aUPDATED\x10\x04\x12\v\n" +
+	"\aDELETED\x10\x052\xa5\x0f\n" +
 	"\vUserService\x12s\n" +
 	"\n" +
 	"CreateUser\x12$.gomicroservice.v1.CreateUserRequest\x1a\x17.gomicroservice.v1.User\"&\xdaA\fuser,user_id\x82\xd3\xe4\x93\x02\x11:\x04user\"\t/v1/users\x12h\n" +
-	"\aGetUser\x12!.gomicroservice.v1.GetUserRequest\x1a\x17.gomicroservice.v1.User\"!\xdaA\x04name\x82\xd3\xe4\x93\x02\x14\x12\x12/v1/{name=users/*}\x12i\n" +
+	"\aGetUser\x12!.gomicroservice.v1.GetUserRequest\x1a\x17.gomicroservice.v1.User\"!\xdaA\x04name\x82\xd3\xe4\x93\x02\x14\x12\x12/v1/{name=users/*}\x12\x8d\x01\n" +
+	"\x10BatchCreateUsers\x12*.gomicroservice.v1.BatchCreateUsersRequest\x1a+.gomicroservice.v1.BatchCreateUsersResponse\" \x82\xd3\xe4\x93\x02\x1a:\x01*\"\x15/v1/users:batchCreate\x12~\n" +
+	"\rBatchGetUsers\x12'.gomicroservice.v1.BatchGetUsersRequest\x1a(.gomicroservice.v1.BatchGetUsersResponse\"\x1a\x82\xd3\xe4\x93\x02\x14\x12\x12/v1/users:batchGet\x12i\n" +
 	"\tListUsers\x12#.gomicroservice.v1.ListUsersRequest\x1a$.gomicroservice.v1.ListUsersResponse\"\x11\x82\xd3\xe4\x93\x02\v\x12\t/v1/users\x12\x85\x01\n" +
 	"\n" +
-	"UpdateUser\x12$.gomicroservice.v1.UpdateUserRequest\x1a\x17.gomicroservice.v1.User\"8\xdaA\x10user,update_mask\x82\xd3\xe4\x93\x02\x1f:\x04user2\x17/v1/{user.name=users/*}\x12m\n" +
+	"UpdateUser\x12$.gomicroservice.v1.UpdateUserRequest\x1a\x17.gomicroservice.v1.User\"8\xdaA\x10user,update_mask\x82\xd3\xe4\x93\x02\x1f:\x04user2\x17/v1/{user.name=users/*}\x12\x8d\x01\n" +
+	"\x10BatchUpdateUsers\x12*.gomicroservice.v1.BatchUpdateUsersRequest\x1a+.gomicroservice.v1.BatchUpdateUsersResponse\" \x82\xd3\xe4\x93\x02\x1a:\x01*\"\x15/v1/users:batchUpdate\x12m\n" +
+	"\n" +
+	"DeleteUser\x12$.gomicroservice.v1.DeleteUserRequest\x1a\x16.google.protobuf.Empty\"!\xdaA\x04name\x82\xd3\xe4\x93\x02\x14*\x12/v1/{name=users/*}\x12x\n" +
+	"\x10BatchDeleteUsers\x12*.gomicroservice.v1.BatchDeleteUsersRequest\x1a\x16.google.protobuf.Empty\" \x82\xd3\xe4\x93\x02\x1a:\x01*\"\x15/v1/users:batchDelete\x12{\n" +
+	"\vImportUsers\x12%.gomicroservice.v1.ImportUsersRequest\x1a&.gomicroservice.v1.ImportUsersResponse\"\x1b\x82\xd3\xe4\x93\x02\x15:\x01*\"\x10/v1/users:import(\x01\x12\x98\x01\n" +
+	"\n" +
+	"PurgeUsers\x12$.gomicroservice.v1.PurgeUsersRequest\x1a\x1d.google.longrunning.Operation\"E\xcaA(\n" +
+	"\x12PurgeUsersResponse\x12\x12PurgeUsersMetadata\x82\xd3\xe4\x93\x02\x14:\x01*\"\x0f/v1/users:purge\x12~\n" +
+	"\fUndeleteUser\x12&.gomicroservice.v1.UndeleteUserRequest\x1a\x17.gomicroservice.v1.User\"-\xdaA\x04name\x82\xd3\xe4\x93\x02 :\x01*\"\x1b/v1/{name=users/*}:undelete\x12\x9f\x01\n" +
+	"\x11ListUserRevisions\x12+.gomicroservice.v1.ListUserRevisionsRequest\x1a,.gomicroservice.v1.ListUserRevisionsResponse\"/\xdaA\x04name\x82\xd3\xe4\x93\x02\"\x12 /v1/{name=users/*}:listRevisions\x12\x8a\x01\n" +
+	"\fRollbackUser\x12&.gomicroservice.v1.RollbackUserRequest\x1a\x17.gomicroservice.v1.User\"9\xdaA\x10name,revision_id\x82\xd3\xe4\x93\x02 :\x01*\"\x1b/v1/{name=users/*}:rollback\x12t\n" +
 	"\n" +
-	"DeleteUser\x12$.gomicroservice.v1.DeleteUserRequest\x1a\x16.google.protobuf.Empty\"!\xdaA\x04name\x82\xd3\xe4\x93\x02\x14*\x12/v1/{name=users/*}B\xe3\x01\n" +
+	"WatchUsers\x12$.gomicroservice.v1.WatchUsersRequest\x1a%.gomicroservice.v1.WatchUsersResponse\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v1/users:watch0\x01B\xe3\x01\n" +
 	"\x15com.gomicroservice.v1B\x10UserServiceProtoP\x01ZSgithub.com/fredrikaverpil/go-microservice/gen/go/gomicroservice/v1;gomicroservicev1\xa2\x02\x03GXX\xaa\x02\x11Gomicroservice.V1\xca\x02\x11Gomicroservice\\V1\xe2\x02\x1dGomicroservice\\V1\\GPBMetadata\xea\x02\x12Gomicroservice::V1b\x06proto3"
 
 var (
@@ -495,41 +1937,103 @@ func file_gomicroservice_v1_user_service_proto_rawDescGZIP() []byte {
 	return file_gomicroservice_v1_user_service_proto_rawDescData
 }
 
-var file_gomicroservice_v1_user_service_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_gomicroservice_v1_user_service_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_gomicroservice_v1_user_service_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
 var file_gomicroservice_v1_user_service_proto_goTypes = []any{
-	(*User)(nil),                  // 0: gomicroservice.v1.User
-	(*CreateUserRequest)(nil),     // 1: gomicroservice.v1.CreateUserRequest
-	(*GetUserRequest)(nil),        // 2: gomicroservice.v1.GetUserRequest
-	(*ListUsersRequest)(nil),      // 3: gomicroservice.v1.ListUsersRequest
-	(*ListUsersResponse)(nil),     // 4: gomicroservice.v1.ListUsersResponse
-	(*UpdateUserRequest)(nil),     // 5: gomicroservice.v1.UpdateUserRequest
-	(*DeleteUserRequest)(nil),     // 6: gomicroservice.v1.DeleteUserRequest
-	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
-	(*fieldmaskpb.FieldMask)(nil), // 8: google.protobuf.FieldMask
-	(*emptypb.Empty)(nil),         // 9: google.protobuf.Empty
+	(ImportUsersRequest_Format)(0),       // 0: gomicroservice.v1.ImportUsersRequest.Format
+	(WatchUsersResponse_ChangeType)(0),   // 1: gomicroservice.v1.WatchUsersResponse.ChangeType
+	(*User)(nil),                         // 2: gomicroservice.v1.User
+	(*CreateUserRequest)(nil),            // 3: gomicroservice.v1.CreateUserRequest
+	(*GetUserRequest)(nil),               // 4: gomicroservice.v1.GetUserRequest
+	(*BatchCreateUsersRequest)(nil),      // 5: gomicroservice.v1.BatchCreateUsersRequest
+	(*BatchCreateUsersResponse)(nil),     // 6: gomicroservice.v1.BatchCreateUsersResponse
+	(*BatchGetUsersRequest)(nil),         // 7: gomicroservice.v1.BatchGetUsersRequest
+	(*BatchGetUsersResponse)(nil),        // 8: gomicroservice.v1.BatchGetUsersResponse
+	(*ListUsersRequest)(nil),             // 9: gomicroservice.v1.ListUsersRequest
+	(*ListUsersResponse)(nil),            // 10: gomicroservice.v1.ListUsersResponse
+	(*UpdateUserRequest)(nil),            // 11: gomicroservice.v1.UpdateUserRequest
+	(*DeleteUserRequest)(nil),            // 12: gomicroservice.v1.DeleteUserRequest
+	(*BatchUpdateUsersRequest)(nil),      // 13: gomicroservice.v1.BatchUpdateUsersRequest
+	(*BatchUpdateUsersResponse)(nil),     // 14: gomicroservice.v1.BatchUpdateUsersResponse
+	(*BatchDeleteUsersRequest)(nil),      // 15: gomicroservice.v1.BatchDeleteUsersRequest
+	(*ImportUsersRequest)(nil),           // 16: gomicroservice.v1.ImportUsersRequest
+	(*ImportUsersResponse)(nil),          // 17: gomicroservice.v1.ImportUsersResponse
+	(*PurgeUsersRequest)(nil),            // 18: gomicroservice.v1.PurgeUsersRequest
+	(*PurgeUsersResponse)(nil),           // 19: gomicroservice.v1.PurgeUsersResponse
+	(*PurgeUsersMetadata)(nil),           // 20: gomicroservice.v1.PurgeUsersMetadata
+	(*UndeleteUserRequest)(nil),          // 21: gomicroservice.v1.UndeleteUserRequest
+	(*ListUserRevisionsRequest)(nil),     // 22: gomicroservice.v1.ListUserRevisionsRequest
+	(*ListUserRevisionsResponse)(nil),    // 23: gomicroservice.v1.ListUserRevisionsResponse
+	(*RollbackUserRequest)(nil),          // 24: gomicroservice.v1.RollbackUserRequest
+	(*WatchUsersRequest)(nil),            // 25: gomicroservice.v1.WatchUsersRequest
+	(*WatchUsersResponse)(nil),           // 26: gomicroservice.v1.WatchUsersResponse
+	(*ImportUsersResponse_RowError)(nil), // 27: gomicroservice.v1.ImportUsersResponse.RowError
+	(*timestamppb.Timestamp)(nil),        // 28: google.protobuf.Timestamp
+	(*status.Status)(nil),                // 29: google.rpc.Status
+	(*fieldmaskpb.FieldMask)(nil),        // 30: google.protobuf.FieldMask
+	(*emptypb.Empty)(nil),                // 31: google.protobuf.Empty
+	(*longrunningpb.Operation)(nil),      // 32: google.longrunning.Operation
 }
 var file_gomicroservice_v1_user_service_proto_depIdxs = []int32{
-	7,  // 0: gomicroservice.v1.User.create_time:type_name -> google.protobuf.Timestamp
-	7,  // 1: gomicroservice.v1.User.update_time:type_name -> google.protobuf.Timestamp
-	0,  // 2: gomicroservice.v1.CreateUserRequest.user:type_name -> gomicroservice.v1.User
-	0,  // 3: gomicroservice.v1.ListUsersResponse.users:type_name -> gomicroservice.v1.User
-	0,  // 4: gomicroservice.v1.UpdateUserRequest.user:type_name -> gomicroservice.v1.User
-	8,  // 5: gomicroservice.v1.UpdateUserRequest.update_mask:type_name -> google.protobuf.FieldMask
-	1,  // 6: gomicroservice.v1.UserService.CreateUser:input_type -> gomicroservice.v1.CreateUserRequest
-	2,  // 7: gomicroservice.v1.UserService.GetUser:input_type -> gomicroservice.v1.GetUserRequest
-	3,  // 8: gomicroservice.v1.UserService.ListUsers:input_type -> gomicroservice.v1.ListUsersRequest
-	5,  // 9: gomicroservice.v1.UserService.UpdateUser:input_type -> gomicroservice.v1.UpdateUserRequest
-	6,  // 10: gomicroservice.v1.UserService.DeleteUser:input_type -> gomicroservice.v1.DeleteUserRequest
-	0,  // 11: gomicroservice.v1.UserService.CreateUser:output_type -> gomicroservice.v1.User
-	0,  // 12: gomicroservice.v1.UserService.GetUser:output_type -> gomicroservice.v1.User
-	4,  // 13: gomicroservice.v1.UserService.ListUsers:output_type -> gomicroservice.v1.ListUsersResponse
-	0,  // 14: gomicroservice.v1.UserService.UpdateUser:output_type -> gomicroservice.v1.User
-	9,  // 15: gomicroservice.v1.UserService.DeleteUser:output_type -> google.protobuf.Empty
-	11, // [11:16] is the sub-list for method output_type
-	6,  // [6:11] is the sub-list for method input_type
-	6,  // [6:6] is the sub-list for extension type_name
-	6,  // [6:6] is the sub-list for extension extendee
-	0,  // [0:6] is the sub-list for field type_name
+	28, // 0: gomicroservice.v1.User.create_time:type_name -> google.protobuf.Timestamp
+	28, // 1: gomicroservice.v1.User.update_time:type_name -> google.protobuf.Timestamp
+	28, // 2: gomicroservice.v1.User.delete_time:type_name -> google.protobuf.Timestamp
+	28, // 3: gomicroservice.v1.User.purge_time:type_name -> google.protobuf.Timestamp
+	28, // 4: gomicroservice.v1.User.revision_create_time:type_name -> google.protobuf.Timestamp
+	2,  // 5: gomicroservice.v1.CreateUserRequest.user:type_name -> gomicroservice.v1.User
+	28, // 6: gomicroservice.v1.GetUserRequest.read_time:type_name -> google.protobuf.Timestamp
+	3,  // 7: gomicroservice.v1.BatchCreateUsersRequest.requests:type_name -> gomicroservice.v1.CreateUserRequest
+	2,  // 8: gomicroservice.v1.BatchCreateUsersResponse.users:type_name -> gomicroservice.v1.User
+	29, // 9: gomicroservice.v1.BatchCreateUsersResponse.statuses:type_name -> google.rpc.Status
+	2,  // 10: gomicroservice.v1.BatchGetUsersResponse.users:type_name -> gomicroservice.v1.User
+	28, // 11: gomicroservice.v1.ListUsersRequest.read_time:type_name -> google.protobuf.Timestamp
+	2,  // 12: gomicroservice.v1.ListUsersResponse.users:type_name -> gomicroservice.v1.User
+	2,  // 13: gomicroservice.v1.UpdateUserRequest.user:type_name -> gomicroservice.v1.User
+	30, // 14: gomicroservice.v1.UpdateUserRequest.update_mask:type_name -> google.protobuf.FieldMask
+	11, // 15: gomicroservice.v1.BatchUpdateUsersRequest.requests:type_name -> gomicroservice.v1.UpdateUserRequest
+	2,  // 16: gomicroservice.v1.BatchUpdateUsersResponse.users:type_name -> gomicroservice.v1.User
+	12, // 17: gomicroservice.v1.BatchDeleteUsersRequest.requests:type_name -> gomicroservice.v1.DeleteUserRequest
+	0,  // 18: gomicroservice.v1.ImportUsersRequest.format:type_name -> gomicroservice.v1.ImportUsersRequest.Format
+	27, // 19: gomicroservice.v1.ImportUsersResponse.errors:type_name -> gomicroservice.v1.ImportUsersResponse.RowError
+	2,  // 20: gomicroservice.v1.ListUserRevisionsResponse.users:type_name -> gomicroservice.v1.User
+	1,  // 21: gomicroservice.v1.WatchUsersResponse.change_type:type_name -> gomicroservice.v1.WatchUsersResponse.ChangeType
+	2,  // 22: gomicroservice.v1.WatchUsersResponse.user:type_name -> gomicroservice.v1.User
+	29, // 23: gomicroservice.v1.ImportUsersResponse.RowError.status:type_name -> google.rpc.Status
+	3,  // 24: gomicroservice.v1.UserService.CreateUser:input_type -> gomicroservice.v1.CreateUserRequest
+	4,  // 25: gomicroservice.v1.UserService.GetUser:input_type -> gomicroservice.v1.GetUserRequest
+	5,  // 26: gomicroservice.v1.UserService.BatchCreateUsers:input_type -> gomicroservice.v1.BatchCreateUsersRequest
+	7,  // 27: gomicroservice.v1.UserService.BatchGetUsers:input_type -> gomicroservice.v1.BatchGetUsersRequest
+	9,  // 28: gomicroservice.v1.UserService.ListUsers:input_type -> gomicroservice.v1.ListUsersRequest
+	11, // 29: gomicroservice.v1.UserService.UpdateUser:input_type -> gomicroservice.v1.UpdateUserRequest
+	13, // 30: gomicroservice.v1.UserService.BatchUpdateUsers:input_type -> gomicroservice.v1.BatchUpdateUsersRequest
+	12, // 31: gomicroservice.v1.UserService.DeleteUser:input_type -> gomicroservice.v1.DeleteUserRequest
+	15, // 32: gomicroservice.v1.UserService.BatchDeleteUsers:input_type -> gomicroservice.v1.BatchDeleteUsersRequest
+	16, // 33: gomicroservice.v1.UserService.ImportUsers:input_type -> gomicroservice.v1.ImportUsersRequest
+	18, // 34: gomicroservice.v1.UserService.PurgeUsers:input_type -> gomicroservice.v1.PurgeUsersRequest
+	21, // 35: gomicroservice.v1.UserService.UndeleteUser:input_type -> gomicroservice.v1.UndeleteUserRequest
+	22, // 36: gomicroservice.v1.UserService.ListUserRevisions:input_type -> gomicroservice.v1.ListUserRevisionsRequest
+	24, // 37: gomicroservice.v1.UserService.RollbackUser:input_type -> gomicroservice.v1.RollbackUserRequest
+	25, // 38: gomicroservice.v1.UserService.WatchUsers:input_type -> gomicroservice.v1.WatchUsersRequest
+	2,  // 39: gomicroservice.v1.UserService.CreateUser:output_type -> gomicroservice.v1.User
+	2,  // 40: gomicroservice.v1.UserService.GetUser:output_type -> gomicroservice.v1.User
+	6,  // 41: gomicroservice.v1.UserService.BatchCreateUsers:output_type -> gomicroservice.v1.BatchCreateUsersResponse
+	8,  // 42: gomicroservice.v1.UserService.BatchGetUsers:output_type -> gomicroservice.v1.BatchGetUsersResponse
+	10, // 43: gomicroservice.v1.UserService.ListUsers:output_type -> gomicroservice.v1.ListUsersResponse
+	2,  // 44: gomicroservice.v1.UserService.UpdateUser:output_type -> gomicroservice.v1.User
+	14, // 45: gomicroservice.v1.UserService.BatchUpdateUsers:output_type -> gomicroservice.v1.BatchUpdateUsersResponse
+	31, // 46: gomicroservice.v1.UserService.DeleteUser:output_type -> google.protobuf.Empty
+	31, // 47: gomicroservice.v1.UserService.BatchDeleteUsers:output_type -> google.protobuf.Empty
+	17, // 48: gomicroservice.v1.UserService.ImportUsers:output_type -> gomicroservice.v1.ImportUsersResponse
+	32, // 49: gomicroservice.v1.UserService.PurgeUsers:output_type -> google.longrunning.Operation
+	2,  // 50: gomicroservice.v1.UserService.UndeleteUser:output_type -> gomicroservice.v1.User
+	23, // 51: gomicroservice.v1.UserService.ListUserRevisions:output_type -> gomicroservice.v1.ListUserRevisionsResponse
+	2,  // 52: gomicroservice.v1.UserService.RollbackUser:output_type -> gomicroservice.v1.User
+	26, // 53: gomicroservice.v1.UserService.WatchUsers:output_type -> gomicroservice.v1.WatchUsersResponse
+	39, // [39:54] is the sub-list for method output_type
+	24, // [24:39] is the sub-list for method input_type
+	24, // [24:24] is the sub-list for extension type_name
+	24, // [24:24] is the sub-list for extension extendee
+	0,  // [0:24] is the sub-list for field type_name
 }
 
 func init() { file_gomicroservice_v1_user_service_proto_init() }
@@ -542,13 +2046,14 @@ func file_gomicroservice_v1_user_service_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gomicroservice_v1_user_service_proto_rawDesc), len(file_gomicroservice_v1_user_service_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   7,
+			NumEnums:      2,
+			NumMessages:   26,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_gomicroservice_v1_user_service_proto_goTypes,
 		DependencyIndexes: file_gomicroservice_v1_user_service_proto_depIdxs,
+		EnumInfos:         file_gomicroservice_v1_user_service_proto_enumTypes,
 		MessageInfos:      file_gomicroservice_v1_user_service_proto_msgTypes,
 	}.Build()
 	File_gomicroservice_v1_user_service_proto = out.File
@@ -1,23 +1,136 @@
 package gomicroservice
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
 	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"go.einride.tech/aip/fieldbehavior"
+	"go.einride.tech/aip/fieldmask"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Domain to Proto conversions.
 func toProtoUser(user *domain.User) *gomicroservicev1.User {
-	return &gomicroservicev1.User{
+	pbUser := &gomicroservicev1.User{
 		Name:        user.Name,
 		DisplayName: user.DisplayName,
 		Email:       user.Email,
 		CreateTime:  timestamppb.New(user.CreateTime),
 		UpdateTime:  timestamppb.New(user.UpdateTime),
+		Etag:        user.Etag,
+
+		RevisionId:         user.RevisionID,
+		RevisionCreateTime: timestamppb.New(user.RevisionCreateTime),
+		RevisionActor:      user.RevisionActor,
+	}
+	// Only soft-deleted users have a delete and purge time
+	if !user.DeleteTime.IsZero() {
+		pbUser.DeleteTime = timestamppb.New(user.DeleteTime)
+		pbUser.PurgeTime = timestamppb.New(user.PurgeTime)
+	}
+	return pbUser
+}
+
+// toProtoRevision converts a revision of a user, which is named after the
+// revision following AIP-162.
+func toProtoRevision(user *domain.User) *gomicroservicev1.User {
+	pbUser := toProtoUser(user)
+	pbUser.Name = user.Name + "@" + user.RevisionID
+	return pbUser
+}
+
+// toProtoUserChange converts a change sent to a watch of users.
+func toProtoUserChange(change domain.UserChange) *gomicroservicev1.WatchUsersResponse {
+	resp := &gomicroservicev1.WatchUsersResponse{
+		ChangeType:  toProtoChangeType(change.Type),
+		ResumeToken: change.ResumeToken,
+	}
+	if change.User != nil {
+		resp.User = toProtoUser(change.User)
+	}
+	return resp
+}
+
+// toProtoOperation converts an operation, packing its metadata and its
+// response or error, following AIP-151.
+func toProtoOperation(op *domain.Operation) (*longrunningpb.Operation, error) {
+	pbOp := &longrunningpb.Operation{Name: op.Name, Done: op.Done}
+	if op.Metadata != nil {
+		metadata, err := anypb.New(toProtoOperationValue(op.Metadata))
+		if err != nil {
+			return nil, err
+		}
+		pbOp.Metadata = metadata
+	}
+	switch {
+	case op.Error != nil:
+		pbOp.Result = &longrunningpb.Operation_Error{Error: status.Convert(toOperationError(op)).Proto()}
+	case op.Done:
+		response, err := anypb.New(toProtoOperationValue(op.Response))
+		if err != nil {
+			return nil, err
+		}
+		pbOp.Result = &longrunningpb.Operation_Response{Response: response}
+	}
+	return pbOp, nil
+}
+
+// toProtoOperationResponse converts an operation to be returned.
+func toProtoOperationResponse(op *domain.Operation) (*longrunningpb.Operation, error) {
+	pbOp, err := toProtoOperation(op)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to convert operation")
+	}
+	return pbOp, nil
+}
+
+// toProtoOperationValue converts the metadata or response of an operation.
+func toProtoOperationValue(value any) proto.Message {
+	switch v := value.(type) {
+	case domain.PurgeUsersMetadata:
+		return &gomicroservicev1.PurgeUsersMetadata{
+			PurgeCount:  int32(v.PurgeCount),  //nolint:gosec // Counts of users fit in int32
+			PurgedCount: int32(v.PurgedCount), //nolint:gosec // Counts of users fit in int32
+		}
+	case domain.PurgeUsersResult:
+		return &gomicroservicev1.PurgeUsersResponse{
+			PurgeCount:  int32(v.PurgeCount), //nolint:gosec // Counts of users fit in int32
+			PurgeSample: v.PurgeSample,
+		}
+	default:
+		return &emptypb.Empty{}
+	}
+}
+
+func toProtoChangeType(changeType domain.UserChangeType) gomicroservicev1.WatchUsersResponse_ChangeType {
+	switch changeType {
+	case domain.UserExisting:
+		return gomicroservicev1.WatchUsersResponse_EXISTING
+	case domain.UserSnapshotComplete:
+		return gomicroservicev1.WatchUsersResponse_SNAPSHOT_COMPLETE
+	case domain.UserChangeCreated:
+		return gomicroservicev1.WatchUsersResponse_CREATED
+	case domain.UserChangeUpdated:
+		return gomicroservicev1.WatchUsersResponse_UPDATED
+	case domain.UserChangeDeleted:
+		return gomicroservicev1.WatchUsersResponse_DELETED
+	default:
+		return gomicroservicev1.WatchUsersResponse_CHANGE_TYPE_UNSPECIFIED
 	}
 }
 
@@ -32,11 +145,96 @@ func toDomainUser(pbUser *gomicroservicev1.User) *domain.User {
 	}
 }
 
+// toDomainRevisionName splits a name of the form users/{user_id}@{revision_id}
+// into the name of the user and the revision ID, which is empty if the name
+// doesn't refer to a revision.
+func toDomainRevisionName(name string) (string, string, error) {
+	userName, revisionID, isRevision := strings.Cut(name, "@")
+	if isRevision && revisionID == "" {
+		return "", "", errors.New("invalid resource name: empty revision ID")
+	}
+	return userName, revisionID, nil
+}
+
+// toDomainReadTime returns the time to read at, which is zero if none is set.
+func toDomainReadTime(readTime *timestamppb.Timestamp) (time.Time, error) {
+	if readTime == nil {
+		return time.Time{}, nil
+	}
+	if err := readTime.CheckValid(); err != nil {
+		return time.Time{}, fmt.Errorf("invalid read_time: %w", err)
+	}
+	return readTime.AsTime(), nil
+}
+
+// toDomainUpdateMask returns the paths to update following AIP-134. Without an
+// update_mask, the populated fields of the user form an implied mask.
+// Unknown paths and paths to output-only or identifier fields are rejected.
+func toDomainUpdateMask(req *gomicroservicev1.UpdateUserRequest) ([]string, error) {
+	mask := req.GetUpdateMask()
+	if len(mask.GetPaths()) == 0 {
+		var paths []string
+		req.GetUser().ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if isUpdatable(fd) {
+				paths = append(paths, string(fd.Name()))
+			}
+			return true
+		})
+		slices.Sort(paths)
+		return paths, nil
+	}
+
+	if err := fieldmask.Validate(mask, &gomicroservicev1.User{}); err != nil {
+		return nil, err
+	}
+	if fieldmask.IsFullReplacement(mask) {
+		return mask.GetPaths(), nil
+	}
+	fields := (&gomicroservicev1.User{}).ProtoReflect().Descriptor().Fields()
+	for _, path := range mask.GetPaths() {
+		name, _, _ := strings.Cut(path, ".")
+		if !isUpdatable(fields.ByName(protoreflect.Name(name))) {
+			return nil, fmt.Errorf("field is not updatable: %s", path)
+		}
+	}
+	return mask.GetPaths(), nil
+}
+
+func isUpdatable(fd protoreflect.FieldDescriptor) bool {
+	return !fieldbehavior.Has(fd, annotations.FieldBehavior_OUTPUT_ONLY) &&
+		!fieldbehavior.Has(fd, annotations.FieldBehavior_IDENTIFIER)
+}
+
+// errorInfoDomain is the domain of the google.rpc.ErrorInfo details returned by this service.
+const errorInfoDomain = "gomicroservice"
+
+// toAlreadyExistsError converts an AlreadyExists error to a gRPC error. If the
+// conflict is on a unique field, an ErrorInfo detail names the field.
+func toAlreadyExistsError(customErr *domain.Error) error {
+	st := status.New(codes.AlreadyExists, customErr.Message)
+	if customErr.Field == "" {
+		return st.Err()
+	}
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   strings.ToUpper(customErr.Field) + "_ALREADY_EXISTS",
+		Domain:   errorInfoDomain,
+		Metadata: map[string]string{"field": customErr.Field},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
 // checkTransientError checks for common transient errors that can occur in any operation.
 // This should be called before checking specific operation errors.
 func checkTransientError(err error) error {
 	var customErr *domain.Error
 	if !errors.As(err, &customErr) {
+		// The caller went away, or its deadline passed
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return status.FromContextError(err).Err()
+		}
 		return nil
 	}
 
@@ -55,7 +253,7 @@ func checkTransientError(err error) error {
 // toCreateUserError converts internal errors to gRPC errors following AIP-133.
 // Valid error codes for Create methods:
 // - InvalidArgument: Client specified invalid/malformed argument.
-// - AlreadyExists: The resource already exists.
+// - AlreadyExists: The resource, or another one with the same email, already exists.
 // - Internal: All other errors are mapped to Internal.
 func toCreateUserError(err error) error {
 	if transientErr := checkTransientError(err); transientErr != nil {
@@ -69,7 +267,7 @@ func toCreateUserError(err error) error {
 
 	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
 	case domain.AlreadyExists:
-		return status.Error(codes.AlreadyExists, customErr.Message)
+		return toAlreadyExistsError(customErr)
 	case domain.InvalidInput:
 		return status.Error(codes.InvalidArgument, customErr.Message)
 	default:
@@ -77,9 +275,18 @@ func toCreateUserError(err error) error {
 	}
 }
 
+// toBatchItemError returns the gRPC error err of the item at index of a batch,
+// with the index in the message.
+func toBatchItemError(index int, err error) error {
+	st := status.Convert(err).Proto()
+	st.Message = fmt.Sprintf("requests[%d]: %s", index, st.GetMessage())
+	return status.ErrorProto(st)
+}
+
 // toGetUserError converts internal errors to gRPC errors following AIP-131.
 // Valid error codes for Get methods:
-// - NotFound: The resource was not found.
+// - NotFound: The resource, or the requested revision of it, was not found.
+// - FailedPrecondition: The read_time is outside the history that is kept.
 // - Internal: All other errors are mapped to Internal.
 func toGetUserError(err error) error {
 	if transientErr := checkTransientError(err); transientErr != nil {
@@ -91,6 +298,30 @@ func toGetUserError(err error) error {
 		return status.Error(codes.Internal, "internal error")
 	}
 
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.NotFound:
+		return status.Error(codes.NotFound, customErr.Message)
+	case domain.FailedPrecondition:
+		return status.Error(codes.FailedPrecondition, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toBatchGetUsersError converts internal errors to gRPC errors following AIP-231.
+// Valid error codes for Batch Get methods:
+// - NotFound: One of the resources was not found.
+// - Internal: All other errors are mapped to Internal.
+func toBatchGetUsersError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
 	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
 	case domain.NotFound:
 		return status.Error(codes.NotFound, customErr.Message)
@@ -102,6 +333,7 @@ func toGetUserError(err error) error {
 // toListUsersError converts internal errors to gRPC errors following AIP-132.
 // Valid error codes for List methods:
 // - InvalidArgument: Client specified invalid argument like invalid page token.
+// - FailedPrecondition: The read_time is outside the history that is kept.
 // - Internal: All other errors are mapped to Internal.
 func toListUsersError(err error) error {
 	if transientErr := checkTransientError(err); transientErr != nil {
@@ -116,6 +348,61 @@ func toListUsersError(err error) error {
 	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
 	case domain.InvalidInput:
 		return status.Error(codes.InvalidArgument, customErr.Message)
+	case domain.FailedPrecondition:
+		return status.Error(codes.FailedPrecondition, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toListUserRevisionsError converts internal errors to gRPC errors following AIP-162.
+// Valid error codes for listing revisions:
+// - InvalidArgument: Client specified invalid argument like invalid page token.
+// - NotFound: No revisions of the resource are kept.
+// - Internal: All other errors are mapped to Internal.
+func toListUserRevisionsError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.InvalidInput:
+		return status.Error(codes.InvalidArgument, customErr.Message)
+	case domain.NotFound:
+		return status.Error(codes.NotFound, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toRollbackUserError converts internal errors to gRPC errors following AIP-162.
+// Valid error codes for Rollback methods:
+// - NotFound: The resource or the revision was not found.
+// - AlreadyExists: The email of the revision has been taken by another resource.
+// - Aborted: The etag doesn't match the current resource.
+// - Internal: All other errors are mapped to Internal.
+func toRollbackUserError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.NotFound:
+		return status.Error(codes.NotFound, customErr.Message)
+	case domain.AlreadyExists:
+		return toAlreadyExistsError(customErr)
+	case domain.Conflict:
+		return status.Error(codes.Aborted, customErr.Message)
 	default:
 		return status.Error(codes.Internal, customErr.Message)
 	}
@@ -125,6 +412,8 @@ func toListUsersError(err error) error {
 // Valid error codes for Update methods:
 // - InvalidArgument: Client specified invalid argument.
 // - NotFound: The resource was not found.
+// - AlreadyExists: The email is taken, or allow_missing was set but the name is taken by a deleted resource.
+// - Aborted: The etag doesn't match the current resource.
 // - Internal: All other errors are mapped to Internal.
 func toUpdateUserError(err error) error {
 	if transientErr := checkTransientError(err); transientErr != nil {
@@ -139,16 +428,38 @@ func toUpdateUserError(err error) error {
 	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
 	case domain.NotFound:
 		return status.Error(codes.NotFound, customErr.Message)
+	case domain.AlreadyExists:
+		return toAlreadyExistsError(customErr)
 	case domain.InvalidInput:
 		return status.Error(codes.InvalidArgument, customErr.Message)
+	case domain.Conflict:
+		return status.Error(codes.Aborted, customErr.Message)
 	default:
 		return status.Error(codes.Internal, customErr.Message)
 	}
 }
 
+// toBatchUpdateUsersError converts internal errors to gRPC errors following
+// AIP-234. The error of a request that couldn't be applied has the code
+// toUpdateUserError gives it, and names the request in its message.
+// Valid error codes for Batch Update methods:
+// - InvalidArgument: A request has an invalid argument.
+// - NotFound: The resource of a request was not found.
+// - AlreadyExists: The email of a request is taken, or allow_missing was set but the name is taken by a deleted resource.
+// - Aborted: The etag of a request doesn't match the current resource.
+// - Internal: All other errors are mapped to Internal.
+func toBatchUpdateUsersError(err error) error {
+	var itemErr *domain.BatchItemError
+	if errors.As(err, &itemErr) {
+		return toBatchItemError(itemErr.Index, toUpdateUserError(itemErr.Err))
+	}
+	return toUpdateUserError(err)
+}
+
 // toDeleteUserError converts internal errors to gRPC errors following AIP-135.
 // Valid error codes for Delete methods:
 // - NotFound: The resource was not found.
+// - Aborted: The etag doesn't match the current resource.
 // - Internal: All other errors are mapped to Internal.
 func toDeleteUserError(err error) error {
 	if transientErr := checkTransientError(err); transientErr != nil {
@@ -163,6 +474,166 @@ func toDeleteUserError(err error) error {
 	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
 	case domain.NotFound:
 		return status.Error(codes.NotFound, customErr.Message)
+	case domain.Conflict:
+		return status.Error(codes.Aborted, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toBatchDeleteUsersError converts internal errors to gRPC errors following
+// AIP-235. The error of a request that couldn't be applied has the code
+// toDeleteUserError gives it, and names the request in its message.
+// Valid error codes for Batch Delete methods:
+// - NotFound: The resource of a request was not found.
+// - Aborted: The etag of a request doesn't match the current resource.
+// - Internal: All other errors are mapped to Internal.
+func toBatchDeleteUsersError(err error) error {
+	var itemErr *domain.BatchItemError
+	if errors.As(err, &itemErr) {
+		return toBatchItemError(itemErr.Index, toDeleteUserError(itemErr.Err))
+	}
+	return toDeleteUserError(err)
+}
+
+// toUndeleteUserError converts internal errors to gRPC errors following AIP-164.
+// Valid error codes for Undelete methods:
+// - NotFound: The resource was never created or has already been purged.
+// - AlreadyExists: The resource is not deleted, or its email has been taken.
+// - Internal: All other errors are mapped to Internal.
+func toUndeleteUserError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.NotFound:
+		return status.Error(codes.NotFound, customErr.Message)
+	case domain.AlreadyExists:
+		return toAlreadyExistsError(customErr)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toImportUsersError converts internal errors that stop an import to gRPC
+// errors. The errors of single rows are converted by toCreateUserError.
+// Valid error codes for ImportUsers:
+// - InvalidArgument: The data can't be read.
+// - Canceled: The client went away before the import was done.
+// - Internal: All other errors are mapped to Internal.
+func toImportUsersError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.InvalidInput:
+		return status.Error(codes.InvalidArgument, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toPurgeUsersError converts internal errors to gRPC errors following AIP-165.
+// Valid error codes for Criteria-based Delete methods:
+// - InvalidArgument: The filter is invalid.
+// - Canceled: The operation was cancelled before it was done.
+// - Internal: All other errors are mapped to Internal.
+func toPurgeUsersError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.InvalidInput:
+		return status.Error(codes.InvalidArgument, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toOperationError converts the error of an operation with the mapper of the
+// method that started it.
+func toOperationError(op *domain.Operation) error {
+	switch op.Metadata.(type) {
+	case domain.PurgeUsersMetadata:
+		return toPurgeUsersError(op.Error)
+	default:
+		return toOperationsError(op.Error)
+	}
+}
+
+// toOperationsError converts internal errors to gRPC errors for the methods
+// of the Operations service, following AIP-151.
+// Valid error codes for Operations methods:
+// - InvalidArgument: Client specified invalid argument like invalid filter.
+// - NotFound: The operation doesn't exist, or has been deleted.
+// - Canceled, DeadlineExceeded: The client went away while waiting.
+// - Internal: All other errors are mapped to Internal.
+func toOperationsError(err error) error {
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.InvalidInput:
+		return status.Error(codes.InvalidArgument, customErr.Message)
+	case domain.NotFound:
+		return status.Error(codes.NotFound, customErr.Message)
+	default:
+		return status.Error(codes.Internal, customErr.Message)
+	}
+}
+
+// toWatchUsersError converts internal errors to gRPC errors for WatchUsers.
+// Valid error codes for watches:
+// - InvalidArgument: The resume token is malformed.
+// - FailedPrecondition: The resume token has expired.
+// - Canceled, DeadlineExceeded: The client went away.
+// - Internal: All other errors are mapped to Internal.
+func toWatchUsersError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if transientErr := checkTransientError(err); transientErr != nil {
+		return transientErr
+	}
+	// Failures to send are already gRPC errors
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var customErr *domain.Error
+	if !errors.As(err, &customErr) {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	switch customErr.Type { //nolint:exhaustive // We only care about these specific errors.
+	case domain.InvalidInput:
+		return status.Error(codes.InvalidArgument, customErr.Message)
+	case domain.FailedPrecondition:
+		return status.Error(codes.FailedPrecondition, customErr.Message)
 	default:
 		return status.Error(codes.Internal, customErr.Message)
 	}
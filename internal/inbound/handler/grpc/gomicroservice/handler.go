@@ -2,29 +2,47 @@ package gomicroservice
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
 
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/bufbuild/protovalidate-go"
 	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
 	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
 	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
 	"go.einride.tech/aip/fieldbehavior"
+	"go.einride.tech/aip/fieldmask"
 	"go.einride.tech/aip/resourceid"
 	"google.golang.org/genproto/googleapis/api/annotations"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
+// CreatedHeader is the response header set by UpdateUser when allow_missing
+// caused the user to be created.
+const CreatedHeader = "x-created"
+
 type GRPCHandler struct {
 	gomicroservicev1.UnimplementedUserServiceServer
 	userService port.UserService
 	validator   protovalidate.Validator
+	batchLimit  int
 }
 
-func NewGRPCHandler(userService port.UserService, validator protovalidate.Validator) *GRPCHandler {
+// NewGRPCHandler returns a handler whose batch methods take up to batchLimit
+// users.
+func NewGRPCHandler(userService port.UserService, validator protovalidate.Validator, batchLimit int) *GRPCHandler {
 	return &GRPCHandler{
 		userService: userService,
 		validator:   validator,
+		batchLimit:  batchLimit,
 	}
 }
 
@@ -33,7 +51,25 @@ func (h *GRPCHandler) CreateUser(
 	ctx context.Context,
 	req *gomicroservicev1.CreateUserRequest,
 ) (*gomicroservicev1.User, error) {
-	// Validate the request
+	// Validate and convert the request
+	user, err := h.toDomainCreateUser(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create
+	createdUser, err := h.userService.CreateUser(ctx, user)
+	if err != nil {
+		return nil, toCreateUserError(err)
+	}
+
+	// Convert and return
+	return toProtoUser(createdUser), nil
+}
+
+// toDomainCreateUser validates a CreateUser request, and converts it to the
+// user to create. Errors are gRPC errors.
+func (h *GRPCHandler) toDomainCreateUser(req *gomicroservicev1.CreateUserRequest) (*domain.User, error) {
 	if err := h.validator.Validate(req); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -42,7 +78,6 @@ func (h *GRPCHandler) CreateUser(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	// Convert
 	user := &domain.User{
 		DisplayName: req.GetUser().GetDisplayName(),
 		Email:       req.GetUser().GetEmail(),
@@ -58,15 +93,64 @@ func (h *GRPCHandler) CreateUser(
 		// Generate a new name using the proper format
 		user.Name = "users/" + resourceid.NewSystemGeneratedBase32()
 	}
+	return user, nil
+}
+
+// BatchCreateUsers implements AIP-233.
+func (h *GRPCHandler) BatchCreateUsers(
+	ctx context.Context,
+	req *gomicroservicev1.BatchCreateUsersRequest,
+) (*gomicroservicev1.BatchCreateUsersResponse, error) {
+	// Validate the request. The requests are validated one by one, so that
+	// with best_effort an invalid request only fails itself.
+	if len(req.GetRequests()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: requests")
+	}
+	if err := h.validateBatchSize(len(req.GetRequests())); err != nil {
+		return nil, err
+	}
+	statuses := make([]*spb.Status, len(req.GetRequests()))
+	users := make([]*domain.User, 0, len(req.GetRequests()))
+	indexes := make([]int, 0, len(req.GetRequests())) // The request of each user.
+	for i, itemReq := range req.GetRequests() {
+		user, err := h.toDomainCreateUser(itemReq)
+		if err != nil {
+			if !req.GetBestEffort() {
+				return nil, toBatchItemError(i, err)
+			}
+			statuses[i] = status.Convert(err).Proto()
+			continue
+		}
+		users = append(users, user)
+		indexes = append(indexes, i)
+	}
 
 	// Create
-	createdUser, err := h.userService.CreateUser(ctx, user)
+	created, errs, err := h.userService.BatchCreateUsers(ctx, users, domain.BatchCreateUsersParams{
+		Atomic: !req.GetBestEffort(),
+	})
 	if err != nil {
+		var itemErr *domain.BatchItemError
+		if errors.As(err, &itemErr) {
+			return nil, toBatchItemError(indexes[itemErr.Index], toCreateUserError(itemErr.Err))
+		}
 		return nil, toCreateUserError(err)
 	}
 
 	// Convert and return
-	return toProtoUser(createdUser), nil
+	resp := &gomicroservicev1.BatchCreateUsersResponse{}
+	for j, user := range created {
+		if errs[j] != nil {
+			statuses[indexes[j]] = status.Convert(toCreateUserError(errs[j])).Proto()
+			continue
+		}
+		resp.Users = append(resp.Users, toProtoUser(user))
+		statuses[indexes[j]] = status.New(codes.OK, "").Proto()
+	}
+	if req.GetBestEffort() {
+		resp.Statuses = statuses
+	}
+	return resp, nil
 }
 
 // GetUser implements AIP-131.
@@ -81,24 +165,93 @@ func (h *GRPCHandler) GetUser(
 	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	name, revisionID, err := toDomainRevisionName(req.GetName())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	var resourceName gomicroservicev1.UserResourceName
-	if err := resourceName.UnmarshalString(req.GetName()); err != nil {
+	if err := resourceName.UnmarshalString(name); err != nil {
 		return nil, status.Error(codes.InvalidArgument, "invalid resource name")
 	}
 	if resourceName.ContainsWildcard() {
 		return nil, status.Error(codes.InvalidArgument, "wildcard not allowed")
 	}
 
+	readTime, err := toDomainReadTime(req.GetReadTime())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if revisionID != "" && !readTime.IsZero() {
+		return nil, status.Error(codes.InvalidArgument, "read_time can't be combined with a revision")
+	}
+
 	// Get
-	user, err := h.userService.GetUser(ctx, req.GetName())
+	user, err := h.userService.GetUser(ctx, name, domain.GetUserParams{
+		ShowDeleted: req.GetShowDeleted(),
+		ReadTime:    readTime,
+		RevisionID:  revisionID,
+	})
 	if err != nil {
 		return nil, toGetUserError(err)
 	}
 
 	// Convert and return
+	if revisionID != "" {
+		return toProtoRevision(user), nil
+	}
 	return toProtoUser(user), nil
 }
 
+// BatchGetUsers implements AIP-231.
+func (h *GRPCHandler) BatchGetUsers(
+	ctx context.Context,
+	req *gomicroservicev1.BatchGetUsersRequest,
+) (*gomicroservicev1.BatchGetUsersResponse, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := h.validateBatchSize(len(req.GetNames())); err != nil {
+		return nil, err
+	}
+	for i, name := range req.GetNames() {
+		var resourceName gomicroservicev1.UserResourceName
+		if err := resourceName.UnmarshalString(name); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "names[%d]: invalid resource name", i)
+		}
+		if resourceName.ContainsWildcard() {
+			return nil, status.Errorf(codes.InvalidArgument, "names[%d]: wildcard not allowed", i)
+		}
+	}
+
+	// Get
+	users, err := h.userService.BatchGetUsers(ctx, req.GetNames(), domain.BatchGetUsersParams{
+		SkipMissing: req.GetSkipMissing(),
+	})
+	if err != nil {
+		return nil, toBatchGetUsersError(err)
+	}
+
+	// Convert and return
+	protoUsers := make([]*gomicroservicev1.User, len(users))
+	for i, user := range users {
+		protoUsers[i] = toProtoUser(user)
+	}
+	return &gomicroservicev1.BatchGetUsersResponse{Users: protoUsers}, nil
+}
+
+// validateBatchSize returns an InvalidArgument error if a batch holds more
+// users than the limit.
+func (h *GRPCHandler) validateBatchSize(size int) error {
+	if size > h.batchLimit {
+		return status.Errorf(codes.InvalidArgument, "at most %d users can be handled at once, got %d", h.batchLimit, size)
+	}
+	return nil
+}
+
 // ListUsers implements AIP-132.
 func (h *GRPCHandler) ListUsers(
 	ctx context.Context,
@@ -111,13 +264,31 @@ func (h *GRPCHandler) ListUsers(
 	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	if _, err := query.ParseUserFilter(req.GetFilter()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid filter: "+err.Error())
+	}
+	if _, err := query.ParseUserOrderBy(req.GetOrderBy()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid order_by: "+err.Error())
+	}
+	readTime, err := toDomainReadTime(req.GetReadTime())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	// List
 	pageSize := int32(10) //nolint:mnd // Default page size
 	if req.GetPageSize() > 0 {
 		pageSize = req.GetPageSize()
 	}
-	users, nextPageToken, err := h.userService.ListUsers(ctx, pageSize, req.GetPageToken())
+	users, nextPageToken, err := h.userService.ListUsers(ctx, domain.ListUsersParams{
+		PageSize:  pageSize,
+		PageToken: req.GetPageToken(),
+		Filter:    req.GetFilter(),
+		OrderBy:   req.GetOrderBy(),
+
+		ShowDeleted: req.GetShowDeleted(),
+		ReadTime:    readTime,
+	})
 	if err != nil {
 		return nil, toListUsersError(err)
 	}
@@ -138,30 +309,126 @@ func (h *GRPCHandler) UpdateUser(
 	ctx context.Context,
 	req *gomicroservicev1.UpdateUserRequest,
 ) (*gomicroservicev1.User, error) {
-	// Validate the request
-	if err := h.validator.Validate(req); err != nil {
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+	// Validate and convert the request
+	update, err := h.toDomainUserUpdate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update
+	updatedUser, created, err := h.userService.UpdateUser(ctx, update.User, update.Params)
+	if err != nil {
+		return nil, toUpdateUserError(err)
+	}
+	if created {
+		// SetHeader only fails outside of a gRPC call, such as in tests
+		_ = grpc.SetHeader(ctx, metadata.Pairs(CreatedHeader, "true"))
 	}
+
+	// Convert and return
+	return toProtoUser(updatedUser), nil
+}
+
+// toDomainUserUpdate validates an UpdateUser request, and converts it to the
+// update to apply. Errors are gRPC errors.
+func (h *GRPCHandler) toDomainUserUpdate(req *gomicroservicev1.UpdateUserRequest) (domain.UserUpdate, error) {
 	fieldbehavior.ClearFields(req, annotations.FieldBehavior_OUTPUT_ONLY)
-	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+	updateMask, err := toDomainUpdateMask(req)
+	if err != nil {
+		return domain.UserUpdate{}, status.Error(codes.InvalidArgument, "invalid update_mask: "+err.Error())
+	}
+	if err := h.validateWithMask(req, updateMask); err != nil {
+		return domain.UserUpdate{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := fieldbehavior.ValidateRequiredFieldsWithMask(
+		req.GetUser(),
+		&fieldmaskpb.FieldMask{Paths: updateMask},
+	); err != nil {
+		return domain.UserUpdate{}, status.Error(codes.InvalidArgument, err.Error())
 	}
 	var resourceName gomicroservicev1.UserResourceName
 	if err := resourceName.UnmarshalString(req.GetUser().GetName()); err != nil {
-		return nil, status.Error(codes.InvalidArgument, "invalid resource name")
+		return domain.UserUpdate{}, status.Error(codes.InvalidArgument, "invalid resource name")
+	}
+	if req.GetAllowMissing() {
+		// The name may be used to create the user, so it must be a valid ID
+		if resourceName.ContainsWildcard() {
+			return domain.UserUpdate{}, status.Error(codes.InvalidArgument, "wildcard not allowed")
+		}
+		if err := resourceid.ValidateUserSettable(resourceName.User); err != nil {
+			return domain.UserUpdate{}, status.Error(codes.InvalidArgument, err.Error())
+		}
 	}
 
-	// Convert
-	user := toDomainUser(req.GetUser())
+	return domain.UserUpdate{
+		User: toDomainUser(req.GetUser()),
+		Params: domain.UpdateUserParams{
+			UpdateMask:   updateMask,
+			AllowMissing: req.GetAllowMissing(),
+			Etag:         req.GetEtag(),
+		},
+	}, nil
+}
+
+// BatchUpdateUsers implements AIP-234.
+func (h *GRPCHandler) BatchUpdateUsers(
+	ctx context.Context,
+	req *gomicroservicev1.BatchUpdateUsersRequest,
+) (*gomicroservicev1.BatchUpdateUsersResponse, error) {
+	// Validate and convert the request. The requests are validated one by
+	// one, so that errors name the request they are about.
+	if len(req.GetRequests()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: requests")
+	}
+	if err := h.validateBatchSize(len(req.GetRequests())); err != nil {
+		return nil, err
+	}
+	updates := make([]domain.UserUpdate, len(req.GetRequests()))
+	for i, itemReq := range req.GetRequests() {
+		update, err := h.toDomainUserUpdate(itemReq)
+		if err != nil {
+			return nil, toBatchItemError(i, err)
+		}
+		updates[i] = update
+	}
 
 	// Update
-	updatedUser, err := h.userService.UpdateUser(ctx, user)
+	users, err := h.userService.BatchUpdateUsers(ctx, updates)
 	if err != nil {
-		return nil, toUpdateUserError(err)
+		return nil, toBatchUpdateUsersError(err)
 	}
 
 	// Convert and return
-	return toProtoUser(updatedUser), nil
+	protoUsers := make([]*gomicroservicev1.User, len(users))
+	for i, user := range users {
+		protoUsers[i] = toProtoUser(user)
+	}
+	return &gomicroservicev1.BatchUpdateUsersResponse{Users: protoUsers}, nil
+}
+
+// validateWithMask validates an update request, ignoring violations on user
+// fields that are not in the update mask and therefore won't be written.
+func (h *GRPCHandler) validateWithMask(req *gomicroservicev1.UpdateUserRequest, updateMask []string) error {
+	err := h.validator.Validate(req)
+	var validationErr *protovalidate.ValidationError
+	if !errors.As(err, &validationErr) || slices.Contains(updateMask, fieldmask.WildcardPath) {
+		return err
+	}
+	violations := make([]*protovalidate.Violation, 0, len(validationErr.Violations))
+	for _, violation := range validationErr.Violations {
+		path := protovalidate.FieldPathString(violation.Proto.GetField())
+		if field, ok := strings.CutPrefix(path, "user."); ok {
+			name, _, _ := strings.Cut(field, ".")
+			if !slices.Contains(updateMask, name) {
+				continue
+			}
+		}
+		violations = append(violations, violation)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &protovalidate.ValidationError{Violations: violations}
 }
 
 // DeleteUser implements AIP-135.
@@ -169,11 +436,85 @@ func (h *GRPCHandler) DeleteUser(
 	ctx context.Context,
 	req *gomicroservicev1.DeleteUserRequest,
 ) (*emptypb.Empty, error) {
+	// Validate and convert the request
+	deletion, err := h.toDomainUserDeletion(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete
+	if err := h.userService.DeleteUser(ctx, deletion.Name, deletion.Params); err != nil {
+		return nil, toDeleteUserError(err)
+	}
+
+	// Return
+	return &emptypb.Empty{}, nil
+}
+
+// toDomainUserDeletion validates a DeleteUser request, and converts it to the
+// deletion to apply. Errors are gRPC errors.
+func (h *GRPCHandler) toDomainUserDeletion(req *gomicroservicev1.DeleteUserRequest) (domain.UserDeletion, error) {
+	if err := h.validator.Validate(req); err != nil {
+		return domain.UserDeletion{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	fieldbehavior.ClearFields(req, annotations.FieldBehavior_OUTPUT_ONLY)
+	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
+		return domain.UserDeletion{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var resourceName gomicroservicev1.UserResourceName
+	if err := resourceName.UnmarshalString(req.GetName()); err != nil {
+		return domain.UserDeletion{}, status.Error(codes.InvalidArgument, "invalid resource name")
+	}
+	if resourceName.ContainsWildcard() {
+		return domain.UserDeletion{}, status.Error(codes.InvalidArgument, "wildcard not allowed")
+	}
+
+	return domain.UserDeletion{
+		Name:   req.GetName(),
+		Params: domain.DeleteUserParams{Etag: req.GetEtag()},
+	}, nil
+}
+
+// BatchDeleteUsers implements AIP-235.
+func (h *GRPCHandler) BatchDeleteUsers(
+	ctx context.Context,
+	req *gomicroservicev1.BatchDeleteUsersRequest,
+) (*emptypb.Empty, error) {
+	// Validate and convert the request. The requests are validated one by
+	// one, so that errors name the request they are about.
+	if len(req.GetRequests()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: requests")
+	}
+	if err := h.validateBatchSize(len(req.GetRequests())); err != nil {
+		return nil, err
+	}
+	deletions := make([]domain.UserDeletion, len(req.GetRequests()))
+	for i, itemReq := range req.GetRequests() {
+		deletion, err := h.toDomainUserDeletion(itemReq)
+		if err != nil {
+			return nil, toBatchItemError(i, err)
+		}
+		deletions[i] = deletion
+	}
+
+	// Delete
+	if err := h.userService.BatchDeleteUsers(ctx, deletions); err != nil {
+		return nil, toBatchDeleteUsersError(err)
+	}
+
+	// Return
+	return &emptypb.Empty{}, nil
+}
+
+// UndeleteUser implements AIP-164.
+func (h *GRPCHandler) UndeleteUser(
+	ctx context.Context,
+	req *gomicroservicev1.UndeleteUserRequest,
+) (*gomicroservicev1.User, error) {
 	// Validate the request
 	if err := h.validator.Validate(req); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	fieldbehavior.ClearFields(req, annotations.FieldBehavior_OUTPUT_ONLY)
 	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -185,11 +526,141 @@ func (h *GRPCHandler) DeleteUser(
 		return nil, status.Error(codes.InvalidArgument, "wildcard not allowed")
 	}
 
-	// Delete
-	if err := h.userService.DeleteUser(ctx, req.GetName()); err != nil {
-		return nil, toDeleteUserError(err)
+	// Undelete
+	user, err := h.userService.UndeleteUser(ctx, req.GetName())
+	if err != nil {
+		return nil, toUndeleteUserError(err)
 	}
 
-	// Return
-	return &emptypb.Empty{}, nil
+	// Convert and return
+	return toProtoUser(user), nil
+}
+
+// PurgeUsers implements AIP-165.
+func (h *GRPCHandler) PurgeUsers(
+	ctx context.Context,
+	req *gomicroservicev1.PurgeUsersRequest,
+) (*longrunningpb.Operation, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := query.ParseUserFilter(req.GetFilter()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid filter: "+err.Error())
+	}
+
+	// Purge
+	op, err := h.userService.PurgeUsers(ctx, domain.PurgeUsersParams{
+		Filter: req.GetFilter(),
+		Force:  req.GetForce(),
+	})
+	if err != nil {
+		return nil, toPurgeUsersError(err)
+	}
+
+	// Convert and return
+	return toProtoOperationResponse(op)
+}
+
+// ListUserRevisions implements AIP-162.
+func (h *GRPCHandler) ListUserRevisions(
+	ctx context.Context,
+	req *gomicroservicev1.ListUserRevisionsRequest,
+) (*gomicroservicev1.ListUserRevisionsResponse, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateUserName(req.GetName()); err != nil {
+		return nil, err
+	}
+
+	// List
+	pageSize := int32(10) //nolint:mnd // Default page size
+	if req.GetPageSize() > 0 {
+		pageSize = req.GetPageSize()
+	}
+	revisions, nextPageToken, err := h.userService.ListUserRevisions(ctx, req.GetName(), domain.ListUserRevisionsParams{
+		PageSize:  pageSize,
+		PageToken: req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, toListUserRevisionsError(err)
+	}
+
+	// Convert and return
+	protoRevisions := make([]*gomicroservicev1.User, len(revisions))
+	for i, revision := range revisions {
+		protoRevisions[i] = toProtoRevision(revision)
+	}
+	return &gomicroservicev1.ListUserRevisionsResponse{
+		Users:         protoRevisions,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// RollbackUser implements AIP-162.
+func (h *GRPCHandler) RollbackUser(
+	ctx context.Context,
+	req *gomicroservicev1.RollbackUserRequest,
+) (*gomicroservicev1.User, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := fieldbehavior.ValidateRequiredFields(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateUserName(req.GetName()); err != nil {
+		return nil, err
+	}
+
+	// Roll back
+	user, err := h.userService.RollbackUser(ctx, req.GetName(), domain.RollbackUserParams{
+		RevisionID: req.GetRevisionId(),
+		Etag:       req.GetEtag(),
+	})
+	if err != nil {
+		return nil, toRollbackUserError(err)
+	}
+
+	// Convert and return
+	return toProtoUser(user), nil
+}
+
+// WatchUsers streams a snapshot of the users followed by their changes.
+func (h *GRPCHandler) WatchUsers(
+	req *gomicroservicev1.WatchUsersRequest,
+	stream grpc.ServerStreamingServer[gomicroservicev1.WatchUsersResponse],
+) error {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Watch until the client goes away
+	params := domain.WatchUsersParams{ResumeToken: req.GetResumeToken()}
+	err := h.userService.WatchUsers(stream.Context(), params, func(change domain.UserChange) error {
+		return stream.Send(toProtoUserChange(change))
+	})
+	return toWatchUsersError(err)
+}
+
+// validateUserName returns an InvalidArgument error unless name is the name
+// of a single user, rather than a wildcard or a revision.
+func validateUserName(name string) error {
+	var resourceName gomicroservicev1.UserResourceName
+	if err := resourceName.UnmarshalString(name); err != nil || strings.Contains(name, "@") {
+		return status.Error(codes.InvalidArgument, "invalid resource name")
+	}
+	if resourceName.ContainsWildcard() {
+		return status.Error(codes.InvalidArgument, "wildcard not allowed")
+	}
+	return nil
 }
@@ -0,0 +1,364 @@
+package gomicroservice
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// importErrorLimit is how many row errors an ImportUsers response lists.
+const importErrorLimit = 100
+
+// maxImportLineSize is how long a line of NDJSON data can be.
+const maxImportLineSize = 1 << 20
+
+// csvColumns are the columns that CSV data can have, named after the fields
+// of a user.
+var csvColumns = []string{"name", "display_name", "email"}
+
+// ImportUsers creates users from CSV or NDJSON data, streamed in chunks.
+func (h *GRPCHandler) ImportUsers(
+	stream grpc.ClientStreamingServer[gomicroservicev1.ImportUsersRequest, gomicroservicev1.ImportUsersResponse],
+) error {
+	// Validate the first request, which holds the options of the import
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return status.Error(codes.InvalidArgument, "missing required field: format")
+	}
+	if err != nil {
+		return err
+	}
+	if err := h.validator.Validate(first); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	rows, err := newImportRows(first.GetFormat(), &importData{stream: stream, chunk: first.GetData()})
+	if err != nil {
+		return err
+	}
+
+	// Import the rows in batches
+	imp := &userImport{
+		handler: h,
+		params:  domain.ImportUsersParams{ValidateOnly: first.GetValidateOnly()},
+		names:   make(map[string]int),
+		emails:  make(map[string]int),
+		resp:    &gomicroservicev1.ImportUsersResponse{},
+	}
+	for {
+		row, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := imp.add(stream.Context(), row); err != nil {
+			return err
+		}
+		if len(imp.rows) == h.batchLimit {
+			if err := imp.flush(stream.Context()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := imp.flush(stream.Context()); err != nil {
+		return err
+	}
+	return stream.SendAndClose(imp.resp)
+}
+
+// importData reads the chunks of data of an ImportUsers stream.
+type importData struct {
+	stream grpc.ClientStreamingServer[gomicroservicev1.ImportUsersRequest, gomicroservicev1.ImportUsersResponse]
+	chunk  []byte // What is left of the last chunk received.
+}
+
+func (d *importData) Read(p []byte) (int, error) {
+	for len(d.chunk) == 0 {
+		req, err := d.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		d.chunk = req.GetData()
+	}
+	n := copy(p, d.chunk)
+	d.chunk = d.chunk[n:]
+	return n, nil
+}
+
+// importRow is a row of imported data.
+type importRow struct {
+	line int // The line the row starts on.
+	user *gomicroservicev1.User
+	err  error // Why the row isn't a user, if it isn't.
+}
+
+type importRows interface {
+	// next returns the next row, or io.EOF after the last one. Other errors
+	// stop the import.
+	next() (importRow, error)
+}
+
+func newImportRows(format gomicroservicev1.ImportUsersRequest_Format, r io.Reader) (importRows, error) {
+	switch format {
+	case gomicroservicev1.ImportUsersRequest_CSV:
+		reader := csv.NewReader(r)
+		reader.ReuseRecord = true
+		return &csvRows{reader: reader}, nil
+	case gomicroservicev1.ImportUsersRequest_NDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxImportLineSize)
+		return &ndjsonRows{scanner: scanner}, nil
+	default:
+		return nil, status.Error(codes.InvalidArgument, "missing required field: format")
+	}
+}
+
+// csvRows reads the rows of CSV data.
+type csvRows struct {
+	reader  *csv.Reader
+	columns []string // The field of each column, read from the header.
+}
+
+func (r *csvRows) next() (importRow, error) {
+	if r.columns == nil {
+		if err := r.readHeader(); err != nil {
+			return importRow{}, err
+		}
+	}
+	record, err := r.reader.Read()
+	if errors.Is(err, csv.ErrFieldCount) {
+		line, _ := r.reader.FieldPos(0)
+		return importRow{
+			line: line,
+			err:  status.Errorf(codes.InvalidArgument, "got %d columns, want %d", len(record), len(r.columns)),
+		}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+	line, _ := r.reader.FieldPos(0)
+	user := &gomicroservicev1.User{}
+	for i, column := range r.columns {
+		switch column {
+		case "name":
+			user.Name = record[i]
+		case "display_name":
+			user.DisplayName = record[i]
+		case "email":
+			user.Email = record[i]
+		}
+	}
+	return importRow{line: line, user: user}, nil
+}
+
+// readHeader reads the columns of the data from its first row.
+func (r *csvRows) readHeader() error {
+	header, err := r.reader.Read()
+	if err != nil {
+		return err
+	}
+	// Spreadsheets may start the data with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns := make([]string, 0, len(header))
+	for _, column := range header {
+		column = strings.TrimSpace(column)
+		if !slices.Contains(csvColumns, column) {
+			return status.Errorf(codes.InvalidArgument, "unknown column: %q", column)
+		}
+		if slices.Contains(columns, column) {
+			return status.Errorf(codes.InvalidArgument, "duplicate column: %q", column)
+		}
+		columns = append(columns, column)
+	}
+	for _, column := range []string{"display_name", "email"} {
+		if !slices.Contains(columns, column) {
+			return status.Errorf(codes.InvalidArgument, "missing required column: %s", column)
+		}
+	}
+	r.columns = columns
+	return nil
+}
+
+// ndjsonRows reads the rows of NDJSON data, skipping blank lines.
+type ndjsonRows struct {
+	scanner *bufio.Scanner
+	line    int // The line last read.
+}
+
+func (r *ndjsonRows) next() (importRow, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		user := &gomicroservicev1.User{}
+		if err := protojson.Unmarshal(data, user); err != nil {
+			return importRow{line: r.line, err: status.Errorf(codes.InvalidArgument, "invalid JSON: %v", err)}, nil
+		}
+		return importRow{line: r.line, user: user}, nil
+	}
+	if errors.Is(r.scanner.Err(), bufio.ErrTooLong) {
+		return importRow{}, status.Errorf(codes.InvalidArgument,
+			"line %d is longer than %d bytes", r.line+1, maxImportLineSize)
+	}
+	if err := r.scanner.Err(); err != nil {
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
+
+// userImport collects the rows of an import into batches, and tallies the
+// results.
+type userImport struct {
+	handler *GRPCHandler
+	params  domain.ImportUsersParams
+	rows    []importedRow  // The batch of rows to import next.
+	names   map[string]int // The line of every name imported so far or in the batch.
+	emails  map[string]int // The line of every email imported so far or in the batch, in lower case.
+	resp    *gomicroservicev1.ImportUsersResponse
+}
+
+// importedRow is a row of a batch, with its user or why it failed.
+type importedRow struct {
+	line int
+	user *domain.User
+	err  error
+}
+
+// add validates a row, and adds it to the batch. A row with the name or
+// email of a row in the batch waits for the batch to be imported first, as
+// they only conflict if that row is imported.
+func (i *userImport) add(ctx context.Context, row importRow) error {
+	i.resp.RowCount++
+	user, err := i.toDomainUser(row)
+	if err == nil && i.conflictsWithBatch(user) {
+		if err := i.flush(ctx); err != nil {
+			return err
+		}
+	}
+	if err == nil {
+		err = i.reserve(user, row.line)
+	}
+	i.rows = append(i.rows, importedRow{line: row.line, user: user, err: err})
+	return nil
+}
+
+// toDomainUser validates a row like a CreateUser request.
+func (i *userImport) toDomainUser(row importRow) (*domain.User, error) {
+	if row.err != nil {
+		return nil, row.err
+	}
+	req := &gomicroservicev1.CreateUserRequest{User: row.user}
+	if name := row.user.GetName(); name != "" {
+		if err := validateUserName(name); err != nil {
+			return nil, err
+		}
+		var resourceName gomicroservicev1.UserResourceName
+		_ = resourceName.UnmarshalString(name)
+		req.UserId = resourceName.User
+	}
+	return i.handler.toDomainCreateUser(req)
+}
+
+// conflictsWithBatch reports whether a row in the batch has the name or
+// email of user.
+func (i *userImport) conflictsWithBatch(user *domain.User) bool {
+	if len(i.rows) == 0 {
+		return false
+	}
+	// The rows of the batch come after the rows imported before it
+	first := i.rows[0].line
+	if line, exists := i.names[user.Name]; exists && line >= first {
+		return true
+	}
+	line, exists := i.emails[strings.ToLower(user.Email)]
+	return exists && line >= first
+}
+
+// reserve checks that no earlier row has the name or email of user, and
+// holds them for the row on line.
+func (i *userImport) reserve(user *domain.User, line int) error {
+	if taken, exists := i.names[user.Name]; exists {
+		return status.Errorf(codes.AlreadyExists, "user already exists: %s, on line %d", user.Name, taken)
+	}
+	email := strings.ToLower(user.Email)
+	if taken, exists := i.emails[email]; exists {
+		return status.Errorf(codes.AlreadyExists, "email is already in use, on line %d", taken)
+	}
+	i.names[user.Name] = line
+	i.emails[email] = line
+	return nil
+}
+
+// release frees the name and email of a row that failed to import, for the
+// rows after it.
+func (i *userImport) release(row importedRow) {
+	if i.names[row.user.Name] == row.line {
+		delete(i.names, row.user.Name)
+	}
+	email := strings.ToLower(row.user.Email)
+	if i.emails[email] == row.line {
+		delete(i.emails, email)
+	}
+}
+
+// flush imports the users of the batch, and tallies the rows in order.
+func (i *userImport) flush(ctx context.Context) error {
+	users := make([]*domain.User, 0, len(i.rows))
+	for _, row := range i.rows {
+		if row.err == nil {
+			users = append(users, row.user)
+		}
+	}
+	var errs []error
+	if len(users) > 0 {
+		var err error
+		if errs, err = i.handler.userService.ImportUsers(ctx, users, i.params); err != nil {
+			return toImportUsersError(err)
+		}
+	}
+	for _, row := range i.rows {
+		if row.err == nil {
+			if row.err, errs = errs[0], errs[1:]; row.err != nil {
+				i.release(row)
+				row.err = toCreateUserError(row.err)
+			}
+		}
+		if row.err != nil {
+			i.fail(row.line, row.err)
+			continue
+		}
+		i.resp.ImportedCount++
+	}
+	i.rows = i.rows[:0]
+	return nil
+}
+
+// fail counts a row that couldn't be imported, and lists its error unless
+// enough errors are listed already.
+func (i *userImport) fail(line int, err error) {
+	i.resp.FailedCount++
+	if len(i.resp.GetErrors()) < importErrorLimit {
+		i.resp.Errors = append(i.resp.Errors, &gomicroservicev1.ImportUsersResponse_RowError{
+			Line:   int32(line), //nolint:gosec // Line numbers fit in int32
+			Status: status.Convert(err).Proto(),
+		})
+	}
+}
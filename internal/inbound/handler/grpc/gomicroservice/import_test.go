@@ -0,0 +1,395 @@
+package gomicroservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/protovalidate-go"
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+// importStream is an ImportUsers stream that receives data in the given
+// chunks, and then err, or io.EOF if err is nil.
+type importStream struct {
+	grpc.ClientStreamingServer[gomicroservicev1.ImportUsersRequest, gomicroservicev1.ImportUsersResponse]
+	chunks []string
+	err    error
+}
+
+func (s *importStream) Recv() (*gomicroservicev1.ImportUsersRequest, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	req := &gomicroservicev1.ImportUsersRequest{Data: []byte(s.chunks[0])}
+	s.chunks = s.chunks[1:]
+	return req, nil
+}
+
+// wantRow is a row that an importRows should read: a user with the display
+// name, or an error with the message. Only the start of messages is kept, up
+// to any colon, as the rest may come from other packages.
+type wantRow struct {
+	line        int
+	displayName string
+	err         string
+}
+
+// readRows reads rows until io.EOF, and returns them along with the error
+// that stopped them, if any.
+func readRows(t *testing.T, rows importRows) ([]wantRow, error) {
+	t.Helper()
+	var got []wantRow
+	for {
+		row, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		if row.err != nil {
+			message, _, _ := strings.Cut(status.Convert(row.err).Message(), ":")
+			got = append(got, wantRow{line: row.line, err: message})
+			continue
+		}
+		got = append(got, wantRow{line: row.line, displayName: row.user.GetDisplayName()})
+	}
+}
+
+func TestCSVRows(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name    string
+		data    string
+		want    []wantRow
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "rows",
+			data: "name,display_name,email\nusers/ada,Ada,ada@example.com\nusers/alan,Alan,alan@example.com\n",
+			want: []wantRow{{line: 2, displayName: "Ada"}, {line: 3, displayName: "Alan"}},
+		},
+		{
+			name: "header with a byte order mark and spaces",
+			data: "\ufeffemail , display_name\r\nada@example.com,Ada\r\n",
+			want: []wantRow{{line: 2, displayName: "Ada"}},
+		},
+		{
+			name: "quoted field over several lines",
+			data: "display_name,email\n\"Ada\nLovelace\",ada@example.com\nAlan,alan@example.com",
+			want: []wantRow{{line: 2, displayName: "Ada\nLovelace"}, {line: 4, displayName: "Alan"}},
+		},
+		{
+			name: "row with the wrong number of columns",
+			data: "display_name,email\nAda\nAlan,alan@example.com,extra\nGrace,grace@example.com\n",
+			want: []wantRow{
+				{line: 2, err: "got 1 columns, want 2"},
+				{line: 3, err: "got 3 columns, want 2"},
+				{line: 4, displayName: "Grace"},
+			},
+		},
+		{
+			name:    "unknown column",
+			data:    "display_name,email,phone\n",
+			wantErr: `unknown column: "phone"`,
+		},
+		{
+			name:    "duplicate column",
+			data:    "display_name,email,email\n",
+			wantErr: `duplicate column: "email"`,
+		},
+		{
+			name:    "missing required column",
+			data:    "name,display_name\n",
+			wantErr: "missing required column: email",
+		},
+		{
+			name:    "malformed quotes",
+			data:    "display_name,email\n\"Ada\"x,ada@example.com\n",
+			wantErr: "extraneous or missing \" in quoted-field",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rows, err := newImportRows(gomicroservicev1.ImportUsersRequest_CSV, strings.NewReader(tt.data))
+			assert.NilError(t, err)
+			got, err := readRows(t, rows)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.DeepEqual(t, got, tt.want, cmp.AllowUnexported(wantRow{}))
+		})
+	}
+}
+
+func TestNDJSONRows(t *testing.T) {
+	t.Parallel()
+
+	tooLong := `{"displayName":"` + strings.Repeat("a", maxImportLineSize) + `"}`
+	for _, tt := range []struct {
+		name    string
+		data    string
+		want    []wantRow
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "rows without a final newline",
+			data: `{"displayName":"Ada"}` + "\n" + `{"displayName":"Alan"}`,
+			want: []wantRow{{line: 1, displayName: "Ada"}, {line: 2, displayName: "Alan"}},
+		},
+		{
+			name: "blank lines",
+			data: "\n" + `{"displayName":"Ada"}` + "\n  \r\n\t" + `{"displayName":"Alan"}` + "\n\n",
+			want: []wantRow{{line: 2, displayName: "Ada"}, {line: 4, displayName: "Alan"}},
+		},
+		{
+			name: "invalid JSON",
+			data: `{"displayName":"Ada"}` + "\n" + `{"displayName":` + "\n" + `{"unknown":1}` + "\n" + `{"displayName":"Alan"}`,
+			want: []wantRow{
+				{line: 1, displayName: "Ada"},
+				{line: 2, err: "invalid JSON"},
+				{line: 3, err: "invalid JSON"},
+				{line: 4, displayName: "Alan"},
+			},
+		},
+		{
+			name:    "line too long",
+			data:    `{"displayName":"Ada"}` + "\n" + tooLong + "\n",
+			want:    []wantRow{{line: 1, displayName: "Ada"}},
+			wantErr: "line 2 is longer than 1048576 bytes",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rows, err := newImportRows(gomicroservicev1.ImportUsersRequest_NDJSON, strings.NewReader(tt.data))
+			assert.NilError(t, err)
+			got, err := readRows(t, rows)
+			if tt.wantErr != "" {
+				assert.Equal(t, status.Code(err), codes.InvalidArgument)
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.DeepEqual(t, got, tt.want, cmp.AllowUnexported(wantRow{}))
+		})
+	}
+}
+
+func TestNewImportRows(t *testing.T) {
+	t.Parallel()
+	_, err := newImportRows(gomicroservicev1.ImportUsersRequest_FORMAT_UNSPECIFIED, strings.NewReader(""))
+	assert.Equal(t, status.Code(err), codes.InvalidArgument)
+	assert.ErrorContains(t, err, "missing required field: format")
+}
+
+func TestImportData(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reads chunks in turn", func(t *testing.T) {
+		t.Parallel()
+		data := &importData{
+			stream: &importStream{chunks: []string{"", "cde", "", "", "f"}},
+			chunk:  []byte("ab"),
+		}
+		// Reads don't span chunks, and skip empty ones
+		var reads []string
+		buf := make([]byte, 2)
+		for {
+			n, err := data.Read(buf)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.NilError(t, err)
+			reads = append(reads, string(buf[:n]))
+		}
+		assert.DeepEqual(t, reads, []string{"ab", "cd", "e", "f"})
+	})
+
+	t.Run("passes on stream errors", func(t *testing.T) {
+		t.Parallel()
+		streamErr := status.Error(codes.Canceled, "context canceled")
+		data := &importData{stream: &importStream{chunks: []string{"ab"}, err: streamErr}}
+		got, err := io.ReadAll(data)
+		assert.Equal(t, string(got), "ab")
+		assert.Equal(t, err, streamErr)
+	})
+
+	t.Run("rows across chunk boundaries", func(t *testing.T) {
+		t.Parallel()
+		for _, tt := range []struct {
+			format gomicroservicev1.ImportUsersRequest_Format
+			data   string
+		}{
+			{
+				format: gomicroservicev1.ImportUsersRequest_CSV,
+				data:   "display_name,email\nAda,ada@example.com\nAlan,alan@example.com\n",
+			},
+			{
+				format: gomicroservicev1.ImportUsersRequest_NDJSON,
+				data:   `{"displayName":"Ada"}` + "\n" + `{"displayName":"Alan"}` + "\n",
+			},
+		} {
+			// Every size splits the data at different points
+			for size := 1; size <= 8; size++ {
+				var chunks []string
+				for data := tt.data; data != ""; data = data[min(size, len(data)):] {
+					chunks = append(chunks, data[:min(size, len(data))])
+				}
+				rows, err := newImportRows(tt.format, &importData{stream: &importStream{chunks: chunks}})
+				assert.NilError(t, err)
+				got, err := readRows(t, rows)
+				assert.NilError(t, err)
+				assert.Equal(t, len(got), 2, "format %v, chunks of %d bytes", tt.format, size)
+				assert.Equal(t, got[1].displayName, "Alan", "format %v, chunks of %d bytes", tt.format, size)
+			}
+		}
+	})
+}
+
+// takenEmails is a user service that imports users unless their email is
+// taken.
+type takenEmails struct {
+	port.UserService
+	taken []string
+}
+
+func (s *takenEmails) ImportUsers(
+	_ context.Context,
+	users []*domain.User,
+	_ domain.ImportUsersParams,
+) ([]error, error) {
+	errs := make([]error, len(users))
+	for i, user := range users {
+		if slices.Contains(s.taken, user.Email) {
+			errs[i] = domain.NewErrorFieldAlreadyExists("email", "email is already in use", nil)
+		}
+	}
+	return errs, nil
+}
+
+func TestUserImportAdd(t *testing.T) {
+	t.Parallel()
+
+	validator, err := protovalidate.New()
+	assert.NilError(t, err)
+	service := &takenEmails{taken: []string{"taken@example.com"}}
+	imp := &userImport{
+		handler: NewGRPCHandler(service, validator, 10),
+		names:   make(map[string]int),
+		emails:  make(map[string]int),
+		resp:    &gomicroservicev1.ImportUsersResponse{},
+	}
+	user := func(name, email string) *gomicroservicev1.User {
+		return &gomicroservicev1.User{Name: name, DisplayName: "User", Email: email}
+	}
+
+	// The rows are checked in turn, against the rows before them
+	for _, tt := range []struct {
+		name     string
+		row      importRow
+		wantName string
+		wantCode codes.Code
+		wantErr  string
+	}{
+		{
+			name:     "user with a name",
+			row:      importRow{line: 2, user: user("users/ada-lovelace", "ada@example.com")},
+			wantName: "users/ada-lovelace",
+		},
+		{
+			name:     "user without a name",
+			row:      importRow{line: 3, user: user("", "alan@example.com")},
+			wantName: "users/",
+		},
+		{
+			name:     "duplicate name",
+			row:      importRow{line: 4, user: user("users/ada-lovelace", "lovelace@example.com")},
+			wantCode: codes.AlreadyExists,
+			wantErr:  "user already exists: users/ada-lovelace, on line 2",
+		},
+		{
+			name:     "duplicate email in another case",
+			row:      importRow{line: 5, user: user("users/grace-hopper", "ALAN@example.com")},
+			wantCode: codes.AlreadyExists,
+			wantErr:  "email is already in use, on line 3",
+		},
+		{
+			name:     "rows that failed aren't taken",
+			row:      importRow{line: 6, user: user("users/ada-byron", "lovelace@example.com")},
+			wantName: "users/ada-byron",
+		},
+		{
+			name:     "row that fails to import",
+			row:      importRow{line: 7, user: user("users/alan-turing", "taken@example.com")},
+			wantName: "users/alan-turing",
+		},
+		{
+			name:     "name of a row that failed to import",
+			row:      importRow{line: 8, user: user("users/alan-turing", "turing@example.com")},
+			wantName: "users/alan-turing",
+		},
+		{
+			name:     "duplicate name of a row that was imported",
+			row:      importRow{line: 9, user: user("users/alan-turing", "turing2@example.com")},
+			wantCode: codes.AlreadyExists,
+			wantErr:  "user already exists: users/alan-turing, on line 8",
+		},
+		{
+			name:     "invalid name",
+			row:      importRow{line: 10, user: user("people/ada-lovelace", "people@example.com")},
+			wantCode: codes.InvalidArgument,
+			wantErr:  "invalid resource name",
+		},
+		{
+			name:     "invalid email",
+			row:      importRow{line: 11, user: user("users/hopper", "hopper")},
+			wantCode: codes.InvalidArgument,
+			wantErr:  "email",
+		},
+		{
+			name:     "row that couldn't be read",
+			row:      importRow{line: 12, err: status.Error(codes.InvalidArgument, "got 1 columns, want 2")},
+			wantCode: codes.InvalidArgument,
+			wantErr:  "got 1 columns, want 2",
+		},
+	} {
+		assert.NilError(t, imp.add(t.Context(), tt.row), tt.name)
+		got := imp.rows[len(imp.rows)-1]
+		if tt.wantErr != "" {
+			assert.Equal(t, status.Code(got.err), tt.wantCode, tt.name)
+			assert.ErrorContains(t, got.err, tt.wantErr, tt.name)
+			continue
+		}
+		assert.NilError(t, got.err, tt.name)
+		assert.Assert(t, strings.HasPrefix(got.user.Name, tt.wantName), tt.name)
+	}
+
+	// Rows wait for the rows in the batch with the same name to be imported
+	assert.NilError(t, imp.flush(t.Context()))
+	assert.Equal(t, imp.resp.GetRowCount(), int32(11))
+	assert.Equal(t, imp.resp.GetImportedCount(), int32(4))
+	var failed []int32
+	for _, rowErr := range imp.resp.GetErrors() {
+		failed = append(failed, rowErr.GetLine())
+	}
+	assert.DeepEqual(t, failed, []int32{4, 5, 7, 9, 10, 11, 12})
+}
@@ -0,0 +1,193 @@
+package gomicroservice
+
+import (
+	"context"
+	"strings"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"github.com/bufbuild/protovalidate-go"
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// operationsCollection is the collection of the operations, in
+// operations/{operation_id}.
+const operationsCollection = "operations"
+
+// OperationsHandler serves the google.longrunning.Operations service, for the
+// operations that the methods of the UserService start.
+type OperationsHandler struct {
+	longrunningpb.UnimplementedOperationsServer
+	operationService port.OperationService
+	validator        protovalidate.Validator
+}
+
+func NewOperationsHandler(
+	operationService port.OperationService,
+	validator protovalidate.Validator,
+) *OperationsHandler {
+	return &OperationsHandler{
+		operationService: operationService,
+		validator:        validator,
+	}
+}
+
+// GetOperation implements AIP-151.
+func (h *OperationsHandler) GetOperation(
+	ctx context.Context,
+	req *longrunningpb.GetOperationRequest,
+) (*longrunningpb.Operation, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateOperationName(req.GetName()); err != nil {
+		return nil, err
+	}
+
+	// Get
+	op, err := h.operationService.GetOperation(ctx, req.GetName())
+	if err != nil {
+		return nil, toOperationsError(err)
+	}
+
+	// Convert and return
+	return toProtoOperationResponse(op)
+}
+
+// ListOperations implements AIP-151.
+func (h *OperationsHandler) ListOperations(
+	ctx context.Context,
+	req *longrunningpb.ListOperationsRequest,
+) (*longrunningpb.ListOperationsResponse, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetName() != "" && req.GetName() != operationsCollection {
+		return nil, status.Error(codes.InvalidArgument, "invalid collection name")
+	}
+	if _, err := query.ParseOperationFilter(req.GetFilter()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid filter: "+err.Error())
+	}
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	// List
+	pageSize := int32(10) //nolint:mnd // Default page size
+	if req.GetPageSize() > 0 {
+		pageSize = req.GetPageSize()
+	}
+	ops, nextPageToken, err := h.operationService.ListOperations(ctx, domain.ListOperationsParams{
+		PageSize:  pageSize,
+		PageToken: req.GetPageToken(),
+		Filter:    req.GetFilter(),
+	})
+	if err != nil {
+		return nil, toOperationsError(err)
+	}
+
+	// Convert and return
+	pbOps := make([]*longrunningpb.Operation, len(ops))
+	for i, op := range ops {
+		if pbOps[i], err = toProtoOperationResponse(op); err != nil {
+			return nil, err
+		}
+	}
+	return &longrunningpb.ListOperationsResponse{
+		Operations:    pbOps,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// CancelOperation implements AIP-151. The operation is done with a Canceled
+// error once it has stopped.
+func (h *OperationsHandler) CancelOperation(
+	ctx context.Context,
+	req *longrunningpb.CancelOperationRequest,
+) (*emptypb.Empty, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateOperationName(req.GetName()); err != nil {
+		return nil, err
+	}
+
+	// Cancel
+	if err := h.operationService.CancelOperation(ctx, req.GetName()); err != nil {
+		return nil, toOperationsError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// DeleteOperation implements AIP-151. Deleting an operation doesn't cancel
+// it.
+func (h *OperationsHandler) DeleteOperation(
+	ctx context.Context,
+	req *longrunningpb.DeleteOperationRequest,
+) (*emptypb.Empty, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateOperationName(req.GetName()); err != nil {
+		return nil, err
+	}
+
+	// Delete
+	if err := h.operationService.DeleteOperation(ctx, req.GetName()); err != nil {
+		return nil, toOperationsError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// WaitOperation implements AIP-151. It returns the operation once it is done,
+// or when the timeout has passed, whichever comes first.
+func (h *OperationsHandler) WaitOperation(
+	ctx context.Context,
+	req *longrunningpb.WaitOperationRequest,
+) (*longrunningpb.Operation, error) {
+	// Validate the request
+	if err := h.validator.Validate(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateOperationName(req.GetName()); err != nil {
+		return nil, err
+	}
+	if req.GetTimeout() != nil {
+		if err := req.GetTimeout().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid timeout: "+err.Error())
+		}
+		if req.GetTimeout().AsDuration() < 0 {
+			return nil, status.Error(codes.InvalidArgument, "timeout must not be negative")
+		}
+	}
+
+	// Wait
+	op, err := h.operationService.WaitOperation(ctx, req.GetName(), req.GetTimeout().AsDuration())
+	if err != nil {
+		return nil, toOperationsError(err)
+	}
+
+	// Convert and return
+	return toProtoOperationResponse(op)
+}
+
+// validateOperationName checks that name is of the form
+// operations/{operation_id}.
+func validateOperationName(name string) error {
+	if name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	id, ok := strings.CutPrefix(name, operationsCollection+"/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return status.Error(codes.InvalidArgument, "invalid resource name")
+	}
+	return nil
+}
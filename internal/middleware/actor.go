@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ActorHeader names who makes a request, and is recorded on the revisions
+// that the request creates.
+const ActorHeader = "x-actor"
+
+// unaryActorInterceptor puts the actor of a request in its context.
+func unaryActorInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		return handler(contextWithActor(ctx), req)
+	}
+}
+
+// streamActorInterceptor puts the actor of a stream in its context.
+func streamActorInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: contextWithActor(ss.Context())})
+	}
+}
+
+// contextWithActor returns ctx with the actor named by the incoming metadata,
+// if any.
+func contextWithActor(ctx context.Context) context.Context {
+	if values := metadata.ValueFromIncomingContext(ctx, ActorHeader); len(values) > 0 {
+		return domain.ContextWithActor(ctx, values[0])
+	}
+	return ctx
+}
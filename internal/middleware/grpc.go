@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 
 	"google.golang.org/grpc"
@@ -11,8 +12,28 @@ func GRPCUnaryServerInterceptors(logger *slog.Logger) []grpc.UnaryServerIntercep
 	return []grpc.UnaryServerInterceptor{
 		// circuitBreakerUnaryInterceptor(),
 		unaryLoggingInterceptor(logger),
+		unaryActorInterceptor(),
 		// rateLimitInterceptor(100),
 		// metricInterceptor(),
 		// authInterceptor(),
 	}
 }
+
+// GRPCStreamServerInterceptors returns a slice of stream server interceptors,
+// which do for streams what the unary interceptors do for unary calls.
+func GRPCStreamServerInterceptors(logger *slog.Logger) []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		streamLoggingInterceptor(logger),
+		streamActorInterceptor(),
+	}
+}
+
+// serverStream is a grpc.ServerStream with a different context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
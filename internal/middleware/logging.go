@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
@@ -21,6 +22,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController flush streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func loggingMiddleware(logger *slog.Logger) HTTPMiddleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -88,3 +94,39 @@ func unaryLoggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
 		return resp, err
 	}
 }
+
+func streamLoggingInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		// Log stream
+		logger.Info("received stream",
+			"method", info.FullMethod,
+		)
+
+		// Handle stream
+		err := handler(srv, ss)
+
+		// Log end of stream. Streams commonly end because the client went
+		// away, which is not a failure of the server.
+		if st, _ := status.FromError(err); err != nil && st.Code() != codes.Canceled {
+			logger.Error("stream failed",
+				"method", info.FullMethod,
+				"duration", time.Since(start),
+				"code", st.Code(),
+				"error", err,
+			)
+		} else {
+			logger.Info("stream ended",
+				"method", info.FullMethod,
+				"duration", time.Since(start),
+			)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// writeBatch stages user versions to be written to a MemoryRepository, and
+// then writes them all in one write. The caller must hold the write lock of
+// the repository from creating the batch until it is committed or aborted.
+//
+// Emails are claimed in the shared email index as versions are staged, and
+// the emails of replaced versions are only released on commit. A sharded
+// batch therefore can't hand an email from one user to another.
+type writeBatch struct {
+	repo     *MemoryRepository
+	next     *memorySnapshot // The current snapshot with the staged versions.
+	users    []*domain.User  // The staged versions, in order.
+	replaced []*domain.User  // The version each staged version replaces, if any.
+	claimed  []*domain.User  // The staged versions that claimed their email.
+}
+
+func (r *MemoryRepository) newWriteBatch() *writeBatch {
+	return &writeBatch{repo: r, next: r.snapshot()}
+}
+
+// stored returns the version of a user with the staged versions applied.
+func (b *writeBatch) stored(name string) *domain.User {
+	user, _ := b.next.users.get(name)
+	return user
+}
+
+// stage checks that the email of a user version is available next to the
+// users that exist and are staged, claims it, and stages the version.
+func (b *writeBatch) stage(user *domain.User) error {
+	replaced := b.stored(user.Name)
+	if user.DeleteTime.IsZero() {
+		if err := b.next.checkEmailAvailable(user.Email, user.Name); err != nil {
+			return err
+		}
+		if err := b.repo.claimEmail(user); err != nil {
+			return err
+		}
+		b.claimed = append(b.claimed, user)
+	}
+	b.next = b.next.withUser(user)
+	b.users = append(b.users, user)
+	b.replaced = append(b.replaced, replaced)
+	return nil
+}
+
+// stageCreate stages the first version of a new user.
+func (b *writeBatch) stageCreate(user *domain.User, c change) (*domain.User, error) {
+	created, err := createdUser(user, c)
+	if err != nil {
+		return nil, err
+	}
+	if b.stored(created.Name) != nil {
+		return nil, domain.NewErrorAlreadyExists(
+			fmt.Sprintf("user already exists: %s", created.Name),
+			nil,
+		)
+	}
+	if err := b.stage(created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// abort releases the emails that the staged versions claimed, unless the
+// stored versions hold them.
+func (b *writeBatch) abort() {
+	for _, user := range b.claimed {
+		stored, _ := b.repo.snapshot().users.get(user.Name)
+		b.repo.releaseEmail(user, stored)
+	}
+}
+
+// commit writes the staged versions, with one journal entry and one snapshot.
+// If the journal fails, nothing is written.
+func (b *writeBatch) commit() error {
+	if len(b.users) == 0 {
+		return nil
+	}
+	r := b.repo
+	events := make([]domain.UserEvent, len(b.users))
+	for i, user := range b.users {
+		events[i] = domain.NewUserEvent(user)
+	}
+	if r.journal != nil {
+		for i := range events {
+			events[i].Sequence = r.outbox.reserve()
+		}
+		if err := r.journal.logPuts(b.users, events); err != nil {
+			b.abort()
+			return domain.NewErrorInternal("failed to write users", err)
+		}
+	}
+	// The versions of a batch are written at the same time
+	r.publish(b.next, b.users[0].RevisionCreateTime)
+	for i, user := range b.users {
+		r.revisions.add(user)
+		r.outbox.add(events[i])
+		// The email of a replaced version is kept if the user ends up with it
+		r.releaseEmail(b.replaced[i], b.stored(user.Name))
+	}
+	return nil
+}
+
+// stageCreates stages every user in the batch that batchOf picks for it. It
+// returns the staged users and the errors of the others at the index of each
+// user. In atomic mode it stops at the first user that fails, and returns its
+// error as a domain.BatchItemError.
+func stageCreates(
+	users []*domain.User,
+	atomic bool,
+	c change,
+	batchOf func(name string) *writeBatch,
+) ([]*domain.User, []error, error) {
+	created := make([]*domain.User, len(users))
+	errs := make([]error, len(users))
+	for i, user := range users {
+		created[i], errs[i] = batchOf(user.Name).stageCreate(user, c)
+		if errs[i] != nil && atomic {
+			return nil, nil, &domain.BatchItemError{Index: i, Err: errs[i]}
+		}
+	}
+	return created, errs, nil
+}
+
+// stageUpdates stages every update in the batch that batchOf picks for it,
+// and returns the updated users. It stops at the first update that fails, and
+// returns its error as a domain.BatchItemError.
+func stageUpdates(
+	updates []domain.UserUpdate,
+	c change,
+	batchOf func(name string) *writeBatch,
+) ([]*domain.User, error) {
+	updated := make([]*domain.User, len(updates))
+	for i, update := range updates {
+		batch := batchOf(update.User.Name)
+		user, err := updatedUser(batch.stored(update.User.Name), update.User, update.Params, c)
+		if err == nil {
+			err = batch.stage(user)
+		}
+		if err != nil {
+			return nil, &domain.BatchItemError{Index: i, Err: err}
+		}
+		updated[i] = user
+	}
+	return updated, nil
+}
+
+// stageDeletions stages every deletion in the batch that batchOf picks for
+// it. It stops at the first deletion that fails, and returns its error as a
+// domain.BatchItemError.
+func stageDeletions(
+	deletions []domain.UserDeletion,
+	c change,
+	batchOf func(name string) *writeBatch,
+) error {
+	for i, deletion := range deletions {
+		batch := batchOf(deletion.Name)
+		user, err := deletedUser(batch.stored(deletion.Name), deletion.Params, c)
+		if err == nil {
+			err = batch.stage(user)
+		}
+		if err != nil {
+			return &domain.BatchItemError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// copyUsers returns copies of users, keeping nil entries.
+func copyUsers(users []*domain.User) []*domain.User {
+	copies := make([]*domain.User, len(users))
+	for i, user := range users {
+		if user != nil {
+			copies[i] = user.Copy()
+		}
+	}
+	return copies
+}
@@ -0,0 +1,333 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheOptions configures a CachedRepository.
+type CacheOptions struct {
+	// Size is the maximum number of cached users, including cached misses.
+	Size int
+	// TTL is how long a user is cached.
+	TTL time.Duration
+	// NegativeTTL is how long a user that was not found is cached.
+	NegativeTTL time.Duration
+}
+
+// CacheStats counts the lookups of a CachedRepository.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// CachedRepository is a read-through cache of GetUser in front of another
+// repository. Entries live in a bounded LRU with a TTL, users that don't
+// exist are cached as well, and concurrent misses for the same user are
+// collapsed into a single read. Every write that passes through the cache
+// invalidates the users it touches; writes made directly to the underlying
+// repository are only picked up once the TTL has passed.
+//
+// All other methods pass straight through.
+type CachedRepository struct {
+	port.UserRepository
+	opts   CacheOptions
+	logger *slog.Logger
+	group  singleflight.Group
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Front is most recently used.
+	// loads tracks the reads in flight of each user, so that a read that
+	// started before a write to the user doesn't fill the cache with the
+	// version the write replaced.
+	loads map[string]*cacheLoad
+	// epoch is bumped by invalidateAll, which does the same for all users.
+	epoch uint64
+	// writes is bumped by every invalidation, so that reads that start after
+	// a write don't join reads from before it.
+	writes uint64
+
+	hits, misses, evictions atomic.Int64
+}
+
+// cacheEntry is the outcome of reading a user, regardless of whether it is
+// deleted. A nil user is a cached NotFound.
+type cacheEntry struct {
+	name    string
+	user    *domain.User
+	expires time.Time
+}
+
+// cacheLoad tracks the reads of a user from the underlying repository.
+type cacheLoad struct {
+	reads  int    // The number of reads in flight.
+	writes uint64 // Bumped by every write to the user.
+}
+
+// loadToken is what a read knows of the invalidations before it started.
+type loadToken struct {
+	epoch, writes uint64
+}
+
+func NewCachedRepository(logger *slog.Logger, repo port.UserRepository, opts CacheOptions) *CachedRepository {
+	return &CachedRepository{
+		UserRepository: repo,
+		opts:           opts,
+		logger:         logger,
+		entries:        make(map[string]*list.Element),
+		loads:          make(map[string]*cacheLoad),
+		lru:            list.New(),
+	}
+}
+
+// Stats returns the number of cache hits, misses and evictions so far.
+func (r *CachedRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:      r.hits.Load(),
+		Misses:    r.misses.Load(),
+		Evictions: r.evictions.Load(),
+	}
+}
+
+func (r *CachedRepository) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	user, writes, ok := r.lookup(name)
+	if ok {
+		r.hits.Add(1)
+	} else {
+		r.misses.Add(1)
+		// Reads that start after a write must not join a read from before it
+		key := strconv.FormatUint(writes, 10) + "/" + name
+		// The shared read outlives callers that give up waiting for it
+		results := r.group.DoChan(key, func() (any, error) {
+			return r.load(context.WithoutCancel(ctx), name)
+		})
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, domain.NewErrorTimeout("timed out waiting for user", ctx.Err())
+			}
+			return nil, ctx.Err()
+		case result := <-results:
+			if result.Err != nil {
+				return nil, result.Err
+			}
+			user, _ = result.Val.(*domain.User)
+		}
+	}
+
+	if user == nil || (!user.DeleteTime.IsZero() && !params.ShowDeleted) {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	// Return a copy to prevent modifications of the cached user
+	return user.Copy(), nil
+}
+
+// load reads a user from the underlying repository and caches the outcome,
+// unless the user was invalidated while it read.
+func (r *CachedRepository) load(ctx context.Context, name string) (*domain.User, error) {
+	token := r.beginLoad(name)
+	defer r.endLoad(name)
+	user, err := r.UserRepository.GetUser(ctx, name, domain.GetUserParams{ShowDeleted: true})
+	var domainErr *domain.Error
+	if errors.As(err, &domainErr) && domainErr.Type == domain.NotFound {
+		r.store(name, nil, token, r.opts.NegativeTTL)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.store(name, user, token, r.opts.TTL)
+	return user, nil
+}
+
+func (r *CachedRepository) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+	defer r.invalidate(user.Name)
+	return r.UserRepository.CreateUser(ctx, user)
+}
+
+func (r *CachedRepository) BatchCreateUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.BatchCreateUsersParams,
+) ([]*domain.User, []error, error) {
+	defer func() {
+		for _, user := range users {
+			r.invalidate(user.Name)
+		}
+	}()
+	return r.UserRepository.BatchCreateUsers(ctx, users, params)
+}
+
+func (r *CachedRepository) UpdateUser(
+	ctx context.Context,
+	user *domain.User,
+	params domain.UpdateUserParams,
+) (*domain.User, bool, error) {
+	defer r.invalidate(user.Name)
+	return r.UserRepository.UpdateUser(ctx, user, params)
+}
+
+func (r *CachedRepository) BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error) {
+	defer func() {
+		for _, update := range updates {
+			r.invalidate(update.User.Name)
+		}
+	}()
+	return r.UserRepository.BatchUpdateUsers(ctx, updates)
+}
+
+func (r *CachedRepository) DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error {
+	defer r.invalidate(name)
+	return r.UserRepository.DeleteUser(ctx, name, params)
+}
+
+func (r *CachedRepository) BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error {
+	defer func() {
+		for _, deletion := range deletions {
+			r.invalidate(deletion.Name)
+		}
+	}()
+	return r.UserRepository.BatchDeleteUsers(ctx, deletions)
+}
+
+func (r *CachedRepository) UndeleteUser(ctx context.Context, name string) (*domain.User, error) {
+	defer r.invalidate(name)
+	return r.UserRepository.UndeleteUser(ctx, name)
+}
+
+func (r *CachedRepository) RollbackUser(
+	ctx context.Context,
+	name string,
+	params domain.RollbackUserParams,
+) (*domain.User, error) {
+	defer r.invalidate(name)
+	return r.UserRepository.RollbackUser(ctx, name, params)
+}
+
+func (r *CachedRepository) PurgeExpiredUsers(ctx context.Context, now time.Time) (int, error) {
+	purged, err := r.UserRepository.PurgeExpiredUsers(ctx, now)
+	// The purged users aren't known, so start over
+	if purged > 0 || err != nil {
+		r.invalidateAll()
+	}
+	return purged, err
+}
+
+func (r *CachedRepository) PurgeUsers(ctx context.Context, names []string) (int, error) {
+	defer func() {
+		for _, name := range names {
+			r.invalidate(name)
+		}
+	}()
+	return r.UserRepository.PurgeUsers(ctx, names)
+}
+
+// lookup returns the cached user for name, and the number of invalidations
+// so far.
+func (r *CachedRepository) lookup(name string) (*domain.User, uint64, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	element, exists := r.entries[name]
+	if !exists {
+		return nil, r.writes, false
+	}
+	entry := element.Value.(*cacheEntry) //nolint:errcheck,forcetypeassert // only entries are stored
+	if !time.Now().Before(entry.expires) {
+		r.lru.Remove(element)
+		delete(r.entries, name)
+		return nil, r.writes, false
+	}
+	r.lru.MoveToFront(element)
+	return entry.user, r.writes, true
+}
+
+// beginLoad registers a read of name, and returns what it knows.
+func (r *CachedRepository) beginLoad(name string) loadToken {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	load, exists := r.loads[name]
+	if !exists {
+		load = &cacheLoad{}
+		r.loads[name] = load
+	}
+	load.reads++
+	return loadToken{epoch: r.epoch, writes: load.writes}
+}
+
+// endLoad unregisters a read of name.
+func (r *CachedRepository) endLoad(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	load := r.loads[name]
+	load.reads--
+	if load.reads == 0 {
+		delete(r.loads, name)
+	}
+}
+
+// store caches the outcome of a read with token, evicting the least recently
+// used entry if the cache is full.
+func (r *CachedRepository) store(name string, user *domain.User, token loadToken, ttl time.Duration) {
+	if ttl <= 0 || r.opts.Size <= 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if token.epoch != r.epoch || token.writes != r.loads[name].writes {
+		return
+	}
+	entry := &cacheEntry{name: name, user: user, expires: time.Now().Add(ttl)}
+	if element, exists := r.entries[name]; exists {
+		element.Value = entry
+		r.lru.MoveToFront(element)
+		return
+	}
+	r.entries[name] = r.lru.PushFront(entry)
+	for r.lru.Len() > r.opts.Size {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).name) //nolint:errcheck,forcetypeassert // only entries are stored
+		r.evictions.Add(1)
+	}
+}
+
+// invalidate drops the cached user for name.
+func (r *CachedRepository) invalidate(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.writes++
+	if load, exists := r.loads[name]; exists {
+		load.writes++
+	}
+	if element, exists := r.entries[name]; exists {
+		r.lru.Remove(element)
+		delete(r.entries, name)
+	}
+}
+
+// invalidateAll drops all cached users.
+func (r *CachedRepository) invalidateAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.epoch++
+	r.writes++
+	clear(r.entries)
+	r.lru.Init()
+	r.logger.Debug("user cache cleared")
+}
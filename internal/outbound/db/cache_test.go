@@ -0,0 +1,303 @@
+package db_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
+	"gotest.tools/v3/assert"
+)
+
+// countingRepository counts the GetUser calls that reach a repository, and
+// optionally holds them until release is closed.
+type countingRepository struct {
+	port.UserRepository
+	gets    atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *countingRepository) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	r.gets.Add(1)
+	if r.release != nil {
+		r.started <- struct{}{}
+		<-r.release
+	}
+	return r.UserRepository.GetUser(ctx, name, params)
+}
+
+func setupCachedRepo(t *testing.T, opts db.CacheOptions) (*db.CachedRepository, *countingRepository) {
+	t.Helper()
+	memory := db.NewMemoryRepository(slog.Default()).(*db.MemoryRepository)
+	memory.SetHistoryWindow(time.Hour)
+	memory.SetRevisionRetention(time.Hour)
+	inner := &countingRepository{UserRepository: memory}
+	return db.NewCachedRepository(slog.Default(), inner, opts), inner
+}
+
+// TestCachedRepositoryConformance runs the repository conformance suite
+// through the cache.
+func TestCachedRepositoryConformance(t *testing.T) {
+	t.Parallel()
+	dbtest.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+		repo, _ := setupCachedRepo(t, db.CacheOptions{Size: 3, TTL: time.Minute, NegativeTTL: time.Minute})
+		return repo
+	})
+}
+
+// TestCachedRepository tests the caching of GetUser.
+func TestCachedRepository(t *testing.T) {
+	t.Parallel()
+
+	defaultOptions := db.CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute}
+	jane := &domain.User{Name: "users/jane", DisplayName: "Jane", Email: "jane@example.com"}
+
+	t.Run("hits after a miss", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+
+		for range 3 {
+			_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, inner.gets.Load(), int32(1))
+		assert.Equal(t, repo.Stats(), db.CacheStats{Hits: 2, Misses: 1})
+	})
+
+	t.Run("returns copies", func(t *testing.T) {
+		t.Parallel()
+		repo, _ := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+
+		got, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		got.DisplayName = "Modified"
+		got, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, got.DisplayName, "Jane")
+	})
+
+	t.Run("caches not found until created", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		for range 2 {
+			_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+			assertErrorType(t, err, domain.NotFound)
+		}
+		assert.Equal(t, inner.gets.Load(), int32(1))
+
+		// A user created behind the cache's back stays hidden
+		_, err := inner.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assertErrorType(t, err, domain.NotFound)
+
+		// Writing through the cache invalidates the miss
+		_, _, err = repo.UpdateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "Jane Doe"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+		got, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, got.DisplayName, "Jane Doe")
+	})
+
+	t.Run("deleted users are cached once for both views", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assertErrorType(t, err, domain.NotFound)
+		deleted, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !deleted.DeleteTime.IsZero())
+		assert.Equal(t, inner.gets.Load(), int32(1))
+	})
+
+	t.Run("expires after the ttl", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: 10 * time.Millisecond})
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		time.Sleep(20 * time.Millisecond)
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, inner.gets.Load(), int32(2))
+
+		// Without a negative ttl, misses aren't cached
+		for range 2 {
+			_, err = repo.GetUser(ctx, "users/missing", domain.GetUserParams{})
+			assertErrorType(t, err, domain.NotFound)
+		}
+		assert.Equal(t, inner.gets.Load(), int32(4))
+	})
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, db.CacheOptions{Size: 2, TTL: time.Minute, NegativeTTL: time.Minute})
+		ctx := t.Context()
+		get := func(name string) {
+			_, _ = repo.GetUser(ctx, name, domain.GetUserParams{})
+		}
+		get("users/a")
+		get("users/b")
+		get("users/a") // b is now least recently used
+		get("users/c") // evicts b
+		get("users/a")
+		assert.Equal(t, inner.gets.Load(), int32(3))
+		get("users/b")
+		assert.Equal(t, inner.gets.Load(), int32(4))
+		assert.Equal(t, repo.Stats(), db.CacheStats{Hits: 2, Misses: 4, Evictions: 2})
+	})
+
+	t.Run("collapses concurrent misses", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+		inner.started = make(chan struct{}, 1)
+		inner.release = make(chan struct{})
+
+		const readers = 8
+		var wg sync.WaitGroup
+		for range readers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+				assert.Check(t, err)
+			}()
+		}
+		<-inner.started
+		// Give the other readers time to join the read in flight
+		for repo.Stats().Misses < readers {
+			time.Sleep(time.Millisecond)
+		}
+		close(inner.release)
+		wg.Wait()
+		assert.Equal(t, inner.gets.Load(), int32(1))
+	})
+
+	t.Run("reads in flight during a write are not cached", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+		inner.started = make(chan struct{}, 1)
+		inner.release = make(chan struct{})
+
+		read := make(chan *domain.User)
+		go func() {
+			user, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+			assert.Check(t, err)
+			read <- user
+		}()
+		<-inner.started
+		_, _, err = repo.UpdateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "Jane Doe"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+
+		// The read after the write starts its own read rather than joining
+		inner.release <- struct{}{}
+		<-read
+		go func() { <-inner.started; inner.release <- struct{}{} }()
+		got, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, got.DisplayName, "Jane Doe")
+	})
+
+	t.Run("reads in flight during a write to another user are cached", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+		inner.started = make(chan struct{}, 1)
+		inner.release = make(chan struct{})
+
+		read := make(chan struct{})
+		go func() {
+			_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+			assert.Check(t, err)
+			close(read)
+		}()
+		<-inner.started
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/john", DisplayName: "John", Email: "john@example.com"})
+		assert.NilError(t, err)
+		close(inner.release)
+		<-read
+
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, inner.gets.Load(), int32(1))
+	})
+
+	t.Run("callers stop waiting when cancelled", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		inner.started = make(chan struct{}, 1)
+		inner.release = make(chan struct{})
+		defer close(inner.release)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		go func() { <-inner.started; cancel() }()
+		_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("callers stop waiting at their deadline", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupCachedRepo(t, defaultOptions)
+		inner.started = make(chan struct{}, 1)
+		inner.release = make(chan struct{})
+		defer close(inner.release)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assertErrorType(t, err, domain.Timeout)
+	})
+
+	t.Run("purge clears the cache", func(t *testing.T) {
+		t.Parallel()
+		repo, _ := setupCachedRepo(t, defaultOptions)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, jane)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{}))
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+
+		purged, err := repo.PurgeExpiredUsers(ctx, time.Now().UTC())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assertErrorType(t, err, domain.NotFound)
+	})
+}
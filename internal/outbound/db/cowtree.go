@@ -0,0 +1,188 @@
+package db
+
+import (
+	"hash/maphash"
+	"iter"
+)
+
+// treeSeed randomizes the node priorities of every cowTree.
+//
+//nolint:gochecknoglobals // read-only after initialization
+var treeSeed = maphash.MakeSeed()
+
+// cowTree is an immutable map from string keys to values, ordered by key.
+// Modifications return a new tree that shares all untouched nodes with the
+// old one, so a tree can be read concurrently without locking while newer
+// versions of it are being built.
+//
+// It is a treap: a binary search tree on the keys that is also a heap on
+// pseudo-random node priorities, which keeps it balanced in expectation.
+// The zero value is an empty tree.
+type cowTree[V any] struct {
+	root *cowNode[V]
+	size int
+}
+
+// cowNode is a node of a cowTree. Nodes are never modified once they are
+// reachable from a tree.
+type cowNode[V any] struct {
+	key         string
+	value       V
+	priority    uint64
+	left, right *cowNode[V]
+}
+
+// len returns the number of keys in the tree.
+func (t cowTree[V]) len() int {
+	return t.size
+}
+
+// get returns the value of key, if any.
+func (t cowTree[V]) get(key string) (V, bool) {
+	n := t.root
+	for n != nil {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// with returns a tree where key holds value.
+func (t cowTree[V]) with(key string, value V) cowTree[V] {
+	root, added := insertNode(t.root, key, value, maphash.String(treeSeed, key))
+	if added {
+		t.size++
+	}
+	t.root = root
+	return t
+}
+
+// without returns a tree without key.
+func (t cowTree[V]) without(key string) cowTree[V] {
+	root, removed := removeNode(t.root, key)
+	if removed {
+		t.size--
+		t.root = root
+	}
+	return t
+}
+
+// all returns the keys and values of the tree in key order.
+func (t cowTree[V]) all() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		ascendNode(t.root, yield)
+	}
+}
+
+// after returns the keys greater than key and their values in key order,
+// without visiting the subtrees that come before key.
+func (t cowTree[V]) after(key string) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		ascendNodeAfter(t.root, key, yield)
+	}
+}
+
+// insertNode returns a copy of the subtree n where key holds value, and
+// whether key was added.
+func insertNode[V any](n *cowNode[V], key string, value V, priority uint64) (*cowNode[V], bool) {
+	if n == nil {
+		return &cowNode[V]{key: key, value: value, priority: priority}, true
+	}
+	c := *n
+	var added bool
+	switch {
+	case key < n.key:
+		c.left, added = insertNode(n.left, key, value, priority)
+		if c.left.priority > c.priority {
+			return rotateRight(&c), added
+		}
+	case key > n.key:
+		c.right, added = insertNode(n.right, key, value, priority)
+		if c.right.priority > c.priority {
+			return rotateLeft(&c), added
+		}
+	default:
+		c.value = value
+	}
+	return &c, added
+}
+
+// removeNode returns a copy of the subtree n without key, and whether key
+// was removed. The subtree is returned as is if it doesn't hold key.
+func removeNode[V any](n *cowNode[V], key string) (*cowNode[V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	var removed bool
+	c := *n
+	switch {
+	case key < n.key:
+		c.left, removed = removeNode(n.left, key)
+	case key > n.key:
+		c.right, removed = removeNode(n.right, key)
+	default:
+		return mergeNodes(n.left, n.right), true
+	}
+	if !removed {
+		return n, false
+	}
+	return &c, true
+}
+
+// mergeNodes joins two subtrees where all keys of a come before those of b.
+func mergeNodes[V any](a, b *cowNode[V]) *cowNode[V] {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.priority > b.priority:
+		c := *a
+		c.right = mergeNodes(a.right, b)
+		return &c
+	default:
+		c := *b
+		c.left = mergeNodes(a, b.left)
+		return &c
+	}
+}
+
+// rotateRight lifts the left child of n, which must both be fresh copies.
+func rotateRight[V any](n *cowNode[V]) *cowNode[V] {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	return l
+}
+
+// rotateLeft lifts the right child of n, which must both be fresh copies.
+func rotateLeft[V any](n *cowNode[V]) *cowNode[V] {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	return r
+}
+
+func ascendNode[V any](n *cowNode[V], yield func(string, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	return ascendNode(n.left, yield) && yield(n.key, n.value) && ascendNode(n.right, yield)
+}
+
+func ascendNodeAfter[V any](n *cowNode[V], key string, yield func(string, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.key <= key {
+		return ascendNodeAfter(n.right, key, yield)
+	}
+	return ascendNodeAfter(n.left, key, yield) && yield(n.key, n.value) && ascendNode(n.right, yield)
+}
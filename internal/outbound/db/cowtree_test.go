@@ -0,0 +1,116 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gotest.tools/v3/assert"
+)
+
+func TestCowTree(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches a map under random writes", func(t *testing.T) {
+		t.Parallel()
+		random := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // not used for security
+		var tree cowTree[int]
+		want := make(map[string]int)
+		for i := range 5000 {
+			key := strconv.Itoa(random.IntN(500))
+			if random.IntN(3) == 0 {
+				tree = tree.without(key)
+				delete(want, key)
+			} else {
+				tree = tree.with(key, i)
+				want[key] = i
+			}
+		}
+
+		got := make(map[string]int)
+		var keys []string
+		for key, value := range tree.all() {
+			got[key] = value
+			keys = append(keys, key)
+		}
+		assert.DeepEqual(t, got, want)
+		assert.Equal(t, tree.len(), len(want))
+		assert.DeepEqual(t, keys, slices.Sorted(maps.Keys(want)))
+		for key, value := range want {
+			stored, ok := tree.get(key)
+			assert.Assert(t, ok)
+			assert.Equal(t, stored, value)
+		}
+	})
+
+	t.Run("old versions are unchanged", func(t *testing.T) {
+		t.Parallel()
+		var versions []cowTree[int]
+		var tree cowTree[int]
+		for i := range 100 {
+			versions = append(versions, tree)
+			tree = tree.with(strconv.Itoa(i), i)
+		}
+		for i := range 100 {
+			versions = append(versions, tree)
+			tree = tree.without(strconv.Itoa(i))
+		}
+
+		for i, version := range versions[:100] {
+			assert.Equal(t, version.len(), i)
+			_, ok := version.get(strconv.Itoa(i))
+			assert.Assert(t, !ok)
+			if i > 0 {
+				value, ok := version.get(strconv.Itoa(i - 1))
+				assert.Assert(t, ok)
+				assert.Equal(t, value, i-1)
+			}
+		}
+		for i, version := range versions[100:] {
+			assert.Equal(t, version.len(), 100-i)
+			value, ok := version.get(strconv.Itoa(i))
+			assert.Assert(t, ok)
+			assert.Equal(t, value, i)
+		}
+		assert.Equal(t, tree.len(), 0)
+	})
+
+	t.Run("removing a missing key keeps the tree", func(t *testing.T) {
+		t.Parallel()
+		tree := cowTree[int]{}.with("a", 1)
+		assert.Equal(t, tree.without("b").root, tree.root)
+	})
+
+	t.Run("ascends after a key", func(t *testing.T) {
+		t.Parallel()
+		var tree cowTree[int]
+		var keys []string
+		for i := range 200 {
+			key := fmt.Sprintf("%03d", 2*i)
+			tree = tree.with(key, i)
+			keys = append(keys, key)
+		}
+		for _, after := range []string{"", "000", "001", "199", "200", "398", "399"} {
+			var got []string
+			for key := range tree.after(after) {
+				got = append(got, key)
+			}
+			want := slices.DeleteFunc(slices.Clone(keys), func(key string) bool { return key <= after })
+			assert.DeepEqual(t, got, want, cmpopts.EquateEmpty())
+		}
+
+		// Ascending stops when asked to
+		var got []string
+		for key := range tree.after("100") {
+			if len(got) == 3 {
+				break
+			}
+			got = append(got, key)
+		}
+		assert.DeepEqual(t, got, []string{"102", "104", "106"})
+	})
+}
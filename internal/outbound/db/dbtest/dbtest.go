@@ -0,0 +1,1845 @@
+// Package dbtest provides a conformance test suite for implementations of
+// port.UserRepository and port.OperationStore, so that every backend is held
+// to the same contract.
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gotest.tools/v3/assert"
+)
+
+// Factory returns a new, empty repository for a test. It should register any
+// cleanup it needs with t.Cleanup.
+type Factory func(t *testing.T) port.UserRepository
+
+// ignoredTimeFields defines which User fields to ignore in comparisons.
+var ignoredTimeFields = cmpopts.IgnoreFields( //nolint:gochecknoglobals // read-only comparison option
+	domain.User{},
+	"CreateTime",
+	"UpdateTime",
+	"Revision",
+	"Etag",
+	"RevisionID",
+	"RevisionCreateTime",
+)
+
+// TestUserRepository runs the conformance tests against repositories created
+// by newRepo. The tests follow the AIP-13x standard methods and AIP-164 soft
+// deletes, and include concurrent scenarios that are meant to be run with the
+// race detector.
+func TestUserRepository(t *testing.T, newRepo Factory) {
+	t.Helper()
+	t.Run("Create", func(t *testing.T) { t.Parallel(); testCreate(t, newRepo) })
+	t.Run("BatchCreate", func(t *testing.T) { t.Parallel(); testBatchCreate(t, newRepo) })
+	t.Run("Get", func(t *testing.T) { t.Parallel(); testGet(t, newRepo) })
+	t.Run("BatchGet", func(t *testing.T) { t.Parallel(); testBatchGet(t, newRepo) })
+	t.Run("List", func(t *testing.T) { t.Parallel(); testList(t, newRepo) })
+	t.Run("Update", func(t *testing.T) { t.Parallel(); testUpdate(t, newRepo) })
+	t.Run("BatchUpdate", func(t *testing.T) { t.Parallel(); testBatchUpdate(t, newRepo) })
+	t.Run("Delete", func(t *testing.T) { t.Parallel(); testDelete(t, newRepo) })
+	t.Run("BatchDelete", func(t *testing.T) { t.Parallel(); testBatchDelete(t, newRepo) })
+	t.Run("Undelete", func(t *testing.T) { t.Parallel(); testUndelete(t, newRepo) })
+	t.Run("PurgeExpired", func(t *testing.T) { t.Parallel(); testPurgeExpired(t, newRepo) })
+	t.Run("Purge", func(t *testing.T) { t.Parallel(); testPurge(t, newRepo) })
+	t.Run("Email", func(t *testing.T) { t.Parallel(); testEmail(t, newRepo) })
+	t.Run("Concurrency", func(t *testing.T) { t.Parallel(); testConcurrency(t, newRepo) })
+	t.Run("Snapshot", func(t *testing.T) { t.Parallel(); testSnapshot(t, newRepo) })
+	t.Run("Revisions", func(t *testing.T) { t.Parallel(); testRevisions(t, newRepo) })
+	t.Run("Events", func(t *testing.T) { t.Parallel(); testEvents(t, newRepo) })
+}
+
+// newUser returns a valid user with the given id.
+func newUser(id string) *domain.User {
+	return &domain.User{
+		Name:        "users/" + id,
+		DisplayName: "User " + id,
+		Email:       id + "@example.com",
+	}
+}
+
+func createUsers(t *testing.T, repo port.UserRepository, ids ...string) []*domain.User {
+	t.Helper()
+	users := make([]*domain.User, 0, len(ids))
+	for _, id := range ids {
+		created, err := repo.CreateUser(t.Context(), newUser(id))
+		assert.NilError(t, err)
+		users = append(users, created)
+	}
+	return users
+}
+
+// assertError asserts that err is a domain error with the type, message and
+// field of want. The wrapped error is not compared.
+func assertError(t *testing.T, err error, want *domain.Error) {
+	t.Helper()
+	var domainErr *domain.Error
+	assert.Assert(t, errors.As(err, &domainErr), "expected a domain error, got %v", err)
+	assert.Equal(t, domainErr.Type, want.Type, "unexpected error type: %v", err)
+	assert.Equal(t, domainErr.Message, want.Message)
+	assert.Equal(t, domainErr.Field, want.Field)
+}
+
+// assertErrorType asserts that err is a domain error of the given type.
+func assertErrorType(t *testing.T, err error, want domain.ErrorType) {
+	t.Helper()
+	var domainErr *domain.Error
+	assert.Assert(t, errors.As(err, &domainErr), "expected a domain error, got %v", err)
+	assert.Equal(t, domainErr.Type, want, "unexpected error type: %v", err)
+}
+
+// assertBatchItemError asserts that err is a domain.BatchItemError at index,
+// of a domain error like want.
+func assertBatchItemError(t *testing.T, err error, index int, want *domain.Error) {
+	t.Helper()
+	var itemErr *domain.BatchItemError
+	assert.Assert(t, errors.As(err, &itemErr), "expected a batch item error, got %v", err)
+	assert.Equal(t, itemErr.Index, index)
+	assertError(t, itemErr.Err, want)
+}
+
+// assertValidTimestamps verifies that CreateTime and UpdateTime are set, in
+// UTC, recent, and that UpdateTime is not before CreateTime.
+func assertValidTimestamps(t *testing.T, user *domain.User) {
+	t.Helper()
+	now := time.Now().UTC()
+	for field, ts := range map[string]time.Time{"CreateTime": user.CreateTime, "UpdateTime": user.UpdateTime} {
+		assert.Assert(t, !ts.IsZero(), "%s should not be zero", field)
+		assert.Equal(t, ts.Location(), time.UTC, "%s should be in UTC", field)
+		assert.Assert(t, !ts.After(now) && now.Sub(ts) < time.Second, "%s should be recent", field)
+	}
+	assert.Assert(t, !user.UpdateTime.Before(user.CreateTime), "UpdateTime should not be before CreateTime")
+}
+
+var errNotFound = &domain.Error{Type: domain.NotFound, Message: "user not found"} //nolint:gochecknoglobals // read-only
+
+func testCreate(t *testing.T, newRepo Factory) {
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created, err := repo.CreateUser(t.Context(), newUser("jane"))
+		assert.NilError(t, err)
+		assertValidTimestamps(t, created)
+		assert.DeepEqual(t, created.CreateTime, created.UpdateTime)
+		assert.DeepEqual(t, created, newUser("jane"), ignoredTimeFields)
+		assert.Assert(t, created.Etag != "")
+		assert.Assert(t, created.DeleteTime.IsZero())
+		assert.Assert(t, created.PurgeTime.IsZero())
+	})
+
+	t.Run("success - ignores output only fields", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		user := newUser("jane")
+		user.CreateTime = time.Unix(0, 0).UTC()
+		user.DeleteTime = time.Unix(0, 0).UTC()
+		user.Etag = "bogus"
+		created, err := repo.CreateUser(t.Context(), user)
+		assert.NilError(t, err)
+		assertValidTimestamps(t, created)
+		assert.Assert(t, created.DeleteTime.IsZero())
+		assert.Assert(t, created.Etag != "bogus")
+	})
+
+	t.Run("success - returns a copy", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created, err := repo.CreateUser(ctx, newUser("jane"))
+		assert.NilError(t, err)
+		created.DisplayName = "Modified"
+
+		retrieved, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, retrieved.DisplayName, "User jane")
+	})
+
+	t.Run("failure - already exists", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "jane")
+		user := newUser("jane")
+		user.Email = "other@example.com"
+		_, err := repo.CreateUser(t.Context(), user)
+		assertError(t, err, &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/jane"})
+	})
+
+	t.Run("failure - already exists when deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "jane")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+		_, err := repo.CreateUser(ctx, newUser("jane"))
+		assertError(t, err, &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/jane"})
+	})
+
+	t.Run("failure - missing required fields", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, &domain.User{Name: "users/jane", Email: "jane@example.com"})
+		assertError(t, err, &domain.Error{Type: domain.InvalidInput, Message: "display_name is required"})
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "Jane"})
+		assertError(t, err, &domain.Error{Type: domain.InvalidInput, Message: "email is required"})
+
+		// A failed create must not leave a partial user behind
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assertError(t, err, errNotFound)
+	})
+}
+
+func testBatchCreate(t *testing.T, newRepo Factory) {
+	atomic := domain.BatchCreateUsersParams{Atomic: true}
+	// sameName returns a user with the name of another one, and a new email.
+	sameName := func(id string) *domain.User {
+		user := newUser(id)
+		user.Email = "other-" + id + "@example.com"
+		return user
+	}
+	emailTaken := &domain.Error{
+		Type:    domain.AlreadyExists,
+		Message: "email is already in use",
+		Field:   "email",
+	}
+
+	t.Run("success - in order", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		users := []*domain.User{newUser("c"), newUser("a"), newUser("b")}
+		created, errs, err := repo.BatchCreateUsers(t.Context(), users, atomic)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(created), []string{"users/c", "users/a", "users/b"})
+		for i, user := range created {
+			assert.NilError(t, errs[i])
+			assertValidTimestamps(t, user)
+			assert.DeepEqual(t, user, users[i], ignoredTimeFields)
+		}
+		assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 10}),
+			[]string{"users/a", "users/b", "users/c"})
+	})
+
+	t.Run("success - records an event per user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		created, _, err := repo.BatchCreateUsers(t.Context(), []*domain.User{newUser("a"), newUser("b")}, atomic)
+		assert.NilError(t, err)
+		// Only the events of each user are ordered
+		events := readEvents(t, repo)
+		slices.SortFunc(events, func(a, b domain.UserEvent) int { return strings.Compare(a.User.Name, b.User.Name) })
+		assert.Equal(t, len(events), 2)
+		for i, event := range events {
+			assert.Equal(t, event.Type, domain.UserCreated)
+			assert.DeepEqual(t, event.User, created[i])
+		}
+	})
+
+	t.Run("failure - atomic creates no user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "b")
+		_, _, err := repo.BatchCreateUsers(ctx, []*domain.User{newUser("a"), sameName("b"), newUser("c")}, atomic)
+		assertBatchItemError(t, err, 1, &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/b"})
+		assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 10}), []string{"users/b"})
+
+		// The emails of the users that weren't created are still free
+		createUsers(t, repo, "a", "c")
+	})
+
+	t.Run("success - best effort creates the others", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "b")
+		invalid := newUser("d")
+		invalid.DisplayName = ""
+		users := []*domain.User{newUser("a"), sameName("b"), newUser("c"), invalid}
+		created, errs, err := repo.BatchCreateUsers(t.Context(), users, domain.BatchCreateUsersParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(created), len(users))
+		assert.Equal(t, len(errs), len(users))
+		assert.NilError(t, errs[0])
+		assert.Equal(t, created[0].Name, "users/a")
+		assert.Assert(t, created[1] == nil)
+		assertError(t, errs[1], &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/b"})
+		assert.NilError(t, errs[2])
+		assert.Equal(t, created[2].Name, "users/c")
+		assert.Assert(t, created[3] == nil)
+		assertError(t, errs[3], &domain.Error{Type: domain.InvalidInput, Message: "display_name is required"})
+		assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 10}),
+			[]string{"users/a", "users/b", "users/c"})
+	})
+
+	t.Run("failure - duplicates within the batch", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		sameEmail := newUser("c")
+		sameEmail.Email = "A@example.com"
+		users := []*domain.User{newUser("a"), sameName("a"), newUser("b"), sameEmail}
+		created, errs, err := repo.BatchCreateUsers(t.Context(), users, domain.BatchCreateUsersParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names([]*domain.User{created[0], created[2]}), []string{"users/a", "users/b"})
+		assertError(t, errs[1], &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/a"})
+		assertError(t, errs[3], emailTaken)
+
+		_, _, err = repo.BatchCreateUsers(t.Context(), []*domain.User{newUser("d"), sameName("d")}, atomic)
+		assertError(t, err, &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/d"})
+	})
+}
+
+func testGet(t *testing.T, newRepo Factory) {
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created := createUsers(t, repo, "jane")[0]
+		retrieved, err := repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, created)
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		_, err := repo.GetUser(t.Context(), "users/missing", domain.GetUserParams{})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("show deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "jane")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+
+		_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assertError(t, err, errNotFound)
+		deleted, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !deleted.DeleteTime.IsZero())
+	})
+}
+
+func testBatchGet(t *testing.T, newRepo Factory) {
+	t.Run("success - skips missing and deleted users", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane", "john", "mary")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/john", domain.DeleteUserParams{Retention: time.Hour}))
+
+		users, err := repo.BatchGetUsers(ctx, []string{"users/mary", "users/john", "users/missing", "users/jane", "users/mary"})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, users, map[string]*domain.User{"users/jane": created[0], "users/mary": created[2]})
+	})
+
+	t.Run("success - no names", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "jane")
+		users, err := repo.BatchGetUsers(t.Context(), nil)
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 0)
+	})
+
+	t.Run("returns copies", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "jane")
+		users, err := repo.BatchGetUsers(ctx, []string{"users/jane"})
+		assert.NilError(t, err)
+		users["users/jane"].DisplayName = "Changed"
+		stored, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, stored.DisplayName, "User jane")
+	})
+}
+
+// names returns the names of users.
+func names(users []*domain.User) []string {
+	result := make([]string, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.Name)
+	}
+	return result
+}
+
+// listAll lists all pages of users and returns their names.
+func listAll(t *testing.T, repo port.UserSnapshot, params domain.ListUsersParams) []string {
+	t.Helper()
+	var result []string
+	for {
+		users, nextPageToken, err := repo.ListUsers(t.Context(), params)
+		assert.NilError(t, err)
+		assert.Assert(t, len(users) <= int(params.PageSize))
+		result = append(result, names(users)...)
+		if nextPageToken == "" {
+			return result
+		}
+		params.PageToken = nextPageToken
+	}
+}
+
+func testList(t *testing.T, newRepo Factory) {
+	t.Run("success - empty", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		users, nextPageToken, err := repo.ListUsers(t.Context(), domain.ListUsersParams{PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 0)
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - pages in name order", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "e", "c", "a", "d", "b")
+
+		users, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/a", "users/b"})
+		assert.Assert(t, nextPageToken != "")
+
+		users, nextPageToken, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2, PageToken: nextPageToken})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/c", "users/d"})
+		assert.Assert(t, nextPageToken != "")
+
+		users, nextPageToken, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2, PageToken: nextPageToken})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/e"})
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - no token after an exactly full last page", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "a", "b")
+		users, nextPageToken, err := repo.ListUsers(t.Context(), domain.ListUsersParams{PageSize: 2})
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 2)
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - cursor survives writes", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c", "d")
+
+		users, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/a", "users/b"})
+
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+		assert.NilError(t, repo.DeleteUser(ctx, "users/c", domain.DeleteUserParams{}))
+		createUsers(t, repo, "aa", "e")
+
+		users, nextPageToken, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2, PageToken: nextPageToken})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/d", "users/e"})
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - filter", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/c", domain.DeleteUserParams{}))
+
+		for filter, want := range map[string][]string{
+			`email = "b@*" OR display_name = "User c"`: {"users/b"},
+			`display_name:"USER"`:                      {"users/a", "users/b"},
+			`NOT name = "users/a"`:                     {"users/b"},
+			`create_time > "2000-01-01T00:00:00Z"`:     {"users/a", "users/b"},
+			`create_time < "2000-01-01T00:00:00Z"`:     nil,
+		} {
+			assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 1, Filter: filter}), want)
+		}
+	})
+
+	t.Run("success - show deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+
+		got := listAll(t, repo, domain.ListUsersParams{PageSize: 2, ShowDeleted: true})
+		assert.DeepEqual(t, got, []string{"users/a", "users/b", "users/c"})
+	})
+
+	t.Run("success - order by with pagination", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		for _, user := range []*domain.User{
+			{Name: "users/a", DisplayName: "Carol", Email: "a@example.com"},
+			{Name: "users/b", DisplayName: "Alice", Email: "b@example.com"},
+			{Name: "users/c", DisplayName: "Bob", Email: "c@example.com"},
+			{Name: "users/d", DisplayName: "Alice", Email: "d@example.com"},
+			{Name: "users/e", DisplayName: "Bob", Email: "e@example.com"},
+		} {
+			_, err := repo.CreateUser(ctx, user)
+			assert.NilError(t, err)
+		}
+
+		for orderBy, want := range map[string][]string{
+			"display_name desc":         {"users/a", "users/c", "users/e", "users/b", "users/d"},
+			"display_name, name desc":   {"users/d", "users/b", "users/e", "users/c", "users/a"},
+			"create_time desc":          {"users/e", "users/d", "users/c", "users/b", "users/a"},
+			"update_time, display_name": {"users/a", "users/b", "users/c", "users/d", "users/e"},
+			"name, display_name desc":   {"users/a", "users/b", "users/c", "users/d", "users/e"},
+			"name desc":                 {"users/e", "users/d", "users/c", "users/b", "users/a"},
+		} {
+			assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 2, OrderBy: orderBy}), want)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		params func(nextPageToken string) domain.ListUsersParams
+	}{
+		{
+			name: "failure - page token reused with different order by",
+			params: func(nextPageToken string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, PageToken: nextPageToken, OrderBy: "email desc"}
+			},
+		},
+		{
+			name: "failure - page token reused with different filter",
+			params: func(nextPageToken string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, PageToken: nextPageToken, Filter: `display_name:"User"`}
+			},
+		},
+		{
+			name: "failure - page token reused with show deleted",
+			params: func(nextPageToken string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, PageToken: nextPageToken, ShowDeleted: true}
+			},
+		},
+		{
+			name: "failure - invalid page token",
+			params: func(string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, PageToken: "invalid page token"}
+			},
+		},
+		{
+			name: "failure - invalid filter",
+			params: func(string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, Filter: `display_name =`}
+			},
+		},
+		{
+			name: "failure - unknown filter field",
+			params: func(string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, Filter: `etag = "x"`}
+			},
+		},
+		{
+			name: "failure - invalid order by",
+			params: func(string) domain.ListUsersParams {
+				return domain.ListUsersParams{PageSize: 1, OrderBy: "etag"}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := newRepo(t)
+			ctx := t.Context()
+			createUsers(t, repo, "a", "b", "c")
+			_, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 1})
+			assert.NilError(t, err)
+
+			_, _, err = repo.ListUsers(ctx, tt.params(nextPageToken))
+			assertErrorType(t, err, domain.InvalidInput)
+		})
+	}
+}
+
+func testUpdate(t *testing.T, newRepo Factory) {
+	t.Run("success - only masked fields", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane")[0]
+
+		updated, createdNow, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/jane",
+			DisplayName: "Renamed User",
+			Email:       "ignored@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+		assert.Assert(t, !createdNow)
+		assert.DeepEqual(t, updated, &domain.User{
+			Name:        "users/jane",
+			DisplayName: "Renamed User",
+			Email:       "jane@example.com",
+		}, ignoredTimeFields)
+		assertValidTimestamps(t, updated)
+		assert.DeepEqual(t, updated.CreateTime, created.CreateTime)
+		assert.Assert(t, updated.UpdateTime.After(created.UpdateTime))
+		assert.Equal(t, updated.Revision, created.Revision+1)
+		assert.Assert(t, updated.Etag != created.Etag)
+
+		retrieved, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, updated)
+	})
+
+	t.Run("success - full replacement keeps create time", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created := createUsers(t, repo, "jane")[0]
+
+		updated, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/jane",
+			DisplayName: "Renamed User",
+			Email:       "renamed@example.com",
+			CreateTime:  time.Unix(0, 0).UTC(),
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}})
+		assert.NilError(t, err)
+		assert.Equal(t, updated.DisplayName, "Renamed User")
+		assert.Equal(t, updated.Email, "renamed@example.com")
+		assert.DeepEqual(t, updated.CreateTime, created.CreateTime)
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		_, _, err := repo.UpdateUser(t.Context(), newUser("missing"),
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("failure - deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "jane")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+		_, _, err := repo.UpdateUser(ctx, newUser("jane"), domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("failure - output only path", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "jane")
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{Name: "users/jane"},
+			domain.UpdateUserParams{UpdateMask: []string{"create_time"}})
+		assertError(t, err, &domain.Error{
+			Type:    domain.InvalidInput,
+			Message: "update_mask path is not updatable: create_time",
+		})
+	})
+
+	t.Run("failure - missing required fields", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane")[0]
+		_, _, err := repo.UpdateUser(ctx, &domain.User{Name: "users/jane", Email: "jane@example.com"},
+			domain.UpdateUserParams{UpdateMask: []string{"*"}})
+		assertError(t, err, &domain.Error{Type: domain.InvalidInput, Message: "display_name is required"})
+
+		// A failed update must leave the user unchanged
+		retrieved, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, created)
+	})
+
+	t.Run("success - allow missing creates user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		upserted, created, err := repo.UpdateUser(ctx, newUser("jane"),
+			domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+		assert.NilError(t, err)
+		assert.Assert(t, created)
+		assertValidTimestamps(t, upserted)
+		assert.DeepEqual(t, upserted.CreateTime, upserted.UpdateTime)
+		assert.DeepEqual(t, upserted, newUser("jane"), ignoredTimeFields)
+
+		retrieved, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, upserted)
+	})
+
+	t.Run("success - allow missing updates existing user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		existing := createUsers(t, repo, "jane")[0]
+		updated, created, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/jane",
+			DisplayName: "Renamed User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, AllowMissing: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !created)
+		assert.Equal(t, updated.Email, existing.Email)
+		assert.DeepEqual(t, updated.CreateTime, existing.CreateTime)
+	})
+
+	t.Run("failure - allow missing with missing required fields", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		_, _, err := repo.UpdateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "Jane"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}, AllowMissing: true})
+		assertError(t, err, &domain.Error{Type: domain.InvalidInput, Message: "email is required"})
+
+		// A failed upsert must not leave a partial user behind
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("failure - allow missing on deleted user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "jane")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+		_, _, err := repo.UpdateUser(ctx, newUser("jane"),
+			domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+		assertError(t, err, &domain.Error{Type: domain.AlreadyExists, Message: "user already exists: users/jane"})
+	})
+
+	t.Run("success - matching etag", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created := createUsers(t, repo, "jane")[0]
+		updated, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/jane",
+			DisplayName: "Renamed User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+		assert.NilError(t, err)
+		assert.Equal(t, updated.Revision, created.Revision+1)
+	})
+
+	t.Run("failure - stale etag", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane")[0]
+		_, _, err := repo.UpdateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "First Writer"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+		assert.NilError(t, err)
+		_, _, err = repo.UpdateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "Second Writer"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+		assertError(t, err, &domain.Error{
+			Type:    domain.Conflict,
+			Message: "etag mismatch: the user has been modified",
+		})
+
+		retrieved, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, retrieved.DisplayName, "First Writer")
+	})
+
+	t.Run("failure - allow missing with etag", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		_, _, err := repo.UpdateUser(t.Context(), newUser("jane"),
+			domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true, Etag: "stale"})
+		assertError(t, err, &domain.Error{
+			Type:    domain.Conflict,
+			Message: "etag mismatch: the user does not exist",
+		})
+	})
+}
+
+func testBatchUpdate(t *testing.T, newRepo Factory) {
+	t.Run("success - every update with its own mask", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		users := createUsers(t, repo, "a", "b")
+		updated, err := repo.BatchUpdateUsers(ctx, []domain.UserUpdate{
+			{
+				User:   &domain.User{Name: "users/b", DisplayName: "Renamed", Email: "ignored@example.com"},
+				Params: domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: users[1].Etag},
+			},
+			{
+				User:   &domain.User{Name: "users/a", Email: "new-a@example.com"},
+				Params: domain.UpdateUserParams{UpdateMask: []string{"email"}},
+			},
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(updated), []string{"users/b", "users/a"})
+		assert.Equal(t, updated[0].DisplayName, "Renamed")
+		assert.Equal(t, updated[0].Email, "b@example.com")
+		assert.Equal(t, updated[1].DisplayName, "User a")
+		assert.Equal(t, updated[1].Email, "new-a@example.com")
+		for _, user := range updated {
+			retrieved, err := repo.GetUser(ctx, user.Name, domain.GetUserParams{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, retrieved, user)
+		}
+
+		// The old email is released
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/c", DisplayName: "User c", Email: "a@example.com"})
+		assert.NilError(t, err)
+	})
+
+	t.Run("success - updates of the same user apply in order", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "a")
+		mask := domain.UpdateUserParams{UpdateMask: []string{"display_name"}}
+		updated, err := repo.BatchUpdateUsers(t.Context(), []domain.UserUpdate{
+			{User: &domain.User{Name: "users/a", DisplayName: "First"}, Params: mask},
+			{User: &domain.User{Name: "users/a", DisplayName: "Second"}, Params: mask},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, updated[1].DisplayName, "Second")
+		assert.Assert(t, updated[1].Revision > updated[0].Revision)
+		retrieved, err := repo.GetUser(t.Context(), "users/a", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, updated[1])
+	})
+
+	t.Run("success - allow missing creates users", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		updated, err := repo.BatchUpdateUsers(t.Context(), []domain.UserUpdate{{
+			User:   newUser("a"),
+			Params: domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true},
+		}})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, updated[0], newUser("a"), ignoredTimeFields)
+	})
+
+	t.Run("failure - applies no update", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		users := createUsers(t, repo, "a", "b", "c")
+		mask := domain.UpdateUserParams{UpdateMask: []string{"display_name"}}
+		_, err := repo.BatchUpdateUsers(ctx, []domain.UserUpdate{
+			{User: &domain.User{Name: "users/a", DisplayName: "Renamed"}, Params: mask},
+			{User: &domain.User{Name: "users/missing", DisplayName: "Renamed"}, Params: mask},
+		})
+		assertBatchItemError(t, err, 1, errNotFound)
+
+		_, err = repo.BatchUpdateUsers(ctx, []domain.UserUpdate{
+			{User: &domain.User{Name: "users/a", DisplayName: "Renamed"}, Params: mask},
+			{
+				User:   &domain.User{Name: "users/b", DisplayName: "Renamed"},
+				Params: domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: "stale"},
+			},
+		})
+		assertErrorType(t, err, domain.Conflict)
+
+		_, err = repo.BatchUpdateUsers(ctx, []domain.UserUpdate{
+			{
+				User:   &domain.User{Name: "users/a", Email: "new-a@example.com"},
+				Params: domain.UpdateUserParams{UpdateMask: []string{"email"}},
+			},
+			{
+				User:   &domain.User{Name: "users/b", Email: "C@example.com"},
+				Params: domain.UpdateUserParams{UpdateMask: []string{"email"}},
+			},
+		})
+		assertBatchItemError(t, err, 1, &domain.Error{
+			Type:    domain.AlreadyExists,
+			Message: "email is already in use",
+			Field:   "email",
+		})
+
+		for _, user := range users {
+			retrieved, err := repo.GetUser(ctx, user.Name, domain.GetUserParams{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, retrieved, user)
+		}
+		// The email of the update that was rolled back is still free
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/d", DisplayName: "User d", Email: "new-a@example.com"})
+		assert.NilError(t, err)
+	})
+}
+
+func testDelete(t *testing.T, newRepo Factory) {
+	t.Run("success - soft deletes with purge time", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane")[0]
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+
+		deleted, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Equal(t, deleted.DeleteTime.Location(), time.UTC)
+		assert.Assert(t, time.Since(deleted.DeleteTime) < time.Second)
+		assert.Equal(t, deleted.PurgeTime, deleted.DeleteTime.Add(time.Hour))
+		assert.DeepEqual(t, deleted.CreateTime, created.CreateTime)
+		assert.Assert(t, deleted.Etag != created.Etag)
+	})
+
+	t.Run("success - matching etag", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created := createUsers(t, repo, "jane")[0]
+		assert.NilError(t, repo.DeleteUser(t.Context(), "users/jane", domain.DeleteUserParams{Etag: created.Etag}))
+	})
+
+	t.Run("failure - stale etag", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane")[0]
+		_, _, err := repo.UpdateUser(ctx, &domain.User{Name: "users/jane", DisplayName: "Renamed User"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+
+		err = repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Etag: created.Etag})
+		assertError(t, err, &domain.Error{
+			Type:    domain.Conflict,
+			Message: "etag mismatch: the user has been modified",
+		})
+		_, err = repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		err := repo.DeleteUser(t.Context(), "users/missing", domain.DeleteUserParams{})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("failure - already deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "jane")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+		err := repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{})
+		assertError(t, err, errNotFound)
+	})
+}
+
+func testBatchDelete(t *testing.T, newRepo Factory) {
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		users := createUsers(t, repo, "a", "b", "c")
+		assert.NilError(t, repo.BatchDeleteUsers(ctx, []domain.UserDeletion{
+			{Name: "users/a", Params: domain.DeleteUserParams{Retention: time.Hour, Etag: users[0].Etag}},
+			{Name: "users/c", Params: domain.DeleteUserParams{Retention: time.Hour}},
+		}))
+		assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 10}), []string{"users/b"})
+		deleted, err := repo.GetUser(ctx, "users/a", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, deleted.PurgeTime, deleted.DeleteTime.Add(time.Hour))
+
+		// Deleted users release their email
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/d", DisplayName: "User d", Email: "a@example.com"})
+		assert.NilError(t, err)
+	})
+
+	t.Run("failure - deletes no user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b")
+		retention := domain.DeleteUserParams{Retention: time.Hour}
+
+		err := repo.BatchDeleteUsers(ctx, []domain.UserDeletion{
+			{Name: "users/a", Params: retention},
+			{Name: "users/missing", Params: retention},
+		})
+		assertBatchItemError(t, err, 1, errNotFound)
+
+		err = repo.BatchDeleteUsers(ctx, []domain.UserDeletion{
+			{Name: "users/a", Params: retention},
+			{Name: "users/b", Params: domain.DeleteUserParams{Retention: time.Hour, Etag: "stale"}},
+		})
+		assertErrorType(t, err, domain.Conflict)
+
+		// Deleting a user twice fails the second time
+		err = repo.BatchDeleteUsers(ctx, []domain.UserDeletion{
+			{Name: "users/a", Params: retention},
+			{Name: "users/a", Params: retention},
+		})
+		assertBatchItemError(t, err, 1, errNotFound)
+
+		assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 10}), []string{"users/a", "users/b"})
+	})
+}
+
+func testUndelete(t *testing.T, newRepo Factory) {
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created := createUsers(t, repo, "jane")[0]
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+
+		restored, err := repo.UndeleteUser(ctx, "users/jane")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, restored, created, ignoredTimeFields)
+		assert.Assert(t, restored.DeleteTime.IsZero())
+		assert.Assert(t, restored.PurgeTime.IsZero())
+		assert.DeepEqual(t, restored.CreateTime, created.CreateTime)
+		assert.Assert(t, restored.UpdateTime.After(created.UpdateTime))
+
+		retrieved, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, restored)
+	})
+
+	t.Run("failure - not deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "jane")
+		_, err := repo.UndeleteUser(t.Context(), "users/jane")
+		assertError(t, err, &domain.Error{Type: domain.AlreadyExists, Message: "user is not deleted: users/jane"})
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		_, err := repo.UndeleteUser(t.Context(), "users/missing")
+		assertError(t, err, errNotFound)
+	})
+}
+
+func testPurgeExpired(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	ctx := t.Context()
+	createUsers(t, repo, "active", "expired", "retained")
+	assert.NilError(t, repo.DeleteUser(ctx, "users/expired", domain.DeleteUserParams{}))
+	assert.NilError(t, repo.DeleteUser(ctx, "users/retained", domain.DeleteUserParams{Retention: time.Hour}))
+
+	purged, err := repo.PurgeExpiredUsers(ctx, time.Now().UTC())
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 1)
+
+	_, err = repo.GetUser(ctx, "users/expired", domain.GetUserParams{ShowDeleted: true})
+	assertError(t, err, errNotFound)
+	_, err = repo.GetUser(ctx, "users/retained", domain.GetUserParams{ShowDeleted: true})
+	assert.NilError(t, err)
+	_, err = repo.GetUser(ctx, "users/active", domain.GetUserParams{})
+	assert.NilError(t, err)
+
+	// Purging again finds nothing, and a purged name can be reused
+	purged, err = repo.PurgeExpiredUsers(ctx, time.Now().UTC())
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 0)
+	createUsers(t, repo, "expired")
+}
+
+func testPurge(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	ctx := t.Context()
+	createUsers(t, repo, "active", "deleted", "retained")
+	assert.NilError(t, repo.DeleteUser(ctx, "users/deleted", domain.DeleteUserParams{Retention: time.Hour}))
+	assert.NilError(t, repo.DeleteUser(ctx, "users/retained", domain.DeleteUserParams{Retention: time.Hour}))
+
+	// Users that are active or missing are skipped, whatever the purge time
+	purged, err := repo.PurgeUsers(ctx, []string{"users/active", "users/deleted", "users/missing"})
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 1)
+
+	_, err = repo.GetUser(ctx, "users/deleted", domain.GetUserParams{ShowDeleted: true})
+	assertError(t, err, errNotFound)
+	_, err = repo.GetUser(ctx, "users/retained", domain.GetUserParams{ShowDeleted: true})
+	assert.NilError(t, err)
+	_, err = repo.GetUser(ctx, "users/active", domain.GetUserParams{})
+	assert.NilError(t, err)
+
+	// Purging again finds nothing, and a purged name can be reused
+	purged, err = repo.PurgeUsers(ctx, []string{"users/deleted"})
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 0)
+	createUsers(t, repo, "deleted")
+
+	purged, err = repo.PurgeUsers(ctx, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 0)
+}
+
+// historyKeeper is implemented by repositories that keep past versions of
+// users for reads at a point in time.
+type historyKeeper interface {
+	SetHistoryWindow(window time.Duration)
+}
+
+// newRepoWithHistory returns a repository that keeps an hour of history.
+// Repositories that can't be configured, such as those wrapping another
+// repository, must be created with an hour of history, or the test is
+// skipped if they keep none.
+func newRepoWithHistory(t *testing.T, newRepo Factory) port.UserRepository {
+	t.Helper()
+	repo := newRepo(t)
+	if keeper, ok := repo.(historyKeeper); ok {
+		keeper.SetHistoryWindow(time.Hour)
+	} else if _, err := repo.SnapshotUsers(t.Context(), time.Now()); err != nil {
+		t.Skipf("the repository keeps no history: %v", err)
+	}
+	return repo
+}
+
+func testSnapshot(t *testing.T, newRepo Factory) {
+	t.Run("reads past versions", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithHistory(t, newRepo)
+		ctx := t.Context()
+		created := createUsers(t, repo, "a")[0]
+		updated, _, err := repo.UpdateUser(ctx,
+			&domain.User{Name: "users/a", DisplayName: "Updated"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+		)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{}))
+
+		for _, tc := range []struct {
+			readTime time.Time
+			want     *domain.User
+		}{
+			{readTime: created.CreateTime.Add(-time.Nanosecond)},
+			{readTime: created.CreateTime, want: created},
+			{readTime: updated.UpdateTime.Add(-time.Nanosecond), want: created},
+			{readTime: updated.UpdateTime, want: updated},
+		} {
+			snapshot, err := repo.SnapshotUsers(ctx, tc.readTime)
+			assert.NilError(t, err)
+			user, err := snapshot.GetUser(ctx, "users/a", domain.GetUserParams{})
+			if tc.want == nil {
+				assertError(t, err, errNotFound)
+				continue
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, user, tc.want)
+		}
+
+		// The deleted version is only shown when asked for
+		snapshot, err := repo.SnapshotUsers(ctx, time.Now())
+		assert.NilError(t, err)
+		_, err = snapshot.GetUser(ctx, "users/a", domain.GetUserParams{})
+		assertError(t, err, errNotFound)
+		deleted, err := snapshot.GetUser(ctx, "users/a", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !deleted.DeleteTime.IsZero())
+	})
+
+	t.Run("lists past versions", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithHistory(t, newRepo)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+		before := time.Now()
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+		createUsers(t, repo, "d")
+
+		snapshot, err := repo.SnapshotUsers(ctx, before)
+		assert.NilError(t, err)
+		params := domain.ListUsersParams{PageSize: 1, ReadTime: before}
+		assert.DeepEqual(t, listAll(t, snapshot, params), []string{"users/a", "users/b", "users/c"})
+		params.Filter = `name != "users/a"`
+		assert.DeepEqual(t, listAll(t, snapshot, params), []string{"users/b", "users/c"})
+		assert.DeepEqual(t, listAll(t, repo, domain.ListUsersParams{PageSize: 1}), []string{"users/a", "users/c", "users/d"})
+
+		// Page tokens are tied to the read time
+		_, nextPageToken, err := snapshot.ListUsers(ctx, domain.ListUsersParams{PageSize: 1, ReadTime: before})
+		assert.NilError(t, err)
+		_, _, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 1, PageToken: nextPageToken})
+		assertErrorType(t, err, domain.InvalidInput)
+	})
+
+	t.Run("purged users are kept in the history", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithHistory(t, newRepo)
+		ctx := t.Context()
+		createUsers(t, repo, "a")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{}))
+		before := time.Now()
+		purged, err := repo.PurgeExpiredUsers(ctx, time.Now())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+
+		snapshot, err := repo.SnapshotUsers(ctx, before)
+		assert.NilError(t, err)
+		_, err = snapshot.GetUser(ctx, "users/a", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		snapshot, err = repo.SnapshotUsers(ctx, time.Now())
+		assert.NilError(t, err)
+		_, err = snapshot.GetUser(ctx, "users/a", domain.GetUserParams{ShowDeleted: true})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("read time outside the history", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithHistory(t, newRepo)
+		ctx := t.Context()
+		for _, readTime := range []time.Time{
+			time.Now().Add(time.Minute),
+			time.Now().Add(-2 * time.Hour),
+			time.Now().Add(-time.Minute), // Before the repository was created
+		} {
+			_, err := repo.SnapshotUsers(ctx, readTime)
+			assertErrorType(t, err, domain.FailedPrecondition)
+		}
+	})
+}
+
+// revisionKeeper is implemented by repositories that keep replaced revisions
+// of users.
+type revisionKeeper interface {
+	SetRevisionRetention(retention time.Duration)
+}
+
+// newRepoWithRevisions returns a repository that keeps replaced revisions for
+// an hour. Repositories that can't be configured must be created that way.
+func newRepoWithRevisions(t *testing.T, newRepo Factory) port.UserRepository {
+	t.Helper()
+	repo := newRepo(t)
+	if keeper, ok := repo.(revisionKeeper); ok {
+		keeper.SetRevisionRetention(time.Hour)
+	}
+	return repo
+}
+
+// listRevisions returns all revisions of a user, newest first, reading pages
+// of the given size.
+func listRevisions(t *testing.T, repo port.UserRepository, name string, pageSize int32) []*domain.User {
+	t.Helper()
+	var revisions []*domain.User
+	params := domain.ListUserRevisionsParams{PageSize: pageSize}
+	for {
+		page, nextPageToken, err := repo.ListUserRevisions(t.Context(), name, params)
+		assert.NilError(t, err)
+		assert.Assert(t, len(page) <= int(pageSize))
+		revisions = append(revisions, page...)
+		if nextPageToken == "" {
+			return revisions
+		}
+		params.PageToken = nextPageToken
+	}
+}
+
+var errRevisionNotFound = &domain.Error{Type: domain.NotFound, Message: "revision not found"} //nolint:gochecknoglobals // read-only
+
+func testRevisions(t *testing.T, newRepo Factory) {
+	t.Run("lists revisions newest first", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		alice := domain.ContextWithActor(t.Context(), "alice")
+		bob := domain.ContextWithActor(t.Context(), "bob")
+		created, err := repo.CreateUser(alice, newUser("a"))
+		assert.NilError(t, err)
+		assert.Equal(t, created.RevisionActor, "alice")
+		_, _, err = repo.UpdateUser(bob,
+			&domain.User{Name: "users/a", DisplayName: "Updated"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+		)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(t.Context(), "users/a", domain.DeleteUserParams{Retention: time.Hour}))
+		current, err := repo.GetUser(t.Context(), "users/a", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+
+		revisions := listRevisions(t, repo, "users/a", 10)
+		assert.Equal(t, len(revisions), 3)
+		assert.DeepEqual(t, revisions[0], current)
+		assert.DeepEqual(t, revisions[2], created)
+		assert.Equal(t, revisions[1].DisplayName, "Updated")
+		for i, revision := range revisions {
+			assert.Equal(t, revision.RevisionActor, []string{"", "bob", "alice"}[i])
+			if i > 0 {
+				assert.Assert(t, revision.RevisionID != revisions[i-1].RevisionID)
+				assert.Assert(t, !revision.RevisionCreateTime.After(revisions[i-1].RevisionCreateTime))
+			}
+		}
+		assert.Equal(t, current.RevisionCreateTime, current.DeleteTime)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b")
+		for i := range 4 {
+			_, _, err := repo.UpdateUser(ctx,
+				&domain.User{Name: "users/a", DisplayName: fmt.Sprintf("Update %d", i)},
+				domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+			)
+			assert.NilError(t, err)
+		}
+
+		all := listRevisions(t, repo, "users/a", 10)
+		assert.Equal(t, len(all), 5)
+		assert.DeepEqual(t, listRevisions(t, repo, "users/a", 2), all)
+		assert.DeepEqual(t, listRevisions(t, repo, "users/a", 5), all)
+
+		// Page tokens are tied to the user
+		_, nextPageToken, err := repo.ListUserRevisions(ctx, "users/a", domain.ListUserRevisionsParams{PageSize: 1})
+		assert.NilError(t, err)
+		_, _, err = repo.ListUserRevisions(ctx, "users/b", domain.ListUserRevisionsParams{
+			PageSize:  1,
+			PageToken: nextPageToken,
+		})
+		assertErrorType(t, err, domain.InvalidInput)
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		_, _, err := repo.ListUserRevisions(t.Context(), "users/a", domain.ListUserRevisionsParams{PageSize: 10})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("gets revisions", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		ctx := t.Context()
+		created := createUsers(t, repo, "a", "b")
+		_, _, err := repo.UpdateUser(ctx,
+			&domain.User{Name: "users/a", DisplayName: "Updated"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+		)
+		assert.NilError(t, err)
+
+		revision, err := repo.GetUserRevision(ctx, "users/a", created[0].RevisionID)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, revision, created[0])
+		_, err = repo.GetUserRevision(ctx, "users/a", "unknown")
+		assertError(t, err, errRevisionNotFound)
+		_, err = repo.GetUserRevision(ctx, "users/b", created[0].RevisionID)
+		assertError(t, err, errRevisionNotFound)
+	})
+
+	t.Run("rolls back", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		ctx := domain.ContextWithActor(t.Context(), "alice")
+		created := createUsers(t, repo, "a")[0]
+		updated, _, err := repo.UpdateUser(ctx,
+			&domain.User{Name: "users/a", DisplayName: "Updated", Email: "updated@example.com"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name", "email"}},
+		)
+		assert.NilError(t, err)
+
+		_, err = repo.RollbackUser(ctx, "users/a", domain.RollbackUserParams{
+			RevisionID: created.RevisionID,
+			Etag:       created.Etag,
+		})
+		assertErrorType(t, err, domain.Conflict)
+
+		rolledBack, err := repo.RollbackUser(ctx, "users/a", domain.RollbackUserParams{
+			RevisionID: created.RevisionID,
+			Etag:       updated.Etag,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, rolledBack.DisplayName, created.DisplayName)
+		assert.Equal(t, rolledBack.Email, created.Email)
+		assert.Assert(t, rolledBack.RevisionID != created.RevisionID)
+		assert.Equal(t, rolledBack.CreateTime, created.CreateTime)
+		assert.Assert(t, rolledBack.UpdateTime.After(updated.UpdateTime))
+		assert.Equal(t, rolledBack.RevisionActor, "alice")
+		current, err := repo.GetUser(ctx, "users/a", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, current, rolledBack)
+		assert.Equal(t, len(listRevisions(t, repo, "users/a", 10)), 3)
+	})
+
+	t.Run("failure - rollback", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		ctx := t.Context()
+		created := createUsers(t, repo, "a", "deleted")
+		_, _, err := repo.UpdateUser(ctx,
+			&domain.User{Name: "users/a", Email: "updated@example.com"},
+			domain.UpdateUserParams{UpdateMask: []string{"email"}},
+		)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/deleted", domain.DeleteUserParams{Retention: time.Hour}))
+
+		_, err = repo.RollbackUser(ctx, "users/a", domain.RollbackUserParams{RevisionID: "unknown"})
+		assertError(t, err, errRevisionNotFound)
+		_, err = repo.RollbackUser(ctx, "users/missing", domain.RollbackUserParams{RevisionID: created[0].RevisionID})
+		assertError(t, err, errNotFound)
+		_, err = repo.RollbackUser(ctx, "users/deleted", domain.RollbackUserParams{RevisionID: created[1].RevisionID})
+		assertError(t, err, errNotFound)
+
+		// The email of the revision has been taken since
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/b", DisplayName: "B", Email: created[0].Email})
+		assert.NilError(t, err)
+		_, err = repo.RollbackUser(ctx, "users/a", domain.RollbackUserParams{RevisionID: created[0].RevisionID})
+		assertErrorType(t, err, domain.AlreadyExists)
+	})
+
+	t.Run("revisions of purged users are kept", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		ctx := t.Context()
+		created := createUsers(t, repo, "a")[0]
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{}))
+		purged, err := repo.PurgeExpiredUsers(ctx, time.Now())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+
+		revisions := listRevisions(t, repo, "users/a", 10)
+		assert.Equal(t, len(revisions), 2)
+		assert.DeepEqual(t, revisions[1], created)
+		_, err = repo.GetUserRevision(ctx, "users/a", created.RevisionID)
+		assert.NilError(t, err)
+		_, err = repo.RollbackUser(ctx, "users/a", domain.RollbackUserParams{RevisionID: created.RevisionID})
+		assertError(t, err, errNotFound)
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		keeper, ok := repo.(revisionKeeper)
+		if !ok {
+			t.Skip("the repository can't be configured")
+		}
+		keeper.SetRevisionRetention(0)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b")
+		updated, _, err := repo.UpdateUser(ctx,
+			&domain.User{Name: "users/a", DisplayName: "Updated"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+		)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+		_, err = repo.PurgeExpiredUsers(ctx, time.Now())
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, listRevisions(t, repo, "users/a", 10), []*domain.User{updated})
+		_, _, err = repo.ListUserRevisions(ctx, "users/b", domain.ListUserRevisionsParams{PageSize: 10})
+		assertError(t, err, errNotFound)
+	})
+}
+
+// readEvents returns the events in the outbox without acknowledging them.
+func readEvents(t *testing.T, repo port.UserRepository) []domain.UserEvent {
+	t.Helper()
+	events, err := repo.ReadUserEvents(t.Context(), 1000)
+	assert.NilError(t, err)
+	return events
+}
+
+func testEvents(t *testing.T, newRepo Factory) {
+	t.Run("records an event for every write", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepoWithRevisions(t, newRepo)
+		ctx := domain.ContextWithActor(t.Context(), "alice")
+		created, err := repo.CreateUser(ctx, newUser("a"))
+		assert.NilError(t, err)
+		updated, _, err := repo.UpdateUser(ctx,
+			&domain.User{Name: "users/a", DisplayName: "Updated"},
+			domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+		)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{Retention: time.Hour}))
+		deleted, err := repo.GetUser(ctx, "users/a", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		restored, err := repo.UndeleteUser(ctx, "users/a")
+		assert.NilError(t, err)
+		rolledBack, err := repo.RollbackUser(ctx, "users/a", domain.RollbackUserParams{RevisionID: created.RevisionID})
+		assert.NilError(t, err)
+		upserted, _, err := repo.UpdateUser(ctx, newUser("b"), domain.UpdateUserParams{
+			UpdateMask:   []string{"display_name", "email"},
+			AllowMissing: true,
+		})
+		assert.NilError(t, err)
+
+		// Failed writes and purges have no events
+		_, err = repo.CreateUser(ctx, newUser("a"))
+		assertErrorType(t, err, domain.AlreadyExists)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+		purged, err := repo.PurgeExpiredUsers(ctx, time.Now())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+
+		events := readEvents(t, repo)
+		want := []struct {
+			eventType domain.UserEventType
+			user      *domain.User
+		}{
+			{eventType: domain.UserCreated, user: created},
+			{eventType: domain.UserUpdated, user: updated},
+			{eventType: domain.UserDeleted, user: deleted},
+			{eventType: domain.UserUpdated, user: restored},
+			{eventType: domain.UserUpdated, user: rolledBack},
+			{eventType: domain.UserCreated, user: upserted},
+			{eventType: domain.UserDeleted},
+		}
+		assert.Equal(t, len(events), len(want))
+		for i, event := range events {
+			assert.Equal(t, event.Type, want[i].eventType)
+			assert.Equal(t, event.ID, event.User.Name+"@"+event.User.RevisionID)
+			assert.Equal(t, event.User.RevisionActor, "alice")
+			if want[i].user != nil {
+				assert.DeepEqual(t, event.User, want[i].user)
+			}
+			if i > 0 {
+				assert.Assert(t, event.Sequence > events[i-1].Sequence)
+			}
+		}
+	})
+
+	t.Run("acknowledged events are removed", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+
+		events, err := repo.ReadUserEvents(ctx, 2)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, eventUsers(events), []string{"users/a", "users/b"})
+		// Reading doesn't remove them
+		assert.DeepEqual(t, eventUsers(readEvents(t, repo)), []string{"users/a", "users/b", "users/c"})
+
+		assert.NilError(t, repo.AckUserEvents(ctx, events))
+		assert.DeepEqual(t, eventUsers(readEvents(t, repo)), []string{"users/c"})
+		assert.NilError(t, repo.AckUserEvents(ctx, events))
+		assert.NilError(t, repo.AckUserEvents(ctx, nil))
+		assert.DeepEqual(t, eventUsers(readEvents(t, repo)), []string{"users/c"})
+
+		createUsers(t, repo, "d")
+		assert.NilError(t, repo.AckUserEvents(ctx, readEvents(t, repo)))
+		assert.Equal(t, len(readEvents(t, repo)), 0)
+	})
+
+	t.Run("events of a user are in order", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ids := []string{"a", "b", "c", "d"}
+		createUsers(t, repo, ids...)
+		concurrently(func(i int) {
+			_, _, err := repo.UpdateUser(t.Context(),
+				&domain.User{Name: "users/" + ids[i%len(ids)], DisplayName: fmt.Sprintf("Update %d", i)},
+				domain.UpdateUserParams{UpdateMask: []string{"display_name"}},
+			)
+			assert.Check(t, err)
+		})
+
+		events := readEvents(t, repo)
+		assert.Equal(t, len(events), len(ids)+workers)
+		revisions := make(map[string]int64)
+		for _, event := range events {
+			assert.Equal(t, event.User.Revision, revisions[event.User.Name]+1, "event %s out of order", event.ID)
+			revisions[event.User.Name] = event.User.Revision
+		}
+	})
+}
+
+// eventUsers returns the names of the users of events.
+func eventUsers(events []domain.UserEvent) []string {
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, event.User.Name)
+	}
+	return names
+}
+
+func testEmail(t *testing.T, newRepo Factory) {
+	emailTaken := &domain.Error{
+		Type:    domain.AlreadyExists,
+		Message: "email is already in use",
+		Field:   "email",
+	}
+
+	t.Run("create - case insensitive", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "a")
+		_, err := repo.CreateUser(t.Context(), &domain.User{
+			Name:        "users/b",
+			DisplayName: "User b",
+			Email:       "A@Example.com",
+		})
+		assertError(t, err, emailTaken)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b")
+		mask := domain.UpdateUserParams{UpdateMask: []string{"email"}}
+
+		_, _, err := repo.UpdateUser(ctx, &domain.User{Name: "users/b", Email: "A@example.com"}, mask)
+		assertError(t, err, emailTaken)
+
+		// Changing the case of a user's own email is fine
+		_, _, err = repo.UpdateUser(ctx, &domain.User{Name: "users/a", Email: "A@example.com"}, mask)
+		assert.NilError(t, err)
+
+		// The old email is released when it changes
+		_, _, err = repo.UpdateUser(ctx, &domain.User{Name: "users/b", Email: "new-b@example.com"}, mask)
+		assert.NilError(t, err)
+		_, err = repo.CreateUser(ctx, &domain.User{Name: "users/c", DisplayName: "User c", Email: "b@example.com"})
+		assert.NilError(t, err)
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "a")
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/b",
+			DisplayName: "User b",
+			Email:       "a@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+		assertError(t, err, emailTaken)
+	})
+
+	t.Run("delete releases and undelete reclaims", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{Retention: time.Hour}))
+		_, err := repo.CreateUser(ctx, &domain.User{Name: "users/b", DisplayName: "User b", Email: "a@example.com"})
+		assert.NilError(t, err)
+
+		_, err = repo.UndeleteUser(ctx, "users/a")
+		assertError(t, err, emailTaken)
+
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{Retention: time.Hour}))
+		_, err = repo.UndeleteUser(ctx, "users/a")
+		assert.NilError(t, err)
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		created, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/jane",
+			DisplayName: "Jane",
+			Email:       "Jane@Example.com",
+		})
+		assert.NilError(t, err)
+
+		found, err := repo.LookupUserByEmail(ctx, "jane@EXAMPLE.com")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, found, created)
+
+		assert.NilError(t, repo.DeleteUser(ctx, "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+		_, err = repo.LookupUserByEmail(ctx, "jane@example.com")
+		assertError(t, err, errNotFound)
+	})
+}
+
+// workers is the number of goroutines in the concurrent scenarios.
+const workers = 16
+
+// concurrently runs fn in workers goroutines and waits for all of them.
+func concurrently(fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// outcomes counts the results of concurrent calls by error type, with nil
+// errors counted under "ok".
+type outcomes struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+func (o *outcomes) record(t *testing.T, err error) {
+	t.Helper()
+	key := "ok"
+	if err != nil {
+		var domainErr *domain.Error
+		if !errors.As(err, &domainErr) {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		key = fmt.Sprint(domainErr.Type)
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.counts == nil {
+		o.counts = make(map[string]int)
+	}
+	o.counts[key]++
+}
+
+func testConcurrency(t *testing.T, newRepo Factory) {
+	t.Run("concurrent creates of one name succeed once", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		var results outcomes
+		concurrently(func(i int) {
+			_, err := repo.CreateUser(t.Context(), &domain.User{
+				Name:        "users/jane",
+				DisplayName: "Jane",
+				Email:       fmt.Sprintf("jane%d@example.com", i),
+			})
+			results.record(t, err)
+		})
+		assert.DeepEqual(t, results.counts, map[string]int{
+			"ok":                             1,
+			fmt.Sprint(domain.AlreadyExists): workers - 1,
+		})
+	})
+
+	t.Run("concurrent creates with one email succeed once", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		var results outcomes
+		concurrently(func(i int) {
+			_, err := repo.CreateUser(t.Context(), &domain.User{
+				Name:        fmt.Sprintf("users/jane%d", i),
+				DisplayName: "Jane",
+				Email:       "JANE@example.com"[:i%4] + "jane@example.com"[i%4:],
+			})
+			results.record(t, err)
+		})
+		assert.DeepEqual(t, results.counts, map[string]int{
+			"ok":                             1,
+			fmt.Sprint(domain.AlreadyExists): workers - 1,
+		})
+	})
+
+	t.Run("concurrent upserts create exactly once", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		var (
+			results outcomes
+			creates outcomes
+		)
+		concurrently(func(i int) {
+			_, created, err := repo.UpdateUser(t.Context(), &domain.User{
+				Name:        "users/jane",
+				DisplayName: fmt.Sprintf("Worker %d", i),
+				Email:       "jane@example.com",
+			}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+			results.record(t, err)
+			if created {
+				creates.record(t, nil)
+			}
+		})
+		assert.DeepEqual(t, results.counts, map[string]int{"ok": workers})
+		assert.DeepEqual(t, creates.counts, map[string]int{"ok": 1})
+
+		retrieved, err := repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, retrieved.Revision, int64(workers))
+	})
+
+	t.Run("concurrent updates with one etag succeed once", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created := createUsers(t, repo, "jane")[0]
+		var results outcomes
+		concurrently(func(i int) {
+			_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+				Name:        "users/jane",
+				DisplayName: fmt.Sprintf("Worker %d", i),
+			}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+			results.record(t, err)
+		})
+		assert.DeepEqual(t, results.counts, map[string]int{
+			"ok":                        1,
+			fmt.Sprint(domain.Conflict): workers - 1,
+		})
+	})
+
+	t.Run("concurrent updates are all applied", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		created := createUsers(t, repo, "jane")[0]
+		var results outcomes
+		concurrently(func(i int) {
+			_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+				Name:        "users/jane",
+				DisplayName: fmt.Sprintf("Worker %d", i),
+			}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+			results.record(t, err)
+		})
+		assert.DeepEqual(t, results.counts, map[string]int{"ok": workers})
+
+		retrieved, err := repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, retrieved.Revision, created.Revision+workers)
+	})
+
+	t.Run("concurrent deletes succeed once", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		createUsers(t, repo, "jane")
+		var results outcomes
+		concurrently(func(int) {
+			results.record(t, repo.DeleteUser(t.Context(), "users/jane", domain.DeleteUserParams{Retention: time.Hour}))
+		})
+		assert.DeepEqual(t, results.counts, map[string]int{
+			"ok":                        1,
+			fmt.Sprint(domain.NotFound): workers - 1,
+		})
+	})
+
+	t.Run("concurrent reads and writes", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "seed")
+		var results outcomes
+		concurrently(func(i int) {
+			id := fmt.Sprintf("user%02d", i)
+			switch i % 4 {
+			case 0:
+				_, err := repo.CreateUser(ctx, newUser(id))
+				results.record(t, err)
+				results.record(t, repo.DeleteUser(ctx, "users/"+id, domain.DeleteUserParams{}))
+			case 1:
+				_, _, err := repo.UpdateUser(ctx, newUser(id),
+					domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+				results.record(t, err)
+			case 2: //nolint:mnd // one in four workers reads pages
+				var seen []string
+				params := domain.ListUsersParams{PageSize: 2, ShowDeleted: true}
+				for {
+					users, nextPageToken, err := repo.ListUsers(ctx, params)
+					results.record(t, err)
+					if err != nil {
+						return
+					}
+					seen = append(seen, names(users)...)
+					if nextPageToken == "" {
+						break
+					}
+					params.PageToken = nextPageToken
+				}
+				// Pages never repeat or reorder users, whatever is written meanwhile
+				for j := 1; j < len(seen); j++ {
+					assert.Check(t, seen[j-1] < seen[j], "%s listed after %s", seen[j], seen[j-1])
+				}
+			default:
+				_, err := repo.GetUser(ctx, "users/seed", domain.GetUserParams{})
+				results.record(t, err)
+				_, err = repo.LookupUserByEmail(ctx, "seed@example.com")
+				results.record(t, err)
+			}
+		})
+		for outcome := range results.counts {
+			assert.Equal(t, outcome, "ok")
+		}
+		purged, err := repo.PurgeExpiredUsers(ctx, time.Now().UTC())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, workers/4) //nolint:mnd // the creating workers
+	})
+}
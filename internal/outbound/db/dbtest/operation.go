@@ -0,0 +1,209 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"gotest.tools/v3/assert"
+)
+
+// OperationStoreFactory returns a new, empty operation store for a test. It
+// should register any cleanup it needs with t.Cleanup.
+type OperationStoreFactory func(t *testing.T) port.OperationStore
+
+// TestOperationStore runs the conformance tests against operation stores
+// created by newStore.
+func TestOperationStore(t *testing.T, newStore OperationStoreFactory) {
+	t.Helper()
+	t.Run("Get", func(t *testing.T) { t.Parallel(); testGetOperation(t, newStore) })
+	t.Run("List", func(t *testing.T) { t.Parallel(); testListOperations(t, newStore) })
+	t.Run("Delete", func(t *testing.T) { t.Parallel(); testDeleteOperation(t, newStore) })
+	t.Run("Purge", func(t *testing.T) { t.Parallel(); testPurgeOperations(t, newStore) })
+}
+
+// doneTime is when the done operations of a test were done.
+var doneTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) //nolint:gochecknoglobals // read-only test value
+
+func putOperations(t *testing.T, store port.OperationStore) {
+	t.Helper()
+	for _, op := range []*domain.Operation{
+		{
+			Name:     "operations/a",
+			Metadata: domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 2},
+			Done:     true,
+			DoneTime: doneTime,
+			Response: domain.PurgeUsersResult{PurgeCount: 2},
+		},
+		{
+			Name:            "operations/b",
+			Metadata:        domain.PurgeUsersMetadata{PurgeCount: 2},
+			Owner:           "instance-1",
+			LeaseExpireTime: doneTime,
+		},
+		{
+			Name:     "operations/c",
+			Done:     true,
+			DoneTime: doneTime.Add(time.Hour),
+			Error:    domain.NewErrorUnavailable("operation was interrupted", nil),
+		},
+	} {
+		assert.NilError(t, store.PutOperation(t.Context(), op))
+	}
+}
+
+func operationNames(ops []*domain.Operation) []string {
+	names := make([]string, len(ops))
+	for i, op := range ops {
+		names[i] = op.Name
+	}
+	return names
+}
+
+func testGetOperation(t *testing.T, newStore OperationStoreFactory) {
+	t.Run("returns what was put", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		op, err := store.GetOperation(t.Context(), "operations/a")
+		assert.NilError(t, err)
+		assert.Assert(t, op.Done)
+		assert.Assert(t, op.DoneTime.Equal(doneTime))
+		assert.DeepEqual(t, op.Metadata, domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 2})
+		assert.DeepEqual(t, op.Response, domain.PurgeUsersResult{PurgeCount: 2})
+		assert.NilError(t, op.Error)
+
+		op, err = store.GetOperation(t.Context(), "operations/c")
+		assert.NilError(t, err)
+		assertError(t, op.Error, &domain.Error{Type: domain.Unavailable, Message: "operation was interrupted"})
+	})
+
+	t.Run("keeps cancellations", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		err := store.PutOperation(t.Context(), &domain.Operation{
+			Name:     "operations/a",
+			Done:     true,
+			DoneTime: doneTime,
+			Error:    context.Canceled,
+		})
+		assert.NilError(t, err)
+		op, err := store.GetOperation(t.Context(), "operations/a")
+		assert.NilError(t, err)
+		assert.ErrorIs(t, op.Error, context.Canceled)
+	})
+
+	t.Run("replaces operations", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		op, err := store.GetOperation(t.Context(), "operations/b")
+		assert.NilError(t, err)
+		op.Metadata = domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 1}
+		assert.NilError(t, store.PutOperation(t.Context(), op))
+		op, err = store.GetOperation(t.Context(), "operations/b")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, op.Metadata, domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 1})
+	})
+
+	t.Run("keeps copies of operations", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		op, err := store.GetOperation(t.Context(), "operations/b")
+		assert.NilError(t, err)
+		op.Done = true
+		op, err = store.GetOperation(t.Context(), "operations/b")
+		assert.NilError(t, err)
+		assert.Assert(t, !op.Done)
+	})
+
+	t.Run("missing operation", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		_, err := store.GetOperation(t.Context(), "operations/a")
+		assertError(t, err, &domain.Error{Type: domain.NotFound, Message: "operation not found"})
+	})
+}
+
+func testListOperations(t *testing.T, newStore OperationStoreFactory) {
+	t.Run("lists operations in pages", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		ops, token, err := store.ListOperations(t.Context(), domain.ListOperationsParams{PageSize: 2})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, operationNames(ops), []string{"operations/a", "operations/b"})
+		ops, token, err = store.ListOperations(t.Context(), domain.ListOperationsParams{PageSize: 2, PageToken: token})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, operationNames(ops), []string{"operations/c"})
+		assert.Equal(t, token, "")
+	})
+
+	t.Run("lists operations that match a filter", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		params := domain.ListOperationsParams{PageSize: 1, Filter: "done"}
+		ops, token, err := store.ListOperations(t.Context(), params)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, operationNames(ops), []string{"operations/a"})
+		params.PageToken = token
+		ops, token, err = store.ListOperations(t.Context(), params)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, operationNames(ops), []string{"operations/c"})
+		assert.Equal(t, token, "")
+
+		// Page tokens only work with the filter they were issued for
+		_, _, err = store.ListOperations(t.Context(), domain.ListOperationsParams{PageToken: params.PageToken})
+		assert.ErrorContains(t, err, "invalid page token")
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		_, _, err := store.ListOperations(t.Context(), domain.ListOperationsParams{Filter: "unknown = 1"})
+		assert.ErrorContains(t, err, "invalid filter")
+	})
+}
+
+func testDeleteOperation(t *testing.T, newStore OperationStoreFactory) {
+	t.Run("deletes operations", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		assert.NilError(t, store.DeleteOperation(t.Context(), "operations/a"))
+		_, err := store.GetOperation(t.Context(), "operations/a")
+		assertError(t, err, &domain.Error{Type: domain.NotFound, Message: "operation not found"})
+		err = store.DeleteOperation(t.Context(), "operations/a")
+		assertError(t, err, &domain.Error{Type: domain.NotFound, Message: "operation not found"})
+	})
+}
+
+func testPurgeOperations(t *testing.T, newStore OperationStoreFactory) {
+	t.Run("purges operations done before a time", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		purged, err := store.PurgeOperations(t.Context(), doneTime.Add(time.Minute))
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+		ops, _, err := store.ListOperations(t.Context(), domain.ListOperationsParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, operationNames(ops), []string{"operations/b", "operations/c"})
+	})
+
+	t.Run("keeps operations that aren't done", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		putOperations(t, store)
+		purged, err := store.PurgeOperations(t.Context(), time.Now())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 2)
+		ops, _, err := store.ListOperations(t.Context(), domain.ListOperationsParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, operationNames(ops), []string{"operations/b"})
+	})
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// bumpRevision records a write to the user by incrementing its revision and
+// recomputing its etag. The caller must have set the times of the write.
+func bumpRevision(user *domain.User, c change) {
+	user.Revision++
+	user.Etag = userEtag(user)
+	user.RevisionActor = c.actor
+	setRevisionFields(user)
+}
+
+// setRevisionFields sets the revision ID and create time of a user version,
+// which are derived from its other fields rather than stored.
+func setRevisionFields(user *domain.User) {
+	user.RevisionID = revisionID(user)
+	user.RevisionCreateTime = changeTime(user)
+}
+
+// revisionEncoding encodes revision IDs in lowercase letters and digits.
+//
+//nolint:gochecknoglobals // read-only encoding
+var revisionEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// revisionID returns the ID of a user revision. Like the etag, it covers the
+// create time, so that the revisions of a purged user and of a user later
+// created with the same name never share an ID.
+func revisionID(user *domain.User) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(user.Name))
+	_, _ = h.Write(binary.BigEndian.AppendUint64(nil, uint64(user.CreateTime.UnixNano())))
+	_, _ = h.Write(binary.BigEndian.AppendUint64(nil, uint64(user.Revision)))
+	return revisionEncoding.EncodeToString(h.Sum(nil)[:8])
+}
+
+// userEtag returns the etag of a user revision. The create time is included so
+// that an etag of a purged user never matches a user later created with the
+// same name.
+func userEtag(user *domain.User) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(user.Name))
+	_, _ = h.Write(binary.BigEndian.AppendUint64(nil, uint64(user.CreateTime.UnixNano())))
+	_, _ = h.Write(binary.BigEndian.AppendUint64(nil, uint64(user.Revision)))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// checkEtag returns a conflict error if an etag was given and it doesn't
+// match the user's current etag.
+func checkEtag(user *domain.User, etag string) error {
+	if etag != "" && etag != user.Etag {
+		return domain.NewErrorConflict("etag mismatch: the user has been modified", nil)
+	}
+	return nil
+}
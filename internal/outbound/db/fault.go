@@ -0,0 +1,547 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+)
+
+// The methods of port.UserRepository that faults can be injected into.
+const (
+	MethodCreateUser        = "CreateUser"
+	MethodBatchCreateUsers  = "BatchCreateUsers"
+	MethodGetUser           = "GetUser"
+	MethodBatchGetUsers     = "BatchGetUsers"
+	MethodListUsers         = "ListUsers"
+	MethodUpdateUser        = "UpdateUser"
+	MethodBatchUpdateUsers  = "BatchUpdateUsers"
+	MethodDeleteUser        = "DeleteUser"
+	MethodBatchDeleteUsers  = "BatchDeleteUsers"
+	MethodUndeleteUser      = "UndeleteUser"
+	MethodPurgeExpiredUsers = "PurgeExpiredUsers"
+	MethodPurgeUsers        = "PurgeUsers"
+	MethodLookupUserByEmail = "LookupUserByEmail"
+	MethodSnapshotUsers     = "SnapshotUsers"
+	MethodListUserRevisions = "ListUserRevisions"
+	MethodGetUserRevision   = "GetUserRevision"
+	MethodRollbackUser      = "RollbackUser"
+	MethodReadUserEvents    = "ReadUserEvents"
+	MethodAckUserEvents     = "AckUserEvents"
+)
+
+//nolint:gochecknoglobals // read-only allow-list
+var faultMethods = []string{
+	MethodCreateUser,
+	MethodBatchCreateUsers,
+	MethodGetUser,
+	MethodBatchGetUsers,
+	MethodListUsers,
+	MethodUpdateUser,
+	MethodBatchUpdateUsers,
+	MethodDeleteUser,
+	MethodBatchDeleteUsers,
+	MethodUndeleteUser,
+	MethodPurgeExpiredUsers,
+	MethodPurgeUsers,
+	MethodLookupUserByEmail,
+	MethodSnapshotUsers,
+	MethodListUserRevisions,
+	MethodGetUserRevision,
+	MethodRollbackUser,
+	MethodReadUserEvents,
+	MethodAckUserEvents,
+}
+
+// faultErrors are the errors that can be injected, by name.
+//
+//nolint:gochecknoglobals // read-only lookup table
+var faultErrors = map[string]func(message string, err error) error{
+	"timeout":            domain.NewErrorTimeout,
+	"unavailable":        domain.NewErrorUnavailable,
+	"resource_exhausted": domain.NewErrorResourceExhausted,
+	"internal":           domain.NewErrorInternal,
+}
+
+// FaultConfig configures the faults injected by a FaultyRepository.
+type FaultConfig struct {
+	// Seed makes the probabilistic faults reproducible. Zero picks a random
+	// seed.
+	Seed uint64 `json:"seed,omitempty"`
+	// Rules are evaluated in order for every call, and the first rule that
+	// fires decides the fault.
+	Rules []FaultRule `json:"rules"`
+}
+
+// FaultRule injects latency, an error or both into calls of some methods.
+type FaultRule struct {
+	// Methods are the repository methods the rule applies to, such as
+	// "GetUser". Empty means all methods.
+	Methods []string `json:"methods,omitempty"`
+	// Probability is the chance that the rule fires for a call, from 0 to 1.
+	Probability float64 `json:"probability,omitempty"`
+	// Script, if set, decides whether the rule fires for each successive
+	// call instead of Probability. The rule stops firing once it runs out.
+	Script []bool `json:"script,omitempty"`
+	// Latency delays the call, such as "250ms".
+	Latency string `json:"latency,omitempty"`
+	// Error is the error to fail the call with: "timeout", "unavailable",
+	// "resource_exhausted" or "internal". Empty only adds latency.
+	Error string `json:"error,omitempty"`
+	// AfterCall fails the call after it reached the repository, so that a
+	// write is applied although the caller sees it fail.
+	AfterCall bool `json:"after_call,omitempty"`
+}
+
+// faultRule is a validated FaultRule and the state of its script.
+type faultRule struct {
+	FaultRule
+	latency  time.Duration
+	newError func(message string, err error) error
+	calls    int
+}
+
+func (r *faultRule) matches(method string) bool {
+	return len(r.Methods) == 0 || slices.Contains(r.Methods, method)
+}
+
+// FaultyRepository injects faults into the calls to another repository, to
+// test how clients handle timeouts, unavailability and partial failures.
+// Without rules, calls pass straight through.
+type FaultyRepository struct {
+	repo   port.UserRepository
+	logger *slog.Logger
+
+	mutex  sync.Mutex
+	config FaultConfig
+	rules  []*faultRule
+	random *rand.Rand
+}
+
+func NewFaultyRepository(logger *slog.Logger, repo port.UserRepository) *FaultyRepository {
+	return &FaultyRepository{
+		repo:   repo,
+		logger: logger,
+		random: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), //nolint:gosec // not used for security
+	}
+}
+
+// SetFaults replaces the injected faults, restarting their scripts and random
+// sequence.
+func (r *FaultyRepository) SetFaults(config FaultConfig) error {
+	rules := make([]*faultRule, 0, len(config.Rules))
+	for i, rule := range config.Rules {
+		parsed, err := parseFaultRule(rule)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		rules = append(rules, parsed)
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Uint64() //nolint:gosec // not used for security
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.config = config
+	r.rules = rules
+	r.random = rand.New(rand.NewPCG(seed, seed)) //nolint:gosec // not used for security
+	r.logger.Info("fault injection configured", "rules", len(rules), "seed", seed)
+	return nil
+}
+
+// Faults returns the injected faults.
+func (r *FaultyRepository) Faults() FaultConfig {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	config := r.config
+	if config.Rules == nil {
+		config.Rules = []FaultRule{}
+	}
+	return config
+}
+
+func parseFaultRule(rule FaultRule) (*faultRule, error) {
+	for _, method := range rule.Methods {
+		if !slices.Contains(faultMethods, method) {
+			return nil, fmt.Errorf("unknown method %q", method)
+		}
+	}
+	if rule.Probability < 0 || rule.Probability > 1 {
+		return nil, fmt.Errorf("probability %v is not between 0 and 1", rule.Probability)
+	}
+	parsed := &faultRule{FaultRule: rule}
+	if rule.Latency != "" {
+		latency, err := time.ParseDuration(rule.Latency)
+		if err != nil || latency < 0 {
+			return nil, fmt.Errorf("invalid latency %q", rule.Latency)
+		}
+		parsed.latency = latency
+	}
+	if rule.Error != "" {
+		var ok bool
+		if parsed.newError, ok = faultErrors[rule.Error]; !ok {
+			return nil, fmt.Errorf("unknown error %q", rule.Error)
+		}
+	}
+	if parsed.latency == 0 && parsed.newError == nil {
+		return nil, errors.New("rule has neither latency nor error")
+	}
+	return parsed, nil
+}
+
+// fire returns the first rule that fires for a call to method, if any.
+func (r *FaultyRepository) fire(method string) *faultRule {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, rule := range r.rules {
+		if !rule.matches(method) {
+			continue
+		}
+		var fires bool
+		if rule.Script != nil {
+			fires = rule.calls < len(rule.Script) && rule.Script[rule.calls]
+			rule.calls++
+		} else {
+			fires = r.random.Float64() < rule.Probability
+		}
+		if fires {
+			return rule
+		}
+	}
+	return nil
+}
+
+// inject applies the fault for a call to method, if any. It returns the
+// error to fail the call with before it reaches the repository, and the
+// error to fail it with after it did.
+func (r *FaultyRepository) inject(ctx context.Context, method string) (before, after error) {
+	rule := r.fire(method)
+	if rule == nil {
+		return nil, nil
+	}
+	r.logger.WarnContext(ctx, "injecting fault", "method", method, "latency", rule.latency, "error", rule.Error)
+	if rule.latency > 0 {
+		timer := time.NewTimer(rule.latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return domain.NewErrorTimeout("injected latency exceeded the deadline", ctx.Err()), nil
+		case <-timer.C:
+		}
+	}
+	if rule.newError == nil {
+		return nil, nil
+	}
+	err := rule.newError(fmt.Sprintf("injected fault: %s", rule.Error), nil)
+	if rule.AfterCall {
+		return nil, err
+	}
+	return err, nil
+}
+
+func (r *FaultyRepository) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+	before, after := r.inject(ctx, MethodCreateUser)
+	if before != nil {
+		return nil, before
+	}
+	created, err := r.repo.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return created, nil
+}
+
+func (r *FaultyRepository) BatchCreateUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.BatchCreateUsersParams,
+) ([]*domain.User, []error, error) {
+	before, after := r.inject(ctx, MethodBatchCreateUsers)
+	if before != nil {
+		return nil, nil, before
+	}
+	created, errs, err := r.repo.BatchCreateUsers(ctx, users, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if after != nil {
+		return nil, nil, after
+	}
+	return created, errs, nil
+}
+
+func (r *FaultyRepository) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	before, after := r.inject(ctx, MethodGetUser)
+	if before != nil {
+		return nil, before
+	}
+	user, err := r.repo.GetUser(ctx, name, params)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return user, nil
+}
+
+func (r *FaultyRepository) BatchGetUsers(ctx context.Context, names []string) (map[string]*domain.User, error) {
+	before, after := r.inject(ctx, MethodBatchGetUsers)
+	if before != nil {
+		return nil, before
+	}
+	users, err := r.repo.BatchGetUsers(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return users, nil
+}
+
+func (r *FaultyRepository) ListUsers(
+	ctx context.Context,
+	params domain.ListUsersParams,
+) ([]*domain.User, string, error) {
+	before, after := r.inject(ctx, MethodListUsers)
+	if before != nil {
+		return nil, "", before
+	}
+	users, nextPageToken, err := r.repo.ListUsers(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+	if after != nil {
+		return nil, "", after
+	}
+	return users, nextPageToken, nil
+}
+
+func (r *FaultyRepository) UpdateUser(
+	ctx context.Context,
+	user *domain.User,
+	params domain.UpdateUserParams,
+) (*domain.User, bool, error) {
+	before, after := r.inject(ctx, MethodUpdateUser)
+	if before != nil {
+		return nil, false, before
+	}
+	updated, created, err := r.repo.UpdateUser(ctx, user, params)
+	if err != nil {
+		return nil, false, err
+	}
+	if after != nil {
+		return nil, false, after
+	}
+	return updated, created, nil
+}
+
+func (r *FaultyRepository) BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error) {
+	before, after := r.inject(ctx, MethodBatchUpdateUsers)
+	if before != nil {
+		return nil, before
+	}
+	updated, err := r.repo.BatchUpdateUsers(ctx, updates)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return updated, nil
+}
+
+func (r *FaultyRepository) DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error {
+	before, after := r.inject(ctx, MethodDeleteUser)
+	if before != nil {
+		return before
+	}
+	if err := r.repo.DeleteUser(ctx, name, params); err != nil {
+		return err
+	}
+	return after
+}
+
+func (r *FaultyRepository) BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error {
+	before, after := r.inject(ctx, MethodBatchDeleteUsers)
+	if before != nil {
+		return before
+	}
+	if err := r.repo.BatchDeleteUsers(ctx, deletions); err != nil {
+		return err
+	}
+	return after
+}
+
+func (r *FaultyRepository) UndeleteUser(ctx context.Context, name string) (*domain.User, error) {
+	before, after := r.inject(ctx, MethodUndeleteUser)
+	if before != nil {
+		return nil, before
+	}
+	restored, err := r.repo.UndeleteUser(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return restored, nil
+}
+
+func (r *FaultyRepository) PurgeExpiredUsers(ctx context.Context, now time.Time) (int, error) {
+	before, after := r.inject(ctx, MethodPurgeExpiredUsers)
+	if before != nil {
+		return 0, before
+	}
+	purged, err := r.repo.PurgeExpiredUsers(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	if after != nil {
+		return purged, after
+	}
+	return purged, nil
+}
+
+func (r *FaultyRepository) PurgeUsers(ctx context.Context, names []string) (int, error) {
+	before, after := r.inject(ctx, MethodPurgeUsers)
+	if before != nil {
+		return 0, before
+	}
+	purged, err := r.repo.PurgeUsers(ctx, names)
+	if err != nil {
+		return 0, err
+	}
+	if after != nil {
+		return purged, after
+	}
+	return purged, nil
+}
+
+func (r *FaultyRepository) LookupUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	before, after := r.inject(ctx, MethodLookupUserByEmail)
+	if before != nil {
+		return nil, before
+	}
+	user, err := r.repo.LookupUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return user, nil
+}
+
+// SnapshotUsers injects faults into taking the snapshot, but not into reading
+// from it.
+func (r *FaultyRepository) SnapshotUsers(ctx context.Context, readTime time.Time) (port.UserSnapshot, error) {
+	before, after := r.inject(ctx, MethodSnapshotUsers)
+	if before != nil {
+		return nil, before
+	}
+	snapshot, err := r.repo.SnapshotUsers(ctx, readTime)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return snapshot, nil
+}
+
+func (r *FaultyRepository) ListUserRevisions(
+	ctx context.Context,
+	name string,
+	params domain.ListUserRevisionsParams,
+) ([]*domain.User, string, error) {
+	before, after := r.inject(ctx, MethodListUserRevisions)
+	if before != nil {
+		return nil, "", before
+	}
+	revisions, nextPageToken, err := r.repo.ListUserRevisions(ctx, name, params)
+	if err != nil {
+		return nil, "", err
+	}
+	if after != nil {
+		return nil, "", after
+	}
+	return revisions, nextPageToken, nil
+}
+
+func (r *FaultyRepository) GetUserRevision(ctx context.Context, name, revisionID string) (*domain.User, error) {
+	before, after := r.inject(ctx, MethodGetUserRevision)
+	if before != nil {
+		return nil, before
+	}
+	revision, err := r.repo.GetUserRevision(ctx, name, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return revision, nil
+}
+
+func (r *FaultyRepository) RollbackUser(
+	ctx context.Context,
+	name string,
+	params domain.RollbackUserParams,
+) (*domain.User, error) {
+	before, after := r.inject(ctx, MethodRollbackUser)
+	if before != nil {
+		return nil, before
+	}
+	restored, err := r.repo.RollbackUser(ctx, name, params)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return restored, nil
+}
+
+func (r *FaultyRepository) ReadUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error) {
+	before, after := r.inject(ctx, MethodReadUserEvents)
+	if before != nil {
+		return nil, before
+	}
+	events, err := r.repo.ReadUserEvents(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		return nil, after
+	}
+	return events, nil
+}
+
+func (r *FaultyRepository) AckUserEvents(ctx context.Context, events []domain.UserEvent) error {
+	before, after := r.inject(ctx, MethodAckUserEvents)
+	if before != nil {
+		return before
+	}
+	if err := r.repo.AckUserEvents(ctx, events); err != nil {
+		return err
+	}
+	return after
+}
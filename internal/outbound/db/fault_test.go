@@ -0,0 +1,169 @@
+package db_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
+	"gotest.tools/v3/assert"
+)
+
+func setupFaultyRepo(t *testing.T, faults db.FaultConfig) (*db.FaultyRepository, port.UserRepository) {
+	t.Helper()
+	inner := db.NewMemoryRepository(slog.Default())
+	inner.(*db.MemoryRepository).SetHistoryWindow(time.Hour)
+	inner.(*db.MemoryRepository).SetRevisionRetention(time.Hour)
+	repo := db.NewFaultyRepository(slog.Default(), inner)
+	assert.NilError(t, repo.SetFaults(faults))
+	return repo, inner
+}
+
+// TestFaultyRepositoryConformance runs the repository conformance suite
+// through a fault injector without faults.
+func TestFaultyRepositoryConformance(t *testing.T) {
+	t.Parallel()
+	dbtest.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+		repo, _ := setupFaultyRepo(t, db.FaultConfig{})
+		return repo
+	})
+}
+
+// TestFaultyRepository tests the injection of latency and errors.
+func TestFaultyRepository(t *testing.T) {
+	t.Parallel()
+
+	jane := &domain.User{Name: "users/jane", DisplayName: "Jane", Email: "jane@example.com"}
+
+	// outcomes returns whether each of n GetUser calls failed.
+	outcomes := func(t *testing.T, repo port.UserRepository, n int) []bool {
+		t.Helper()
+		failed := make([]bool, 0, n)
+		for range n {
+			_, err := repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	t.Run("injects errors by type and method", func(t *testing.T) {
+		t.Parallel()
+		for name, want := range map[string]domain.ErrorType{
+			"timeout":            domain.Timeout,
+			"unavailable":        domain.Unavailable,
+			"resource_exhausted": domain.ResourceExhausted,
+			"internal":           domain.Internal,
+		} {
+			repo, inner := setupFaultyRepo(t, db.FaultConfig{Rules: []db.FaultRule{
+				{Methods: []string{db.MethodGetUser}, Probability: 1, Error: name},
+			}})
+			_, err := inner.CreateUser(t.Context(), jane)
+			assert.NilError(t, err)
+
+			_, err = repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+			assertErrorType(t, err, want)
+			_, err = repo.LookupUserByEmail(t.Context(), "jane@example.com")
+			assert.NilError(t, err)
+		}
+	})
+
+	t.Run("same seed fails the same calls", func(t *testing.T) {
+		t.Parallel()
+		faults := db.FaultConfig{Seed: 42, Rules: []db.FaultRule{
+			{Probability: 0.5, Error: "unavailable"},
+		}}
+		first, _ := setupFaultyRepo(t, faults)
+		second, _ := setupFaultyRepo(t, faults)
+		firstOutcomes := outcomes(t, first, 64)
+		assert.DeepEqual(t, firstOutcomes, outcomes(t, second, 64))
+		assert.Assert(t, firstOutcomes[0] || firstOutcomes[1] || firstOutcomes[2] || firstOutcomes[3])
+
+		// Setting the faults again restarts the sequence
+		assert.NilError(t, first.SetFaults(faults))
+		assert.DeepEqual(t, outcomes(t, first, 64), firstOutcomes)
+	})
+
+	t.Run("script decides each call", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupFaultyRepo(t, db.FaultConfig{Rules: []db.FaultRule{
+			{Methods: []string{db.MethodGetUser}, Script: []bool{true, false, true}, Error: "unavailable"},
+		}})
+		_, err := inner.CreateUser(t.Context(), jane)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, outcomes(t, repo, 5), []bool{true, false, true, false, false})
+	})
+
+	t.Run("first firing rule wins", func(t *testing.T) {
+		t.Parallel()
+		repo, _ := setupFaultyRepo(t, db.FaultConfig{Rules: []db.FaultRule{
+			{Script: []bool{false, true}, Error: "timeout"},
+			{Probability: 1, Error: "unavailable"},
+		}})
+		_, err := repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assertErrorType(t, err, domain.Unavailable)
+		_, err = repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assertErrorType(t, err, domain.Timeout)
+	})
+
+	t.Run("partial failure applies the write", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupFaultyRepo(t, db.FaultConfig{Rules: []db.FaultRule{
+			{Methods: []string{db.MethodCreateUser}, Probability: 1, Error: "unavailable", AfterCall: true},
+		}})
+		_, err := repo.CreateUser(t.Context(), jane)
+		assertErrorType(t, err, domain.Unavailable)
+
+		// The user was created, so retrying the create fails differently
+		_, err = inner.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.NilError(t, repo.SetFaults(db.FaultConfig{}))
+		_, err = repo.CreateUser(t.Context(), jane)
+		assertErrorType(t, err, domain.AlreadyExists)
+	})
+
+	t.Run("latency delays the call", func(t *testing.T) {
+		t.Parallel()
+		repo, inner := setupFaultyRepo(t, db.FaultConfig{Rules: []db.FaultRule{
+			{Probability: 1, Latency: "20ms"},
+		}})
+		_, err := inner.CreateUser(t.Context(), jane)
+		assert.NilError(t, err)
+
+		start := time.Now()
+		_, err = repo.GetUser(t.Context(), "users/jane", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Assert(t, time.Since(start) >= 20*time.Millisecond)
+	})
+
+	t.Run("latency past the deadline is a timeout", func(t *testing.T) {
+		t.Parallel()
+		repo, _ := setupFaultyRepo(t, db.FaultConfig{Rules: []db.FaultRule{
+			{Probability: 1, Latency: "1h"},
+		}})
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+		assertErrorType(t, err, domain.Timeout)
+	})
+
+	t.Run("failure - invalid rules", func(t *testing.T) {
+		t.Parallel()
+		repo, _ := setupFaultyRepo(t, db.FaultConfig{})
+		for _, tt := range []struct {
+			rule db.FaultRule
+			want string
+		}{
+			{rule: db.FaultRule{Methods: []string{"DropUsers"}, Error: "internal"}, want: `rule 0: unknown method "DropUsers"`},
+			{rule: db.FaultRule{Probability: 2, Error: "internal"}, want: "rule 0: probability 2 is not between 0 and 1"},
+			{rule: db.FaultRule{Latency: "soon"}, want: `rule 0: invalid latency "soon"`},
+			{rule: db.FaultRule{Error: "oops"}, want: `rule 0: unknown error "oops"`},
+			{rule: db.FaultRule{Probability: 1}, want: "rule 0: rule has neither latency nor error"},
+		} {
+			assert.Error(t, repo.SetFaults(db.FaultConfig{Rules: []db.FaultRule{tt.rule}}), tt.want)
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+const (
+	walFileName      = "users.wal"
+	snapshotFileName = "users.snapshot"
+)
+
+// FileOptions configures a FileRepository.
+type FileOptions struct {
+	Dir              string        // Directory that holds the log and snapshot.
+	Sync             SyncPolicy    // When to fsync the log.
+	SyncInterval     time.Duration // How often to fsync with SyncPeriodic.
+	SnapshotInterval time.Duration // How often to snapshot and compact the log, zero disables it.
+}
+
+// FileRepository is a durable UserRepository backed by files in a directory.
+//
+// Reads are served by an in-memory repository, including its indexes. Every
+// write is appended to a write-ahead log before it is applied in memory,
+// together with its event in the same entry. Snapshots hold the revisions of
+// users that are kept, which end with their current versions unless they
+// were purged, and the events in the outbox, after which the log is emptied.
+// On startup the snapshot is loaded and the log replayed on top of it. Log
+// entries hold the resulting user versions and event sequences, so replaying
+// an entry that a snapshot already covers is harmless.
+type FileRepository struct {
+	*MemoryRepository
+	dir    string
+	wal    *writeAheadLog
+	logger *slog.Logger
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+// NewFileRepository opens or creates a repository in opts.Dir, recovering the
+// users from its snapshot and log. Call Close to release it.
+func NewFileRepository(logger *slog.Logger, opts FileOptions) (*FileRepository, error) {
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+	r := &FileRepository{
+		MemoryRepository: newMemoryRepository(logger),
+		dir:              opts.Dir,
+		logger:           logger,
+		stop:             make(chan struct{}),
+	}
+
+	// Recover the snapshot, then the writes made after it
+	snapshot, err := readSnapshot(filepath.Join(opts.Dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	r.replay(snapshot)
+	wal, entries, torn, err := openWAL(filepath.Join(opts.Dir, walFileName), opts.Sync)
+	if err != nil {
+		return nil, err
+	}
+	if torn {
+		logger.Warn("discarded torn entry at the end of the write-ahead log", "dir", opts.Dir)
+	}
+	r.replay(entries)
+	// What happened before the recovered versions is not known
+	r.resetHistory()
+	r.wal = wal
+	r.journal = r
+	logger.Info("file repository opened",
+		"dir", opts.Dir,
+		"users", r.snapshot().users.len(),
+		"replayedEntries", len(entries),
+	)
+
+	var syncInterval time.Duration
+	if opts.Sync == SyncPeriodic {
+		syncInterval = opts.SyncInterval
+	}
+	r.done.Add(1)
+	go r.runBackground(syncInterval, opts.SnapshotInterval)
+	return r, nil
+}
+
+// Close stops background work and closes the log.
+func (r *FileRepository) Close() error {
+	close(r.stop)
+	r.done.Wait()
+	return r.wal.close()
+}
+
+// Snapshot writes all users and their revisions to the snapshot file and
+// empties the log. Writes are blocked while it runs.
+func (r *FileRepository) Snapshot() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Replaying the revisions in order leaves every user at its current version
+	var buf []byte
+	err := r.revisions.all(func(revisions []*domain.User, purged bool) error {
+		var err error
+		for _, user := range revisions {
+			if buf, err = appendFrame(buf, walEntry{Op: walPut, Name: user.Name, User: toUserRecord(user)}); err != nil {
+				return err
+			}
+		}
+		if purged {
+			buf, err = appendFrame(buf, walEntry{Op: walRemove, Name: revisions[0].Name})
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range r.outbox.pending() {
+		entry := walEntry{Op: walEvent, Name: event.User.Name, User: toUserRecord(event.User), Sequence: event.Sequence}
+		if buf, err = appendFrame(buf, entry); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(r.dir, snapshotFileName), buf); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	// Should this fail, the log is replayed on top of the new snapshot
+	return r.wal.reset()
+}
+
+func (r *FileRepository) logPut(user *domain.User, event domain.UserEvent) error {
+	return r.wal.append(walEntry{Op: walPut, Name: user.Name, User: toUserRecord(user), Sequence: event.Sequence})
+}
+
+func (r *FileRepository) logPuts(users []*domain.User, events []domain.UserEvent) error {
+	// One entry holds all puts, so that a torn write loses all of them
+	entries := make([]walEntry, len(users))
+	for i, user := range users {
+		entries[i] = walEntry{Op: walPut, Name: user.Name, User: toUserRecord(user), Sequence: events[i].Sequence}
+	}
+	return r.wal.append(walEntry{Op: walBatch, Entries: entries})
+}
+
+func (r *FileRepository) logRemove(name string) error {
+	return r.wal.append(walEntry{Op: walRemove, Name: name})
+}
+
+func (r *FileRepository) logAck(sequences []int64) error {
+	return r.wal.append(walEntry{Op: walAck, Sequences: sequences})
+}
+
+// replay applies recovered entries to the in-memory users.
+func (r *FileRepository) replay(entries []walEntry) {
+	for _, entry := range entries {
+		switch entry.Op {
+		case walPut:
+			user := entry.User.toDomain()
+			r.store(user)
+			if entry.Sequence != 0 {
+				r.restoreEvent(user, entry.Sequence)
+			}
+		case walRemove:
+			r.unstore(entry.Name)
+		case walEvent:
+			r.restoreEvent(entry.User.toDomain(), entry.Sequence)
+		case walAck:
+			r.outbox.ack(entry.Sequences)
+		case walBatch:
+			r.replay(entry.Entries)
+		}
+	}
+}
+
+// restoreEvent puts the event of a recovered user version back in the
+// outbox.
+func (r *FileRepository) restoreEvent(user *domain.User, sequence int64) {
+	event := domain.NewUserEvent(user)
+	event.Sequence = sequence
+	r.outbox.add(event)
+}
+
+// runBackground syncs the log and takes snapshots until Close is called. A
+// zero interval disables the corresponding task.
+func (r *FileRepository) runBackground(syncInterval, snapshotInterval time.Duration) {
+	defer r.done.Done()
+	syncTick, stopSync := newTicker(syncInterval)
+	defer stopSync()
+	snapshotTick, stopSnapshot := newTicker(snapshotInterval)
+	defer stopSnapshot()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-syncTick:
+			if err := r.wal.sync(); err != nil {
+				r.logger.Error("failed to sync write-ahead log", "error", err)
+			}
+		case <-snapshotTick:
+			if err := r.Snapshot(); err != nil {
+				r.logger.Error("failed to snapshot users", "error", err)
+			}
+		}
+	}
+}
+
+// newTicker returns a channel that ticks every interval and a function that
+// stops it. If interval is zero, the channel is nil and never fires.
+func newTicker(interval time.Duration) (<-chan time.Time, func()) {
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// readSnapshot reads the entries of a snapshot. A missing snapshot is empty.
+func readSnapshot(path string) ([]walEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer file.Close()
+	// Snapshots are renamed into place once complete, so they are never torn
+	entries, _, err := readFrames(file)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	return entries, nil
+}
+
+// writeFileAtomic replaces the file at path with data, such that a crash
+// leaves either the old or the new file in place.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// Sync the directory so that the rename itself is durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
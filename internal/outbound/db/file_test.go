@@ -0,0 +1,233 @@
+package db_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
+	"gotest.tools/v3/assert"
+)
+
+func openFileRepo(t *testing.T, dir string) *db.FileRepository {
+	t.Helper()
+	repo, err := db.NewFileRepository(slog.Default(), db.FileOptions{
+		Dir:  dir,
+		Sync: db.SyncAlways,
+	})
+	assert.NilError(t, err)
+	return repo
+}
+
+// TestFileRepositoryConformance runs the repository conformance suite.
+func TestFileRepositoryConformance(t *testing.T) {
+	t.Parallel()
+	dbtest.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+		repo := openFileRepo(t, t.TempDir())
+		t.Cleanup(func() { _ = repo.Close() })
+		return repo
+	})
+}
+
+// TestFileRepository tests that users survive reopening the repository.
+func TestFileRepository(t *testing.T) {
+	t.Parallel()
+
+	createUser := func(t *testing.T, repo *db.FileRepository, id string) *domain.User {
+		t.Helper()
+		created, err := repo.CreateUser(t.Context(), &domain.User{
+			Name:        "users/" + id,
+			DisplayName: "User " + id,
+			Email:       id + "@example.com",
+		})
+		assert.NilError(t, err)
+		return created
+	}
+
+	t.Run("recovers writes from the log", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ctx := t.Context()
+
+		repo := openFileRepo(t, dir)
+		createUser(t, repo, "a")
+		createUser(t, repo, "b")
+		createUser(t, repo, "c")
+		updated, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/a",
+			DisplayName: "Renamed",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{Retention: time.Hour}))
+		assert.NilError(t, repo.DeleteUser(ctx, "users/c", domain.DeleteUserParams{}))
+		purged, err := repo.PurgeExpiredUsers(ctx, time.Now().UTC())
+		assert.NilError(t, err)
+		assert.Equal(t, purged, 1)
+		assert.NilError(t, repo.Close())
+
+		repo = openFileRepo(t, dir)
+		defer repo.Close()
+		retrieved, err := repo.GetUser(ctx, "users/a", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retrieved, updated)
+		deleted, err := repo.GetUser(ctx, "users/b", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !deleted.DeleteTime.IsZero())
+		_, err = repo.GetUser(ctx, "users/c", domain.GetUserParams{ShowDeleted: true})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+
+		// The email index is rebuilt too
+		_, err = repo.CreateUser(ctx, &domain.User{
+			Name:        "users/d",
+			DisplayName: "User d",
+			Email:       "A@example.com",
+		})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.AlreadyExists,
+			Message: "email is already in use",
+			Field:   "email",
+		})
+	})
+
+	t.Run("recovers batches from the log", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ctx := t.Context()
+
+		repo := openFileRepo(t, dir)
+		created, _, err := repo.BatchCreateUsers(ctx, []*domain.User{
+			{Name: "users/a", DisplayName: "User a", Email: "a@example.com"},
+			{Name: "users/b", DisplayName: "User b", Email: "b@example.com"},
+		}, domain.BatchCreateUsersParams{Atomic: true})
+		assert.NilError(t, err)
+		assert.NilError(t, repo.Close())
+
+		repo = openFileRepo(t, dir)
+		defer repo.Close()
+		for _, user := range created {
+			retrieved, err := repo.GetUser(ctx, user.Name, domain.GetUserParams{})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, retrieved, user)
+		}
+	})
+
+	t.Run("discards a torn log entry", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ctx := t.Context()
+
+		repo := openFileRepo(t, dir)
+		createUser(t, repo, "a")
+		assert.NilError(t, repo.Close())
+
+		// Simulate a crash in the middle of appending an entry
+		file, err := os.OpenFile(filepath.Join(dir, "users.wal"), os.O_WRONLY|os.O_APPEND, 0)
+		assert.NilError(t, err)
+		_, err = file.Write([]byte{0, 0, 1, 0, 0xde, 0xad})
+		assert.NilError(t, err)
+		assert.NilError(t, file.Close())
+
+		repo = openFileRepo(t, dir)
+		_, err = repo.GetUser(ctx, "users/a", domain.GetUserParams{})
+		assert.NilError(t, err)
+		createUser(t, repo, "b")
+		assert.NilError(t, repo.Close())
+
+		// Writes after the recovery are readable
+		repo = openFileRepo(t, dir)
+		defer repo.Close()
+		_, err = repo.GetUser(ctx, "users/b", domain.GetUserParams{})
+		assert.NilError(t, err)
+	})
+
+	t.Run("snapshot compacts the log", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ctx := t.Context()
+
+		repo := openFileRepo(t, dir)
+		createUser(t, repo, "a")
+		createUser(t, repo, "b")
+		assert.NilError(t, repo.Snapshot())
+		info, err := os.Stat(filepath.Join(dir, "users.wal"))
+		assert.NilError(t, err)
+		assert.Equal(t, info.Size(), int64(0))
+
+		// Writes after the snapshot go to the log
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{}))
+		createUser(t, repo, "c")
+		assert.NilError(t, repo.Close())
+
+		repo = openFileRepo(t, dir)
+		defer repo.Close()
+		users, _, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 10})
+		assert.NilError(t, err)
+		names := make([]string, 0, len(users))
+		for _, user := range users {
+			names = append(names, user.Name)
+		}
+		assert.DeepEqual(t, names, []string{"users/b", "users/c"})
+	})
+
+	t.Run("recovers the outbox", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		ctx := t.Context()
+
+		repo := openFileRepo(t, dir)
+		createUser(t, repo, "a")
+		createUser(t, repo, "b")
+		createUser(t, repo, "c")
+		events, err := repo.ReadUserEvents(ctx, 1)
+		assert.NilError(t, err)
+		assert.NilError(t, repo.AckUserEvents(ctx, events))
+		pending, err := repo.ReadUserEvents(ctx, 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(pending), 2)
+		assert.NilError(t, repo.Close())
+
+		// Acks are recovered from the log
+		repo = openFileRepo(t, dir)
+		recovered, err := repo.ReadUserEvents(ctx, 10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, recovered, pending)
+
+		// Pending events are kept in snapshots, and sequences carry on
+		assert.NilError(t, repo.Snapshot())
+		assert.NilError(t, repo.AckUserEvents(ctx, recovered[:1]))
+		createUser(t, repo, "d")
+		assert.NilError(t, repo.Close())
+
+		repo = openFileRepo(t, dir)
+		defer repo.Close()
+		recovered, err = repo.ReadUserEvents(ctx, 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(recovered), 2)
+		assert.DeepEqual(t, recovered[0], pending[1])
+		assert.Equal(t, recovered[1].User.Name, "users/d")
+		assert.Assert(t, recovered[1].Sequence > pending[1].Sequence)
+	})
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	t.Parallel()
+	for s, want := range map[string]db.SyncPolicy{
+		"always":   db.SyncAlways,
+		"periodic": db.SyncPeriodic,
+		"never":    db.SyncNever,
+	} {
+		got, err := db.ParseSyncPolicy(s)
+		assert.NilError(t, err)
+		assert.Equal(t, got, want)
+	}
+	_, err := db.ParseSyncPolicy("sometimes")
+	assert.ErrorContains(t, err, "unknown sync policy")
+}
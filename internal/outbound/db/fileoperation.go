@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// FileOperationStore keeps operations in memory, and writes all of them to a
+// file on every change, so that they survive restarts. It suits the small
+// number of operations that are kept within their retention.
+type FileOperationStore struct {
+	*MemoryOperationStore
+	path  string
+	mutex sync.Mutex // Serializes the changes along with writing them.
+}
+
+// NewFileOperationStore returns a store that keeps its operations in the file
+// at path, and reads the operations that the file already holds.
+func NewFileOperationStore(path string) (*FileOperationStore, error) {
+	store := &FileOperationStore{MemoryOperationStore: NewMemoryOperationStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read operations: %w", err)
+	}
+	var records []*operationRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("decode operations: %w", err)
+	}
+	for _, record := range records {
+		op, err := record.toDomain()
+		if err != nil {
+			return nil, err
+		}
+		store.operations[op.Name] = op
+	}
+	return store, nil
+}
+
+func (s *FileOperationStore) PutOperation(ctx context.Context, op *domain.Operation) error {
+	// Check that the operation can be stored before keeping it
+	if _, err := toOperationRecord(op); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.MemoryOperationStore.PutOperation(ctx, op); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+func (s *FileOperationStore) DeleteOperation(ctx context.Context, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.MemoryOperationStore.DeleteOperation(ctx, name); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+func (s *FileOperationStore) PurgeOperations(ctx context.Context, before time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	purged, err := s.MemoryOperationStore.PurgeOperations(ctx, before)
+	if err != nil || purged == 0 {
+		return purged, err
+	}
+	return purged, s.save(ctx)
+}
+
+// save writes all operations to the file.
+func (s *FileOperationStore) save(ctx context.Context) error {
+	ops, _, err := s.ListOperations(ctx, domain.ListOperationsParams{})
+	if err != nil {
+		return err
+	}
+	records := make([]*operationRecord, 0, len(ops))
+	for _, op := range ops {
+		record, err := toOperationRecord(op)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return domain.NewErrorInternal("failed to encode operations", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return domain.NewErrorInternal("failed to write operations", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// Repositories keep the past versions of users for reads at a point in time,
+// for a window that is set with SetHistoryWindow. A zero window, the default,
+// keeps no history.
+
+// checkReadTime returns a FailedPrecondition error if readTime is outside
+// the history that is kept: in the future, older than the window, or before
+// the oldest version that is known.
+func checkReadTime(readTime, oldest time.Time, window time.Duration) error {
+	now := time.Now()
+	switch {
+	case readTime.After(now):
+		return domain.NewErrorFailedPrecondition("read_time is in the future", nil)
+	case readTime.Before(now.Add(-window)):
+		return domain.NewErrorFailedPrecondition(
+			fmt.Sprintf("read_time is older than the %s of history that is kept", window),
+			nil,
+		)
+	case readTime.Before(oldest):
+		return domain.NewErrorFailedPrecondition("read_time is before the history that is kept", nil)
+	}
+	return nil
+}
+
+// changeTime returns when a user version was written, which is when it
+// becomes visible to reads at a point in time.
+func changeTime(user *domain.User) time.Time {
+	if user.DeleteTime.After(user.UpdateTime) {
+		return user.DeleteTime
+	}
+	return user.UpdateTime
+}
@@ -3,136 +3,736 @@ package db
 import (
 	"context"
 	"fmt"
+	"iter"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
 	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"go.einride.tech/aip/filtering"
+	"go.einride.tech/aip/ordering"
 )
 
+// MemoryRepository keeps users in memory as immutable versions.
+//
+// All users are held in a snapshot that is never modified. Every write builds
+// the next snapshot from the current one, sharing the users and index entries
+// it didn't touch, and publishes it atomically. Readers load the current
+// snapshot without locking, so they never wait for writers and see a
+// consistent view for the whole call. Writers are serialized by a mutex.
+//
+// Past snapshots are kept for the history window, for reads at a point in
+// time, and past revisions of users for the revision retention. The event of
+// every write is added to an outbox under the same lock.
 type MemoryRepository struct {
-	users  map[string]*domain.User
-	mutex  sync.RWMutex
-	logger *slog.Logger
+	current atomic.Pointer[memorySnapshot]
+	mutex   sync.Mutex // Held by writers.
+	logger  *slog.Logger
+
+	historyMutex  sync.RWMutex
+	history       []*memorySnapshot // Oldest first, ending with the current snapshot.
+	historyWindow time.Duration
+
+	revisions *revisionLog
+	// outbox holds the events of the writes, and may be shared with other
+	// repositories.
+	outbox *eventOutbox
+
+	journal journal // Optional, records every write before it is applied.
+	// emailOwners is an optional unique email index shared with other
+	// repositories, which then don't journal.
+	emailOwners *emailIndex
+}
+
+// memorySnapshot is an immutable view of all users.
+type memorySnapshot struct {
+	time   time.Time // When it became current.
+	users  cowTree[*domain.User]
+	emails cowTree[string] // Unique index of lowercased email to name, for users that aren't deleted.
+}
+
+// journal records the writes of a MemoryRepository so that they can be
+// replayed later. Writes are recorded as the resulting user versions, which
+// makes replaying them idempotent.
+type journal interface {
+	// logPut records that a user was created or replaced, and the event of
+	// the change.
+	logPut(user *domain.User, event domain.UserEvent) error
+	// logPuts records several puts in one write, which is replayed in full
+	// or not at all.
+	logPuts(users []*domain.User, events []domain.UserEvent) error
+	// logRemove records that a user was permanently removed.
+	logRemove(name string) error
+	// logAck records that events were removed from the outbox.
+	logAck(sequences []int64) error
 }
 
 func NewMemoryRepository(logger *slog.Logger) port.UserRepository {
-	return &MemoryRepository{
-		users:  make(map[string]*domain.User),
-		logger: logger,
+	return newMemoryRepository(logger)
+}
+
+func newMemoryRepository(logger *slog.Logger) *MemoryRepository {
+	initial := &memorySnapshot{time: time.Now()}
+	r := &MemoryRepository{
+		logger:    logger,
+		history:   []*memorySnapshot{initial},
+		revisions: newRevisionLog(),
+		outbox:    newEventOutbox(),
+	}
+	r.current.Store(initial)
+	return r
+}
+
+// SetHistoryWindow sets how long past versions of users are kept for reads
+// at a point in time.
+func (r *MemoryRepository) SetHistoryWindow(window time.Duration) {
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+	r.historyWindow = window
+}
+
+// SetRevisionRetention sets how long revisions of users are kept after they
+// were replaced.
+func (r *MemoryRepository) SetRevisionRetention(retention time.Duration) {
+	r.revisions.setRetention(retention)
+}
+
+// snapshot returns the current snapshot of all users.
+func (r *MemoryRepository) snapshot() *memorySnapshot {
+	return r.current.Load()
+}
+
+func (r *MemoryRepository) SnapshotUsers(_ context.Context, readTime time.Time) (port.UserSnapshot, error) {
+	return r.snapshotAt(readTime)
+}
+
+// snapshotAt returns the snapshot that was current at readTime.
+func (r *MemoryRepository) snapshotAt(readTime time.Time) (*memorySnapshot, error) {
+	r.historyMutex.RLock()
+	defer r.historyMutex.RUnlock()
+	if err := checkReadTime(readTime, r.history[0].time, r.historyWindow); err != nil {
+		return nil, err
+	}
+	i, _ := slices.BinarySearchFunc(r.history, readTime, func(s *memorySnapshot, t time.Time) int {
+		if s.time.After(t) {
+			return 1
+		}
+		return -1
+	})
+	return r.history[i-1], nil
+}
+
+// publish makes a snapshot the current one as of at, and drops the past
+// snapshots that fell out of the history window. The caller must hold the
+// write lock.
+func (r *MemoryRepository) publish(next *memorySnapshot, at time.Time) {
+	next.time = at
+	if current := r.snapshot(); at.Before(current.time) {
+		next.time = current.time
 	}
+
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+	r.history = append(r.history, next)
+	// Keep the snapshot that was current at the start of the window
+	cutoff := time.Now().Add(-r.historyWindow)
+	var expired int
+	for expired+1 < len(r.history) && !r.history[expired+1].time.After(cutoff) {
+		expired++
+	}
+	clear(r.history[:expired])
+	r.history = r.history[expired:]
+	r.current.Store(next)
+}
+
+// resetHistory forgets all past snapshots, and starts the history with the
+// current snapshot. The caller must hold the write lock.
+func (r *MemoryRepository) resetHistory() {
+	current := *r.snapshot()
+	current.time = time.Now()
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+	r.history = []*memorySnapshot{&current}
+	r.current.Store(&current)
 }
 
 func (r *MemoryRepository) CreateUser(
-	_ context.Context,
+	ctx context.Context,
 	user *domain.User,
 ) (*domain.User, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	// Validate required fields
-	if user.DisplayName == "" {
-		return nil, domain.NewErrorInvalidInput("display_name is required", nil)
-	}
-	if user.Email == "" {
-		return nil, domain.NewErrorInvalidInput("email is required", nil)
+	// Create new user with timestamps
+	newUser, err := createdUser(user, newChange(ctx))
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if user already exists
-	if _, exists := r.users[user.Name]; exists {
+	if _, exists := r.snapshot().users.get(newUser.Name); exists {
 		return nil, domain.NewErrorAlreadyExists(
-			fmt.Sprintf("user already exists: %s", user.Name),
+			fmt.Sprintf("user already exists: %s", newUser.Name),
 			nil,
 		)
 	}
-
-	// Create new user with timestamps
-	now := time.Now().UTC()
-	newUser := &domain.User{
-		Name:        user.Name,
-		DisplayName: user.DisplayName,
-		Email:       user.Email,
-		CreateTime:  now,
-		UpdateTime:  now,
+	if err := r.checkEmailAvailable(newUser.Email, newUser.Name); err != nil {
+		return nil, err
 	}
 
 	// Store user
-	r.users[newUser.Name] = newUser
+	if err := r.put(newUser); err != nil {
+		return nil, err
+	}
 
 	// Return a copy to prevent external modifications
-	copyUser, err := newUser.Copy()
+	return newUser.Copy(), nil
+}
+
+func (r *MemoryRepository) BatchCreateUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.BatchCreateUsersParams,
+) ([]*domain.User, []error, error) {
+	var (
+		created []*domain.User
+		errs    []error
+	)
+	err := r.writeBatch(func(batchOf func(string) *writeBatch) error {
+		var err error
+		created, errs, err = stageCreates(users, params.Atomic, newChange(ctx), batchOf)
+		return err
+	})
 	if err != nil {
-		return nil, domain.NewErrorInternal("failed to copy user", err)
+		return nil, nil, err
+	}
+
+	// Return copies to prevent external modifications
+	return copyUsers(created), errs, nil
+}
+
+// writeBatch stages writes in a batch under the write lock, and commits them
+// unless staging fails.
+func (r *MemoryRepository) writeBatch(stage func(batchOf func(name string) *writeBatch) error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	batch := r.newWriteBatch()
+	if err := stage(func(string) *writeBatch { return batch }); err != nil {
+		batch.abort()
+		return err
 	}
-	return copyUser, nil
+	return batch.commit()
 }
 
-func (r *MemoryRepository) GetUser(_ context.Context, name string) (*domain.User, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+func (r *MemoryRepository) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	return r.snapshot().GetUser(ctx, name, params)
+}
 
-	user, exists := r.users[name]
-	if !exists || !user.DeleteTime.IsZero() {
-		return nil, domain.NewErrorNotFound("user not found", nil)
+func (r *MemoryRepository) BatchGetUsers(_ context.Context, names []string) (map[string]*domain.User, error) {
+	snapshot := r.snapshot()
+	users := make(map[string]*domain.User, len(names))
+	for _, name := range names {
+		if user, ok := snapshot.live(name); ok {
+			users[name] = user
+		}
 	}
-	return user, nil
+	return users, nil
 }
 
 func (r *MemoryRepository) ListUsers(
+	ctx context.Context,
+	params domain.ListUsersParams,
+) ([]*domain.User, string, error) {
+	return r.snapshot().ListUsers(ctx, params)
+}
+
+func (s *memorySnapshot) GetUser(
+	_ context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	user, exists := s.users.get(name)
+	if !exists || (!user.DeleteTime.IsZero() && !params.ShowDeleted) {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+
+	// Return a copy to prevent external modifications
+	return user.Copy(), nil
+}
+
+// live returns a copy of the user with the name if it exists and isn't
+// deleted.
+func (s *memorySnapshot) live(name string) (*domain.User, bool) {
+	user, exists := s.users.get(name)
+	if !exists || !user.DeleteTime.IsZero() {
+		return nil, false
+	}
+	return user.Copy(), true
+}
+
+func (s *memorySnapshot) ListUsers(
 	_ context.Context,
-	pageSize int32, // pageSize
-	_ string, // pageToken
+	params domain.ListUsersParams,
 ) ([]*domain.User, string, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-	if len(r.users) == 0 {
-		return nil, "", domain.NewErrorNotFound("user not found", nil)
+	request, err := parseListRequest(params)
+	if err != nil {
+		return nil, "", err
+	}
+	matches, err := s.list(request)
+	if err != nil {
+		return nil, "", err
+	}
+	users, nextPageToken := request.page(matches)
+	return users, nextPageToken, nil
+}
+
+// listRequest is a parsed ListUsers request.
+type listRequest struct {
+	filter      filtering.Filter
+	orderBy     ordering.OrderBy
+	cursor      *domain.User // Users up to and including it were already read.
+	checksum    uint32
+	pageSize    int
+	showDeleted bool
+}
+
+func parseListRequest(params domain.ListUsersParams) (*listRequest, error) {
+	checksum := listChecksum(params)
+	token, err := decodePageToken(params.PageToken, checksum)
+	if err != nil {
+		return nil, domain.NewErrorInvalidInput("invalid page token", err)
+	}
+	filter, err := query.ParseUserFilter(params.Filter)
+	if err != nil {
+		return nil, domain.NewErrorInvalidInput("invalid filter", err)
+	}
+	orderBy, err := query.ParseUserOrderBy(params.OrderBy)
+	if err != nil {
+		return nil, domain.NewErrorInvalidInput("invalid order_by", err)
 	}
-	users := make([]*domain.User, 0, len(r.users))
-	count := int32(0)
-	for _, user := range r.users {
-		if user.DeleteTime.IsZero() {
-			users = append(users, user)
+	var cursor *domain.User
+	if token.LastKey != nil {
+		if cursor, err = query.CursorUser(orderBy, token.LastKey); err != nil {
+			return nil, domain.NewErrorInvalidInput("invalid page token", err)
 		}
-		count++
-		if count >= pageSize {
+	}
+	return &listRequest{
+		filter:      filter,
+		orderBy:     orderBy,
+		cursor:      cursor,
+		checksum:    checksum,
+		pageSize:    max(int(params.PageSize), 0),
+		showDeleted: params.ShowDeleted,
+	}, nil
+}
+
+// list returns the matching users that come after the cursor in order, at
+// most one more than fits on the page.
+func (s *memorySnapshot) list(request *listRequest) ([]*domain.User, error) {
+	// In name order the tree is already sorted, so only the users from the
+	// cursor until the page is full are read
+	if request.inNameOrder() {
+		users := s.users.all()
+		if request.cursor != nil {
+			users = s.users.after(request.cursor.Name)
+		}
+		return request.collect(users, request.pageSize+1)
+	}
+	matches, err := request.collect(s.users.all(), s.users.len())
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(matches, request.compare)
+	return matches[:min(len(matches), request.pageSize+1)], nil
+}
+
+// collect returns the users that match the request and come after its
+// cursor, in the order given, up to limit of them.
+func (r *listRequest) collect(users iter.Seq2[string, *domain.User], limit int) ([]*domain.User, error) {
+	var matches []*domain.User
+	for _, user := range users {
+		if len(matches) >= limit {
 			break
 		}
+		if !user.DeleteTime.IsZero() && !r.showDeleted {
+			continue
+		}
+		if r.cursor != nil && query.CompareUsers(r.orderBy, user, r.cursor) <= 0 {
+			continue
+		}
+		match, err := query.MatchUser(r.filter, user)
+		if err != nil {
+			return nil, domain.NewErrorInvalidInput("invalid filter", err)
+		}
+		if match {
+			matches = append(matches, user)
+		}
+	}
+	return matches, nil
+}
+
+// inNameOrder reports whether users are listed in the order of their names,
+// which is the key order of the tree. Names are unique, so any fields after
+// an ascending name don't change the order.
+func (r *listRequest) inNameOrder() bool {
+	return len(r.orderBy.Fields) == 0 ||
+		(r.orderBy.Fields[0].Path == query.FieldName && !r.orderBy.Fields[0].Desc)
+}
+
+// compare orders users as requested.
+func (r *listRequest) compare(a, b *domain.User) int {
+	return query.CompareUsers(r.orderBy, a, b)
+}
+
+// page returns copies of the users on the page out of the ordered matches,
+// and the token of the next page if there are more.
+func (r *listRequest) page(matches []*domain.User) ([]*domain.User, string) {
+	page := matches[:min(len(matches), r.pageSize)]
+
+	// Only hand out a cursor when there is something left to read
+	var nextPageToken string
+	if len(page) > 0 && len(matches) > len(page) {
+		nextPageToken = encodePageToken(query.Cursor(r.orderBy, page[len(page)-1]), r.checksum)
 	}
-	return users, "", nil
+
+	// Return copies to prevent external modifications
+	users := make([]*domain.User, 0, len(page))
+	for _, user := range page {
+		users = append(users, user.Copy())
+	}
+	return users, nextPageToken
 }
 
 func (r *MemoryRepository) UpdateUser(
-	_ context.Context,
+	ctx context.Context,
 	u *domain.User,
-) (*domain.User, error) {
+	params domain.UpdateUserParams,
+) (*domain.User, bool, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	user, exists := r.users[u.Name]
-	if !exists {
-		return nil, domain.NewErrorNotFound("user not found", nil)
+
+	// Look up the user and apply the update, creating the user if allowed.
+	// Both happen under the same lock, so concurrent upserts create it once.
+	stored, _ := r.snapshot().users.get(u.Name)
+	updated, err := updatedUser(stored, u, params, newChange(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := r.checkEmailAvailable(updated.Email, updated.Name); err != nil {
+		return nil, false, err
 	}
-	userCopy, err := user.Copy()
+	if err := r.put(updated); err != nil {
+		return nil, false, err
+	}
+
+	// Return a copy to prevent external modifications
+	return updated.Copy(), stored == nil, nil
+}
+
+func (r *MemoryRepository) BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error) {
+	var updated []*domain.User
+	err := r.writeBatch(func(batchOf func(string) *writeBatch) error {
+		var err error
+		updated, err = stageUpdates(updates, newChange(ctx), batchOf)
+		return err
+	})
 	if err != nil {
-		return nil, domain.NewErrorInternal("failed to copy user", err)
+		return nil, err
 	}
-	userCopy.CreateTime = u.CreateTime
-	userCopy.UpdateTime = time.Now().UTC()
-	r.users[userCopy.Name] = userCopy
-	return nil, domain.NewErrorNotFound("user not found", nil)
+
+	// Return copies to prevent external modifications
+	return copyUsers(updated), nil
 }
 
 func (r *MemoryRepository) DeleteUser(
-	_ context.Context,
+	ctx context.Context,
 	s string, // name
+	params domain.DeleteUserParams,
 ) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	user, exists := r.users[s]
-	if !exists || !user.DeleteTime.IsZero() {
-		return domain.NewErrorNotFound("user not found", nil)
+	stored, _ := r.snapshot().users.get(s)
+	deleted, err := deletedUser(stored, params, newChange(ctx))
+	if err != nil {
+		return err
+	}
+
+	// Deleted users release their email, and must claim it again on undelete
+	return r.put(deleted)
+}
+
+func (r *MemoryRepository) BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error {
+	return r.writeBatch(func(batchOf func(string) *writeBatch) error {
+		return stageDeletions(deletions, newChange(ctx), batchOf)
+	})
+}
+
+func (r *MemoryRepository) UndeleteUser(ctx context.Context, name string) (*domain.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stored, _ := r.snapshot().users.get(name)
+	restored, err := undeletedUser(stored, newChange(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkEmailAvailable(restored.Email, restored.Name); err != nil {
+		return nil, err
+	}
+	if err := r.put(restored); err != nil {
+		return nil, err
+	}
+
+	// Return a copy to prevent external modifications
+	return restored.Copy(), nil
+}
+
+func (r *MemoryRepository) PurgeExpiredUsers(_ context.Context, now time.Time) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var purged int
+	for name, user := range r.snapshot().users.all() {
+		if !user.DeleteTime.IsZero() && !user.PurgeTime.After(now) {
+			if err := r.remove(name); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	r.revisions.prune(time.Now())
+	return purged, nil
+}
+
+func (r *MemoryRepository) PurgeUsers(_ context.Context, names []string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var purged int
+	for _, name := range names {
+		user, exists := r.snapshot().users.get(name)
+		if !exists || user.DeleteTime.IsZero() {
+			continue
+		}
+		if err := r.remove(name); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	r.revisions.prune(time.Now())
+	return purged, nil
+}
+
+func (r *MemoryRepository) LookupUserByEmail(_ context.Context, email string) (*domain.User, error) {
+	snapshot := r.snapshot()
+	name, exists := snapshot.emails.get(emailKey(email))
+	if !exists {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	user, _ := snapshot.users.get(name)
+
+	// Return a copy to prevent external modifications
+	return user.Copy(), nil
+}
+
+func (r *MemoryRepository) ListUserRevisions(
+	_ context.Context,
+	name string,
+	params domain.ListUserRevisionsParams,
+) ([]*domain.User, string, error) {
+	checksum := requestChecksum(name)
+	token, err := decodePageToken(params.PageToken, checksum)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+	}
+	var after string
+	if token.LastKey != nil {
+		after = token.LastKey[0]
+	}
+	// Read one extra revision to know whether there is a next page
+	pageSize := max(int(params.PageSize), 0)
+	revisions, exists := r.revisions.list(name, after, pageSize+1)
+	if !exists {
+		return nil, "", domain.NewErrorNotFound("user not found", nil)
+	}
+
+	// Only hand out a cursor when there is something left to read
+	var nextPageToken string
+	if len(revisions) > pageSize {
+		revisions = revisions[:pageSize]
+		if pageSize > 0 {
+			nextPageToken = encodePageToken([]string{revisions[pageSize-1].RevisionID}, checksum)
+		}
 	}
-	user.DeleteTime = time.Now().UTC()
+	return revisions, nextPageToken, nil
+}
+
+func (r *MemoryRepository) GetUserRevision(_ context.Context, name, revisionID string) (*domain.User, error) {
+	revision, exists := r.revisions.get(name, revisionID)
+	if !exists {
+		return nil, domain.NewErrorNotFound("revision not found", nil)
+	}
+	return revision, nil
+}
+
+func (r *MemoryRepository) RollbackUser(
+	ctx context.Context,
+	name string,
+	params domain.RollbackUserParams,
+) (*domain.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stored, _ := r.snapshot().users.get(name)
+	revision, _ := r.revisions.get(name, params.RevisionID)
+	restored, err := rolledBackUser(stored, revision, params, newChange(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkEmailAvailable(restored.Email, restored.Name); err != nil {
+		return nil, err
+	}
+	if err := r.put(restored); err != nil {
+		return nil, err
+	}
+
+	// Return a copy to prevent external modifications
+	return restored.Copy(), nil
+}
+
+func (r *MemoryRepository) ReadUserEvents(_ context.Context, limit int) ([]domain.UserEvent, error) {
+	return r.outbox.read(limit), nil
+}
+
+func (r *MemoryRepository) AckUserEvents(_ context.Context, events []domain.UserEvent) error {
+	// Acks are journaled under the write lock, so that snapshots see them
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.journal != nil {
+		if err := r.journal.logAck(sequences(events)); err != nil {
+			return domain.NewErrorInternal("failed to acknowledge events", err)
+		}
+	}
+	r.outbox.ack(sequences(events))
+	return nil
+}
+
+// put journals a user version and the event of the write, and then stores
+// both. The caller must hold the write lock, and must not modify the user
+// afterwards.
+func (r *MemoryRepository) put(user *domain.User) error {
+	if err := r.claimEmail(user); err != nil {
+		return err
+	}
+	event := domain.NewUserEvent(user)
+	if r.journal != nil {
+		event.Sequence = r.outbox.reserve()
+		if err := r.journal.logPut(user, event); err != nil {
+			return domain.NewErrorInternal("failed to write user", err)
+		}
+	}
+	stored, _ := r.snapshot().users.get(user.Name)
+	r.store(user)
+	r.outbox.add(event)
+	r.releaseEmail(stored, user)
+	return nil
+}
+
+// remove journals the removal of a user and then removes it. The caller must
+// hold the write lock.
+func (r *MemoryRepository) remove(name string) error {
+	if r.journal != nil {
+		if err := r.journal.logRemove(name); err != nil {
+			return domain.NewErrorInternal("failed to remove user", err)
+		}
+	}
+	stored, _ := r.snapshot().users.get(name)
+	r.unstore(name)
+	r.releaseEmail(stored, nil)
 	return nil
 }
+
+// claimEmail claims the email of a user version that isn't deleted in the
+// shared email index, if any.
+func (r *MemoryRepository) claimEmail(user *domain.User) error {
+	if r.emailOwners == nil || !user.DeleteTime.IsZero() {
+		return nil
+	}
+	return r.emailOwners.claim(user.Email, user.Name)
+}
+
+// releaseEmail releases the email of a replaced user version in the shared
+// email index, if any, unless its replacement still holds it.
+func (r *MemoryRepository) releaseEmail(replaced, replacement *domain.User) {
+	if r.emailOwners == nil || replaced == nil || !replaced.DeleteTime.IsZero() {
+		return
+	}
+	if replacement != nil && replacement.DeleteTime.IsZero() && emailKey(replacement.Email) == emailKey(replaced.Email) {
+		return
+	}
+	r.emailOwners.release(replaced.Email, replaced.Name)
+}
+
+// store publishes a snapshot with a user version, keeping the email index in
+// sync, and records it as a revision. The caller must hold the write lock.
+func (r *MemoryRepository) store(user *domain.User) {
+	r.publish(r.snapshot().withUser(user), user.RevisionCreateTime)
+	r.revisions.add(user)
+}
+
+// unstore publishes a snapshot without a user and its email index entry. The
+// caller must hold the write lock.
+func (r *MemoryRepository) unstore(name string) {
+	now := time.Now()
+	r.publish(r.snapshot().withoutUser(name), now)
+	r.revisions.remove(name, now)
+}
+
+// withUser returns a snapshot where the user holds the given version.
+func (s *memorySnapshot) withUser(user *domain.User) *memorySnapshot {
+	next := s.withoutUser(user.Name)
+	next.users = next.users.with(user.Name, user)
+	if user.DeleteTime.IsZero() {
+		next.emails = next.emails.with(emailKey(user.Email), user.Name)
+	}
+	return next
+}
+
+// withoutUser returns a snapshot without the user.
+func (s *memorySnapshot) withoutUser(name string) *memorySnapshot {
+	next := *s
+	user, exists := s.users.get(name)
+	if !exists {
+		return &next
+	}
+	if owner, _ := s.emails.get(emailKey(user.Email)); owner == name {
+		next.emails = next.emails.without(emailKey(user.Email))
+	}
+	next.users = next.users.without(name)
+	return &next
+}
+
+// checkEmailAvailable returns an AlreadyExists error if the email belongs to
+// a user other than name. The caller must hold the write lock.
+func (r *MemoryRepository) checkEmailAvailable(email, name string) error {
+	return r.snapshot().checkEmailAvailable(email, name)
+}
+
+// checkEmailAvailable returns an AlreadyExists error if the email belongs to
+// a user other than name in the snapshot.
+func (s *memorySnapshot) checkEmailAvailable(email, name string) error {
+	if owner, taken := s.emails.get(emailKey(email)); taken && owner != name {
+		return domain.NewErrorFieldAlreadyExists("email", "email is already in use", nil)
+	}
+	return nil
+}
+
+// emailKey returns the key of an email in the case-insensitive email index.
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
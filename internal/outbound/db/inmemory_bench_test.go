@@ -0,0 +1,224 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+)
+
+// benchRepository is the part of port.UserRepository that is benchmarked.
+type benchRepository interface {
+	CreateUser(ctx context.Context, user *domain.User) (*domain.User, error)
+	GetUser(ctx context.Context, name string, params domain.GetUserParams) (*domain.User, error)
+	ListUsers(ctx context.Context, params domain.ListUsersParams) ([]*domain.User, string, error)
+	UpdateUser(ctx context.Context, user *domain.User, params domain.UpdateUserParams) (*domain.User, bool, error)
+}
+
+// gobRepository is the design that MemoryRepository replaced, kept as a
+// baseline for the benchmarks: a map behind a sync.RWMutex, where users are
+// copied with a gob round trip and ListUsers returns the stored users.
+type gobRepository struct {
+	mutex sync.RWMutex
+	users map[string]*domain.User
+}
+
+func newGobRepository() *gobRepository {
+	return &gobRepository{users: make(map[string]*domain.User)}
+}
+
+func gobCopy(user *domain.User) (*domain.User, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(user); err != nil {
+		return nil, err
+	}
+	var userCopy domain.User
+	if err := gob.NewDecoder(&buf).Decode(&userCopy); err != nil {
+		return nil, err
+	}
+	return &userCopy, nil
+}
+
+func (r *gobRepository) CreateUser(_ context.Context, user *domain.User) (*domain.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.users[user.Name]; exists {
+		return nil, domain.NewErrorAlreadyExists("user already exists", nil)
+	}
+	created, err := gobCopy(user)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	created.CreateTime, created.UpdateTime = now, now
+	r.users[created.Name] = created
+	return gobCopy(created)
+}
+
+func (r *gobRepository) GetUser(_ context.Context, name string, _ domain.GetUserParams) (*domain.User, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	user, exists := r.users[name]
+	if !exists {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	return gobCopy(user)
+}
+
+func (r *gobRepository) ListUsers(_ context.Context, params domain.ListUsersParams) ([]*domain.User, string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	users := make([]*domain.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b *domain.User) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return users[:min(len(users), int(params.PageSize))], "", nil
+}
+
+func (r *gobRepository) UpdateUser(
+	_ context.Context,
+	u *domain.User,
+	_ domain.UpdateUserParams,
+) (*domain.User, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stored, exists := r.users[u.Name]
+	if !exists {
+		return nil, false, domain.NewErrorNotFound("user not found", nil)
+	}
+	updated, err := gobCopy(stored)
+	if err != nil {
+		return nil, false, err
+	}
+	updated.DisplayName = u.DisplayName
+	updated.UpdateTime = time.Now().UTC()
+	r.users[updated.Name] = updated
+	copyUser, err := gobCopy(updated)
+	return copyUser, false, err
+}
+
+// newBenchRepository returns a repository of the given design, "cow" or
+// "gob", holding size users named by benchUserName.
+func newBenchRepository(b *testing.B, design string, size int) benchRepository {
+	b.Helper()
+	var repo benchRepository = newGobRepository()
+	if design == "cow" {
+		repo = db.NewMemoryRepository(slog.New(slog.DiscardHandler))
+	}
+	for i := range size {
+		if _, err := repo.CreateUser(context.Background(), benchUser(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func benchUserName(i int) string {
+	return fmt.Sprintf("users/bench-%06d", i)
+}
+
+func benchUser(i int) *domain.User {
+	return &domain.User{
+		Name:        benchUserName(i),
+		DisplayName: fmt.Sprintf("Bench User %d", i),
+		Email:       fmt.Sprintf("bench-%06d@example.com", i),
+	}
+}
+
+const benchUsers = 1000
+
+func BenchmarkMemoryRepository(b *testing.B) {
+	ctx := context.Background()
+	for _, design := range []string{"cow", "gob"} {
+		b.Run(design, func(b *testing.B) {
+			b.Run("GetUser", func(b *testing.B) {
+				repo := newBenchRepository(b, design, benchUsers)
+				var next atomic.Int64
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						name := benchUserName(int(next.Add(1) % benchUsers))
+						if _, err := repo.GetUser(ctx, name, domain.GetUserParams{}); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+
+			b.Run("ListUsers", func(b *testing.B) {
+				repo := newBenchRepository(b, design, benchUsers)
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if _, _, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 50}); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+
+			b.Run("CreateUser", func(b *testing.B) {
+				repo := newBenchRepository(b, design, 0)
+				var next atomic.Int64
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if _, err := repo.CreateUser(ctx, benchUser(int(next.Add(1)))); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+
+			b.Run("UpdateUser", func(b *testing.B) {
+				repo := newBenchRepository(b, design, benchUsers)
+				var next atomic.Int64
+				params := domain.UpdateUserParams{UpdateMask: []string{"display_name"}}
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						user := benchUser(int(next.Add(1) % benchUsers))
+						if _, _, err := repo.UpdateUser(ctx, user, params); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+
+			// Nine reads for every write, as a read-heavy service would see
+			b.Run("Mixed", func(b *testing.B) {
+				repo := newBenchRepository(b, design, benchUsers)
+				var next atomic.Int64
+				params := domain.UpdateUserParams{UpdateMask: []string{"display_name"}}
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						n := int(next.Add(1))
+						var err error
+						if n%10 == 0 {
+							_, _, err = repo.UpdateUser(ctx, benchUser(n%benchUsers), params)
+						} else {
+							_, err = repo.GetUser(ctx, benchUserName(n%benchUsers), domain.GetUserParams{})
+						}
+						if err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		})
+	}
+}
@@ -1,14 +1,20 @@
 package db_test
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
 	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
 	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
 )
@@ -20,12 +26,29 @@ var ignoredTimeFields = cmpopts.IgnoreFields( //nolint:gochecknoglobals // this
 	"UpdateTime",
 )
 
+// ignoredRevisionFields defines which repository-managed User fields to ignore in comparisons.
+var ignoredRevisionFields = cmpopts.IgnoreFields( //nolint:gochecknoglobals // this is just a test file
+	domain.User{},
+	"Revision",
+	"Etag",
+	"RevisionID",
+	"RevisionCreateTime",
+)
+
 func setupTestRepo(_ *testing.T) *db.MemoryRepository {
 	logger := slog.Default()
 	repo := db.NewMemoryRepository(logger).(*db.MemoryRepository)
 	return repo
 }
 
+// TestMemoryRepositoryConformance runs the repository conformance suite.
+func TestMemoryRepositoryConformance(t *testing.T) {
+	t.Parallel()
+	dbtest.TestUserRepository(t, func(*testing.T) port.UserRepository {
+		return db.NewMemoryRepository(slog.Default())
+	})
+}
+
 // isRecentTime returns true if the given time is within the last second.
 func isRecentTime(t time.Time) bool {
 	now := time.Now().UTC()
@@ -84,7 +107,7 @@ func TestCreateUser(t *testing.T) {
 			Email:       "test@example.com",
 		}
 
-		assert.DeepEqual(t, expectedUser, created, ignoredTimeFields)
+		assert.DeepEqual(t, expectedUser, created, ignoredTimeFields, ignoredRevisionFields)
 	})
 
 	t.Run("success with provided ID", func(t *testing.T) {
@@ -110,7 +133,7 @@ func TestCreateUser(t *testing.T) {
 			Email:       "test@example.com",
 		}
 
-		assert.DeepEqual(t, expectedUser, created, ignoredTimeFields)
+		assert.DeepEqual(t, expectedUser, created, ignoredTimeFields, ignoredRevisionFields)
 	})
 
 	t.Run("failure - already exists", func(t *testing.T) {
@@ -172,6 +195,122 @@ func TestCreateUser(t *testing.T) {
 	})
 }
 
+// TestEmailUniqueness tests that no two users that aren't deleted share an email.
+func TestEmailUniqueness(t *testing.T) {
+	t.Parallel()
+
+	emailTaken := &domain.Error{
+		Type:    domain.AlreadyExists,
+		Message: "email is already in use",
+		Field:   "email",
+	}
+
+	createUser := func(t *testing.T, repo *db.MemoryRepository, id, email string) {
+		t.Helper()
+		_, err := repo.CreateUser(t.Context(), &domain.User{
+			Name:        "users/" + id,
+			DisplayName: "User " + id,
+			Email:       email,
+		})
+		assert.NilError(t, err)
+	}
+
+	t.Run("create - case insensitive", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		createUser(t, repo, "a", "same@example.com")
+
+		_, err := repo.CreateUser(t.Context(), &domain.User{
+			Name:        "users/b",
+			DisplayName: "User b",
+			Email:       "Same@Example.com",
+		})
+		assert.DeepEqual(t, err, emailTaken)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUser(t, repo, "a", "a@example.com")
+		createUser(t, repo, "b", "b@example.com")
+
+		_, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:  "users/b",
+			Email: "A@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"email"}})
+		assert.DeepEqual(t, err, emailTaken)
+
+		// Changing the case of a user's own email is fine
+		_, _, err = repo.UpdateUser(ctx, &domain.User{
+			Name:  "users/a",
+			Email: "A@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"email"}})
+		assert.NilError(t, err)
+
+		// The old email is released when it changes
+		_, _, err = repo.UpdateUser(ctx, &domain.User{
+			Name:  "users/b",
+			Email: "new-b@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"email"}})
+		assert.NilError(t, err)
+		createUser(t, repo, "c", "b@example.com")
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		createUser(t, repo, "a", "a@example.com")
+
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/b",
+			DisplayName: "User b",
+			Email:       "a@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+		assert.DeepEqual(t, err, emailTaken)
+	})
+
+	t.Run("delete releases and undelete reclaims", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUser(t, repo, "a", "same@example.com")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/a", domain.DeleteUserParams{}))
+		createUser(t, repo, "b", "same@example.com")
+
+		_, err := repo.UndeleteUser(ctx, "users/a")
+		assert.DeepEqual(t, err, emailTaken)
+
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+		_, err = repo.UndeleteUser(ctx, "users/a")
+		assert.NilError(t, err)
+	})
+}
+
+// TestLookupUserByEmail tests looking up users through the email index.
+func TestLookupUserByEmail(t *testing.T) {
+	t.Parallel()
+	repo := setupTestRepo(t)
+	ctx := t.Context()
+	created, err := repo.CreateUser(ctx, &domain.User{
+		Name:        "users/test123",
+		DisplayName: "Test User",
+		Email:       "Test@Example.com",
+	})
+	assert.NilError(t, err)
+
+	found, err := repo.LookupUserByEmail(ctx, "test@example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, found, created)
+
+	assert.NilError(t, repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{}))
+	_, err = repo.LookupUserByEmail(ctx, "test@example.com")
+	assert.DeepEqual(t, err, &domain.Error{
+		Type:    domain.NotFound,
+		Message: "user not found",
+	})
+}
+
 // TestGetUser tests the Get method following AIP-131 (Get Resource).
 func TestGetUser(t *testing.T) {
 	t.Parallel()
@@ -191,7 +330,7 @@ func TestGetUser(t *testing.T) {
 		assert.NilError(t, err)
 
 		// Get the user
-		retrieved, err := repo.GetUser(ctx, created.Name)
+		retrieved, err := repo.GetUser(ctx, created.Name, domain.GetUserParams{})
 		assert.NilError(t, err)
 
 		// Verify timestamps are preserved
@@ -205,7 +344,7 @@ func TestGetUser(t *testing.T) {
 		}
 
 		// We expect exactly the same object that was created
-		assert.DeepEqual(t, expectedUser, retrieved, ignoredTimeFields)
+		assert.DeepEqual(t, expectedUser, retrieved, ignoredTimeFields, ignoredRevisionFields)
 	})
 
 	t.Run("failure - not found", func(t *testing.T) {
@@ -213,10 +352,728 @@ func TestGetUser(t *testing.T) {
 		repo := setupTestRepo(t)
 		ctx := t.Context()
 
-		_, err := repo.GetUser(ctx, "users/nonexistent")
+		_, err := repo.GetUser(ctx, "users/nonexistent", domain.GetUserParams{})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+	})
+
+	t.Run("show deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{}))
+
+		_, err = repo.GetUser(ctx, "users/test123", domain.GetUserParams{})
 		assert.DeepEqual(t, err, &domain.Error{
 			Type:    domain.NotFound,
 			Message: "user not found",
 		})
+
+		retrieved, err := repo.GetUser(ctx, "users/test123", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !retrieved.DeleteTime.IsZero())
+	})
+}
+
+// TestListUsers tests the List method following AIP-132 (List Resources) and
+// AIP-158 (Pagination).
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+
+	createUsers := func(t *testing.T, repo *db.MemoryRepository, ids ...string) {
+		t.Helper()
+		for _, id := range ids {
+			_, err := repo.CreateUser(t.Context(), &domain.User{
+				Name:        "users/" + id,
+				DisplayName: "User " + id,
+				Email:       id + "@example.com",
+			})
+			assert.NilError(t, err)
+		}
+	}
+
+	names := func(users []*domain.User) []string {
+		result := make([]string, 0, len(users))
+		for _, user := range users {
+			result = append(result, user.Name)
+		}
+		return result
+	}
+
+	t.Run("success - empty", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+
+		users, nextPageToken, err := repo.ListUsers(t.Context(), domain.ListUsersParams{PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 0)
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - pages in name order", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "e", "c", "a", "d", "b")
+
+		users, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/a", "users/b"})
+		assert.Assert(t, nextPageToken != "")
+
+		users, nextPageToken, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2, PageToken: nextPageToken})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/c", "users/d"})
+		assert.Assert(t, nextPageToken != "")
+
+		users, nextPageToken, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2, PageToken: nextPageToken})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/e"})
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - cursor survives deletes", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c", "d")
+
+		users, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/a", "users/b"})
+
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+		assert.NilError(t, repo.DeleteUser(ctx, "users/c", domain.DeleteUserParams{}))
+
+		users, nextPageToken, err = repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 2, PageToken: nextPageToken})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/d"})
+		assert.Equal(t, nextPageToken, "")
+	})
+
+	t.Run("success - filter", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/c", domain.DeleteUserParams{}))
+
+		users, _, err := repo.ListUsers(ctx, domain.ListUsersParams{
+			PageSize: 10,
+			Filter:   `email = "b@*" OR display_name = "User c"`,
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/b"})
+	})
+
+	t.Run("success - show deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+		assert.NilError(t, repo.DeleteUser(ctx, "users/b", domain.DeleteUserParams{}))
+
+		users, _, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 10, ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names(users), []string{"users/a", "users/b", "users/c"})
+	})
+
+	t.Run("success - order by with pagination", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		for _, user := range []*domain.User{
+			{Name: "users/a", DisplayName: "Carol", Email: "a@example.com"},
+			{Name: "users/b", DisplayName: "Alice", Email: "b@example.com"},
+			{Name: "users/c", DisplayName: "Bob", Email: "c@example.com"},
+			{Name: "users/d", DisplayName: "Alice", Email: "d@example.com"},
+			{Name: "users/e", DisplayName: "Bob", Email: "e@example.com"},
+		} {
+			_, err := repo.CreateUser(ctx, user)
+			assert.NilError(t, err)
+		}
+
+		var got []string
+		params := domain.ListUsersParams{PageSize: 2, OrderBy: "display_name desc"}
+		for {
+			users, nextPageToken, err := repo.ListUsers(ctx, params)
+			assert.NilError(t, err)
+			got = append(got, names(users)...)
+			if nextPageToken == "" {
+				break
+			}
+			params.PageToken = nextPageToken
+		}
+		assert.DeepEqual(t, got, []string{"users/a", "users/c", "users/e", "users/b", "users/d"})
+	})
+
+	t.Run("failure - page token reused with different order by", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+
+		_, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 1, OrderBy: "email"})
+		assert.NilError(t, err)
+
+		_, _, err = repo.ListUsers(ctx, domain.ListUsersParams{
+			PageSize:  1,
+			PageToken: nextPageToken,
+			OrderBy:   "email desc",
+		})
+		var domainErr *domain.Error
+		assert.Assert(t, errors.As(err, &domainErr))
+		assert.Equal(t, domainErr.Type, domain.InvalidInput)
+	})
+
+	t.Run("failure - page token reused with different filter", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a", "b", "c")
+
+		_, nextPageToken, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 1})
+		assert.NilError(t, err)
+
+		_, _, err = repo.ListUsers(ctx, domain.ListUsersParams{
+			PageSize:  1,
+			PageToken: nextPageToken,
+			Filter:    `display_name:"User"`,
+		})
+		var domainErr *domain.Error
+		assert.Assert(t, errors.As(err, &domainErr))
+		assert.Equal(t, domainErr.Type, domain.InvalidInput)
+	})
+
+	t.Run("failure - invalid filter", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+
+		_, _, err := repo.ListUsers(t.Context(), domain.ListUsersParams{
+			PageSize: 10,
+			Filter:   `display_name =`,
+		})
+		var domainErr *domain.Error
+		assert.Assert(t, errors.As(err, &domainErr))
+		assert.Equal(t, domainErr.Type, domain.InvalidInput)
+	})
+
+	t.Run("failure - invalid page token", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+
+		_, _, err := repo.ListUsers(t.Context(), domain.ListUsersParams{
+			PageSize:  10,
+			PageToken: "invalid page token",
+		})
+		var domainErr *domain.Error
+		assert.Assert(t, errors.As(err, &domainErr))
+		assert.Equal(t, domainErr.Type, domain.InvalidInput)
+	})
+
+	t.Run("success - returns copies", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUsers(t, repo, "a")
+
+		users, _, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 10})
+		assert.NilError(t, err)
+		users[0].DisplayName = "Changed"
+
+		user, err := repo.GetUser(ctx, "users/a", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, user.DisplayName, "User a")
+	})
+
+	t.Run("success - consistent during writes", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		ids := make([]string, 0, 200)
+		for i := range cap(ids) {
+			ids = append(ids, fmt.Sprintf("user-%03d", i))
+		}
+
+		// Users are created in name order, so every list must see a prefix
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for _, id := range ids {
+				user := &domain.User{Name: "users/" + id, DisplayName: id, Email: id + "@example.com"}
+				if _, err := repo.CreateUser(ctx, user); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		for listing := true; listing; {
+			select {
+			case <-done:
+				listing = false
+			default:
+			}
+			users, _, err := repo.ListUsers(ctx, domain.ListUsersParams{PageSize: 1000})
+			assert.NilError(t, err)
+			for i, user := range users {
+				assert.Equal(t, user.Name, "users/"+ids[i])
+			}
+		}
+	})
+}
+
+// TestUpdateUser tests the Update method following AIP-134 (Update Resource).
+func TestUpdateUser(t *testing.T) {
+	t.Parallel()
+
+	createUser := func(t *testing.T, repo *db.MemoryRepository) *domain.User {
+		t.Helper()
+		created, err := repo.CreateUser(t.Context(), &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+		return created
+	}
+
+	t.Run("success - only masked fields", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		created := createUser(t, repo)
+
+		updated, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+			Email:       "ignored@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+
+		expectedUser := &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+			Email:       "test@example.com",
+		}
+		assert.DeepEqual(t, expectedUser, updated, ignoredTimeFields, ignoredRevisionFields)
+		assert.DeepEqual(t, created.CreateTime, updated.CreateTime)
+		assert.Assert(t, updated.UpdateTime.After(created.UpdateTime))
+
+		// The update should be persisted
+		retrieved, err := repo.GetUser(ctx, "users/test123", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, updated, retrieved)
+	})
+
+	t.Run("success - full replacement keeps create time", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		created := createUser(t, repo)
+
+		updated, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+			Email:       "renamed@example.com",
+			CreateTime:  time.Unix(0, 0).UTC(),
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}})
+		assert.NilError(t, err)
+
+		expectedUser := &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+			Email:       "renamed@example.com",
+		}
+		assert.DeepEqual(t, expectedUser, updated, ignoredTimeFields, ignoredRevisionFields)
+		assert.DeepEqual(t, created.CreateTime, updated.CreateTime)
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/nonexistent",
+			DisplayName: "Test User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+	})
+
+	t.Run("failure - deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUser(t, repo)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{}))
+
+		_, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+	})
+
+	t.Run("failure - output only path", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		createUser(t, repo)
+
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name: "users/test123",
+		}, domain.UpdateUserParams{UpdateMask: []string{"create_time"}})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.InvalidInput,
+			Message: "update_mask path is not updatable: create_time",
+		})
+	})
+
+	t.Run("failure - missing required fields", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		createUser(t, repo)
+
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:  "users/test123",
+			Email: "test@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.InvalidInput,
+			Message: "display_name is required",
+		})
+	})
+
+	t.Run("success - allow missing creates user", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+
+		upserted, created, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/upserted",
+			DisplayName: "Upserted User",
+			Email:       "upserted@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+		assert.NilError(t, err)
+		assert.Assert(t, created)
+		assert.Assert(t, !upserted.CreateTime.IsZero())
+		assert.DeepEqual(t, upserted.CreateTime, upserted.UpdateTime)
+
+		retrieved, err := repo.GetUser(ctx, "users/upserted", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, upserted, retrieved)
+	})
+
+	t.Run("success - allow missing updates existing user", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		existing := createUser(t, repo)
+
+		updated, created, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, AllowMissing: true})
+		assert.NilError(t, err)
+		assert.Assert(t, !created)
+		assert.Equal(t, updated.Email, existing.Email)
+		assert.DeepEqual(t, updated.CreateTime, existing.CreateTime)
+	})
+
+	t.Run("failure - allow missing with missing required fields", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+
+		_, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/upserted",
+			DisplayName: "Upserted User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, AllowMissing: true})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.InvalidInput,
+			Message: "email is required",
+		})
+
+		// A failed upsert must not leave a partial user behind
+		_, err = repo.GetUser(ctx, "users/upserted", domain.GetUserParams{})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+	})
+
+	t.Run("failure - allow missing on deleted user", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		createUser(t, repo)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{}))
+
+		_, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.AlreadyExists,
+			Message: "user already exists: users/test123",
+		})
+	})
+
+	t.Run("success - matching etag", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		created := createUser(t, repo)
+		assert.Assert(t, created.Etag != "")
+
+		updated, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+		assert.NilError(t, err)
+		assert.Equal(t, updated.Revision, created.Revision+1)
+		assert.Assert(t, updated.Etag != created.Etag)
+	})
+
+	t.Run("failure - stale etag", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		created := createUser(t, repo)
+
+		// The first writer wins and invalidates the etag read by the second
+		_, _, err := repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "First Writer",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+		assert.NilError(t, err)
+		_, _, err = repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Second Writer",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}, Etag: created.Etag})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.Conflict,
+			Message: "etag mismatch: the user has been modified",
+		})
+
+		retrieved, err := repo.GetUser(ctx, "users/test123", domain.GetUserParams{})
+		assert.NilError(t, err)
+		assert.Equal(t, retrieved.DisplayName, "First Writer")
+	})
+
+	t.Run("failure - allow missing with etag", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+
+		_, _, err := repo.UpdateUser(t.Context(), &domain.User{
+			Name:        "users/upserted",
+			DisplayName: "Upserted User",
+			Email:       "upserted@example.com",
+		}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true, Etag: "stale"})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.Conflict,
+			Message: "etag mismatch: the user does not exist",
+		})
+	})
+
+	t.Run("concurrent upserts create exactly once", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+
+		const workers = 16
+		var (
+			wg      sync.WaitGroup
+			creates atomic.Int32
+		)
+		for i := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, created, err := repo.UpdateUser(ctx, &domain.User{
+					Name:        "users/racy",
+					DisplayName: fmt.Sprintf("Worker %d", i),
+					Email:       "racy@example.com",
+				}, domain.UpdateUserParams{UpdateMask: []string{"*"}, AllowMissing: true})
+				assert.Check(t, err)
+				if created {
+					creates.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, creates.Load(), int32(1))
+	})
+}
+
+// TestDeleteUser tests the Delete method following AIP-135 and AIP-164 (Soft Delete).
+func TestDeleteUser(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success - soft deletes with purge time", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+
+		err = repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{Retention: time.Hour})
+		assert.NilError(t, err)
+
+		deleted, err := repo.GetUser(ctx, "users/test123", domain.GetUserParams{ShowDeleted: true})
+		assert.NilError(t, err)
+		assert.Assert(t, isRecentTime(deleted.DeleteTime))
+		assert.Equal(t, deleted.PurgeTime, deleted.DeleteTime.Add(time.Hour))
+	})
+
+	t.Run("failure - stale etag", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		created, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+		_, _, err = repo.UpdateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Renamed User",
+		}, domain.UpdateUserParams{UpdateMask: []string{"display_name"}})
+		assert.NilError(t, err)
+
+		err = repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{Etag: created.Etag})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.Conflict,
+			Message: "etag mismatch: the user has been modified",
+		})
+	})
+
+	t.Run("failure - already deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{}))
+
+		err = repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{})
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+	})
+}
+
+// TestUndeleteUser tests the Undelete method following AIP-164 (Soft Delete).
+func TestUndeleteUser(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		created, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+		assert.NilError(t, repo.DeleteUser(ctx, "users/test123", domain.DeleteUserParams{Retention: time.Hour}))
+
+		restored, err := repo.UndeleteUser(ctx, "users/test123")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, created, restored, ignoredTimeFields, ignoredRevisionFields)
+		assert.Assert(t, restored.DeleteTime.IsZero())
+		assert.Assert(t, restored.PurgeTime.IsZero())
+		assert.Assert(t, restored.UpdateTime.After(created.UpdateTime))
+
+		_, err = repo.GetUser(ctx, "users/test123", domain.GetUserParams{})
+		assert.NilError(t, err)
+	})
+
+	t.Run("failure - not deleted", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+		ctx := t.Context()
+		_, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/test123",
+			DisplayName: "Test User",
+			Email:       "test@example.com",
+		})
+		assert.NilError(t, err)
+
+		_, err = repo.UndeleteUser(ctx, "users/test123")
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.AlreadyExists,
+			Message: "user is not deleted: users/test123",
+		})
+	})
+
+	t.Run("failure - not found", func(t *testing.T) {
+		t.Parallel()
+		repo := setupTestRepo(t)
+
+		_, err := repo.UndeleteUser(t.Context(), "users/nonexistent")
+		assert.DeepEqual(t, err, &domain.Error{
+			Type:    domain.NotFound,
+			Message: "user not found",
+		})
+	})
+}
+
+func TestPurgeExpiredUsers(t *testing.T) {
+	t.Parallel()
+	repo := setupTestRepo(t)
+	ctx := t.Context()
+	for _, id := range []string{"active", "expired", "retained"} {
+		_, err := repo.CreateUser(ctx, &domain.User{
+			Name:        "users/" + id,
+			DisplayName: "User " + id,
+			Email:       id + "@example.com",
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, repo.DeleteUser(ctx, "users/expired", domain.DeleteUserParams{}))
+	assert.NilError(t, repo.DeleteUser(ctx, "users/retained", domain.DeleteUserParams{Retention: time.Hour}))
+
+	purged, err := repo.PurgeExpiredUsers(ctx, time.Now().UTC())
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 1)
+
+	_, err = repo.GetUser(ctx, "users/expired", domain.GetUserParams{ShowDeleted: true})
+	assert.DeepEqual(t, err, &domain.Error{
+		Type:    domain.NotFound,
+		Message: "user not found",
+	})
+	_, err = repo.GetUser(ctx, "users/retained", domain.GetUserParams{ShowDeleted: true})
+	assert.NilError(t, err)
+	_, err = repo.GetUser(ctx, "users/active", domain.GetUserParams{})
+	assert.NilError(t, err)
+
+	// A purged name can be reused
+	_, err = repo.CreateUser(ctx, &domain.User{
+		Name:        "users/expired",
+		DisplayName: "User expired",
+		Email:       "expired@example.com",
 	})
+	assert.NilError(t, err)
 }
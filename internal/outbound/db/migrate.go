@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is a versioned schema change, with the SQL to apply and revert it.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// Migrator applies and reverts the embedded schema migrations of a dialect.
+// Applied versions are recorded in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	logger     *slog.Logger
+	migrations []migration
+}
+
+func NewMigrator(logger *slog.Logger, db *sql.DB, dialect Dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations reads the migrations of a dialect, which are named
+// NNNN_description.up.sql and NNNN_description.down.sql.
+func loadMigrations(dialect Dialect) ([]migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		versionString, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionString)
+		if !ok || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration: %w", err)
+		}
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", m.version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+	return migrations, nil
+}
+
+// Version returns the version the schema is migrated to, which is zero for
+// an empty database, and the latest version available.
+func (m *Migrator) Version(ctx context.Context) (current, latest int, err error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, 0, err
+	}
+	if err := m.db.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version), 0) FROM schema_migrations",
+	).Scan(&current); err != nil {
+		return 0, 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if len(m.migrations) > 0 {
+		latest = m.migrations[len(m.migrations)-1].version
+	}
+	return current, latest, nil
+}
+
+// Up applies all pending migrations and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	current, _, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var applied int
+	for _, migration := range m.migrations {
+		if migration.version <= current {
+			continue
+		}
+		err := m.inTx(ctx, migration.up,
+			"INSERT INTO schema_migrations (version, applied_at) VALUES ("+
+				m.dialect.placeholder(1)+", "+m.dialect.placeholder(2)+")",
+			migration.version, time.Now().UnixNano(),
+		)
+		if err != nil {
+			return applied, fmt.Errorf("apply migration %d_%s: %w", migration.version, migration.name, err)
+		}
+		m.logger.InfoContext(ctx, "applied migration", "version", migration.version, "name", migration.name)
+		applied++
+	}
+	return applied, nil
+}
+
+// Down reverts up to steps of the most recently applied migrations and
+// returns how many were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	current, _, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var reverted int
+	for _, migration := range slices.Backward(m.migrations) {
+		if reverted == steps {
+			break
+		}
+		if migration.version > current {
+			continue
+		}
+		err := m.inTx(ctx, migration.down,
+			"DELETE FROM schema_migrations WHERE version = "+m.dialect.placeholder(1),
+			migration.version,
+		)
+		if err != nil {
+			return reverted, fmt.Errorf("revert migration %d_%s: %w", migration.version, migration.name, err)
+		}
+		m.logger.InfoContext(ctx, "reverted migration", "version", migration.version, "name", migration.name)
+		reverted++
+	}
+	return reverted, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    applied_at BIGINT NOT NULL
+)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// inTx runs a migration script and the statement that records it in one
+// transaction, so that a failed migration leaves no trace.
+func (m *Migrator) inTx(ctx context.Context, script, record string, args ...any) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,30 @@
+-- Past and current versions of users, for reads at a point in time. A
+-- version is valid from valid_from until valid_to, which is NULL for the
+-- current version of a user.
+CREATE TABLE user_versions (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name TEXT COLLATE "C" NOT NULL,
+    display_name TEXT COLLATE "C" NOT NULL,
+    email TEXT COLLATE "C" NOT NULL,
+    create_time BIGINT NOT NULL,
+    update_time BIGINT NOT NULL,
+    delete_time BIGINT,
+    purge_time BIGINT,
+    revision BIGINT NOT NULL,
+    etag TEXT NOT NULL,
+    valid_from BIGINT NOT NULL,
+    valid_to BIGINT
+);
+
+CREATE INDEX user_versions_name_idx ON user_versions (name) WHERE valid_to IS NULL;
+
+CREATE INDEX user_versions_valid_to_idx ON user_versions (valid_to);
+
+-- The history starts with the current users
+INSERT INTO user_versions (
+    name, display_name, email, create_time, update_time, delete_time, purge_time, revision, etag, valid_from
+)
+SELECT
+    name, display_name, email, create_time, update_time, delete_time, purge_time, revision, etag,
+    GREATEST(update_time, COALESCE(delete_time, 0))
+FROM users;
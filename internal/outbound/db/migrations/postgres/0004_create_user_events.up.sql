@@ -0,0 +1,9 @@
+-- The outbox of events of changes to users, which are inserted in the same
+-- transaction as the changes and deleted once they have been published. The
+-- user after the change is stored as JSON, and the events of a user are
+-- ordered by id.
+CREATE TABLE user_events (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name TEXT NOT NULL,
+    user_record TEXT NOT NULL
+);
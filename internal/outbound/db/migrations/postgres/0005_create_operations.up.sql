@@ -0,0 +1,7 @@
+-- Long-running operations. The operation is stored as JSON, and done_time is
+-- set once it is done, so that done operations can be purged.
+CREATE TABLE operations (
+    name TEXT PRIMARY KEY,
+    done_time BIGINT,
+    record TEXT NOT NULL
+);
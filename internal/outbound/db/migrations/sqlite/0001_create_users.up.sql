@@ -0,0 +1,19 @@
+-- Times are stored as nanoseconds since the Unix epoch, so that they round
+-- trip without losing precision.
+CREATE TABLE users (
+    name TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    email_key TEXT NOT NULL,
+    create_time BIGINT NOT NULL,
+    update_time BIGINT NOT NULL,
+    delete_time BIGINT,
+    purge_time BIGINT,
+    revision BIGINT NOT NULL,
+    etag TEXT NOT NULL
+);
+
+-- Emails are unique, ignoring case, among users that aren't deleted.
+CREATE UNIQUE INDEX users_email_key_idx ON users (email_key) WHERE delete_time IS NULL;
+
+CREATE INDEX users_purge_time_idx ON users (purge_time) WHERE delete_time IS NOT NULL;
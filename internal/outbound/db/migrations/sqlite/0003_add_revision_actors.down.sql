@@ -0,0 +1,5 @@
+DROP INDEX user_versions_name_id_idx;
+
+ALTER TABLE user_versions DROP COLUMN revision_actor;
+
+ALTER TABLE users DROP COLUMN revision_actor;
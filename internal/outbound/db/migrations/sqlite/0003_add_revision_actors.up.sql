@@ -0,0 +1,8 @@
+-- The actor who wrote each version, empty for versions written before this
+-- migration.
+ALTER TABLE users ADD COLUMN revision_actor TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE user_versions ADD COLUMN revision_actor TEXT NOT NULL DEFAULT '';
+
+-- The versions of a user are also its revisions, listed newest first.
+CREATE INDEX user_versions_name_id_idx ON user_versions (name, id);
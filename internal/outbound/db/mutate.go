@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// The functions in this file compute the next version of a user for each
+// kind of write, so that every repository applies the same rules. They never
+// modify the stored version, and leave persisting the result to the caller.
+
+// change describes a write: when it is made, and by whom.
+type change struct {
+	time  time.Time
+	actor string
+}
+
+// newChange returns a change made now by the actor of the request.
+func newChange(ctx context.Context) change {
+	return change{time: time.Now().UTC(), actor: domain.ActorFromContext(ctx)}
+}
+
+// createdUser returns the first version of a new user.
+func createdUser(user *domain.User, c change) (*domain.User, error) {
+	if err := validateRequiredFields(user); err != nil {
+		return nil, err
+	}
+	created := &domain.User{
+		Name:        user.Name,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		CreateTime:  c.time,
+		UpdateTime:  c.time,
+	}
+	bumpRevision(created, c)
+	return created, nil
+}
+
+// updatedUser returns the version of a user after applying an update to the
+// stored version, which is nil if there is none. With allow_missing, a
+// missing user is created.
+func updatedUser(
+	stored *domain.User,
+	u *domain.User,
+	params domain.UpdateUserParams,
+	c change,
+) (*domain.User, error) {
+	var updated *domain.User
+	switch {
+	case stored == nil && params.AllowMissing:
+		// There is no revision an etag could match
+		if params.Etag != "" {
+			return nil, domain.NewErrorConflict("etag mismatch: the user does not exist", nil)
+		}
+		updated = &domain.User{Name: u.Name, CreateTime: c.time}
+	case stored != nil && !stored.DeleteTime.IsZero() && params.AllowMissing:
+		return nil, domain.NewErrorAlreadyExists(
+			fmt.Sprintf("user already exists: %s", u.Name),
+			nil,
+		)
+	case stored == nil || !stored.DeleteTime.IsZero():
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	default:
+		if err := checkEtag(stored, params.Etag); err != nil {
+			return nil, err
+		}
+		updated = stored.Copy()
+	}
+
+	// Apply only the fields in the mask
+	for _, path := range params.UpdateMask {
+		switch path {
+		case "*":
+			updated.DisplayName = u.DisplayName
+			updated.Email = u.Email
+		case "display_name":
+			updated.DisplayName = u.DisplayName
+		case "email":
+			updated.Email = u.Email
+		default:
+			return nil, domain.NewErrorInvalidInput(
+				fmt.Sprintf("update_mask path is not updatable: %s", path),
+				nil,
+			)
+		}
+	}
+	if err := validateRequiredFields(updated); err != nil {
+		return nil, err
+	}
+
+	updated.UpdateTime = c.time
+	bumpRevision(updated, c)
+	return updated, nil
+}
+
+// deletedUser returns the soft-deleted version of a stored user, which is nil
+// if there is none.
+func deletedUser(stored *domain.User, params domain.DeleteUserParams, c change) (*domain.User, error) {
+	if stored == nil || !stored.DeleteTime.IsZero() {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	if err := checkEtag(stored, params.Etag); err != nil {
+		return nil, err
+	}
+	deleted := stored.Copy()
+	deleted.DeleteTime = c.time
+	deleted.PurgeTime = c.time.Add(params.Retention)
+	bumpRevision(deleted, c)
+	return deleted, nil
+}
+
+// undeletedUser returns the restored version of a soft-deleted user, which is
+// nil if there is none.
+func undeletedUser(stored *domain.User, c change) (*domain.User, error) {
+	if stored == nil {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	if stored.DeleteTime.IsZero() {
+		return nil, domain.NewErrorAlreadyExists(
+			fmt.Sprintf("user is not deleted: %s", stored.Name),
+			nil,
+		)
+	}
+	restored := stored.Copy()
+	restored.DeleteTime = time.Time{}
+	restored.PurgeTime = time.Time{}
+	restored.UpdateTime = c.time
+	bumpRevision(restored, c)
+	return restored, nil
+}
+
+// rolledBackUser returns the version of a stored user, which is nil if there
+// is none, that restores the display name and email of one of its revisions,
+// which is nil if it isn't kept.
+func rolledBackUser(
+	stored, revision *domain.User,
+	params domain.RollbackUserParams,
+	c change,
+) (*domain.User, error) {
+	if stored == nil || !stored.DeleteTime.IsZero() {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	if revision == nil {
+		return nil, domain.NewErrorNotFound("revision not found", nil)
+	}
+	if err := checkEtag(stored, params.Etag); err != nil {
+		return nil, err
+	}
+	restored := stored.Copy()
+	restored.DisplayName = revision.DisplayName
+	restored.Email = revision.Email
+	restored.UpdateTime = c.time
+	bumpRevision(restored, c)
+	return restored, nil
+}
+
+// validateRequiredFields returns an InvalidInput error if a required field of
+// the user is missing.
+func validateRequiredFields(user *domain.User) error {
+	if user.DisplayName == "" {
+		return domain.NewErrorInvalidInput("display_name is required", nil)
+	}
+	if user.Email == "" {
+		return domain.NewErrorInvalidInput("email is required", nil)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+)
+
+// MemoryOperationStore keeps operations in memory, so they are lost when the
+// process exits.
+type MemoryOperationStore struct {
+	mutex      sync.RWMutex
+	operations map[string]*domain.Operation
+}
+
+func NewMemoryOperationStore() *MemoryOperationStore {
+	return &MemoryOperationStore{operations: make(map[string]*domain.Operation)}
+}
+
+func (s *MemoryOperationStore) PutOperation(_ context.Context, op *domain.Operation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	copied := *op
+	s.operations[op.Name] = &copied
+	return nil
+}
+
+func (s *MemoryOperationStore) GetOperation(_ context.Context, name string) (*domain.Operation, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	op, exists := s.operations[name]
+	if !exists {
+		return nil, domain.NewErrorNotFound("operation not found", nil)
+	}
+	copied := *op
+	return &copied, nil
+}
+
+func (s *MemoryOperationStore) ListOperations(
+	_ context.Context,
+	params domain.ListOperationsParams,
+) ([]*domain.Operation, string, error) {
+	filter, err := query.ParseOperationFilter(params.Filter)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid filter", err)
+	}
+	checksum := requestChecksum(params.Filter)
+	token, err := decodePageToken(params.PageToken, checksum)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+	}
+	var after string
+	if token.LastKey != nil {
+		after = token.LastKey[0]
+	}
+	pageSize := max(int(params.PageSize), 0)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var ops []*domain.Operation
+	for _, name := range slices.Sorted(maps.Keys(s.operations)) {
+		if name <= after {
+			continue
+		}
+		op := s.operations[name]
+		match, err := query.MatchOperation(filter, op)
+		if err != nil {
+			return nil, "", domain.NewErrorInvalidInput("invalid filter", err)
+		}
+		if !match {
+			continue
+		}
+		if pageSize > 0 && len(ops) == pageSize {
+			return ops, encodePageToken([]string{ops[len(ops)-1].Name}, checksum), nil
+		}
+		copied := *op
+		ops = append(ops, &copied)
+	}
+	return ops, "", nil
+}
+
+func (s *MemoryOperationStore) DeleteOperation(_ context.Context, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.operations[name]; !exists {
+		return domain.NewErrorNotFound("operation not found", nil)
+	}
+	delete(s.operations, name)
+	return nil
+}
+
+func (s *MemoryOperationStore) PurgeOperations(_ context.Context, before time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	purged := 0
+	for name, op := range s.operations {
+		if op.Done && op.DoneTime.Before(before) {
+			delete(s.operations, name)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// operationRecord is the stored form of a domain.Operation, for the stores
+// that outlive the process.
+type operationRecord struct {
+	Name            string          `json:"name"`
+	Done            bool            `json:"done"`
+	DoneTime        time.Time       `json:"done_time,omitzero"`
+	Metadata        *operationValue `json:"metadata,omitempty"`
+	Response        *operationValue `json:"response,omitempty"`
+	Error           *operationError `json:"error,omitempty"`
+	Owner           string          `json:"owner,omitempty"`
+	LeaseExpireTime time.Time       `json:"lease_expire_time,omitzero"`
+}
+
+// operationValue is the metadata or response of a stored operation, tagged
+// with its type.
+type operationValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// operationError is the error of a stored operation.
+type operationError struct {
+	Canceled bool             `json:"canceled,omitempty"`
+	Type     domain.ErrorType `json:"type"`
+	Message  string           `json:"message"`
+	Field    string           `json:"field,omitempty"`
+}
+
+// Tags of the types of the values that stored operations hold.
+const (
+	purgeUsersMetadataType = "PurgeUsersMetadata"
+	purgeUsersResultType   = "PurgeUsersResult"
+)
+
+func toOperationRecord(op *domain.Operation) (*operationRecord, error) {
+	metadata, err := toOperationValue(op.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	response, err := toOperationValue(op.Response)
+	if err != nil {
+		return nil, err
+	}
+	return &operationRecord{
+		Name:            op.Name,
+		Done:            op.Done,
+		DoneTime:        op.DoneTime,
+		Metadata:        metadata,
+		Response:        response,
+		Error:           toOperationError(op.Error),
+		Owner:           op.Owner,
+		LeaseExpireTime: op.LeaseExpireTime,
+	}, nil
+}
+
+func (r *operationRecord) toDomain() (*domain.Operation, error) {
+	metadata, err := r.Metadata.toDomain()
+	if err != nil {
+		return nil, err
+	}
+	response, err := r.Response.toDomain()
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Operation{
+		Name:            r.Name,
+		Metadata:        metadata,
+		Done:            r.Done,
+		Response:        response,
+		Error:           r.Error.toDomain(),
+		DoneTime:        r.DoneTime,
+		Owner:           r.Owner,
+		LeaseExpireTime: r.LeaseExpireTime,
+	}, nil
+}
+
+func toOperationValue(value any) (*operationValue, error) {
+	var valueType string
+	switch value.(type) {
+	case nil:
+		return nil, nil //nolint:nilnil // An operation may have no value.
+	case domain.PurgeUsersMetadata:
+		valueType = purgeUsersMetadataType
+	case domain.PurgeUsersResult:
+		valueType = purgeUsersResultType
+	default:
+		return nil, domain.NewErrorInternal(fmt.Sprintf("unsupported operation value: %T", value), nil)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, domain.NewErrorInternal("failed to encode operation value", err)
+	}
+	return &operationValue{Type: valueType, Value: data}, nil
+}
+
+func (v *operationValue) toDomain() (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch v.Type {
+	case purgeUsersMetadataType:
+		return decodeOperationValue[domain.PurgeUsersMetadata](v.Value)
+	case purgeUsersResultType:
+		return decodeOperationValue[domain.PurgeUsersResult](v.Value)
+	default:
+		return nil, domain.NewErrorInternal("unsupported operation value: "+v.Type, nil)
+	}
+}
+
+func decodeOperationValue[T any](data json.RawMessage) (any, error) {
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, domain.NewErrorInternal("failed to decode operation value", err)
+	}
+	return value, nil
+}
+
+// toOperationError keeps the type and message of domain errors, and whether
+// the operation was cancelled. Other errors become Internal.
+func toOperationError(err error) *operationError {
+	var customErr *domain.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return &operationError{Canceled: true, Type: domain.Internal, Message: err.Error()}
+	case errors.As(err, &customErr):
+		return &operationError{Type: customErr.Type, Message: customErr.Message, Field: customErr.Field}
+	default:
+		return &operationError{Type: domain.Internal, Message: err.Error()}
+	}
+}
+
+func (e *operationError) toDomain() error {
+	switch {
+	case e == nil:
+		return nil
+	case e.Canceled:
+		return context.Canceled
+	default:
+		return &domain.Error{Type: e.Type, Message: e.Message, Field: e.Field}
+	}
+}
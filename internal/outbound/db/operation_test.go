@@ -0,0 +1,79 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
+	"gotest.tools/v3/assert"
+)
+
+// TestMemoryOperationStore runs the operation store conformance suite.
+func TestMemoryOperationStore(t *testing.T) {
+	t.Parallel()
+	dbtest.TestOperationStore(t, func(*testing.T) port.OperationStore {
+		return db.NewMemoryOperationStore()
+	})
+}
+
+// TestFileOperationStore runs the operation store conformance suite, and
+// tests that operations survive reopening the store.
+func TestFileOperationStore(t *testing.T) {
+	t.Parallel()
+	dbtest.TestOperationStore(t, func(t *testing.T) port.OperationStore {
+		store, err := db.NewFileOperationStore(filepath.Join(t.TempDir(), "operations.json"))
+		assert.NilError(t, err)
+		return store
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "operations.json")
+		store, err := db.NewFileOperationStore(path)
+		assert.NilError(t, err)
+		assert.NilError(t, store.PutOperation(t.Context(), &domain.Operation{
+			Name:     "operations/a",
+			Metadata: domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 1},
+		}))
+		assert.NilError(t, store.PutOperation(t.Context(), &domain.Operation{Name: "operations/b"}))
+		assert.NilError(t, store.DeleteOperation(t.Context(), "operations/b"))
+
+		store, err = db.NewFileOperationStore(path)
+		assert.NilError(t, err)
+		op, err := store.GetOperation(t.Context(), "operations/a")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, op.Metadata, domain.PurgeUsersMetadata{PurgeCount: 2, PurgedCount: 1})
+		_, err = store.GetOperation(t.Context(), "operations/b")
+		assert.ErrorContains(t, err, "operation not found")
+	})
+
+	t.Run("rejects values it can't keep", func(t *testing.T) {
+		t.Parallel()
+		store, err := db.NewFileOperationStore(filepath.Join(t.TempDir(), "operations.json"))
+		assert.NilError(t, err)
+		err = store.PutOperation(t.Context(), &domain.Operation{Name: "operations/a", Metadata: "progress"})
+		assert.ErrorContains(t, err, "unsupported operation value: string")
+		_, err = store.GetOperation(t.Context(), "operations/a")
+		assert.ErrorContains(t, err, "operation not found")
+	})
+}
+
+// TestSQLOperationStore runs the operation store conformance suite against
+// each dialect.
+func TestSQLOperationStore(t *testing.T) {
+	t.Parallel()
+
+	for dialect, open := range sqlTestDatabases(t) {
+		t.Run(string(dialect), func(t *testing.T) {
+			t.Parallel()
+			dbtest.TestOperationStore(t, func(t *testing.T) port.OperationStore {
+				database := open(t)
+				migrateUp(t, database, dialect)
+				return db.NewSQLOperationStore(database, dialect)
+			})
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// eventOutbox keeps the events of a MemoryRepository, or of all shards of a
+// ShardedRepository, until they are acknowledged. Events are added under the
+// write lock of the repository that holds the user, so the events of a user
+// are in the order of its changes.
+type eventOutbox struct {
+	mutex  sync.Mutex
+	last   int64              // The last sequence handed out.
+	events []domain.UserEvent // Ordered by sequence.
+}
+
+func newEventOutbox() *eventOutbox {
+	return &eventOutbox{}
+}
+
+// reserve hands out the next sequence, for an event that is journaled before
+// it is added.
+func (o *eventOutbox) reserve() int64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.last++
+	return o.last
+}
+
+// add adds an event, giving it the next sequence unless it has one. An event
+// that is already in the outbox is ignored, so that replaying writes has no
+// further effect.
+func (o *eventOutbox) add(event domain.UserEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if event.Sequence == 0 {
+		o.last++
+		event.Sequence = o.last
+	}
+	o.last = max(o.last, event.Sequence)
+	i, exists := slices.BinarySearchFunc(o.events, event.Sequence, compareSequence)
+	if !exists {
+		o.events = slices.Insert(o.events, i, event)
+	}
+}
+
+// read returns up to limit of the oldest events, with copies of their users.
+func (o *eventOutbox) read(limit int) []domain.UserEvent {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	events := slices.Clone(o.events[:min(len(o.events), max(limit, 0))])
+	for i := range events {
+		events[i].User = events[i].User.Copy()
+	}
+	return events
+}
+
+// ack removes the events with the given sequences.
+func (o *eventOutbox) ack(sequences []int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = slices.DeleteFunc(o.events, func(e domain.UserEvent) bool {
+		return slices.Contains(sequences, e.Sequence)
+	})
+}
+
+// pending returns all events in the outbox.
+func (o *eventOutbox) pending() []domain.UserEvent {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return slices.Clone(o.events)
+}
+
+func compareSequence(e domain.UserEvent, sequence int64) int {
+	return cmp.Compare(e.Sequence, sequence)
+}
+
+// sequences returns the sequences of events.
+func sequences(events []domain.UserEvent) []int64 {
+	s := make([]int64, len(events))
+	for i, event := range events {
+		s[i] = event.Sequence
+	}
+	return s
+}
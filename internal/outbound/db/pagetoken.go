@@ -0,0 +1,84 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// pageTokenVersion is bumped whenever the page token format changes, which
+// invalidates all tokens issued by earlier versions.
+const pageTokenVersion = 2
+
+// pageToken is an opaque cursor into a listing. It records the sort key of
+// the last returned item and a checksum of the request parameters it was
+// issued for, so that a token can't be reused with a different request.
+type pageToken struct {
+	Version  int      `json:"v"`
+	LastKey  []string `json:"k"`
+	Checksum uint32   `json:"c"`
+}
+
+// requestChecksum returns a checksum of the request parameters that must stay
+// the same across pages. The page size and page token are not included.
+func requestChecksum(params ...string) uint32 {
+	return crc32.ChecksumIEEE([]byte(strings.Join(params, "\x00")))
+}
+
+// listChecksum returns the checksum of the parameters of a ListUsers request
+// that must stay the same across pages.
+func listChecksum(params domain.ListUsersParams) uint32 {
+	parts := []string{params.Filter, params.OrderBy, strconv.FormatBool(params.ShowDeleted)}
+	// Tokens of current reads stay the same
+	if !params.ReadTime.IsZero() {
+		parts = append(parts, params.ReadTime.UTC().Format(time.RFC3339Nano))
+	}
+	return requestChecksum(parts...)
+}
+
+// encodePageToken returns the opaque string form of a page token.
+func encodePageToken(lastKey []string, checksum uint32) string {
+	data, err := json.Marshal(pageToken{
+		Version:  pageTokenVersion,
+		LastKey:  lastKey,
+		Checksum: checksum,
+	})
+	if err != nil {
+		// Marshaling a struct of strings and integers can't fail
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken parses a page token and verifies that it was issued for a
+// request with the given checksum. An empty token decodes to a zero token.
+func decodePageToken(s string, checksum uint32) (pageToken, error) {
+	if s == "" {
+		return pageToken{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageToken{}, fmt.Errorf("decode page token: %w", err)
+	}
+	var token pageToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return pageToken{}, fmt.Errorf("decode page token: %w", err)
+	}
+	if token.Version != pageTokenVersion {
+		return pageToken{}, fmt.Errorf("unsupported page token version %d", token.Version)
+	}
+	if len(token.LastKey) == 0 {
+		return pageToken{}, errors.New("page token has no cursor")
+	}
+	if token.Checksum != checksum {
+		return pageToken{}, errors.New("page token was issued for a different request")
+	}
+	return token, nil
+}
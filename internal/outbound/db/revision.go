@@ -0,0 +1,152 @@
+package db
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// Repositories keep the revisions of users for AIP-162, for a retention that
+// is set with SetRevisionRetention and counts from when a revision was
+// replaced. The current revision of a user is never replaced, and the last
+// revision of a purged user is replaced when it is purged. A zero retention,
+// the default, keeps only the current revisions.
+
+// revisionLog keeps the revisions of the users of a MemoryRepository. Its
+// latest revision of every user that exists is the user's current version.
+type revisionLog struct {
+	mutex     sync.RWMutex
+	retention time.Duration
+	users     map[string][]revisionEntry // Oldest first.
+}
+
+// revisionEntry is a revision, and when it was replaced. The replace time is
+// zero for the current revision of a user.
+type revisionEntry struct {
+	user        *domain.User
+	replaceTime time.Time
+}
+
+func newRevisionLog() *revisionLog {
+	return &revisionLog{users: make(map[string][]revisionEntry)}
+}
+
+// setRetention sets how long revisions are kept after they were replaced.
+func (l *revisionLog) setRetention(retention time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.retention = retention
+}
+
+// add records a new revision of a user. A revision that is already kept is
+// ignored, so that replaying writes has no further effect.
+func (l *revisionLog) add(user *domain.User) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entries := l.users[user.Name]
+	isRevision := func(e revisionEntry) bool { return e.user.RevisionID == user.RevisionID }
+	if i := slices.IndexFunc(entries, isRevision); i >= 0 {
+		// A replayed purge may have replaced it
+		if i == len(entries)-1 {
+			entries[i].replaceTime = time.Time{}
+		}
+		return
+	}
+	if n := len(entries); n > 0 && entries[n-1].replaceTime.IsZero() {
+		entries[n-1].replaceTime = user.RevisionCreateTime
+	}
+	l.users[user.Name] = l.expire(append(entries, revisionEntry{user: user}), time.Now())
+}
+
+// remove records that a user was purged at the given time.
+func (l *revisionLog) remove(name string, at time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entries := l.users[name]
+	if n := len(entries); n > 0 && entries[n-1].replaceTime.IsZero() {
+		entries[n-1].replaceTime = at
+	}
+}
+
+// prune drops the revisions of all users that are past the retention.
+func (l *revisionLog) prune(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for name, entries := range l.users {
+		if entries = l.expire(entries, now); len(entries) == 0 {
+			delete(l.users, name)
+		} else {
+			l.users[name] = entries
+		}
+	}
+}
+
+// expire returns the entries without the leading ones that are past the
+// retention. The caller must hold the write lock.
+func (l *revisionLog) expire(entries []revisionEntry, now time.Time) []revisionEntry {
+	cutoff := now.Add(-l.retention)
+	var expired int
+	for expired < len(entries) {
+		replaceTime := entries[expired].replaceTime
+		if replaceTime.IsZero() || replaceTime.After(cutoff) {
+			break
+		}
+		expired++
+	}
+	clear(entries[:expired])
+	return entries[expired:]
+}
+
+// list returns copies of the revisions of a user, newest first, that come
+// after the revision with the ID after, or from the newest if it is empty.
+// At most limit revisions are returned.
+func (l *revisionLog) list(name, after string, limit int) ([]*domain.User, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	entries, exists := l.users[name]
+	if !exists {
+		return nil, false
+	}
+	end := len(entries)
+	if after != "" {
+		end = slices.IndexFunc(entries, func(e revisionEntry) bool { return e.user.RevisionID == after })
+		// The revisions before one that expired have expired as well
+		end = max(end, 0)
+	}
+	revisions := make([]*domain.User, 0, min(end, limit))
+	for i := end - 1; i >= 0 && len(revisions) < limit; i-- {
+		revisions = append(revisions, entries[i].user.Copy())
+	}
+	return revisions, true
+}
+
+// get returns a copy of a revision of a user.
+func (l *revisionLog) get(name, revisionID string) (*domain.User, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for _, entry := range l.users[name] {
+		if entry.user.RevisionID == revisionID {
+			return entry.user.Copy(), true
+		}
+	}
+	return nil, false
+}
+
+// all calls fn with the revisions of every user that are kept, oldest first,
+// and whether the user was purged.
+func (l *revisionLog) all(fn func(revisions []*domain.User, purged bool) error) error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for _, entries := range l.users {
+		revisions := make([]*domain.User, 0, len(entries))
+		for _, entry := range entries {
+			revisions = append(revisions, entry.user)
+		}
+		if err := fn(revisions, !entries[len(entries)-1].replaceTime.IsZero()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
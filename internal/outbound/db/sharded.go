@@ -0,0 +1,441 @@
+package db
+
+import (
+	"container/heap"
+	"context"
+	"hash/maphash"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+)
+
+// ShardedRepository spreads users over several in-memory shards by a hash of
+// their name, so that writes to different shards don't contend for the same
+// lock. Emails are kept unique across shards by a shared index, which is
+// itself sharded by email, and the events of all shards go to a shared
+// outbox.
+//
+// Reads of a single user behave as with a MemoryRepository. ListUsers merges
+// the pages of all shards into one, reading a snapshot of each shard; the
+// snapshots are not taken at the same instant, unless a read time is given.
+type ShardedRepository struct {
+	shards []*MemoryRepository
+	emails *emailIndex
+	outbox *eventOutbox
+	seed   maphash.Seed
+}
+
+// NewShardedRepository returns a repository with the given number of shards,
+// at least one.
+func NewShardedRepository(logger *slog.Logger, shards int) *ShardedRepository {
+	shards = max(shards, 1)
+	r := &ShardedRepository{
+		shards: make([]*MemoryRepository, 0, shards),
+		emails: newEmailIndex(shards),
+		outbox: newEventOutbox(),
+		seed:   maphash.MakeSeed(),
+	}
+	for range shards {
+		shard := newMemoryRepository(logger)
+		shard.emailOwners = r.emails
+		shard.outbox = r.outbox
+		r.shards = append(r.shards, shard)
+	}
+	return r
+}
+
+// SetHistoryWindow sets how long past versions of users are kept for reads
+// at a point in time.
+func (r *ShardedRepository) SetHistoryWindow(window time.Duration) {
+	for _, shard := range r.shards {
+		shard.SetHistoryWindow(window)
+	}
+}
+
+// SetRevisionRetention sets how long revisions of users are kept after they
+// were replaced.
+func (r *ShardedRepository) SetRevisionRetention(retention time.Duration) {
+	for _, shard := range r.shards {
+		shard.SetRevisionRetention(retention)
+	}
+}
+
+// shard returns the shard that holds the user with the given name.
+func (r *ShardedRepository) shard(name string) *MemoryRepository {
+	return r.shards[r.shardIndex(name)]
+}
+
+func (r *ShardedRepository) shardIndex(name string) int {
+	return int(maphash.String(r.seed, name) % uint64(len(r.shards)))
+}
+
+func (r *ShardedRepository) SnapshotUsers(_ context.Context, readTime time.Time) (port.UserSnapshot, error) {
+	snapshot := &shardedSnapshot{repo: r, shards: make([]*memorySnapshot, 0, len(r.shards))}
+	for _, shard := range r.shards {
+		shardSnapshot, err := shard.snapshotAt(readTime)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.shards = append(snapshot.shards, shardSnapshot)
+	}
+	return snapshot, nil
+}
+
+// current returns the current snapshots of all shards.
+func (r *ShardedRepository) current() *shardedSnapshot {
+	snapshot := &shardedSnapshot{repo: r, shards: make([]*memorySnapshot, 0, len(r.shards))}
+	for _, shard := range r.shards {
+		snapshot.shards = append(snapshot.shards, shard.snapshot())
+	}
+	return snapshot
+}
+
+// shardedSnapshot is a snapshot of every shard of a ShardedRepository.
+type shardedSnapshot struct {
+	repo   *ShardedRepository
+	shards []*memorySnapshot
+}
+
+func (s *shardedSnapshot) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	return s.shards[s.repo.shardIndex(name)].GetUser(ctx, name, params)
+}
+
+func (s *shardedSnapshot) ListUsers(
+	_ context.Context,
+	params domain.ListUsersParams,
+) ([]*domain.User, string, error) {
+	request, err := parseListRequest(params)
+	if err != nil {
+		return nil, "", err
+	}
+	// Every shard contributes the matches that could make the page
+	lists := make([][]*domain.User, 0, len(s.shards))
+	for _, shard := range s.shards {
+		matches, err := shard.list(request)
+		if err != nil {
+			return nil, "", err
+		}
+		lists = append(lists, matches)
+	}
+	users, nextPageToken := request.page(mergeSorted(lists, request.compare, request.pageSize+1))
+	return users, nextPageToken, nil
+}
+
+func (r *ShardedRepository) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+	return r.shard(user.Name).CreateUser(ctx, user)
+}
+
+func (r *ShardedRepository) BatchCreateUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.BatchCreateUsersParams,
+) ([]*domain.User, []error, error) {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	var (
+		created []*domain.User
+		errs    []error
+	)
+	err := r.writeBatch(names, func(batchOf func(string) *writeBatch) error {
+		var err error
+		created, errs, err = stageCreates(users, params.Atomic, newChange(ctx), batchOf)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Return copies to prevent external modifications
+	return copyUsers(created), errs, nil
+}
+
+// writeBatch holds the write locks of the shards of all named users while it
+// stages writes in a batch for each shard, so that the writes are atomic
+// across shards. The batches are committed unless staging fails.
+func (r *ShardedRepository) writeBatch(names []string, stage func(batchOf func(name string) *writeBatch) error) error {
+	// Lock the shards in order, so that concurrent batches can't deadlock
+	indexes := make([]int, 0, len(names))
+	for _, name := range names {
+		indexes = append(indexes, r.shardIndex(name))
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+	batches := make([]*writeBatch, len(r.shards))
+	for _, i := range indexes {
+		r.shards[i].mutex.Lock()
+		defer r.shards[i].mutex.Unlock()
+		batches[i] = r.shards[i].newWriteBatch()
+	}
+
+	err := stage(func(name string) *writeBatch {
+		return batches[r.shardIndex(name)]
+	})
+	if err != nil {
+		for _, i := range indexes {
+			batches[i].abort()
+		}
+		return err
+	}
+	// Shards don't journal, so committing can't fail part way
+	for _, i := range indexes {
+		if err := batches[i].commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ShardedRepository) GetUser(
+	ctx context.Context,
+	name string,
+	params domain.GetUserParams,
+) (*domain.User, error) {
+	return r.shard(name).GetUser(ctx, name, params)
+}
+
+func (r *ShardedRepository) BatchGetUsers(_ context.Context, names []string) (map[string]*domain.User, error) {
+	snapshot := r.current()
+	users := make(map[string]*domain.User, len(names))
+	for _, name := range names {
+		if user, ok := snapshot.shards[r.shardIndex(name)].live(name); ok {
+			users[name] = user
+		}
+	}
+	return users, nil
+}
+
+func (r *ShardedRepository) ListUsers(
+	ctx context.Context,
+	params domain.ListUsersParams,
+) ([]*domain.User, string, error) {
+	return r.current().ListUsers(ctx, params)
+}
+
+func (r *ShardedRepository) UpdateUser(
+	ctx context.Context,
+	user *domain.User,
+	params domain.UpdateUserParams,
+) (*domain.User, bool, error) {
+	return r.shard(user.Name).UpdateUser(ctx, user, params)
+}
+
+func (r *ShardedRepository) BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error) {
+	names := make([]string, 0, len(updates))
+	for _, update := range updates {
+		names = append(names, update.User.Name)
+	}
+	var updated []*domain.User
+	err := r.writeBatch(names, func(batchOf func(string) *writeBatch) error {
+		var err error
+		updated, err = stageUpdates(updates, newChange(ctx), batchOf)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Return copies to prevent external modifications
+	return copyUsers(updated), nil
+}
+
+func (r *ShardedRepository) DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error {
+	return r.shard(name).DeleteUser(ctx, name, params)
+}
+
+func (r *ShardedRepository) BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error {
+	names := make([]string, 0, len(deletions))
+	for _, deletion := range deletions {
+		names = append(names, deletion.Name)
+	}
+	return r.writeBatch(names, func(batchOf func(string) *writeBatch) error {
+		return stageDeletions(deletions, newChange(ctx), batchOf)
+	})
+}
+
+func (r *ShardedRepository) UndeleteUser(ctx context.Context, name string) (*domain.User, error) {
+	return r.shard(name).UndeleteUser(ctx, name)
+}
+
+func (r *ShardedRepository) PurgeExpiredUsers(ctx context.Context, now time.Time) (int, error) {
+	var purged int
+	for _, shard := range r.shards {
+		n, err := shard.PurgeExpiredUsers(ctx, now)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (r *ShardedRepository) PurgeUsers(ctx context.Context, names []string) (int, error) {
+	byShard := make([][]string, len(r.shards))
+	for _, name := range names {
+		i := r.shardIndex(name)
+		byShard[i] = append(byShard[i], name)
+	}
+	var purged int
+	for i, shardNames := range byShard {
+		if len(shardNames) == 0 {
+			continue
+		}
+		n, err := r.shards[i].PurgeUsers(ctx, shardNames)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (r *ShardedRepository) LookupUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	name, exists := r.emails.owner(email)
+	if !exists {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	return r.shard(name).LookupUserByEmail(ctx, email)
+}
+
+func (r *ShardedRepository) ListUserRevisions(
+	ctx context.Context,
+	name string,
+	params domain.ListUserRevisionsParams,
+) ([]*domain.User, string, error) {
+	return r.shard(name).ListUserRevisions(ctx, name, params)
+}
+
+func (r *ShardedRepository) GetUserRevision(ctx context.Context, name, revisionID string) (*domain.User, error) {
+	return r.shard(name).GetUserRevision(ctx, name, revisionID)
+}
+
+func (r *ShardedRepository) RollbackUser(
+	ctx context.Context,
+	name string,
+	params domain.RollbackUserParams,
+) (*domain.User, error) {
+	return r.shard(name).RollbackUser(ctx, name, params)
+}
+
+func (r *ShardedRepository) ReadUserEvents(_ context.Context, limit int) ([]domain.UserEvent, error) {
+	return r.outbox.read(limit), nil
+}
+
+func (r *ShardedRepository) AckUserEvents(_ context.Context, events []domain.UserEvent) error {
+	r.outbox.ack(sequences(events))
+	return nil
+}
+
+// mergeSorted merges lists that are each sorted by compare into one sorted
+// list of at most limit users.
+func mergeSorted(lists [][]*domain.User, compare func(a, b *domain.User) int, limit int) []*domain.User {
+	h := &mergeHeap{compare: compare}
+	for _, list := range lists {
+		if len(list) > 0 {
+			h.lists = append(h.lists, list)
+		}
+	}
+	heap.Init(h)
+	merged := make([]*domain.User, 0, limit)
+	for h.Len() > 0 && len(merged) < limit {
+		list := h.lists[0]
+		merged = append(merged, list[0])
+		if len(list) == 1 {
+			heap.Pop(h)
+		} else {
+			h.lists[0] = list[1:]
+			heap.Fix(h, 0)
+		}
+	}
+	return merged
+}
+
+// mergeHeap is a heap of non-empty sorted lists, ordered by their first user.
+type mergeHeap struct {
+	lists   [][]*domain.User
+	compare func(a, b *domain.User) int
+}
+
+func (h *mergeHeap) Len() int           { return len(h.lists) }
+func (h *mergeHeap) Less(i, j int) bool { return h.compare(h.lists[i][0], h.lists[j][0]) < 0 }
+func (h *mergeHeap) Swap(i, j int)      { h.lists[i], h.lists[j] = h.lists[j], h.lists[i] }
+func (h *mergeHeap) Push(x any)         { h.lists = append(h.lists, x.([]*domain.User)) } //nolint:forcetypeassert // only lists are pushed
+
+func (h *mergeHeap) Pop() any {
+	last := h.lists[len(h.lists)-1]
+	h.lists = h.lists[:len(h.lists)-1]
+	return last
+}
+
+// emailIndex is a unique index of lowercased email to user name, shared by
+// the shards of a ShardedRepository. It is split into shards by email of its
+// own, so that writes of different emails rarely contend. Shards claim and
+// release emails while holding their write lock, and never the other way
+// around.
+type emailIndex struct {
+	shards []emailShard
+	seed   maphash.Seed
+}
+
+type emailShard struct {
+	mutex  sync.Mutex
+	owners map[string]string
+}
+
+func newEmailIndex(shards int) *emailIndex {
+	index := &emailIndex{
+		shards: make([]emailShard, max(shards, 1)),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range index.shards {
+		index.shards[i].owners = make(map[string]string)
+	}
+	return index
+}
+
+func (x *emailIndex) shard(key string) *emailShard {
+	return &x.shards[maphash.String(x.seed, key)%uint64(len(x.shards))]
+}
+
+// claim makes name the owner of email, unless another user owns it.
+func (x *emailIndex) claim(email, name string) error {
+	key := emailKey(email)
+	shard := x.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if owner, taken := shard.owners[key]; taken && owner != name {
+		return domain.NewErrorFieldAlreadyExists("email", "email is already in use", nil)
+	}
+	shard.owners[key] = name
+	return nil
+}
+
+// release gives up the email if name owns it.
+func (x *emailIndex) release(email, name string) {
+	key := emailKey(email)
+	shard := x.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if shard.owners[key] == name {
+		delete(shard.owners, key)
+	}
+}
+
+// owner returns the name of the user that owns email.
+func (x *emailIndex) owner(email string) (string, bool) {
+	key := emailKey(email)
+	shard := x.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	name, exists := shard.owners[key]
+	return name, exists
+}
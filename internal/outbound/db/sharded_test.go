@@ -0,0 +1,117 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
+	"gotest.tools/v3/assert"
+)
+
+func TestShardedRepository(t *testing.T) {
+	t.Parallel()
+
+	t.Run("conformance", func(t *testing.T) {
+		t.Parallel()
+		dbtest.TestUserRepository(t, func(*testing.T) port.UserRepository {
+			return db.NewShardedRepository(slog.Default(), 4)
+		})
+	})
+
+	t.Run("list matches the in-memory repository", func(t *testing.T) {
+		t.Parallel()
+		sharded := db.NewShardedRepository(slog.Default(), 4)
+		memory := db.NewMemoryRepository(slog.Default())
+		ctx := t.Context()
+		for i := range 40 {
+			for _, repo := range []port.UserRepository{sharded, memory} {
+				_, err := repo.CreateUser(ctx, &domain.User{
+					Name:        fmt.Sprintf("users/user-%02d", i),
+					DisplayName: fmt.Sprintf("User %d", i%7),
+					Email:       fmt.Sprintf("user-%02d@example.com", i),
+				})
+				assert.NilError(t, err)
+				if i%5 == 0 {
+					assert.NilError(t, repo.DeleteUser(ctx, fmt.Sprintf("users/user-%02d", i), domain.DeleteUserParams{}))
+				}
+			}
+		}
+
+		for _, params := range []domain.ListUsersParams{
+			{PageSize: 1},
+			{PageSize: 3, ShowDeleted: true},
+			{PageSize: 4, OrderBy: "display_name desc"},
+			{PageSize: 5, OrderBy: "display_name, create_time desc", ShowDeleted: true},
+			{PageSize: 100, Filter: `display_name = "User 3"`},
+			{PageSize: 2, Filter: `name > "users/user-20"`, OrderBy: "email desc"},
+		} {
+			t.Run(fmt.Sprintf("%+v", params), func(t *testing.T) {
+				assert.DeepEqual(t, listNames(t, sharded, params), listNames(t, memory, params))
+			})
+		}
+	})
+
+	t.Run("list failures", func(t *testing.T) {
+		t.Parallel()
+		repo := db.NewShardedRepository(slog.Default(), 4)
+		ctx := t.Context()
+		_, _, err := repo.ListUsers(ctx, domain.ListUsersParams{Filter: `display_name = `})
+		assertErrorType(t, err, domain.InvalidInput)
+		_, _, err = repo.ListUsers(ctx, domain.ListUsersParams{PageToken: "invalid"})
+		assertErrorType(t, err, domain.InvalidInput)
+	})
+
+	t.Run("email moves between shards", func(t *testing.T) {
+		t.Parallel()
+		repo := db.NewShardedRepository(slog.Default(), 16)
+		ctx := t.Context()
+		for i := range 16 {
+			name := fmt.Sprintf("users/user-%02d", i)
+			if i > 0 {
+				assert.NilError(t, repo.DeleteUser(ctx, fmt.Sprintf("users/user-%02d", i-1), domain.DeleteUserParams{}))
+			}
+			_, err := repo.CreateUser(ctx, &domain.User{Name: name, DisplayName: "User", Email: "moving@example.com"})
+			assert.NilError(t, err)
+
+			user, err := repo.LookupUserByEmail(ctx, "Moving@example.com")
+			assert.NilError(t, err)
+			assert.Equal(t, user.Name, name)
+		}
+		_, err := repo.UndeleteUser(ctx, "users/user-00")
+		assertErrorType(t, err, domain.AlreadyExists)
+	})
+}
+
+// BenchmarkShardedRepository compares parallel creates in a single in-memory
+// store with those in a sharded one, as the number of processors grows.
+func BenchmarkShardedRepository(b *testing.B) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	for _, procs := range []int{1, 2, 4, 8, 16} {
+		for _, shards := range []int{1, 16} {
+			b.Run(fmt.Sprintf("GOMAXPROCS=%d/shards=%d/CreateUser", procs, shards), func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+				var repo port.UserRepository = db.NewMemoryRepository(logger)
+				if shards > 1 {
+					repo = db.NewShardedRepository(logger, shards)
+				}
+				var next atomic.Int64
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if _, err := repo.CreateUser(ctx, benchUser(int(next.Add(1)))); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
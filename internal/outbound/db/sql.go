@@ -0,0 +1,1021 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the pgx driver.
+	_ "github.com/mattn/go-sqlite3"    // Registers the sqlite3 driver.
+)
+
+// Dialect is a SQL database supported by SQLRepository.
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// ParseDialect parses "sqlite" or "postgres" into a Dialect.
+func ParseDialect(s string) (Dialect, error) {
+	switch dialect := Dialect(s); dialect {
+	case DialectSQLite, DialectPostgres:
+		return dialect, nil
+	default:
+		return "", fmt.Errorf("unknown SQL dialect: %q", s)
+	}
+}
+
+// sqliteOptions are added to SQLite data source names. Transactions take the
+// write lock up front so that concurrent writers wait for each other instead
+// of failing, and LIKE is case-sensitive as it is in Postgres.
+const sqliteOptions = "_txlock=immediate&_busy_timeout=5000&_case_sensitive_like=1"
+
+// OpenSQL opens a database of the given dialect. For SQLite, dsn is a file
+// path or URI, and for Postgres a connection string.
+func OpenSQL(dialect Dialect, dsn string) (*sql.DB, error) {
+	switch dialect {
+	case DialectSQLite:
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		return sql.Open("sqlite3", dsn+separator+sqliteOptions)
+	case DialectPostgres:
+		return sql.Open("pgx", dsn)
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect: %q", dialect)
+	}
+}
+
+// placeholder returns the query parameter placeholder for the nth argument,
+// counting from 1. Placeholders are numbered in both dialects, so arguments
+// can be bound in any order.
+func (d Dialect) placeholder(n int) string {
+	if d == DialectPostgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?" + strconv.Itoa(n)
+}
+
+// forUpdate returns the clause that locks the rows read by a SELECT for the
+// rest of the transaction. SQLite locks the whole database instead.
+func (d Dialect) forUpdate() string {
+	if d == DialectPostgres {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// uniqueViolation returns the column or constraint that err reports a unique
+// violation on.
+func (d Dialect) uniqueViolation(err error) (string, bool) {
+	switch d {
+	case DialectPostgres:
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return pgErr.ConstraintName, true
+		}
+	case DialectSQLite:
+		// The error type of the driver needs cgo, so match the message instead
+		const prefix = "UNIQUE constraint failed: "
+		if message := err.Error(); strings.HasPrefix(message, prefix) {
+			return strings.TrimPrefix(message, prefix), true
+		}
+	}
+	return "", false
+}
+
+// userColumns are the columns of the users table, in the order scanUser reads them.
+const userColumns = "name, display_name, email, create_time, update_time, delete_time, purge_time, revision, etag, " +
+	"revision_actor"
+
+// SQLRepository is a UserRepository backed by a SQL database. Filtering,
+// ordering, pagination and soft delete are all done by the database.
+//
+// Every version of a user is also recorded in the user_versions table, for
+// reads at a point in time, and as the revisions of the user. Versions that
+// fell out of both the history window and the revision retention are pruned
+// when expired users are purged. The event of every write is inserted into
+// the user_events outbox in the same transaction.
+type SQLRepository struct {
+	db      *sql.DB
+	dialect Dialect
+	logger  *slog.Logger
+	// historyStart is when the history was started by a migration.
+	historyStart      time.Time
+	historyWindow     atomic.Int64
+	revisionRetention atomic.Int64
+}
+
+// NewSQLRepository returns a repository backed by db, which must already be
+// migrated to the latest schema version.
+func NewSQLRepository(ctx context.Context, logger *slog.Logger, db *sql.DB, dialect Dialect) (*SQLRepository, error) {
+	migrator, err := NewMigrator(logger, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	current, latest, err := migrator.Version(ctx)
+	if err != nil {
+		return nil, toDomainSQLError("failed to read schema version", err)
+	}
+	if current != latest {
+		return nil, fmt.Errorf("database schema is at version %d, expected %d: run the migrate command", current, latest)
+	}
+	var historyStart int64
+	err = db.QueryRowContext(ctx,
+		"SELECT applied_at FROM schema_migrations WHERE version = "+dialect.placeholder(1),
+		userVersionsMigration,
+	).Scan(&historyStart)
+	if err != nil {
+		return nil, toDomainSQLError("failed to read history start", err)
+	}
+	return &SQLRepository{
+		db:           db,
+		dialect:      dialect,
+		logger:       logger,
+		historyStart: fromUnixNano(historyStart),
+	}, nil
+}
+
+// userVersionsMigration is the schema version that started the history.
+const userVersionsMigration = 2
+
+// SetHistoryWindow sets how long past versions of users are kept for reads
+// at a point in time.
+func (r *SQLRepository) SetHistoryWindow(window time.Duration) {
+	r.historyWindow.Store(int64(window))
+}
+
+// SetRevisionRetention sets how long revisions of users are kept after they
+// were replaced.
+func (r *SQLRepository) SetRevisionRetention(retention time.Duration) {
+	r.revisionRetention.Store(int64(retention))
+}
+
+// Close closes the database.
+func (r *SQLRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *SQLRepository) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+	newUser, err := createdUser(user, newChange(ctx))
+	if err != nil {
+		return nil, err
+	}
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		return r.insert(ctx, tx, newUser)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newUser, nil
+}
+
+// BatchCreateUsers inserts all users in one transaction. In best-effort mode
+// every user is inserted under a savepoint, so that a user that fails is
+// rolled back on its own.
+func (r *SQLRepository) BatchCreateUsers(
+	ctx context.Context,
+	users []*domain.User,
+	params domain.BatchCreateUsersParams,
+) ([]*domain.User, []error, error) {
+	c := newChange(ctx)
+	created := make([]*domain.User, len(users))
+	errs := make([]error, len(users))
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for i, user := range users {
+			newUser, err := createdUser(user, c)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case params.Atomic:
+				errs[i] = r.insert(ctx, tx, newUser)
+			default:
+				if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+					return toDomainSQLError("failed to create savepoint", err)
+				}
+				errs[i] = r.insert(ctx, tx, newUser)
+				end := "RELEASE SAVEPOINT batch_item"
+				if errs[i] != nil {
+					end = "ROLLBACK TO SAVEPOINT batch_item"
+				}
+				if _, err := tx.ExecContext(ctx, end); err != nil {
+					return toDomainSQLError("failed to end savepoint", err)
+				}
+			}
+			if errs[i] != nil && params.Atomic {
+				return &domain.BatchItemError{Index: i, Err: errs[i]}
+			}
+			if errs[i] == nil {
+				created[i] = newUser
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, errs, nil
+}
+
+func (r *SQLRepository) GetUser(ctx context.Context, name string, params domain.GetUserParams) (*domain.User, error) {
+	return sqlSnapshot{repo: r}.GetUser(ctx, name, params)
+}
+
+func (r *SQLRepository) ListUsers(ctx context.Context, params domain.ListUsersParams) ([]*domain.User, string, error) {
+	return sqlSnapshot{repo: r}.ListUsers(ctx, params)
+}
+
+func (r *SQLRepository) SnapshotUsers(_ context.Context, readTime time.Time) (port.UserSnapshot, error) {
+	if err := checkReadTime(readTime, r.historyStart, time.Duration(r.historyWindow.Load())); err != nil {
+		return nil, err
+	}
+	return sqlSnapshot{repo: r, readTime: readTime}, nil
+}
+
+// sqlSnapshot reads the users as they were at readTime, or the current users
+// if it is zero.
+type sqlSnapshot struct {
+	repo     *SQLRepository
+	readTime time.Time
+}
+
+// source returns the table to read users from, and the conditions that pick
+// the versions that were current at the read time.
+func (s sqlSnapshot) source(b *sqlBuilder) (string, []string) {
+	if s.readTime.IsZero() {
+		return "users", nil
+	}
+	readTime := b.bind(s.readTime.UnixNano())
+	return "user_versions", []string{
+		"valid_from <= " + readTime,
+		"(valid_to IS NULL OR valid_to > " + readTime + ")",
+	}
+}
+
+func (s sqlSnapshot) GetUser(ctx context.Context, name string, params domain.GetUserParams) (*domain.User, error) {
+	b := &sqlBuilder{dialect: s.repo.dialect}
+	table, conditions := s.source(b)
+	conditions = append(conditions, "name = "+b.bind(name))
+	if !params.ShowDeleted {
+		conditions = append(conditions, "delete_time IS NULL")
+	}
+	q := "SELECT " + userColumns + " FROM " + table + " WHERE " + strings.Join(conditions, " AND ")
+	user, err := scanUser(s.repo.db.QueryRowContext(ctx, q, b.args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	if err != nil {
+		return nil, toDomainSQLError("failed to get user", err)
+	}
+	return user, nil
+}
+
+func (r *SQLRepository) BatchGetUsers(ctx context.Context, names []string) (map[string]*domain.User, error) {
+	users := make(map[string]*domain.User, len(names))
+	if len(names) == 0 {
+		return users, nil
+	}
+	// One statement reads all users at the same point in time
+	b := &sqlBuilder{dialect: r.dialect}
+	placeholders := make([]string, 0, len(names))
+	for _, name := range names {
+		placeholders = append(placeholders, b.bind(name))
+	}
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE delete_time IS NULL AND name IN ("+strings.Join(placeholders, ", ")+")",
+		b.args...,
+	)
+	if err != nil {
+		return nil, toDomainSQLError("failed to get users", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, toDomainSQLError("failed to get users", err)
+		}
+		users[user.Name] = user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, toDomainSQLError("failed to get users", err)
+	}
+	return users, nil
+}
+
+func (s sqlSnapshot) ListUsers(ctx context.Context, params domain.ListUsersParams) ([]*domain.User, string, error) {
+	checksum := listChecksum(params)
+	token, err := decodePageToken(params.PageToken, checksum)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+	}
+	filter, err := query.ParseUserFilter(params.Filter)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid filter", err)
+	}
+	orderBy, err := query.ParseUserOrderBy(params.OrderBy)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid order_by", err)
+	}
+
+	b := &sqlBuilder{dialect: s.repo.dialect}
+	table, conditions := s.source(b)
+	if !params.ShowDeleted {
+		conditions = append(conditions, "delete_time IS NULL")
+	}
+	if filter.CheckedExpr != nil {
+		condition, err := b.filter(filter.CheckedExpr.GetExpr())
+		if err != nil {
+			return nil, "", domain.NewErrorInvalidInput("invalid filter", err)
+		}
+		conditions = append(conditions, condition)
+	}
+	if token.LastKey != nil {
+		cursor, err := query.CursorUser(orderBy, token.LastKey)
+		if err != nil {
+			return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+		}
+		conditions = append(conditions, b.after(orderBy, cursor))
+	}
+	pageSize := max(int(params.PageSize), 0)
+	q := "SELECT " + userColumns + " FROM " + table
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Read one extra user to know whether there is a next page
+	q += " ORDER BY " + orderByClause(orderBy) + " LIMIT " + strconv.Itoa(pageSize+1)
+
+	rows, err := s.repo.db.QueryContext(ctx, q, b.args...)
+	if err != nil {
+		return nil, "", toDomainSQLError("failed to list users", err)
+	}
+	defer rows.Close()
+	users := make([]*domain.User, 0, pageSize+1)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, "", toDomainSQLError("failed to list users", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", toDomainSQLError("failed to list users", err)
+	}
+
+	// Only hand out a cursor when there is something left to read
+	var nextPageToken string
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		if pageSize > 0 {
+			nextPageToken = encodePageToken(query.Cursor(orderBy, users[pageSize-1]), checksum)
+		}
+	}
+	return users, nextPageToken, nil
+}
+
+func (r *SQLRepository) UpdateUser(
+	ctx context.Context,
+	u *domain.User,
+	params domain.UpdateUserParams,
+) (*domain.User, bool, error) {
+	var (
+		updated *domain.User
+		created bool
+	)
+	// A row that doesn't exist can't be locked, so two upserts may both try
+	// to create the user. The loser retries, and then finds the user.
+	for attempt := 0; ; attempt++ {
+		err := r.inTx(ctx, func(tx *sql.Tx) error {
+			stored, err := r.getForUpdate(ctx, tx, u.Name)
+			if err != nil {
+				return err
+			}
+			if updated, err = updatedUser(stored, u, params, newChange(ctx)); err != nil {
+				return err
+			}
+			created = stored == nil
+			if created {
+				return r.insert(ctx, tx, updated)
+			}
+			return r.update(ctx, tx, updated)
+		})
+		// Only inserting the user can fail on a taken name
+		var domainErr *domain.Error
+		if attempt == 0 && created && errors.As(err, &domainErr) &&
+			domainErr.Type == domain.AlreadyExists && domainErr.Field == "" {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return updated, created, nil
+	}
+}
+
+// BatchUpdateUsers applies all updates in one transaction.
+func (r *SQLRepository) BatchUpdateUsers(ctx context.Context, updates []domain.UserUpdate) ([]*domain.User, error) {
+	c := newChange(ctx)
+	updated := make([]*domain.User, len(updates))
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for i, update := range updates {
+			stored, err := r.getForUpdate(ctx, tx, update.User.Name)
+			if err != nil {
+				return err
+			}
+			if updated[i], err = updatedUser(stored, update.User, update.Params, c); err != nil {
+				return &domain.BatchItemError{Index: i, Err: err}
+			}
+			if stored == nil {
+				err = r.insert(ctx, tx, updated[i])
+			} else {
+				err = r.update(ctx, tx, updated[i])
+			}
+			if err != nil {
+				return &domain.BatchItemError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *SQLRepository) DeleteUser(ctx context.Context, name string, params domain.DeleteUserParams) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := r.getForUpdate(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		deleted, err := deletedUser(stored, params, newChange(ctx))
+		if err != nil {
+			return err
+		}
+		return r.update(ctx, tx, deleted)
+	})
+}
+
+// BatchDeleteUsers deletes all users in one transaction.
+func (r *SQLRepository) BatchDeleteUsers(ctx context.Context, deletions []domain.UserDeletion) error {
+	c := newChange(ctx)
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		for i, deletion := range deletions {
+			stored, err := r.getForUpdate(ctx, tx, deletion.Name)
+			if err != nil {
+				return err
+			}
+			deleted, err := deletedUser(stored, deletion.Params, c)
+			if err == nil {
+				err = r.update(ctx, tx, deleted)
+			}
+			if err != nil {
+				return &domain.BatchItemError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+func (r *SQLRepository) UndeleteUser(ctx context.Context, name string) (*domain.User, error) {
+	var restored *domain.User
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := r.getForUpdate(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if restored, err = undeletedUser(stored, newChange(ctx)); err != nil {
+			return err
+		}
+		return r.update(ctx, tx, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+func (r *SQLRepository) PurgeExpiredUsers(ctx context.Context, now time.Time) (int, error) {
+	var purged int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		expired := "SELECT name FROM users WHERE delete_time IS NOT NULL AND purge_time <= " + r.dialect.placeholder(2)
+		_, err := tx.ExecContext(ctx,
+			"UPDATE user_versions SET valid_to = "+r.dialect.placeholder(1)+
+				" WHERE valid_to IS NULL AND name IN ("+expired+")",
+			time.Now().UnixNano(), now.UnixNano(),
+		)
+		if err != nil {
+			return toDomainSQLError("failed to purge users", err)
+		}
+		result, err := tx.ExecContext(ctx,
+			"DELETE FROM users WHERE delete_time IS NOT NULL AND purge_time <= "+r.dialect.placeholder(1),
+			now.UnixNano(),
+		)
+		if err != nil {
+			return toDomainSQLError("failed to purge users", err)
+		}
+		if purged, err = result.RowsAffected(); err != nil {
+			return toDomainSQLError("failed to purge users", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := r.pruneHistory(ctx); err != nil {
+		return int(purged), err
+	}
+	return int(purged), nil
+}
+
+func (r *SQLRepository) PurgeUsers(ctx context.Context, names []string) (int, error) {
+	if len(names) == 0 {
+		return 0, nil
+	}
+	var purged int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		b := &sqlBuilder{dialect: r.dialect}
+		validTo := b.bind(time.Now().UnixNano())
+		placeholders := make([]string, 0, len(names))
+		for _, name := range names {
+			placeholders = append(placeholders, b.bind(name))
+		}
+		deleted := "SELECT name FROM users WHERE delete_time IS NOT NULL AND name IN (" +
+			strings.Join(placeholders, ", ") + ")"
+		_, err := tx.ExecContext(ctx,
+			"UPDATE user_versions SET valid_to = "+validTo+" WHERE valid_to IS NULL AND name IN ("+deleted+")",
+			b.args...,
+		)
+		if err != nil {
+			return toDomainSQLError("failed to purge users", err)
+		}
+		// The names are bound after valid_to above, so they are bound again
+		b = &sqlBuilder{dialect: r.dialect}
+		placeholders = placeholders[:0]
+		for _, name := range names {
+			placeholders = append(placeholders, b.bind(name))
+		}
+		result, err := tx.ExecContext(ctx,
+			"DELETE FROM users WHERE delete_time IS NOT NULL AND name IN ("+strings.Join(placeholders, ", ")+")",
+			b.args...,
+		)
+		if err != nil {
+			return toDomainSQLError("failed to purge users", err)
+		}
+		if purged, err = result.RowsAffected(); err != nil {
+			return toDomainSQLError("failed to purge users", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := r.pruneHistory(ctx); err != nil {
+		return int(purged), err
+	}
+	return int(purged), nil
+}
+
+// pruneHistory removes the versions that were replaced before both the
+// history window and the revision retention.
+func (r *SQLRepository) pruneHistory(ctx context.Context) error {
+	keep := max(time.Duration(r.historyWindow.Load()), time.Duration(r.revisionRetention.Load()))
+	cutoff := time.Now().Add(-keep)
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM user_versions WHERE valid_to <= "+r.dialect.placeholder(1),
+		cutoff.UnixNano(),
+	)
+	if err != nil {
+		return toDomainSQLError("failed to prune user history", err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) ListUserRevisions(
+	ctx context.Context,
+	name string,
+	params domain.ListUserRevisionsParams,
+) ([]*domain.User, string, error) {
+	checksum := requestChecksum(name)
+	token, err := decodePageToken(params.PageToken, checksum)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+	}
+	b := &sqlBuilder{dialect: r.dialect}
+	conditions := []string{"name = " + b.bind(name)}
+	if token.LastKey != nil {
+		lastID, err := strconv.ParseInt(token.LastKey[0], 10, 64)
+		if err != nil {
+			return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+		}
+		conditions = append(conditions, "id < "+b.bind(lastID))
+	}
+	// Read one extra revision to know whether there is a next page
+	pageSize := max(int(params.PageSize), 0)
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, "+userColumns+" FROM user_versions WHERE "+strings.Join(conditions, " AND ")+
+			" ORDER BY id DESC LIMIT "+strconv.Itoa(pageSize+1),
+		b.args...,
+	)
+	if err != nil {
+		return nil, "", toDomainSQLError("failed to list revisions", err)
+	}
+	defer rows.Close()
+	var (
+		revisions []*domain.User
+		ids       []int64
+	)
+	for rows.Next() {
+		var id int64
+		revision, err := scanUser(idScanner{rowScanner: rows, id: &id})
+		if err != nil {
+			return nil, "", toDomainSQLError("failed to list revisions", err)
+		}
+		revisions = append(revisions, revision)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", toDomainSQLError("failed to list revisions", err)
+	}
+	if len(revisions) == 0 && token.LastKey == nil {
+		return nil, "", domain.NewErrorNotFound("user not found", nil)
+	}
+
+	// Only hand out a cursor when there is something left to read
+	var nextPageToken string
+	if len(revisions) > pageSize {
+		revisions = revisions[:pageSize]
+		if pageSize > 0 {
+			nextPageToken = encodePageToken([]string{strconv.FormatInt(ids[pageSize-1], 10)}, checksum)
+		}
+	}
+	return revisions, nextPageToken, nil
+}
+
+func (r *SQLRepository) GetUserRevision(ctx context.Context, name, revisionID string) (*domain.User, error) {
+	revision, err := r.getRevision(ctx, r.db, name, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if revision == nil {
+		return nil, domain.NewErrorNotFound("revision not found", nil)
+	}
+	return revision, nil
+}
+
+func (r *SQLRepository) RollbackUser(
+	ctx context.Context,
+	name string,
+	params domain.RollbackUserParams,
+) (*domain.User, error) {
+	var restored *domain.User
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := r.getForUpdate(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		revision, err := r.getRevision(ctx, tx, name, params.RevisionID)
+		if err != nil {
+			return err
+		}
+		if restored, err = rolledBackUser(stored, revision, params, newChange(ctx)); err != nil {
+			return err
+		}
+		return r.update(ctx, tx, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// getRevision reads a revision of a user. It returns nil if there is no such
+// revision. Revision IDs are derived rather than stored, so all revisions of
+// the user are read to find it.
+func (r *SQLRepository) getRevision(ctx context.Context, db queryer, name, revisionID string) (*domain.User, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM user_versions WHERE name = "+r.dialect.placeholder(1)+" ORDER BY id DESC",
+		name,
+	)
+	if err != nil {
+		return nil, toDomainSQLError("failed to get revision", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		revision, err := scanUser(rows)
+		if err != nil {
+			return nil, toDomainSQLError("failed to get revision", err)
+		}
+		if revision.RevisionID == revisionID {
+			return revision, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, toDomainSQLError("failed to get revision", err)
+	}
+	return nil, nil //nolint:nilnil // a missing revision is not an error here
+}
+
+func (r *SQLRepository) LookupUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE email_key = "+r.dialect.placeholder(1)+" AND delete_time IS NULL",
+		emailKey(email),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewErrorNotFound("user not found", nil)
+	}
+	if err != nil {
+		return nil, toDomainSQLError("failed to look up user", err)
+	}
+	return user, nil
+}
+
+func (r *SQLRepository) ReadUserEvents(ctx context.Context, limit int) ([]domain.UserEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, user_record FROM user_events ORDER BY id LIMIT "+r.dialect.placeholder(1),
+		max(limit, 0),
+	)
+	if err != nil {
+		return nil, toDomainSQLError("failed to read user events", err)
+	}
+	defer rows.Close()
+	var events []domain.UserEvent
+	for rows.Next() {
+		var (
+			sequence int64
+			record   []byte
+		)
+		if err := rows.Scan(&sequence, &record); err != nil {
+			return nil, toDomainSQLError("failed to read user events", err)
+		}
+		var user userRecord
+		if err := json.Unmarshal(record, &user); err != nil {
+			return nil, domain.NewErrorInternal("failed to decode user event", err)
+		}
+		event := domain.NewUserEvent(user.toDomain())
+		event.Sequence = sequence
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, toDomainSQLError("failed to read user events", err)
+	}
+	return events, nil
+}
+
+func (r *SQLRepository) AckUserEvents(ctx context.Context, events []domain.UserEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	b := &sqlBuilder{dialect: r.dialect}
+	placeholders := make([]string, 0, len(events))
+	for _, event := range events {
+		placeholders = append(placeholders, b.bind(event.Sequence))
+	}
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM user_events WHERE id IN ("+strings.Join(placeholders, ", ")+")",
+		b.args...,
+	)
+	if err != nil {
+		return toDomainSQLError("failed to acknowledge user events", err)
+	}
+	return nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// inTx runs fn in a transaction, which is committed if fn succeeds.
+func (r *SQLRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return toDomainSQLError("failed to begin transaction", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return toDomainSQLError("failed to commit transaction", err)
+	}
+	return nil
+}
+
+// getForUpdate reads a user, deleted or not, and locks it for the rest of the
+// transaction. It returns nil if there is no such user.
+func (r *SQLRepository) getForUpdate(ctx context.Context, tx *sql.Tx, name string) (*domain.User, error) {
+	user, err := scanUser(tx.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE name = "+r.dialect.placeholder(1)+r.dialect.forUpdate(),
+		name,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil //nolint:nilnil // a missing user is not an error here
+	}
+	if err != nil {
+		return nil, toDomainSQLError("failed to get user", err)
+	}
+	return user, nil
+}
+
+func (r *SQLRepository) insert(ctx context.Context, db execer, user *domain.User) error {
+	placeholders := make([]string, 11) //nolint:mnd // one per column
+	for i := range placeholders {
+		placeholders[i] = r.dialect.placeholder(i + 1)
+	}
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+", email_key) VALUES ("+strings.Join(placeholders, ", ")+")",
+		append(userValues(user), emailKey(user.Email))...,
+	)
+	if err != nil {
+		return r.toWriteError(user, err)
+	}
+	if err := r.recordVersion(ctx, db, user); err != nil {
+		return err
+	}
+	return r.recordEvent(ctx, db, user)
+}
+
+func (r *SQLRepository) update(ctx context.Context, db execer, user *domain.User) error {
+	columns := strings.Split(userColumns, ", ")
+	assignments := make([]string, 0, len(columns))
+	for i, column := range columns[1:] {
+		assignments = append(assignments, column+" = "+r.dialect.placeholder(i+1))
+	}
+	assignments = append(assignments, "email_key = "+r.dialect.placeholder(len(columns)))
+	values := userValues(user)
+	_, err := db.ExecContext(ctx,
+		"UPDATE users SET "+strings.Join(assignments, ", ")+
+			" WHERE name = "+r.dialect.placeholder(len(columns)+1),
+		append(values[1:], emailKey(user.Email), user.Name)...,
+	)
+	if err != nil {
+		return r.toWriteError(user, err)
+	}
+	if err := r.recordVersion(ctx, db, user); err != nil {
+		return err
+	}
+	return r.recordEvent(ctx, db, user)
+}
+
+// recordEvent inserts the event of the write of a user version into the
+// outbox.
+func (r *SQLRepository) recordEvent(ctx context.Context, db execer, user *domain.User) error {
+	record, err := json.Marshal(toUserRecord(user))
+	if err != nil {
+		return domain.NewErrorInternal("failed to record user event", err)
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO user_events (name, user_record) VALUES ("+r.dialect.placeholder(1)+", "+r.dialect.placeholder(2)+")",
+		user.Name, string(record),
+	)
+	if err != nil {
+		return toDomainSQLError("failed to record user event", err)
+	}
+	return nil
+}
+
+// recordVersion replaces the current version of a user in the history,
+// as of when the new version was written.
+func (r *SQLRepository) recordVersion(ctx context.Context, db execer, user *domain.User) error {
+	validFrom := user.RevisionCreateTime.UnixNano()
+	_, err := db.ExecContext(ctx,
+		"UPDATE user_versions SET valid_to = "+r.dialect.placeholder(1)+
+			" WHERE name = "+r.dialect.placeholder(2)+" AND valid_to IS NULL",
+		validFrom, user.Name,
+	)
+	if err != nil {
+		return toDomainSQLError("failed to record user version", err)
+	}
+	placeholders := make([]string, 11) //nolint:mnd // one per column
+	for i := range placeholders {
+		placeholders[i] = r.dialect.placeholder(i + 1)
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO user_versions ("+userColumns+", valid_from) VALUES ("+strings.Join(placeholders, ", ")+")",
+		append(userValues(user), validFrom)...,
+	)
+	if err != nil {
+		return toDomainSQLError("failed to record user version", err)
+	}
+	return nil
+}
+
+// toWriteError converts the error of a write, turning unique violations into
+// AlreadyExists errors.
+func (r *SQLRepository) toWriteError(user *domain.User, err error) error {
+	constraint, ok := r.dialect.uniqueViolation(err)
+	switch {
+	case ok && strings.Contains(constraint, "email_key"):
+		return domain.NewErrorFieldAlreadyExists("email", "email is already in use", err)
+	case ok:
+		return domain.NewErrorAlreadyExists(fmt.Sprintf("user already exists: %s", user.Name), err)
+	default:
+		return toDomainSQLError("failed to write user", err)
+	}
+}
+
+// toDomainSQLError converts a database error into a domain error, telling
+// timeouts and unreachable databases apart from other failures.
+func toDomainSQLError(message string, err error) error {
+	var opErr interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return domain.NewErrorTimeout(message, err)
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, sql.ErrConnDone):
+		return domain.NewErrorUnavailable(message, err)
+	case errors.As(err, &opErr) && opErr.Timeout():
+		return domain.NewErrorTimeout(message, err)
+	default:
+		return domain.NewErrorInternal(message, err)
+	}
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// idScanner scans the id column of user_versions in front of the user.
+type idScanner struct {
+	rowScanner
+	id *int64
+}
+
+func (s idScanner) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append([]any{s.id}, dest...)...)
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	var (
+		user                   domain.User
+		createTime, updateTime int64
+		deleteTime, purgeTime  sql.NullInt64
+	)
+	if err := row.Scan(
+		&user.Name,
+		&user.DisplayName,
+		&user.Email,
+		&createTime,
+		&updateTime,
+		&deleteTime,
+		&purgeTime,
+		&user.Revision,
+		&user.Etag,
+		&user.RevisionActor,
+	); err != nil {
+		return nil, err
+	}
+	user.CreateTime = fromUnixNano(createTime)
+	user.UpdateTime = fromUnixNano(updateTime)
+	if deleteTime.Valid {
+		user.DeleteTime = fromUnixNano(deleteTime.Int64)
+		user.PurgeTime = fromUnixNano(purgeTime.Int64)
+	}
+	setRevisionFields(&user)
+	return &user, nil
+}
+
+// userValues returns the values of userColumns for a user.
+func userValues(user *domain.User) []any {
+	var deleteTime, purgeTime sql.NullInt64
+	if !user.DeleteTime.IsZero() {
+		deleteTime = sql.NullInt64{Int64: user.DeleteTime.UnixNano(), Valid: true}
+		purgeTime = sql.NullInt64{Int64: user.PurgeTime.UnixNano(), Valid: true}
+	}
+	return []any{
+		user.Name,
+		user.DisplayName,
+		user.Email,
+		user.CreateTime.UnixNano(),
+		user.UpdateTime.UnixNano(),
+		deleteTime,
+		purgeTime,
+		user.Revision,
+		user.Etag,
+		user.RevisionActor,
+	}
+}
+
+func fromUnixNano(nanos int64) time.Time {
+	return time.Unix(0, nanos).UTC()
+}
@@ -0,0 +1,233 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db/dbtest"
+	"gotest.tools/v3/assert"
+)
+
+// openSQLiteDB opens a new SQLite database in a temporary directory.
+func openSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := db.OpenSQL(db.DialectSQLite, filepath.Join(t.TempDir(), "users.db"))
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+	return database
+}
+
+func migrateUp(t *testing.T, database *sql.DB, dialect db.Dialect) {
+	t.Helper()
+	migrator, err := db.NewMigrator(slog.Default(), database, dialect)
+	assert.NilError(t, err)
+	_, err = migrator.Up(t.Context())
+	assert.NilError(t, err)
+}
+
+// sqlTestDatabases returns the databases to run the SQL tests against: SQLite
+// always, and Postgres when TEST_POSTGRES_DSN points to an empty database.
+func sqlTestDatabases(t *testing.T) map[db.Dialect]func(t *testing.T) *sql.DB {
+	t.Helper()
+	databases := map[db.Dialect]func(t *testing.T) *sql.DB{
+		db.DialectSQLite: openSQLiteDB,
+	}
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		// Postgres tests share one database, so they take turns
+		var mutex sync.Mutex
+		databases[db.DialectPostgres] = func(t *testing.T) *sql.DB {
+			t.Helper()
+			mutex.Lock()
+			database, err := db.OpenSQL(db.DialectPostgres, dsn)
+			assert.NilError(t, err)
+			t.Cleanup(func() {
+				_, _ = database.ExecContext(context.Background(),
+					"DROP TABLE IF EXISTS users, user_versions, user_events, operations, schema_migrations")
+				_ = database.Close()
+				mutex.Unlock()
+			})
+			return database
+		}
+	}
+	return databases
+}
+
+func setupSQLRepo(t *testing.T, open func(t *testing.T) *sql.DB, dialect db.Dialect) *db.SQLRepository {
+	t.Helper()
+	database := open(t)
+	migrateUp(t, database, dialect)
+	repo, err := db.NewSQLRepository(t.Context(), slog.Default(), database, dialect)
+	assert.NilError(t, err)
+	return repo
+}
+
+// TestMigrator tests applying and reverting the schema migrations.
+func TestMigrator(t *testing.T) {
+	t.Parallel()
+
+	for dialect, open := range sqlTestDatabases(t) {
+		t.Run(string(dialect), func(t *testing.T) {
+			t.Parallel()
+			database := open(t)
+			ctx := t.Context()
+			migrator, err := db.NewMigrator(slog.Default(), database, dialect)
+			assert.NilError(t, err)
+
+			current, latest, err := migrator.Version(ctx)
+			assert.NilError(t, err)
+			assert.Equal(t, current, 0)
+			assert.Assert(t, latest > 0)
+
+			_, err = db.NewSQLRepository(ctx, slog.Default(), database, dialect)
+			assert.ErrorContains(t, err, "run the migrate command")
+
+			applied, err := migrator.Up(ctx)
+			assert.NilError(t, err)
+			assert.Equal(t, applied, latest)
+			applied, err = migrator.Up(ctx)
+			assert.NilError(t, err)
+			assert.Equal(t, applied, 0)
+			current, _, err = migrator.Version(ctx)
+			assert.NilError(t, err)
+			assert.Equal(t, current, latest)
+
+			reverted, err := migrator.Down(ctx, latest+1)
+			assert.NilError(t, err)
+			assert.Equal(t, reverted, latest)
+			current, _, err = migrator.Version(ctx)
+			assert.NilError(t, err)
+			assert.Equal(t, current, 0)
+
+			// The schema can be applied again after being reverted
+			_, err = migrator.Up(ctx)
+			assert.NilError(t, err)
+			_, err = db.NewSQLRepository(ctx, slog.Default(), database, dialect)
+			assert.NilError(t, err)
+		})
+	}
+}
+
+// TestSQLRepository runs the repository conformance suite against each
+// dialect, and tests what is specific to SQL.
+func TestSQLRepository(t *testing.T) {
+	t.Parallel()
+
+	for dialect, open := range sqlTestDatabases(t) {
+		t.Run(string(dialect), func(t *testing.T) {
+			t.Parallel()
+
+			dbtest.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+				return setupSQLRepo(t, open, dialect)
+			})
+
+			t.Run("list matches the in-memory repository", func(t *testing.T) {
+				repo := setupSQLRepo(t, open, dialect)
+				memory := db.NewMemoryRepository(slog.Default())
+				ctx := t.Context()
+				for i, user := range []struct{ id, displayName, email string }{
+					{"ada", "Ada Lovelace", "ada@example.com"},
+					{"alan", "Alan Turing", "alan@EXAMPLE.org"},
+					{"grace", "Grace Hopper", "grace@example.com"},
+					{"edsger", "Edsger Dijkstra", "edsger@example.net"},
+					{"barbara", "Barbara Liskov", "barbara@example.com"},
+					{"donald", "Donald Knuth", "don%ald@example.com"},
+					{"ken", "Ken Thompson", "ken_t@example.org"},
+				} {
+					for _, r := range []port.UserRepository{repo, memory} {
+						_, err := r.CreateUser(ctx, &domain.User{
+							Name:        "users/" + user.id,
+							DisplayName: user.displayName,
+							Email:       user.email,
+						})
+						assert.NilError(t, err)
+						if i%3 == 0 {
+							assert.NilError(t, r.DeleteUser(ctx, "users/"+user.id, domain.DeleteUserParams{}))
+						}
+					}
+				}
+
+				for _, params := range []domain.ListUsersParams{
+					{PageSize: 2},
+					{PageSize: 3, ShowDeleted: true},
+					{PageSize: 2, OrderBy: "display_name desc"},
+					{PageSize: 2, OrderBy: "create_time desc, email", ShowDeleted: true},
+					{PageSize: 10, Filter: `display_name = "A*"`, ShowDeleted: true},
+					{PageSize: 10, Filter: `email != "*example.com"`},
+					{PageSize: 10, Filter: `email:"EXAMPLE.ORG" OR email:"%"`, ShowDeleted: true},
+					{PageSize: 10, Filter: `email:"_"`, ShowDeleted: true},
+					{PageSize: 10, Filter: `email:*`},
+					{PageSize: 10, Filter: `NOT name < "users/c"`, ShowDeleted: true},
+					{PageSize: 10, Filter: `create_time > "2000-01-01T00:00:00Z" AND create_time <= update_time`},
+					{PageSize: 10, Filter: `update_time < timestamp("2000-01-01T00:00:00Z")`},
+				} {
+					t.Run(fmt.Sprintf("%+v", params), func(t *testing.T) {
+						assert.DeepEqual(t, listNames(t, repo, params), listNames(t, memory, params))
+					})
+				}
+			})
+
+			t.Run("list failures", func(t *testing.T) {
+				repo := setupSQLRepo(t, open, dialect)
+				ctx := t.Context()
+				_, _, err := repo.ListUsers(ctx, domain.ListUsersParams{Filter: `display_name = `})
+				assertErrorType(t, err, domain.InvalidInput)
+				_, _, err = repo.ListUsers(ctx, domain.ListUsersParams{OrderBy: "etag"})
+				assertErrorType(t, err, domain.InvalidInput)
+				_, _, err = repo.ListUsers(ctx, domain.ListUsersParams{PageToken: "invalid"})
+				assertErrorType(t, err, domain.InvalidInput)
+			})
+
+			t.Run("deadline exceeded is a timeout", func(t *testing.T) {
+				repo := setupSQLRepo(t, open, dialect)
+				ctx, cancel := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+				defer cancel()
+				_, err := repo.GetUser(ctx, "users/jane", domain.GetUserParams{})
+				assertErrorType(t, err, domain.Timeout)
+			})
+		})
+	}
+
+	t.Run("connection refused is unavailable", func(t *testing.T) {
+		t.Parallel()
+		database, err := db.OpenSQL(db.DialectPostgres, "postgres://user@127.0.0.1:1/users?connect_timeout=5")
+		assert.NilError(t, err)
+		defer database.Close()
+		_, err = db.NewSQLRepository(t.Context(), slog.Default(), database, db.DialectPostgres)
+		assertErrorType(t, err, domain.Unavailable)
+	})
+}
+
+// listNames lists all pages of users and returns their names.
+func listNames(t *testing.T, repo port.UserRepository, params domain.ListUsersParams) []string {
+	t.Helper()
+	var names []string
+	for {
+		users, next, err := repo.ListUsers(t.Context(), params)
+		assert.NilError(t, err)
+		for _, user := range users {
+			names = append(names, user.Name)
+		}
+		if next == "" {
+			return names
+		}
+		params.PageToken = next
+	}
+}
+
+func assertErrorType(t *testing.T, err error, want domain.ErrorType) {
+	t.Helper()
+	var domainErr *domain.Error
+	assert.Assert(t, errors.As(err, &domainErr), "got %v", err)
+	assert.Equal(t, domainErr.Type, want, "got %v", err)
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+)
+
+// SQLOperationStore keeps operations in the operations table of a SQL
+// database, which must already be migrated to the latest schema version.
+type SQLOperationStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewSQLOperationStore(db *sql.DB, dialect Dialect) *SQLOperationStore {
+	return &SQLOperationStore{db: db, dialect: dialect}
+}
+
+func (s *SQLOperationStore) PutOperation(ctx context.Context, op *domain.Operation) error {
+	record, err := toOperationRecord(op)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return domain.NewErrorInternal("failed to encode operation", err)
+	}
+	var doneTime sql.NullInt64
+	if op.Done {
+		doneTime = sql.NullInt64{Int64: op.DoneTime.UnixNano(), Valid: true}
+	}
+	p := s.dialect.placeholder
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO operations (name, done_time, record) VALUES ("+p(1)+", "+p(2)+", "+p(3)+") "+
+			"ON CONFLICT (name) DO UPDATE SET done_time = excluded.done_time, record = excluded.record",
+		op.Name, doneTime, string(data),
+	)
+	if err != nil {
+		return toDomainSQLError("failed to write operation", err)
+	}
+	return nil
+}
+
+func (s *SQLOperationStore) GetOperation(ctx context.Context, name string) (*domain.Operation, error) {
+	op, err := scanOperation(s.db.QueryRowContext(ctx,
+		"SELECT record FROM operations WHERE name = "+s.dialect.placeholder(1),
+		name,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewErrorNotFound("operation not found", nil)
+	}
+	if err != nil {
+		return nil, toDomainSQLError("failed to read operation", err)
+	}
+	return op, nil
+}
+
+func (s *SQLOperationStore) ListOperations(
+	ctx context.Context,
+	params domain.ListOperationsParams,
+) ([]*domain.Operation, string, error) {
+	filter, err := query.ParseOperationFilter(params.Filter)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid filter", err)
+	}
+	checksum := requestChecksum(params.Filter)
+	token, err := decodePageToken(params.PageToken, checksum)
+	if err != nil {
+		return nil, "", domain.NewErrorInvalidInput("invalid page token", err)
+	}
+	var after string
+	if token.LastKey != nil {
+		after = token.LastKey[0]
+	}
+	pageSize := max(int(params.PageSize), 0)
+
+	// The filter is matched here, so rows are read until the page is full
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT record FROM operations WHERE name > "+s.dialect.placeholder(1)+" ORDER BY name",
+		after,
+	)
+	if err != nil {
+		return nil, "", toDomainSQLError("failed to list operations", err)
+	}
+	defer rows.Close()
+	var ops []*domain.Operation
+	for rows.Next() {
+		op, err := scanOperation(rows)
+		if err != nil {
+			return nil, "", toDomainSQLError("failed to read operation", err)
+		}
+		match, err := query.MatchOperation(filter, op)
+		if err != nil {
+			return nil, "", domain.NewErrorInvalidInput("invalid filter", err)
+		}
+		if !match {
+			continue
+		}
+		if pageSize > 0 && len(ops) == pageSize {
+			return ops, encodePageToken([]string{ops[len(ops)-1].Name}, checksum), nil
+		}
+		ops = append(ops, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", toDomainSQLError("failed to list operations", err)
+	}
+	return ops, "", nil
+}
+
+func (s *SQLOperationStore) DeleteOperation(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM operations WHERE name = "+s.dialect.placeholder(1), name)
+	if err != nil {
+		return toDomainSQLError("failed to delete operation", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return toDomainSQLError("failed to delete operation", err)
+	} else if deleted == 0 {
+		return domain.NewErrorNotFound("operation not found", nil)
+	}
+	return nil
+}
+
+func (s *SQLOperationStore) PurgeOperations(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM operations WHERE done_time < "+s.dialect.placeholder(1),
+		before.UnixNano(),
+	)
+	if err != nil {
+		return 0, toDomainSQLError("failed to purge operations", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, toDomainSQLError("failed to purge operations", err)
+	}
+	return int(purged), nil
+}
+
+func scanOperation(row rowScanner) (*domain.Operation, error) {
+	var data string
+	if err := row.Scan(&data); err != nil {
+		return nil, err
+	}
+	var record operationRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, domain.NewErrorInternal("failed to decode operation", err)
+	}
+	return record.toDomain()
+}
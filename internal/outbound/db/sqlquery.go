@@ -0,0 +1,324 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/core/query"
+	"go.einride.tech/aip/filtering"
+	"go.einride.tech/aip/ordering"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// sqlBuilder builds the WHERE clause of a user listing, collecting the query
+// arguments as it goes. The conditions match the same users as
+// query.MatchUser and query.CompareUsers.
+type sqlBuilder struct {
+	dialect Dialect
+	args    []any
+}
+
+// bind adds a query argument and returns its placeholder.
+func (b *sqlBuilder) bind(value any) string {
+	b.args = append(b.args, value)
+	return b.dialect.placeholder(len(b.args))
+}
+
+// sqlOperandKind is the type of an operand in a filter.
+type sqlOperandKind int
+
+const (
+	sqlString sqlOperandKind = iota
+	sqlTime
+	sqlBool
+)
+
+// sqlOperand is an operand of a filter comparison. Constants are kept as
+// values until the type of the comparison is known.
+type sqlOperand struct {
+	kind     sqlOperandKind
+	sql      string
+	constant *string
+}
+
+// render returns the SQL of an operand, binding constants as arguments of
+// the given kind.
+func (b *sqlBuilder) render(operand sqlOperand, kind sqlOperandKind) (string, error) {
+	if operand.constant == nil {
+		if operand.kind != kind {
+			return "", fmt.Errorf("cannot compare %s with %s", operand.kind, kind)
+		}
+		return operand.sql, nil
+	}
+	switch kind {
+	case sqlTime:
+		t, err := time.Parse(time.RFC3339, *operand.constant)
+		if err != nil {
+			return "", fmt.Errorf("invalid timestamp %q: %w", *operand.constant, err)
+		}
+		return b.bind(t.UnixNano()), nil
+	case sqlString:
+		return b.bind(*operand.constant), nil
+	default:
+		return "", fmt.Errorf("cannot compare string with %s", kind)
+	}
+}
+
+func (k sqlOperandKind) String() string {
+	switch k {
+	case sqlTime:
+		return "timestamp"
+	case sqlBool:
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+// filter returns a SQL condition for a checked filter expression.
+func (b *sqlBuilder) filter(e *expr.Expr) (string, error) {
+	switch kind := e.GetExprKind().(type) {
+	case *expr.Expr_ConstExpr:
+		if c, ok := kind.ConstExpr.GetConstantKind().(*expr.Constant_BoolValue); ok {
+			return sqlBoolLiteral(c.BoolValue), nil
+		}
+		return "", fmt.Errorf("constant %v is not a bool", kind.ConstExpr)
+	case *expr.Expr_CallExpr:
+		return b.call(kind.CallExpr)
+	default:
+		return "", fmt.Errorf("unsupported expression %T", kind)
+	}
+}
+
+func (b *sqlBuilder) call(call *expr.Expr_Call) (string, error) {
+	args := call.GetArgs()
+	switch call.GetFunction() {
+	case filtering.FunctionAnd, filtering.FunctionOr:
+		conditions := make([]string, 0, len(args))
+		for _, arg := range args {
+			condition, err := b.filter(arg)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+		}
+		return "(" + strings.Join(conditions, " "+call.GetFunction()+" ") + ")", nil
+	case filtering.FunctionNot:
+		if len(args) != 1 {
+			return "", errors.New("NOT takes exactly one argument")
+		}
+		condition, err := b.filter(args[0])
+		if err != nil {
+			return "", err
+		}
+		return "(NOT " + condition + ")", nil
+	case filtering.FunctionHas:
+		return b.has(args)
+	case filtering.FunctionEquals,
+		filtering.FunctionNotEquals,
+		filtering.FunctionLessThan,
+		filtering.FunctionLessEquals,
+		filtering.FunctionGreaterThan,
+		filtering.FunctionGreaterEquals:
+		return b.comparison(call.GetFunction(), args)
+	default:
+		return "", fmt.Errorf("unsupported function %q", call.GetFunction())
+	}
+}
+
+func (b *sqlBuilder) has(args []*expr.Expr) (string, error) {
+	if len(args) != 2 { //nolint:mnd // binary operator
+		return "", errors.New("has operator takes exactly two arguments")
+	}
+	lhs, err := b.operand(args[0])
+	if err != nil {
+		return "", err
+	}
+	rhs, err := b.operand(args[1])
+	if err != nil {
+		return "", err
+	}
+	if lhs.constant != nil || lhs.kind != sqlString || rhs.constant == nil {
+		return "", errors.New("has operator is only supported between a string field and a constant")
+	}
+	if *rhs.constant == "*" {
+		return "(" + lhs.sql + " <> '')", nil
+	}
+	pattern := "%" + escapeLike(strings.ToLower(*rhs.constant)) + "%"
+	return "(LOWER(" + lhs.sql + ") LIKE " + b.bind(pattern) + ` ESCAPE '\')`, nil
+}
+
+func (b *sqlBuilder) comparison(function string, args []*expr.Expr) (string, error) {
+	if len(args) != 2 { //nolint:mnd // binary operator
+		return "", fmt.Errorf("%s takes exactly two arguments", function)
+	}
+	lhs, err := b.operand(args[0])
+	if err != nil {
+		return "", err
+	}
+	rhs, err := b.operand(args[1])
+	if err != nil {
+		return "", err
+	}
+	// The type of a comparison is given by its field, if it has one
+	kind := lhs.kind
+	if lhs.constant != nil {
+		kind = rhs.kind
+	}
+
+	if kind == sqlString && rhs.constant != nil && strings.Contains(*rhs.constant, "*") &&
+		(function == filtering.FunctionEquals || function == filtering.FunctionNotEquals) {
+		left, err := b.render(lhs, kind)
+		if err != nil {
+			return "", err
+		}
+		pattern := escapeLike(*rhs.constant)
+		pattern = strings.ReplaceAll(pattern, "*", "%")
+		operator := "LIKE"
+		if function == filtering.FunctionNotEquals {
+			operator = "NOT LIKE"
+		}
+		return "(" + left + " " + operator + " " + b.bind(pattern) + ` ESCAPE '\')`, nil
+	}
+	if kind == sqlBool && function != filtering.FunctionEquals && function != filtering.FunctionNotEquals {
+		return "", fmt.Errorf("operator %s not supported for bool", function)
+	}
+
+	left, err := b.render(lhs, kind)
+	if err != nil {
+		return "", err
+	}
+	right, err := b.render(rhs, kind)
+	if err != nil {
+		return "", err
+	}
+	operator := function
+	if function == filtering.FunctionNotEquals {
+		operator = "<>"
+	}
+	return "(" + left + " " + operator + " " + right + ")", nil
+}
+
+// operand converts a comparison operand: a field, a constant, a timestamp or
+// a nested condition.
+func (b *sqlBuilder) operand(e *expr.Expr) (sqlOperand, error) {
+	switch kind := e.GetExprKind().(type) {
+	case *expr.Expr_IdentExpr:
+		return userFieldOperand(kind.IdentExpr.GetName())
+	case *expr.Expr_ConstExpr:
+		switch c := kind.ConstExpr.GetConstantKind().(type) {
+		case *expr.Constant_StringValue:
+			return sqlOperand{kind: sqlString, constant: &c.StringValue}, nil
+		case *expr.Constant_BoolValue:
+			return sqlOperand{kind: sqlBool, sql: sqlBoolLiteral(c.BoolValue)}, nil
+		default:
+			return sqlOperand{}, fmt.Errorf("unsupported constant %T", c)
+		}
+	case *expr.Expr_CallExpr:
+		if kind.CallExpr.GetFunction() == filtering.FunctionTimestamp && len(kind.CallExpr.GetArgs()) == 1 {
+			arg, err := b.operand(kind.CallExpr.GetArgs()[0])
+			if err != nil {
+				return sqlOperand{}, err
+			}
+			if arg.constant == nil && arg.kind != sqlTime {
+				return sqlOperand{}, fmt.Errorf("cannot use %s as timestamp", arg.kind)
+			}
+			arg.kind = sqlTime
+			return arg, nil
+		}
+		condition, err := b.filter(e)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		return sqlOperand{kind: sqlBool, sql: condition}, nil
+	default:
+		return sqlOperand{}, fmt.Errorf("unsupported operand %T", kind)
+	}
+}
+
+func userFieldOperand(field string) (sqlOperand, error) {
+	switch field {
+	case query.FieldName, query.FieldDisplayName, query.FieldEmail:
+		return sqlOperand{kind: sqlString, sql: field}, nil
+	case query.FieldCreateTime, query.FieldUpdateTime:
+		return sqlOperand{kind: sqlTime, sql: field}, nil
+	default:
+		return sqlOperand{}, fmt.Errorf("unknown field %q", field)
+	}
+}
+
+// after returns a SQL condition matching the users that come after the
+// cursor in the given ordering, ties being broken by name.
+func (b *sqlBuilder) after(orderBy ordering.OrderBy, cursor *domain.User) string {
+	type key struct {
+		column string
+		value  any
+		desc   bool
+	}
+	keys := make([]key, 0, len(orderBy.Fields)+1)
+	for _, field := range orderBy.Fields {
+		keys = append(keys, key{column: field.Path, value: cursorValue(field.Path, cursor), desc: field.Desc})
+	}
+	keys = append(keys, key{column: query.FieldName, value: cursor.Name})
+
+	// (a > x) OR (a = x AND b > y) OR ...
+	alternatives := make([]string, 0, len(keys))
+	for i, k := range keys {
+		terms := make([]string, 0, i+1)
+		for _, equal := range keys[:i] {
+			terms = append(terms, equal.column+" = "+b.bind(equal.value))
+		}
+		operator := " > "
+		if k.desc {
+			operator = " < "
+		}
+		terms = append(terms, k.column+operator+b.bind(k.value))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+func cursorValue(field string, cursor *domain.User) any {
+	switch field {
+	case query.FieldDisplayName:
+		return cursor.DisplayName
+	case query.FieldEmail:
+		return cursor.Email
+	case query.FieldCreateTime:
+		return cursor.CreateTime.UnixNano()
+	case query.FieldUpdateTime:
+		return cursor.UpdateTime.UnixNano()
+	default: // query.FieldName
+		return cursor.Name
+	}
+}
+
+// orderByClause returns the ORDER BY clause of a listing, ties being broken
+// by name.
+func orderByClause(orderBy ordering.OrderBy) string {
+	terms := make([]string, 0, len(orderBy.Fields)+1)
+	for _, field := range orderBy.Fields {
+		if field.Desc {
+			terms = append(terms, field.Path+" DESC")
+		} else {
+			terms = append(terms, field.Path)
+		}
+	}
+	return strings.Join(append(terms, query.FieldName), ", ")
+}
+
+func sqlBoolLiteral(b bool) string {
+	if b {
+		return "(1 = 1)"
+	}
+	return "(1 = 0)"
+}
+
+// escapeLike escapes the LIKE wildcards in s, using backslash as the escape
+// character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
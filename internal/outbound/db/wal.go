@@ -0,0 +1,331 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// SyncPolicy controls when the write-ahead log is flushed to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every write. A write is durable once it returns.
+	SyncAlways SyncPolicy = iota
+	// SyncPeriodic fsyncs in the background. Writes made since the last sync
+	// may be lost if the machine crashes, but not if only the process does.
+	SyncPeriodic
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+// ParseSyncPolicy parses "always", "periodic" or "never" into a SyncPolicy.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "always":
+		return SyncAlways, nil
+	case "periodic":
+		return SyncPeriodic, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return 0, fmt.Errorf("unknown sync policy: %q", s)
+	}
+}
+
+// walOp is the kind of change recorded by a log entry.
+type walOp string
+
+const (
+	walPut    walOp = "put"
+	walRemove walOp = "remove"
+	walEvent  walOp = "event"
+	walAck    walOp = "ack"
+	walBatch  walOp = "batch"
+)
+
+// walEntry is a single change to the users or the outbox. Puts carry the full
+// user, and events their sequence, so replaying an entry more than once has
+// no further effect.
+type walEntry struct {
+	Op   walOp       `json:"op"`
+	Name string      `json:"name,omitempty"`
+	User *userRecord `json:"user,omitempty"`
+	// Sequence is the sequence of the event of a put, zero if the put has no
+	// event, or of an event that is still in the outbox.
+	Sequence int64 `json:"sequence,omitempty"`
+	// Sequences are the sequences of acknowledged events.
+	Sequences []int64 `json:"sequences,omitempty"`
+	// Entries are the entries of a batch, which are applied together.
+	Entries []walEntry `json:"entries,omitempty"`
+}
+
+// userRecord is the stored form of a domain.User. It is kept separate from the
+// domain type so that the file format doesn't change by accident.
+type userRecord struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email"`
+	CreateTime  time.Time `json:"create_time"`
+	UpdateTime  time.Time `json:"update_time"`
+	DeleteTime  time.Time `json:"delete_time,omitzero"`
+	PurgeTime   time.Time `json:"purge_time,omitzero"`
+	Revision    int64     `json:"revision"`
+	Etag        string    `json:"etag"`
+	// RevisionActor is empty in records written before it was added.
+	RevisionActor string `json:"revision_actor,omitempty"`
+}
+
+func toUserRecord(user *domain.User) *userRecord {
+	return &userRecord{
+		Name:          user.Name,
+		DisplayName:   user.DisplayName,
+		Email:         user.Email,
+		CreateTime:    user.CreateTime,
+		UpdateTime:    user.UpdateTime,
+		DeleteTime:    user.DeleteTime,
+		PurgeTime:     user.PurgeTime,
+		Revision:      user.Revision,
+		Etag:          user.Etag,
+		RevisionActor: user.RevisionActor,
+	}
+}
+
+func (u *userRecord) toDomain() *domain.User {
+	user := &domain.User{
+		Name:        u.Name,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		CreateTime:  u.CreateTime,
+		UpdateTime:  u.UpdateTime,
+		DeleteTime:  u.DeleteTime,
+		PurgeTime:   u.PurgeTime,
+		Revision:    u.Revision,
+		Etag:        u.Etag,
+
+		RevisionActor: u.RevisionActor,
+	}
+	setRevisionFields(user)
+	return user
+}
+
+// Every entry is framed by its length and checksum, so that a torn write at
+// the end of the log can be detected and discarded.
+const frameHeaderSize = 8
+
+// maxFrameSize is the length of the largest entry. A frame header with a
+// larger length is corrupt.
+const maxFrameSize = 64 << 20
+
+var (
+	// errTornEntry means that the last entry was only partially written.
+	errTornEntry = errors.New("torn log entry")
+	// errCorruptEntry means that an entry before the last one is damaged, so
+	// the entries after it can't be trusted either.
+	errCorruptEntry = errors.New("corrupt log entry")
+)
+
+// appendFrame appends an entry, framed by its length and checksum, to buf.
+func appendFrame(buf []byte, entry walEntry) ([]byte, error) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("encode log entry: %w", err)
+	}
+	if len(payload) > maxFrameSize {
+		return nil, fmt.Errorf("encode log entry: %d bytes exceeds the limit of %d", len(payload), maxFrameSize)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload))) //nolint:gosec // Capped by maxFrameSize
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	return append(buf, payload...), nil
+}
+
+// readFrames reads framed entries until the end of r. It returns the entries
+// and the number of bytes they take up. If the last entry is incomplete or
+// damaged, the entries before it are returned together with errTornEntry.
+// A damaged entry before the last one fails with errCorruptEntry.
+func readFrames(r io.Reader) ([]walEntry, int64, error) {
+	reader := bufio.NewReader(r)
+	var (
+		entries []walEntry
+		offset  int64
+		header  [frameHeaderSize]byte
+	)
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return entries, offset, nil
+			}
+			return entries, offset, readFrameError(err)
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		if length > maxFrameSize {
+			// A frame that doesn't fit in the rest of the log is the last one
+			if n, err := io.CopyN(io.Discard, reader, length); n < length {
+				return entries, offset, readFrameError(err)
+			}
+			return entries, offset, fmt.Errorf("%w at offset %d: length %d exceeds the limit", errCorruptEntry, offset, length)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return entries, offset, readFrameError(err)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			if _, err := reader.Peek(1); err != nil {
+				return entries, offset, readFrameError(err)
+			}
+			return entries, offset, fmt.Errorf("%w at offset %d: checksum mismatch", errCorruptEntry, offset)
+		}
+		var entry walEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return entries, offset, fmt.Errorf("decode log entry: %w", err)
+		}
+		entries = append(entries, entry)
+		offset += frameHeaderSize + length
+	}
+}
+
+// readFrameError returns errTornEntry if err means that the log ended in the
+// middle of a frame, and err otherwise.
+func readFrameError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errTornEntry
+	}
+	return fmt.Errorf("read log: %w", err)
+}
+
+// walFile is the file of a log. It is an *os.File outside of tests.
+type walFile interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// writeAheadLog is an append-only file of framed entries.
+type writeAheadLog struct {
+	mutex  sync.Mutex
+	file   walFile
+	policy SyncPolicy
+	size   int64 // The end of the last complete entry.
+	dirty  bool  // Whether there are writes that haven't been synced.
+	// failed is set once a failed write couldn't be undone. The log may end
+	// in a partial entry then, so it takes no more writes.
+	failed error
+}
+
+// openWAL opens the log at path, creating it if needed, and returns it
+// together with the entries it holds. A torn entry at the end, left by a
+// crash in the middle of a write, is truncated away.
+func openWAL(path string, policy SyncPolicy) (*writeAheadLog, []walEntry, bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("open log: %w", err)
+	}
+	entries, size, err := readFrames(file)
+	torn := errors.Is(err, errTornEntry)
+	if err != nil && !torn {
+		_ = file.Close()
+		return nil, nil, false, err
+	}
+	if torn {
+		if err := file.Truncate(size); err != nil {
+			_ = file.Close()
+			return nil, nil, false, fmt.Errorf("truncate torn log entry: %w", err)
+		}
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, nil, false, fmt.Errorf("seek log: %w", err)
+	}
+	return &writeAheadLog{file: file, policy: policy, size: size}, entries, torn, nil
+}
+
+// append writes an entry to the end of the log, and syncs it if the policy
+// says so. If the write fails, the log is cut back to where it was.
+func (w *writeAheadLog) append(entry walEntry) error {
+	buf, err := appendFrame(nil, entry)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.failed != nil {
+		return fmt.Errorf("log failed: %w", w.failed)
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		return w.rollbackLocked(fmt.Errorf("write log: %w", err))
+	}
+	w.dirty = true
+	if w.policy == SyncAlways {
+		if err := w.syncLocked(); err != nil {
+			// The entry must not come back after a restart, as the write failed
+			return w.rollbackLocked(err)
+		}
+	}
+	w.size += int64(len(buf))
+	return nil
+}
+
+// rollbackLocked cuts off what a failed write left after the last complete
+// entry, and returns err. If that fails too, the log is marked failed.
+func (w *writeAheadLog) rollbackLocked(err error) error {
+	if truncErr := w.file.Truncate(w.size); truncErr != nil {
+		w.failed = errors.Join(err, fmt.Errorf("truncate log: %w", truncErr))
+		return w.failed
+	}
+	if _, seekErr := w.file.Seek(w.size, io.SeekStart); seekErr != nil {
+		w.failed = errors.Join(err, fmt.Errorf("seek log: %w", seekErr))
+		return w.failed
+	}
+	return err
+}
+
+// sync flushes the log to stable storage if there are unsynced writes.
+func (w *writeAheadLog) sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.syncLocked()
+}
+
+func (w *writeAheadLog) syncLocked() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync log: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// reset empties the log, once its entries are covered by a snapshot.
+func (w *writeAheadLog) reset() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate log: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek log: %w", err)
+	}
+	w.size = 0
+	w.dirty = true
+	return w.syncLocked()
+}
+
+// close syncs and closes the log.
+func (w *writeAheadLog) close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return errors.Join(w.syncLocked(), w.file.Close())
+}
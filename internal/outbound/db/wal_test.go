@@ -0,0 +1,170 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// memFile is a walFile in memory. Writes fail halfway once failWrite is set,
+// and truncates fail once failTruncate is.
+type memFile struct {
+	data         []byte
+	offset       int64
+	failWrite    bool
+	failTruncate bool
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.failWrite {
+		p = p[:len(p)/2]
+	}
+	f.data = append(f.data[:f.offset], p...)
+	f.offset += int64(len(p))
+	if f.failWrite {
+		return len(p), errors.New("no space left on device")
+	}
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, _ int) (int64, error) {
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("input/output error")
+	}
+	f.data = f.data[:size]
+	return nil
+}
+
+func (f *memFile) Sync() error  { return nil }
+func (f *memFile) Close() error { return nil }
+
+func frames(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf []byte
+	for _, name := range names {
+		var err error
+		buf, err = appendFrame(buf, walEntry{Op: walRemove, Name: name})
+		assert.NilError(t, err)
+	}
+	return buf
+}
+
+func entryNames(entries []walEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name
+	}
+	return names
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	t.Parallel()
+
+	t.Run("cuts off a failed write", func(t *testing.T) {
+		t.Parallel()
+		file := &memFile{}
+		wal := &writeAheadLog{file: file, policy: SyncAlways}
+		assert.NilError(t, wal.append(walEntry{Op: walRemove, Name: "users/a"}))
+		file.failWrite = true
+		assert.ErrorContains(t, wal.append(walEntry{Op: walRemove, Name: "users/b"}), "no space left on device")
+		file.failWrite = false
+		assert.NilError(t, wal.append(walEntry{Op: walRemove, Name: "users/c"}))
+
+		entries, _, err := readFrames(bytes.NewReader(file.data))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, entryNames(entries), []string{"users/a", "users/c"})
+	})
+
+	t.Run("takes no more writes once a failed write can't be cut off", func(t *testing.T) {
+		t.Parallel()
+		file := &memFile{failWrite: true, failTruncate: true}
+		wal := &writeAheadLog{file: file, policy: SyncAlways}
+		assert.ErrorContains(t, wal.append(walEntry{Op: walRemove, Name: "users/a"}), "input/output error")
+		file.failWrite, file.failTruncate = false, false
+		assert.ErrorContains(t, wal.append(walEntry{Op: walRemove, Name: "users/b"}), "log failed")
+	})
+}
+
+func TestReadFrames(t *testing.T) {
+	t.Parallel()
+
+	corrupt := func(data []byte, offset int) []byte {
+		data = bytes.Clone(data)
+		data[offset] ^= 0xff
+		return data
+	}
+	oversized := binary.BigEndian.AppendUint32(nil, maxFrameSize+1)
+	oversized = binary.BigEndian.AppendUint32(oversized, 0)
+	valid := frames(t, "users/a", "users/b")
+	last := len(frames(t, "users/a")) // The offset of the last frame.
+
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr error
+	}{
+		{name: "empty", data: nil},
+		{name: "complete", data: valid, want: []string{"users/a", "users/b"}},
+		{
+			name:    "torn header at the end",
+			data:    valid[:last+3],
+			want:    []string{"users/a"},
+			wantErr: errTornEntry,
+		},
+		{
+			name:    "torn payload at the end",
+			data:    valid[:len(valid)-1],
+			want:    []string{"users/a"},
+			wantErr: errTornEntry,
+		},
+		{
+			name:    "damaged payload at the end",
+			data:    corrupt(valid, len(valid)-2),
+			want:    []string{"users/a"},
+			wantErr: errTornEntry,
+		},
+		{
+			name:    "oversized length at the end",
+			data:    append(frames(t, "users/a"), oversized...),
+			want:    []string{"users/a"},
+			wantErr: errTornEntry,
+		},
+		{
+			name:    "damaged payload before the end",
+			data:    corrupt(valid, last-2),
+			wantErr: errCorruptEntry,
+		},
+		{
+			name:    "oversized length before the end",
+			data:    append(append(frames(t, "users/a"), oversized...), make([]byte, maxFrameSize+1)...),
+			want:    []string{"users/a"},
+			wantErr: errCorruptEntry,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			entries, size, err := readFrames(bytes.NewReader(tt.data))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.DeepEqual(t, entryNames(entries), append([]string{}, tt.want...))
+			if errors.Is(err, errTornEntry) {
+				// What is left after truncating the torn entry reads cleanly
+				_, _, err := readFrames(io.LimitReader(bytes.NewReader(tt.data), size))
+				assert.NilError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// ErrSlowSubscriber means that a subscription was dropped because it didn't
+// keep up with the events.
+var ErrSlowSubscriber = errors.New("subscriber fell behind")
+
+// Broker publishes events to subscribers in the same process. Every
+// subscription receives all events published while it is open, in order,
+// unless it doesn't take an event within the broker's timeout. It is then
+// dropped, so that one slow subscriber doesn't hold up the others.
+type Broker struct {
+	timeout time.Duration
+
+	mutex       sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBroker returns a broker that waits up to timeout for a subscription
+// whose buffer is full.
+func NewBroker(timeout time.Duration) *Broker {
+	return &Broker{
+		timeout:     timeout,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events published by a Broker.
+type Subscription struct {
+	broker *Broker
+	events chan domain.UserEvent
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Subscribe returns a subscription to the events published from now on, with
+// room for buffer events that haven't been received yet. Call Close once
+// done with it.
+func (b *Broker) Subscribe(buffer int) *Subscription {
+	s := &Subscription{
+		broker: b,
+		events: make(chan domain.UserEvent, buffer),
+		done:   make(chan struct{}),
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// Events returns the channel of events, which is closed when the
+// subscription ends.
+func (s *Subscription) Events() <-chan domain.UserEvent {
+	return s.events
+}
+
+// Err returns why the subscription ended, once its channel is closed. It is
+// ErrSlowSubscriber if it was dropped, and nil if it was closed.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.broker.remove(s, nil)
+	})
+}
+
+// remove ends a subscription for the given reason, unless it already ended.
+func (b *Broker) remove(s *Subscription, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.removeLocked(s, err)
+}
+
+func (b *Broker) removeLocked(s *Subscription, err error) {
+	if _, exists := b.subscribers[s]; !exists {
+		return
+	}
+	delete(b.subscribers, s)
+	s.err = err
+	close(s.events)
+}
+
+// PublishUserEvents hands the events to every subscription. It only fails if
+// ctx is done.
+func (b *Broker) PublishUserEvents(ctx context.Context, events []domain.UserEvent) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.subscribers {
+		if err := b.send(ctx, s, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send hands the events to a subscription, and drops it if it doesn't keep
+// up. The caller must hold the lock.
+func (b *Broker) send(ctx context.Context, s *Subscription, events []domain.UserEvent) error {
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+	for _, event := range events {
+		event.User = event.User.Copy()
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return nil
+		case <-timer.C:
+			b.removeLocked(s, ErrSlowSubscriber)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
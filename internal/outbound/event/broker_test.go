@@ -0,0 +1,85 @@
+package event_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
+	"gotest.tools/v3/assert"
+)
+
+// receive returns the ids of the next n events of a subscription.
+func receive(t *testing.T, subscription *event.Subscription, n int) []string {
+	t.Helper()
+	ids := make([]string, 0, n)
+	for range n {
+		select {
+		case e, ok := <-subscription.Events():
+			assert.Assert(t, ok, "subscription ended: %v", subscription.Err())
+			ids = append(ids, e.ID)
+		case <-time.After(time.Second):
+			t.Fatalf("no event after %v", ids)
+		}
+	}
+	return ids
+}
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("delivers events in order to every subscriber", func(t *testing.T) {
+		t.Parallel()
+		broker := event.NewBroker(time.Second)
+		first := broker.Subscribe(1)
+		defer first.Close()
+		second := broker.Subscribe(10)
+		defer second.Close()
+
+		published := make(chan error, 1)
+		go func() { published <- broker.PublishUserEvents(t.Context(), newEvents("a", "b", "c")) }()
+		want := []string{"users/a@reva", "users/b@revb", "users/c@revc"}
+		assert.DeepEqual(t, receive(t, first, 3), want)
+		assert.NilError(t, <-published)
+		assert.DeepEqual(t, receive(t, second, 3), want)
+	})
+
+	t.Run("closed subscriptions receive nothing", func(t *testing.T) {
+		t.Parallel()
+		broker := event.NewBroker(time.Second)
+		subscription := broker.Subscribe(0)
+		subscription.Close()
+		subscription.Close()
+		assert.NilError(t, broker.PublishUserEvents(t.Context(), newEvents("a")))
+		_, ok := <-subscription.Events()
+		assert.Assert(t, !ok)
+		assert.NilError(t, subscription.Err())
+	})
+
+	t.Run("drops slow subscribers", func(t *testing.T) {
+		t.Parallel()
+		broker := event.NewBroker(10 * time.Millisecond)
+		slow := broker.Subscribe(1)
+		defer slow.Close()
+		fast := broker.Subscribe(10)
+		defer fast.Close()
+
+		assert.NilError(t, broker.PublishUserEvents(t.Context(), newEvents("a", "b")))
+		assert.DeepEqual(t, receive(t, fast, 2), []string{"users/a@reva", "users/b@revb"})
+		assert.DeepEqual(t, receive(t, slow, 1), []string{"users/a@reva"})
+		_, ok := <-slow.Events()
+		assert.Assert(t, !ok)
+		assert.ErrorIs(t, slow.Err(), event.ErrSlowSubscriber)
+	})
+
+	t.Run("fails when the context is done", func(t *testing.T) {
+		t.Parallel()
+		broker := event.NewBroker(time.Minute)
+		subscription := broker.Subscribe(0)
+		defer subscription.Close()
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		err := broker.PublishUserEvents(ctx, newEvents("a"))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
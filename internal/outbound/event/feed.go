@@ -0,0 +1,165 @@
+package event
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// Feed keeps the latest events in the order they were published, so that
+// watches can follow them and resume after a disconnect. Every event gets the
+// next position in the feed, and events that are published again are only
+// kept once. Tokens are only valid in the process that issued them, and
+// expire once the events after them are no longer kept.
+type Feed struct {
+	epoch string // Tells the tokens of this process apart.
+	size  int
+
+	mutex   sync.Mutex
+	last    int64               // The position of the newest event.
+	events  []domain.UserEvent  // The kept events, oldest first.
+	ids     map[string]struct{} // The IDs of the kept events.
+	changed chan struct{}       // Closed when events are added.
+	closed  bool
+}
+
+// NewFeed returns a feed that keeps the last size events.
+func NewFeed(size int) *Feed {
+	return &Feed{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:    size,
+		ids:     make(map[string]struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// feedToken is the decoded form of a resume token.
+type feedToken struct {
+	Epoch    string `json:"e"`
+	Position int64  `json:"p"`
+}
+
+func (f *Feed) encodeToken(position int64) string {
+	data, err := json.Marshal(feedToken{Epoch: f.epoch, Position: position})
+	if err != nil {
+		// Marshaling a struct of a string and an integer can't fail
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeToken returns the position of a token issued by this feed.
+func (f *Feed) decodeToken(s string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, domain.NewErrorInvalidInput("invalid resume token", err)
+	}
+	var token feedToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return 0, domain.NewErrorInvalidInput("invalid resume token", err)
+	}
+	if token.Epoch != f.epoch {
+		return 0, domain.NewErrorFailedPrecondition(
+			"resume token has expired because the server restarted, watch again without a token", nil)
+	}
+	return token.Position, nil
+}
+
+func (f *Feed) PublishUserEvents(_ context.Context, events []domain.UserEvent) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var added bool
+	for _, event := range events {
+		if _, exists := f.ids[event.ID]; exists {
+			continue
+		}
+		// The position in the feed replaces the one in the outbox
+		f.last++
+		event.Sequence = f.last
+		event.User = event.User.Copy()
+		f.events = append(f.events, event)
+		f.ids[event.ID] = struct{}{}
+		added = true
+	}
+	if dropped := len(f.events) - f.size; dropped > 0 {
+		for _, event := range f.events[:dropped] {
+			delete(f.ids, event.ID)
+		}
+		f.events = append(f.events[:0:0], f.events[dropped:]...)
+	}
+	if added && !f.closed {
+		close(f.changed)
+		f.changed = make(chan struct{})
+	}
+	return nil
+}
+
+// Close ends the watches of the feed, with an Unavailable error. Events can
+// still be published to it.
+func (f *Feed) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.changed)
+	}
+}
+
+func (f *Feed) UserEventsToken() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.encodeToken(f.last)
+}
+
+func (f *Feed) WaitUserChanges(ctx context.Context, token string, limit int) ([]domain.UserChange, error) {
+	position, err := f.decodeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		changes, changed, err := f.read(position, limit)
+		if err != nil || len(changes) > 0 {
+			return changes, err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// read returns up to limit of the changes after position, or a channel that
+// is closed once there are more events.
+func (f *Feed) read(position int64, limit int) ([]domain.UserChange, <-chan struct{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil, nil, domain.NewErrorUnavailable("watch ended because the server is shutting down", nil)
+	}
+	if position > f.last || position < 0 {
+		return nil, nil, domain.NewErrorInvalidInput("invalid resume token", nil)
+	}
+	// The sequences of the kept events are consecutive
+	first := f.last - int64(len(f.events)) + 1
+	if position < first-1 {
+		return nil, nil, domain.NewErrorFailedPrecondition(
+			"resume token has expired because the changes after it are no longer kept, watch again without a token", nil)
+	}
+	events := f.events[position-first+1:]
+	events = events[:min(len(events), max(limit, 1))]
+	if len(events) == 0 {
+		return nil, f.changed, nil
+	}
+	changes := make([]domain.UserChange, len(events))
+	for i, event := range events {
+		event.User = event.User.Copy()
+		changes[i] = domain.NewUserChange(event, f.encodeToken(event.Sequence))
+	}
+	return changes, nil, nil
+}
@@ -0,0 +1,126 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
+	"gotest.tools/v3/assert"
+)
+
+// changeNames returns the names of the users of changes.
+func changeNames(changes []domain.UserChange) []string {
+	names := make([]string, len(changes))
+	for i, change := range changes {
+		names[i] = change.User.Name
+	}
+	return names
+}
+
+// errorType returns the type of a domain error, and fails if err isn't one.
+func errorType(t *testing.T, err error) domain.ErrorType {
+	t.Helper()
+	var customErr *domain.Error
+	assert.Assert(t, errors.As(err, &customErr), "got %v", err)
+	return customErr.Type
+}
+
+func TestFeed(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns the changes after a token", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(10)
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("a")))
+		token := feed.UserEventsToken()
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("b", "c")))
+
+		changes, err := feed.WaitUserChanges(t.Context(), token, 1)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changeNames(changes), []string{"users/b"})
+		assert.Equal(t, changes[0].Type, domain.UserChangeCreated)
+		changes, err = feed.WaitUserChanges(t.Context(), changes[0].ResumeToken, 10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changeNames(changes), []string{"users/c"})
+	})
+
+	t.Run("keeps events that are published again once", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(10)
+		token := feed.UserEventsToken()
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("a", "b")))
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("a", "b", "c")))
+
+		changes, err := feed.WaitUserChanges(t.Context(), token, 10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changeNames(changes), []string{"users/a", "users/b", "users/c"})
+	})
+
+	t.Run("waits for changes", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(10)
+		token := feed.UserEventsToken()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = feed.PublishUserEvents(context.Background(), newEvents("a"))
+		}()
+		changes, err := feed.WaitUserChanges(t.Context(), token, 10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changeNames(changes), []string{"users/a"})
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(10)
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		_, err := feed.WaitUserChanges(ctx, feed.UserEventsToken(), 10)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("tokens expire once their changes are dropped", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(2)
+		token := feed.UserEventsToken()
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("a", "b")))
+		_, err := feed.WaitUserChanges(t.Context(), token, 10)
+		assert.NilError(t, err)
+
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("c")))
+		_, err = feed.WaitUserChanges(t.Context(), token, 10)
+		assert.Equal(t, errorType(t, err), domain.FailedPrecondition)
+	})
+
+	t.Run("tokens of another feed have expired", func(t *testing.T) {
+		t.Parallel()
+		other := event.NewFeed(10)
+		token := other.UserEventsToken()
+		time.Sleep(time.Microsecond)
+		feed := event.NewFeed(10)
+		_, err := feed.WaitUserChanges(t.Context(), token, 10)
+		assert.Equal(t, errorType(t, err), domain.FailedPrecondition)
+	})
+
+	t.Run("rejects malformed tokens", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(10)
+		_, err := feed.WaitUserChanges(t.Context(), "not a token", 10)
+		assert.Equal(t, errorType(t, err), domain.InvalidInput)
+	})
+
+	t.Run("close ends waiting", func(t *testing.T) {
+		t.Parallel()
+		feed := event.NewFeed(10)
+		token := feed.UserEventsToken()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			feed.Close()
+		}()
+		_, err := feed.WaitUserChanges(t.Context(), token, 10)
+		assert.Equal(t, errorType(t, err), domain.Unavailable)
+		assert.NilError(t, feed.PublishUserEvents(t.Context(), newEvents("a")))
+	})
+}
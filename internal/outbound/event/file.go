@@ -0,0 +1,107 @@
+// Package event provides sinks that publish the events of changes to users.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+)
+
+// FileSink appends events to a file as newline-delimited JSON, one event per
+// line, and syncs the file after every batch. A batch that fails part way is
+// published again in full, so lines may repeat.
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileSink opens the file at path for appending, creating it and its
+// directory if needed. Call Close to release it.
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create event directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open event file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileSink) PublishUserEvents(_ context.Context, events []domain.UserEvent) error {
+	var buf []byte
+	for _, event := range events {
+		line, err := json.Marshal(toEventRecord(event))
+		if err != nil {
+			return fmt.Errorf("encode event: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.file.Write(buf); err != nil {
+		return fmt.Errorf("write events: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync events: %w", err)
+	}
+	return nil
+}
+
+// EventRecord is the published form of a domain.UserEvent. It is kept
+// separate from the domain type so that the format doesn't change by
+// accident.
+type EventRecord struct {
+	ID    string     `json:"id"`
+	Type  string     `json:"type"`
+	Time  time.Time  `json:"time"`
+	Actor string     `json:"actor,omitempty"`
+	User  UserRecord `json:"user"`
+}
+
+// UserRecord is the published form of a domain.User.
+type UserRecord struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email"`
+	CreateTime  time.Time `json:"create_time"`
+	UpdateTime  time.Time `json:"update_time"`
+	DeleteTime  time.Time `json:"delete_time,omitzero"`
+	PurgeTime   time.Time `json:"purge_time,omitzero"`
+	Etag        string    `json:"etag"`
+	RevisionID  string    `json:"revision_id"`
+}
+
+func toEventRecord(event domain.UserEvent) EventRecord {
+	user := event.User
+	return EventRecord{
+		ID:    event.ID,
+		Type:  string(event.Type),
+		Time:  user.RevisionCreateTime,
+		Actor: user.RevisionActor,
+		User: UserRecord{
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+			Email:       user.Email,
+			CreateTime:  user.CreateTime,
+			UpdateTime:  user.UpdateTime,
+			DeleteTime:  user.DeleteTime,
+			PurgeTime:   user.PurgeTime,
+			Etag:        user.Etag,
+			RevisionID:  user.RevisionID,
+		},
+	}
+}
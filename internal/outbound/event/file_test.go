@@ -0,0 +1,75 @@
+package event_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
+	"gotest.tools/v3/assert"
+)
+
+// newEvents returns an event for each of the given user ids.
+func newEvents(ids ...string) []domain.UserEvent {
+	events := make([]domain.UserEvent, 0, len(ids))
+	for i, id := range ids {
+		user := &domain.User{
+			Name:               "users/" + id,
+			DisplayName:        "User " + id,
+			Email:              id + "@example.com",
+			Revision:           1,
+			RevisionID:         "rev" + id,
+			RevisionCreateTime: time.Date(2025, 1, 1, 0, 0, i, 0, time.UTC),
+			RevisionActor:      "alice",
+		}
+		e := domain.NewUserEvent(user)
+		e.Sequence = int64(i + 1)
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "events", "users.ndjson")
+	sink, err := event.NewFileSink(path)
+	assert.NilError(t, err)
+	assert.NilError(t, sink.PublishUserEvents(t.Context(), newEvents("a", "b")))
+	assert.NilError(t, sink.Close())
+
+	// Events are appended to the file across restarts
+	sink, err = event.NewFileSink(path)
+	assert.NilError(t, err)
+	defer sink.Close()
+	assert.NilError(t, sink.PublishUserEvents(t.Context(), newEvents("c")))
+
+	file, err := os.Open(path)
+	assert.NilError(t, err)
+	defer file.Close()
+	var records []event.EventRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record event.EventRecord
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	assert.NilError(t, scanner.Err())
+	assert.Equal(t, len(records), 3)
+	assert.DeepEqual(t, records[0], event.EventRecord{
+		ID:    "users/a@reva",
+		Type:  "UserCreated",
+		Time:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Actor: "alice",
+		User: event.UserRecord{
+			Name:        "users/a",
+			DisplayName: "User a",
+			Email:       "a@example.com",
+			RevisionID:  "reva",
+		},
+	})
+	assert.Equal(t, records[2].ID, "users/c@revc")
+}
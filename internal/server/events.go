@@ -0,0 +1,37 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/fredrikaverpil/go-microservice/internal/config"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
+)
+
+// newUserEventSinks returns the sinks that the events of changes to users are
+// published to, and a function that closes them. The given sinks serve this
+// process, and the events are also appended to a file if one is configured.
+func newUserEventSinks(inProcess ...port.UserEventSink) ([]port.UserEventSink, func() error, error) {
+	sinks := inProcess
+	path := config.GetUserEventFile()
+	if path == "" {
+		return sinks, func() error { return nil }, nil
+	}
+	fileSink, err := event.NewFileSink(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(sinks, fileSink), fileSink.Close, nil
+}
+
+// joinClose returns a function that calls the close functions in order, and
+// joins their errors.
+func joinClose(closers ...func() error) func() error {
+	return func() error {
+		var errs []error
+		for _, closeFn := range closers {
+			errs = append(errs, closeFn())
+		}
+		return errors.Join(errs...)
+	}
+}
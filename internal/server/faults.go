@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/fredrikaverpil/go-microservice/internal/config"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+)
+
+// userFaults is the fault injector of the most recently created gRPC server,
+// which the gateway exposes at /debug/faults.
+//
+//nolint:gochecknoglobals // shared between the gRPC server and the gateway
+var userFaults atomic.Pointer[db.FaultyRepository]
+
+// newFaultyRepository wraps the user store in a fault injector, configured
+// from USER_FAULTS.
+func newFaultyRepository(logger *slog.Logger, repo port.UserRepository) (port.UserRepository, error) {
+	faulty := db.NewFaultyRepository(logger, repo)
+	if faults := config.GetUserFaults(); faults != "" {
+		var faultConfig db.FaultConfig
+		if err := json.Unmarshal([]byte(faults), &faultConfig); err != nil {
+			return nil, fmt.Errorf("parse USER_FAULTS: %w", err)
+		}
+		if err := faulty.SetFaults(faultConfig); err != nil {
+			return nil, fmt.Errorf("invalid USER_FAULTS: %w", err)
+		}
+	}
+	userFaults.Store(faulty)
+	return faulty, nil
+}
+
+// faultsHandler shows the injected faults on GET, replaces them on PUT and
+// removes them on DELETE.
+func faultsHandler(w http.ResponseWriter, r *http.Request) {
+	faulty := userFaults.Load()
+	if faulty == nil {
+		http.Error(w, "fault injection is not enabled", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var faultConfig db.FaultConfig
+		if err := json.NewDecoder(r.Body).Decode(&faultConfig); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := faulty.SetFaults(faultConfig); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		_ = faulty.SetFaults(db.FaultConfig{})
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(faulty.Faults())
+}
@@ -2,17 +2,21 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fredrikaverpil/go-microservice/internal/config"
 	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"github.com/fredrikaverpil/go-microservice/internal/inbound/handler/grpc/gomicroservice"
 	"github.com/fredrikaverpil/go-microservice/internal/middleware"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -31,7 +35,13 @@ func NewGatewayServer(
 	logger *slog.Logger,
 ) (*GatewayServer, error) {
 	ctx := context.Background()
-	mux := runtime.NewServeMux()
+	mux := runtime.NewServeMux(
+		// Headers must be set before the status is written
+		runtime.WithForwardResponseOption(forwardEtagHeader),
+		runtime.WithForwardResponseOption(forwardCreatedStatus),
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithMarshalerOption(eventStreamType, newSSEMarshaler()),
+	)
 
 	// Create client connection to gRPC server
 	opts := []grpc.DialOption{
@@ -42,8 +52,15 @@ func NewGatewayServer(
 	if err := gomicroservicev1.RegisterUserServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
 		return nil, err
 	}
+	if err := registerImportHandler(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	if err := registerOperationsHandler(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
 
 	swaggerHandler := SwaggerHandler(logger)
+	shutdown, cancelStreams := context.WithCancel(ctx)
 
 	mainHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Route Swagger UI and OpenAPI spec requests
@@ -52,8 +69,33 @@ func NewGatewayServer(
 			return
 		}
 
+		// Let developers inject faults into the user store at runtime
+		if config.IsDevelopment() && r.URL.Path == "/debug/faults" {
+			faultsHandler(w, r)
+			return
+		}
+
+		// Serve the metrics of the service, such as the user cache counters
+		if r.URL.Path == "/metrics" {
+			metricsHandler(w, r)
+			return
+		}
+
+		// Serve all expvars. They include the command line and memory stats,
+		// so they aren't served in production.
+		if config.IsDevelopment() && r.URL.Path == "/debug/vars" {
+			expvar.Handler().ServeHTTP(w, r)
+			return
+		}
+
+		// Serve streams as Server-Sent Events if asked to
+		if acceptsEventStream(r) {
+			serveEventStream(shutdown, mux, w, r)
+			return
+		}
+
 		// All other paths go to the gRPC-gateway
-		mux.ServeHTTP(w, r)
+		mux.ServeHTTP(w, ifMatchToEtag(r))
 	})
 
 	// Wrap mux with middlewares
@@ -64,6 +106,7 @@ func NewGatewayServer(
 		Handler:           handler,
 		ReadHeaderTimeout: readHeaderTimeout,
 	}
+	server.RegisterOnShutdown(cancelStreams)
 
 	return &GatewayServer{
 		server: server,
@@ -73,6 +116,54 @@ func NewGatewayServer(
 	}, nil
 }
 
+// forwardEtagHeader sets the ETag header from the etag of a returned user.
+func forwardEtagHeader(_ context.Context, w http.ResponseWriter, resp proto.Message) error {
+	if user, ok := resp.(*gomicroservicev1.User); ok && user.GetEtag() != "" {
+		w.Header().Set("ETag", strconv.Quote(user.GetEtag()))
+	}
+	return nil
+}
+
+// ifMatchToEtag passes an If-Match header on as the etag query parameter,
+// unless the request already has one.
+func ifMatchToEtag(r *http.Request) *http.Request {
+	ifMatch := r.Header.Get("If-Match")
+	query := r.URL.Query()
+	if ifMatch == "" || ifMatch == "*" || query.Has("etag") {
+		return r
+	}
+	etag := strings.TrimPrefix(ifMatch, "W/")
+	if unquoted, err := strconv.Unquote(etag); err == nil {
+		etag = unquoted
+	}
+	query.Set("etag", etag)
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	return r
+}
+
+// incomingHeaderMatcher passes the actor header on to the gRPC server, along
+// with the headers that the gateway passes on by default.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, middleware.ActorHeader) {
+		return middleware.ActorHeader, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// forwardCreatedStatus responds with 201 Created when the gRPC handler signals
+// that the call created a resource, such as an UpdateUser with allow_missing.
+func forwardCreatedStatus(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if values := md.HeaderMD.Get(gomicroservice.CreatedHeader); len(values) > 0 && values[0] == "true" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
 func (s *GatewayServer) Start() error {
 	s.logger.Info("HTTP gateway server listening", "port", s.server.Addr)
 	s.ready = true
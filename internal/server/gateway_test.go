@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/protovalidate-go"
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+// newTestGateway starts a gRPC server as configured by default, with users
+// kept in memory, and returns the handler of a gateway in front of it.
+func newTestGateway(t *testing.T) http.Handler {
+	t.Helper()
+	logger := slog.New(slog.DiscardHandler)
+	validator, err := protovalidate.New()
+	assert.NilError(t, err)
+	grpcServer, err := NewGRPCServer("0", logger, validator)
+	assert.NilError(t, err)
+	// Serve like Start does, with the relay that publishes to watches. Start
+	// isn't used, as it sets the state without waiting for Stop.
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2) //nolint:mnd // the server and the relay
+	go func() { defer wg.Done(); _ = grpcServer.server.Serve(grpcServer.listener) }()
+	go func() { defer wg.Done(); grpcServer.relay.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NilError(t, grpcServer.Stop(context.Background()))
+		wg.Wait()
+	})
+
+	_, grpcPort, err := net.SplitHostPort(grpcServer.listener.Addr().String())
+	assert.NilError(t, err)
+	gateway, err := NewGatewayServer("0", grpcPort, logger)
+	assert.NilError(t, err)
+	return gateway.server.Handler
+}
+
+// serve sends a request with the body to the gateway, and returns the
+// response.
+func serve(t *testing.T, gateway http.Handler, method, target, body string, header http.Header) *http.Response {
+	t.Helper()
+	req := httptest.NewRequestWithContext(t.Context(), method, target, strings.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+// decodeResponse asserts that a response has the status code, and decodes
+// its body into msg.
+func decodeResponse(t *testing.T, resp *http.Response, code int, msg proto.Message) {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.StatusCode, code, "body: %s", body)
+	assert.NilError(t, protojson.Unmarshal(body, msg))
+}
+
+// createUser creates a user with the id through the gateway, and returns it.
+func createUser(t *testing.T, gateway http.Handler, id string) *gomicroservicev1.User {
+	t.Helper()
+	body := fmt.Sprintf(`{"displayName":"User %s","email":"%s@example.com"}`, id, id)
+	var user gomicroservicev1.User
+	decodeResponse(t, serve(t, gateway, http.MethodPost, "/v1/users?user_id="+id, body, nil), http.StatusOK, &user)
+	return &user
+}
+
+func TestForwardCreatedStatus(t *testing.T) {
+	t.Parallel()
+	gateway := newTestGateway(t)
+	upsert := func(displayName string) *http.Response {
+		body := fmt.Sprintf(`{"displayName":%q,"email":"ada@example.com"}`, displayName)
+		return serve(t, gateway, http.MethodPatch, "/v1/users/ada-lovelace?allow_missing=true", body, nil)
+	}
+
+	// Only the call that creates the user responds with 201 Created
+	var user gomicroservicev1.User
+	resp := upsert("Ada")
+	decodeResponse(t, resp, http.StatusCreated, &user)
+	assert.Equal(t, user.GetName(), "users/ada-lovelace")
+	assert.Equal(t, resp.Header.Get("ETag"), strconv.Quote(user.GetEtag()))
+	decodeResponse(t, upsert("Ada Lovelace"), http.StatusOK, &user)
+	assert.Equal(t, user.GetDisplayName(), "Ada Lovelace")
+}
+
+func TestIfMatchToEtag(t *testing.T) {
+	t.Parallel()
+
+	t.Run("passes If-Match on as etag", func(t *testing.T) {
+		t.Parallel()
+		for _, tt := range []struct {
+			name, target, ifMatch string
+			want                  string
+		}{
+			{name: "without If-Match", target: "/v1/users/ada", want: ""},
+			{name: "quoted", target: "/v1/users/ada", ifMatch: `"abc"`, want: "abc"},
+			{name: "weak", target: "/v1/users/ada", ifMatch: `W/"abc"`, want: "abc"},
+			{name: "unquoted", target: "/v1/users/ada", ifMatch: "abc", want: "abc"},
+			{name: "any", target: "/v1/users/ada", ifMatch: "*", want: ""},
+			{name: "with an etag already", target: "/v1/users/ada?etag=def", ifMatch: `"abc"`, want: "def"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+				req := httptest.NewRequest(http.MethodPatch, tt.target, nil)
+				if tt.ifMatch != "" {
+					req.Header.Set("If-Match", tt.ifMatch)
+				}
+				got := ifMatchToEtag(req)
+				assert.Equal(t, got.URL.Query().Get("etag"), tt.want)
+				// The request of the caller isn't changed
+				assert.Equal(t, req.URL.String(), tt.target)
+			})
+		}
+	})
+
+	t.Run("updates only the matching user", func(t *testing.T) {
+		t.Parallel()
+		gateway := newTestGateway(t)
+		user := createUser(t, gateway, "ada-lovelace")
+		update := func(ifMatch string) *http.Response {
+			return serve(t, gateway, http.MethodPatch, "/v1/users/ada-lovelace",
+				`{"displayName":"Ada Lovelace","email":"ada-lovelace@example.com"}`,
+				http.Header{"If-Match": {ifMatch}},
+			)
+		}
+
+		var got gomicroservicev1.User
+		decodeResponse(t, update(`"stale"`), http.StatusConflict, &status.Status{})
+		decodeResponse(t, update(strconv.Quote(user.GetEtag())), http.StatusOK, &got)
+		assert.Equal(t, got.GetDisplayName(), "Ada Lovelace")
+		decodeResponse(t, update(strconv.Quote(user.GetEtag())), http.StatusConflict, &status.Status{})
+		decodeResponse(t, update("*"), http.StatusOK, &got)
+	})
+}
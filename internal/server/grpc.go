@@ -2,9 +2,13 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net"
+	"sync"
+	"time"
 
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/bufbuild/protovalidate-go"
 	"github.com/fredrikaverpil/go-microservice/internal/config"
 	"github.com/fredrikaverpil/go-microservice/internal/core/service"
@@ -12,17 +16,25 @@ import (
 	"github.com/fredrikaverpil/go-microservice/internal/inbound/handler/grpc/gomicroservice"
 	"github.com/fredrikaverpil/go-microservice/internal/middleware"
 	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
 type GRPCServer struct {
-	server   *grpc.Server
-	port     string
-	logger   *slog.Logger
-	listener net.Listener
-	ready    bool
-	state    State
+	server     *grpc.Server
+	port       string
+	logger     *slog.Logger
+	listener   net.Listener
+	reaper     *service.UserReaper
+	relay      *service.UserEventRelay
+	feed       *event.Feed
+	operations *service.Operations
+	stopWorker context.CancelFunc
+	workers    sync.WaitGroup
+	closeRepo  func() error
+	ready      bool
+	state      State
 }
 
 func NewGRPCServer(
@@ -33,15 +45,62 @@ func NewGRPCServer(
 	// Create server with interceptors
 	grpcServer := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(middleware.GRPCUnaryServerInterceptors(logger)...),
+		grpc.ChainStreamInterceptor(middleware.GRPCStreamServerInterceptors(logger)...),
 	)
 
 	// Create repository and service
-	userRepo := db.NewMemoryRepository(logger)
-	userService := service.NewUserService(logger, userRepo)
-	userHandler := gomicroservice.NewGRPCHandler(userService, validator)
+	userRepo, operationStore, closeRepo, err := newUserRepository(logger)
+	if err != nil {
+		return nil, err
+	}
+	if config.IsDevelopment() {
+		if userRepo, err = newFaultyRepository(logger, userRepo); err != nil {
+			return nil, errors.Join(err, closeRepo())
+		}
+	}
+	if size := config.GetUserCacheSize(); size > 0 {
+		cachedRepo := db.NewCachedRepository(logger, userRepo, db.CacheOptions{
+			Size:        size,
+			TTL:         config.GetUserCacheTTL(),
+			NegativeTTL: config.GetUserCacheNegativeTTL(),
+		})
+		publishCacheStats(cachedRepo)
+		userRepo = cachedRepo
+		logger.Info("user cache enabled", "size", size)
+	}
+	// Watches follow the feed, which the relay publishes to with the other sinks
+	userFeed := event.NewFeed(config.GetUserWatchHistory())
+	operations := service.NewOperations(logger, operationStore, service.OperationsOptions{
+		Concurrency: config.GetOperationConcurrency(),
+		Retention:   config.GetOperationRetention(),
+		Owner:       config.GetInstanceID(),
+		Lease:       config.GetOperationLease(),
+	})
+	// Operations left running by the last process are done with an error
+	if _, err := operations.FailAbandoned(context.Background(), time.Now()); err != nil {
+		return nil, errors.Join(err, closeRepo())
+	}
+	userService := service.NewUserService(logger, userRepo, userFeed, operations, config.GetUserRetention())
+	userReaper := service.NewUserReaper(logger, userRepo, operations, config.GetUserPurgeInterval())
+	userEvents := event.NewBroker(config.GetUserEventSubscriberTimeout())
+	sinks, closeSinks, err := newUserEventSinks(userEvents, userFeed)
+	if err != nil {
+		return nil, errors.Join(err, closeRepo())
+	}
+	userRelay := service.NewUserEventRelay(
+		logger,
+		userRepo,
+		config.GetUserEventRelayInterval(),
+		config.GetUserEventBatchSize(),
+		sinks...,
+	)
+	// The sinks are closed with the repository, once the relay has stopped
+	closeRepo = joinClose(closeSinks, closeRepo)
+	userHandler := gomicroservice.NewGRPCHandler(userService, validator, config.GetUserBatchLimit())
 
-	// Register handler
+	// Register handlers
 	gomicroservicev1.RegisterUserServiceServer(grpcServer, userHandler)
+	longrunningpb.RegisterOperationsServer(grpcServer, gomicroservice.NewOperationsHandler(operations, validator))
 
 	// Enable reflection in development
 	if config.IsDevelopment() {
@@ -52,20 +111,34 @@ func NewGRPCServer(
 	// Create listener during initialization
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		return nil, err
+		return nil, errors.Join(err, closeRepo())
 	}
 
 	return &GRPCServer{
-		server:   grpcServer,
-		port:     port,
-		logger:   logger,
-		listener: lis,
-		ready:    false,
-		state:    StateStarting,
+		server:     grpcServer,
+		port:       port,
+		logger:     logger,
+		listener:   lis,
+		reaper:     userReaper,
+		relay:      userRelay,
+		feed:       userFeed,
+		operations: operations,
+		stopWorker: func() {},
+		closeRepo:  closeRepo,
+		ready:      false,
+		state:      StateStarting,
 	}, nil
 }
 
 func (s *GRPCServer) Start() error {
+	// Purge expired soft-deleted users and relay events in the background
+	// while serving
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWorker = cancel
+	s.workers.Add(2) //nolint:mnd // the reaper and the relay
+	go func() { defer s.workers.Done(); s.reaper.Run(ctx) }()
+	go func() { defer s.workers.Done(); s.relay.Run(ctx) }()
+
 	s.logger.Info("gRPC server listening", "port", s.port)
 	s.ready = true
 	s.state = StateRunning
@@ -80,6 +153,10 @@ func (s *GRPCServer) Start() error {
 func (s *GRPCServer) Stop(ctx context.Context) error {
 	s.state = StateShuttingDown
 	s.ready = false
+	s.stopWorker()
+	s.workers.Wait()
+	// Watches never end by themselves, so end them to let the server stop
+	s.feed.Close()
 	stopped := make(chan struct{})
 	go func() {
 		s.ready = false
@@ -90,12 +167,17 @@ func (s *GRPCServer) Stop(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		s.server.Stop()
+		s.operations.Close()
 		s.state = StateStopped
-		return ctx.Err()
+		return errors.Join(ctx.Err(), s.closeRepo())
 	case <-stopped:
 		s.logger.InfoContext(ctx, "gRPC server stopped gracefully")
 		s.state = StateStopped
-		return nil
+		// Operations that are still running are cancelled
+		s.operations.Close()
+		// Publish the events of the last writes, the rest are left in the outbox
+		_, err := s.relay.Relay(ctx)
+		return errors.Join(err, s.closeRepo())
 	}
 }
 
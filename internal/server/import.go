@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// importPattern is the route of ImportUsers on the gateway.
+const importPattern = "/v1/users:import"
+
+// importChunkSize is how much of an upload is sent in each ImportUsers request.
+const importChunkSize = 64 << 10
+
+// importFormats are the formats of the content types that an upload can have.
+var importFormats = map[string]gomicroservicev1.ImportUsersRequest_Format{
+	"text/csv":             gomicroservicev1.ImportUsersRequest_CSV,
+	"application/x-ndjson": gomicroservicev1.ImportUsersRequest_NDJSON,
+	"application/ndjson":   gomicroservicev1.ImportUsersRequest_NDJSON,
+	"application/jsonl":    gomicroservicev1.ImportUsersRequest_NDJSON,
+}
+
+// registerImportHandler routes ImportUsers on the gateway, taking the data
+// as an upload. It takes precedence over the generated route, which expects
+// the requests of the stream as JSON.
+func registerImportHandler(
+	ctx context.Context,
+	mux *runtime.ServeMux,
+	endpoint string,
+	opts []grpc.DialOption,
+) error {
+	conn, err := grpc.NewClient(endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	client := gomicroservicev1.NewUserServiceClient(conn)
+
+	return mux.HandlePath(http.MethodPost, importPattern, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		annotated, err := runtime.AnnotateContext(ctx, mux, r,
+			gomicroservicev1.UserService_ImportUsers_FullMethodName,
+			runtime.WithHTTPPathPattern(importPattern),
+		)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		var md runtime.ServerMetadata
+		resp, err := importUsers(annotated, client, r,
+			grpc.Header(&md.HeaderMD),
+			grpc.Trailer(&md.TrailerMD),
+		)
+		annotated = runtime.NewServerMetadataContext(annotated, md)
+		if err != nil {
+			runtime.HTTPError(annotated, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(annotated, mux, outbound, w, r, resp, mux.GetForwardResponseOptions()...)
+	})
+}
+
+// importUsers streams an upload to ImportUsers in chunks. The options of the
+// import are taken from the query parameters.
+func importUsers(
+	ctx context.Context,
+	client gomicroservicev1.UserServiceClient,
+	r *http.Request,
+	opts ...grpc.CallOption,
+) (proto.Message, error) {
+	data, contentType, err := importUpload(r)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	first := &gomicroservicev1.ImportUsersRequest{}
+	if first.Format, err = importFormat(query.Get("format"), contentType); err != nil {
+		return nil, err
+	}
+	if query.Has("validate_only") {
+		if first.ValidateOnly, err = strconv.ParseBool(query.Get("validate_only")); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid validate_only: %v", err)
+		}
+	}
+
+	stream, err := client.ImportUsers(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	req := first
+	for {
+		// The chunks are sent as they are read, so each needs a buffer of its own
+		chunk := make([]byte, importChunkSize)
+		n, err := io.ReadFull(data, chunk)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to read upload: %v", err)
+		}
+		if n > 0 || req == first {
+			req.Data = chunk[:n]
+			// The server may end the stream early, and then tells why on CloseAndRecv
+			if sendErr := stream.Send(req); sendErr != nil {
+				break
+			}
+			req = &gomicroservicev1.ImportUsersRequest{}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// importUpload returns the data of an upload and its content type: either
+// the body of the request, or its first file if it is multipart/form-data.
+func importUpload(r *http.Request) (io.Reader, string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return r.Body, mediaType, nil //nolint:nilerr // A body without a content type is taken as is.
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", status.Errorf(codes.InvalidArgument, "invalid multipart body: %v", err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", status.Error(codes.InvalidArgument, "missing file in multipart body")
+		}
+		if err != nil {
+			return nil, "", status.Errorf(codes.InvalidArgument, "invalid multipart body: %v", err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		mediaType, _, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+		return part, mediaType, nil
+	}
+}
+
+// importFormat returns the format named by the format query parameter, or
+// else the format of the content type of the data.
+func importFormat(name, contentType string) (gomicroservicev1.ImportUsersRequest_Format, error) {
+	if name == "" {
+		return importFormats[contentType], nil
+	}
+	format, exists := gomicroservicev1.ImportUsersRequest_Format_value[strings.ToUpper(name)]
+	if !exists {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid format: %s", name)
+	}
+	return gomicroservicev1.ImportUsersRequest_Format(format), nil
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+// multipartBody returns a multipart/form-data body with a field, and a file
+// of the content type with the data unless data is empty, along with the
+// content type of the body.
+func multipartBody(t *testing.T, contentType, data string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	assert.NilError(t, writer.WriteField("note", "weekly export"))
+	if data != "" {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="users"`)
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		assert.NilError(t, err)
+		_, err = io.WriteString(part, data)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, writer.Close())
+	return buf.String(), writer.FormDataContentType()
+}
+
+func TestImportFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name, contentType string
+		want              gomicroservicev1.ImportUsersRequest_Format
+		wantErr           string
+	}{
+		{contentType: "text/csv", want: gomicroservicev1.ImportUsersRequest_CSV},
+		{contentType: "application/x-ndjson", want: gomicroservicev1.ImportUsersRequest_NDJSON},
+		{contentType: "application/ndjson", want: gomicroservicev1.ImportUsersRequest_NDJSON},
+		{contentType: "application/jsonl", want: gomicroservicev1.ImportUsersRequest_NDJSON},
+		{contentType: "application/json", want: gomicroservicev1.ImportUsersRequest_FORMAT_UNSPECIFIED},
+		{contentType: "", want: gomicroservicev1.ImportUsersRequest_FORMAT_UNSPECIFIED},
+		{name: "csv", contentType: "application/x-ndjson", want: gomicroservicev1.ImportUsersRequest_CSV},
+		{name: "NDJSON", contentType: "", want: gomicroservicev1.ImportUsersRequest_NDJSON},
+		{name: "xml", contentType: "text/csv", wantErr: "invalid format: xml"},
+	} {
+		t.Run(fmt.Sprintf("%q with %q", tt.name, tt.contentType), func(t *testing.T) {
+			t.Parallel()
+			got, err := importFormat(tt.name, tt.contentType)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestImportUpload(t *testing.T) {
+	t.Parallel()
+
+	multipartCSV, multipartType := multipartBody(t, "text/csv; charset=utf-8", "display_name,email\n")
+	withoutFile, withoutFileType := multipartBody(t, "", "")
+	for _, tt := range []struct {
+		name            string
+		contentType     string
+		body            string
+		wantData        string
+		wantContentType string
+		wantErr         string
+	}{
+		{
+			name:            "raw body",
+			contentType:     "text/csv; charset=utf-8",
+			body:            "display_name,email\n",
+			wantData:        "display_name,email\n",
+			wantContentType: "text/csv",
+		},
+		{
+			name:     "raw body without a content type",
+			body:     "display_name,email\n",
+			wantData: "display_name,email\n",
+		},
+		{
+			name:            "multipart body",
+			contentType:     multipartType,
+			body:            multipartCSV,
+			wantData:        "display_name,email\n",
+			wantContentType: "text/csv",
+		},
+		{
+			name:        "multipart body without a file",
+			contentType: withoutFileType,
+			body:        withoutFile,
+			wantErr:     "missing file in multipart body",
+		},
+		{
+			name:        "malformed multipart body",
+			contentType: "multipart/form-data; boundary=missing",
+			body:        "--missing\r\nnot a header\r\n\r\ndisplay_name,email\n",
+			wantErr:     "invalid multipart body",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodPost, importPattern, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			data, contentType, err := importUpload(req)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			got, err := io.ReadAll(data)
+			assert.NilError(t, err)
+			assert.Equal(t, string(got), tt.wantData)
+			assert.Equal(t, contentType, tt.wantContentType)
+		})
+	}
+}
+
+func TestImportHandler(t *testing.T) {
+	t.Parallel()
+
+	csvData := "display_name,email\nAda Lovelace,ada@example.com\nAlan Turing,alan@example.com\n"
+	ndjsonData := `{"displayName":"Ada Lovelace","email":"ada@example.com"}` + "\n" +
+		`{"displayName":"Alan Turing","email":"alan@example.com"}` + "\n"
+	multipartNDJSON, multipartType := multipartBody(t, "application/x-ndjson", ndjsonData)
+
+	// Data over several chunks, with a failed row in the last one
+	var large strings.Builder
+	large.WriteString("display_name,email\n")
+	for i := 0; large.Len() < 2*importChunkSize; i++ {
+		fmt.Fprintf(&large, "User %d,user%d@example.com\n", i, i)
+	}
+	large.WriteString("Ada Lovelace,not an email\n")
+	largeRows := strings.Count(large.String(), "\n") - 1
+
+	for _, tt := range []struct {
+		name         string
+		target       string
+		contentType  string
+		body         string
+		wantCode     int
+		wantImported int32
+		wantFailed   int32
+		wantUsers    int
+		wantErr      string
+	}{
+		{
+			name:         "csv body",
+			target:       importPattern,
+			contentType:  "text/csv",
+			body:         csvData,
+			wantCode:     http.StatusOK,
+			wantImported: 2,
+			wantUsers:    2,
+		},
+		{
+			name:         "ndjson file of a multipart body",
+			target:       importPattern,
+			contentType:  multipartType,
+			body:         multipartNDJSON,
+			wantCode:     http.StatusOK,
+			wantImported: 2,
+			wantUsers:    2,
+		},
+		{
+			name:         "format from the query",
+			target:       importPattern + "?format=ndjson",
+			contentType:  "text/plain",
+			body:         ndjsonData,
+			wantCode:     http.StatusOK,
+			wantImported: 2,
+			wantUsers:    2,
+		},
+		{
+			name:         "validate only",
+			target:       importPattern + "?validate_only=true",
+			contentType:  "text/csv",
+			body:         csvData,
+			wantCode:     http.StatusOK,
+			wantImported: 2,
+		},
+		{
+			name:         "data over several chunks",
+			target:       importPattern,
+			contentType:  "text/csv",
+			body:         large.String(),
+			wantCode:     http.StatusOK,
+			wantImported: int32(largeRows - 1), //nolint:gosec // The row count is small
+			wantFailed:   1,
+			wantUsers:    largeRows - 1,
+		},
+		{
+			name:        "unknown format",
+			target:      importPattern,
+			contentType: "application/json",
+			body:        ndjsonData,
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "missing required field: format",
+		},
+		{
+			name:        "invalid validate_only",
+			target:      importPattern + "?validate_only=maybe",
+			contentType: "text/csv",
+			body:        csvData,
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "invalid validate_only",
+		},
+		{
+			name:        "invalid data",
+			target:      importPattern,
+			contentType: "text/csv",
+			body:        "display_name\nAda Lovelace\n",
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "missing required column: email",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			gateway := newTestGateway(t)
+			resp := serve(t, gateway, http.MethodPost, tt.target, tt.body, http.Header{"Content-Type": {tt.contentType}})
+			if tt.wantErr != "" {
+				var got status.Status
+				decodeResponse(t, resp, tt.wantCode, &got)
+				assert.Assert(t, cmp.Contains(got.GetMessage(), tt.wantErr))
+				return
+			}
+			var got gomicroservicev1.ImportUsersResponse
+			decodeResponse(t, resp, tt.wantCode, &got)
+			assert.Equal(t, got.GetImportedCount(), tt.wantImported)
+			assert.Equal(t, got.GetFailedCount(), tt.wantFailed)
+
+			assert.Equal(t, countUsers(t, gateway), tt.wantUsers)
+		})
+	}
+}
+
+// countUsers counts the users that the gateway lists.
+func countUsers(t *testing.T, gateway http.Handler) int {
+	t.Helper()
+	count := 0
+	for pageToken := ""; ; {
+		var users gomicroservicev1.ListUsersResponse
+		resp := serve(t, gateway, http.MethodGet, "/v1/users?page_size=1000&page_token="+pageToken, "", nil)
+		decodeResponse(t, resp, http.StatusOK, &users)
+		count += len(users.GetUsers())
+		if pageToken = users.GetNextPageToken(); pageToken == "" {
+			return count
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+)
+
+// userCacheStats is the source of the user_cache metrics: the cache of the
+// most recently created gRPC server.
+//
+//nolint:gochecknoglobals // expvar variables are process-wide
+var (
+	userCacheStats   atomic.Pointer[db.CachedRepository]
+	publishUserCache sync.Once
+)
+
+// publishCacheStats exposes the hit, miss and eviction counts of a user cache
+// at /metrics, and as the user_cache expvar at /debug/vars in development.
+func publishCacheStats(cache *db.CachedRepository) {
+	userCacheStats.Store(cache)
+	publishUserCache.Do(func() {
+		expvar.Publish("user_cache", expvar.Func(func() any {
+			if cache := userCacheStats.Load(); cache != nil {
+				return cache.Stats()
+			}
+			return db.CacheStats{}
+		}))
+	})
+}
+
+// metrics are the metrics of the service that /metrics serves.
+type metrics struct {
+	UserCache *db.CacheStats `json:"user_cache,omitempty"` // Unset if the cache is disabled.
+}
+
+// metricsHandler serves the metrics of the service as JSON. Unlike
+// /debug/vars, they hold nothing about the process, so they are served in
+// production as well.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var current metrics
+	if cache := userCacheStats.Load(); cache != nil {
+		stats := cache.Stats()
+		current.UserCache = &stats
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(current)
+}
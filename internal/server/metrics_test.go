@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/config"
+	"github.com/fredrikaverpil/go-microservice/internal/core/domain"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"gotest.tools/v3/assert"
+)
+
+// The tests share the process-wide cache of the metrics and the environment,
+// so they don't run in parallel.
+func TestMetricsHandler(t *testing.T) {
+	t.Setenv("GO_ENV", config.EnvProduction)
+	previous := userCacheStats.Load()
+	t.Cleanup(func() { userCacheStats.Store(previous) })
+	gateway := newTestGateway(t)
+	get := func(t *testing.T) map[string]db.CacheStats {
+		t.Helper()
+		resp := serve(t, gateway, http.MethodGet, "/metrics", "", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json")
+		var got map[string]db.CacheStats
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&got))
+		return got
+	}
+
+	t.Run("without a cache", func(t *testing.T) {
+		userCacheStats.Store(nil)
+		assert.DeepEqual(t, get(t), map[string]db.CacheStats{})
+	})
+
+	t.Run("with a cache", func(t *testing.T) {
+		logger := slog.New(slog.DiscardHandler)
+		cache := db.NewCachedRepository(logger, db.NewMemoryRepository(logger), db.CacheOptions{Size: 10, NegativeTTL: time.Minute})
+		publishCacheStats(cache)
+		for range 2 {
+			_, err := cache.GetUser(t.Context(), "users/missing", domain.GetUserParams{})
+			assert.ErrorContains(t, err, "user not found")
+		}
+		assert.DeepEqual(t, get(t), map[string]db.CacheStats{"user_cache": {Hits: 1, Misses: 1}})
+	})
+
+	t.Run("only reads", func(t *testing.T) {
+		resp := serve(t, gateway, http.MethodPost, "/metrics", "", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
+		assert.Equal(t, resp.Header.Get("Allow"), "GET, HEAD")
+	})
+
+	t.Run("keeps the expvars to development", func(t *testing.T) {
+		resp := serve(t, gateway, http.MethodGet, "/debug/vars", "", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusNotFound)
+	})
+}
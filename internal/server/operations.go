@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// operationsCall calls a method of the Operations service for a request to
+// the gateway.
+type operationsCall func(
+	ctx context.Context,
+	client longrunningpb.OperationsClient,
+	r *http.Request,
+	inbound runtime.Marshaler,
+	name string,
+	opts ...grpc.CallOption,
+) (proto.Message, error)
+
+// registerOperationsHandler routes the google.longrunning.Operations service
+// on the gateway under /v1/operations, following the HTTP rules of
+// google/longrunning/operations.proto. WaitOperation has no rule there, so it
+// is routed as a custom method. No gateway code is generated for the service,
+// as its proto comes from googleapis, so the routes are registered by hand.
+func registerOperationsHandler(
+	ctx context.Context,
+	mux *runtime.ServeMux,
+	endpoint string,
+	opts []grpc.DialOption,
+) error {
+	conn, err := grpc.NewClient(endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	client := longrunningpb.NewOperationsClient(conn)
+
+	routes := []struct {
+		method, pattern, rpc string
+		call                 operationsCall
+	}{
+		{http.MethodGet, "/v1/{name=operations}", "ListOperations", listOperations},
+		{http.MethodGet, "/v1/{name=operations/*}", "GetOperation", getOperation},
+		{http.MethodDelete, "/v1/{name=operations/*}", "DeleteOperation", deleteOperation},
+		{http.MethodPost, "/v1/{name=operations/*}:cancel", "CancelOperation", cancelOperation},
+		{http.MethodPost, "/v1/{name=operations/*}:wait", "WaitOperation", waitOperation},
+	}
+	for _, route := range routes {
+		handler := operationsHandler(mux, client, route.pattern, route.rpc, route.call)
+		if err := mux.HandlePath(route.method, route.pattern, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// operationsHandler serves the requests to a route of the Operations service
+// the way generated gateway code does.
+func operationsHandler(
+	mux *runtime.ServeMux,
+	client longrunningpb.OperationsClient,
+	pattern, rpc string,
+	call operationsCall,
+) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		annotated, err := runtime.AnnotateContext(ctx, mux, r,
+			"/google.longrunning.Operations/"+rpc,
+			runtime.WithHTTPPathPattern(pattern),
+		)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		var md runtime.ServerMetadata
+		resp, err := call(annotated, client, r, inbound, params["name"],
+			grpc.Header(&md.HeaderMD),
+			grpc.Trailer(&md.TrailerMD),
+		)
+		annotated = runtime.NewServerMetadataContext(annotated, md)
+		if err != nil {
+			runtime.HTTPError(annotated, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(annotated, mux, outbound, w, r, resp, mux.GetForwardResponseOptions()...)
+	}
+}
+
+func listOperations(
+	ctx context.Context,
+	client longrunningpb.OperationsClient,
+	r *http.Request,
+	_ runtime.Marshaler,
+	name string,
+	opts ...grpc.CallOption,
+) (proto.Message, error) {
+	req := &longrunningpb.ListOperationsRequest{}
+	if err := r.ParseForm(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(req, r.Form, utilities.NewDoubleArray(nil)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	req.Name = name
+	return client.ListOperations(ctx, req, opts...)
+}
+
+func getOperation(
+	ctx context.Context,
+	client longrunningpb.OperationsClient,
+	_ *http.Request,
+	_ runtime.Marshaler,
+	name string,
+	opts ...grpc.CallOption,
+) (proto.Message, error) {
+	return client.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: name}, opts...)
+}
+
+func deleteOperation(
+	ctx context.Context,
+	client longrunningpb.OperationsClient,
+	_ *http.Request,
+	_ runtime.Marshaler,
+	name string,
+	opts ...grpc.CallOption,
+) (proto.Message, error) {
+	return client.DeleteOperation(ctx, &longrunningpb.DeleteOperationRequest{Name: name}, opts...)
+}
+
+func cancelOperation(
+	ctx context.Context,
+	client longrunningpb.OperationsClient,
+	r *http.Request,
+	inbound runtime.Marshaler,
+	name string,
+	opts ...grpc.CallOption,
+) (proto.Message, error) {
+	req := &longrunningpb.CancelOperationRequest{}
+	if err := decodeBody(r, inbound, req); err != nil {
+		return nil, err
+	}
+	req.Name = name
+	return client.CancelOperation(ctx, req, opts...)
+}
+
+func waitOperation(
+	ctx context.Context,
+	client longrunningpb.OperationsClient,
+	r *http.Request,
+	inbound runtime.Marshaler,
+	name string,
+	opts ...grpc.CallOption,
+) (proto.Message, error) {
+	req := &longrunningpb.WaitOperationRequest{}
+	if err := decodeBody(r, inbound, req); err != nil {
+		return nil, err
+	}
+	req.Name = name
+	return client.WaitOperation(ctx, req, opts...)
+}
+
+// decodeBody decodes the body of a request into req, if there is one.
+func decodeBody(r *http.Request, inbound runtime.Marshaler, req proto.Message) error {
+	if err := inbound.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return nil
+}
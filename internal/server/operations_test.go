@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gotest.tools/v3/assert"
+)
+
+func TestOperationsRoutes(t *testing.T) {
+	t.Parallel()
+
+	// setup returns a gateway with a purge operation that is done.
+	setup := func(t *testing.T) (http.Handler, *longrunningpb.Operation) {
+		t.Helper()
+		gateway := newTestGateway(t)
+		createUser(t, gateway, "ada-lovelace")
+		var op longrunningpb.Operation
+		resp := serve(t, gateway, http.MethodPost, "/v1/users:purge", `{"filter":"display_name = \"nobody\""}`, nil)
+		decodeResponse(t, resp, http.StatusOK, &op)
+		assert.Assert(t, strings.HasPrefix(op.GetName(), "operations/"))
+		return gateway, &op
+	}
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+		gateway, op := setup(t)
+		var got longrunningpb.ListOperationsResponse
+		decodeResponse(t, serve(t, gateway, http.MethodGet, "/v1/operations", "", nil), http.StatusOK, &got)
+		assert.Equal(t, len(got.GetOperations()), 1)
+		assert.Equal(t, got.GetOperations()[0].GetName(), op.GetName())
+
+		// Query parameters are passed on
+		target := "/v1/operations?filter=" + url.QueryEscape("NOT done")
+		decodeResponse(t, serve(t, gateway, http.MethodGet, target, "", nil), http.StatusOK, &got)
+		assert.Equal(t, len(got.GetOperations()), 0)
+		decodeResponse(t, serve(t, gateway, http.MethodGet, "/v1/operations?filter=(", "", nil),
+			http.StatusBadRequest, &status.Status{})
+	})
+
+	t.Run("get", func(t *testing.T) {
+		t.Parallel()
+		gateway, op := setup(t)
+		var got longrunningpb.Operation
+		decodeResponse(t, serve(t, gateway, http.MethodGet, "/v1/"+op.GetName(), "", nil), http.StatusOK, &got)
+		assert.Equal(t, got.GetName(), op.GetName())
+		assert.Assert(t, got.GetDone())
+		decodeResponse(t, serve(t, gateway, http.MethodGet, "/v1/operations/missing", "", nil),
+			http.StatusNotFound, &status.Status{})
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		t.Parallel()
+		gateway, op := setup(t)
+		var got longrunningpb.Operation
+		resp := serve(t, gateway, http.MethodPost, "/v1/"+op.GetName()+":wait", `{"timeout":"1s"}`, nil)
+		decodeResponse(t, resp, http.StatusOK, &got)
+		assert.Assert(t, got.GetDone())
+		// The body is optional
+		resp = serve(t, gateway, http.MethodPost, "/v1/"+op.GetName()+":wait", "", nil)
+		decodeResponse(t, resp, http.StatusOK, &got)
+		resp = serve(t, gateway, http.MethodPost, "/v1/"+op.GetName()+":wait", `{"timeout":`, nil)
+		decodeResponse(t, resp, http.StatusBadRequest, &status.Status{})
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+		gateway, op := setup(t)
+		// Cancelling an operation that is done does nothing
+		resp := serve(t, gateway, http.MethodPost, "/v1/"+op.GetName()+":cancel", "{}", nil)
+		decodeResponse(t, resp, http.StatusOK, &emptypb.Empty{})
+		var got longrunningpb.Operation
+		decodeResponse(t, serve(t, gateway, http.MethodGet, "/v1/"+op.GetName(), "", nil), http.StatusOK, &got)
+		assert.Assert(t, got.GetError() == nil)
+		resp = serve(t, gateway, http.MethodPost, "/v1/operations/missing:cancel", "", nil)
+		decodeResponse(t, resp, http.StatusNotFound, &status.Status{})
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		gateway, op := setup(t)
+		decodeResponse(t, serve(t, gateway, http.MethodDelete, "/v1/"+op.GetName(), "", nil),
+			http.StatusOK, &emptypb.Empty{})
+		decodeResponse(t, serve(t, gateway, http.MethodGet, "/v1/"+op.GetName(), "", nil),
+			http.StatusNotFound, &status.Status{})
+		decodeResponse(t, serve(t, gateway, http.MethodDelete, "/v1/"+op.GetName(), "", nil),
+			http.StatusNotFound, &status.Status{})
+	})
+}
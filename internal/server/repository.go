@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fredrikaverpil/go-microservice/internal/config"
+	"github.com/fredrikaverpil/go-microservice/internal/core/port"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+)
+
+// newUserRepository returns the user repository selected by configuration,
+// the operation store kept along with it, and a function that releases both
+// on shutdown.
+func newUserRepository(logger *slog.Logger) (port.UserRepository, port.OperationStore, func() error, error) {
+	repo, operations, closeRepo, err := openUserRepository(logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if keeper, ok := repo.(historyKeeper); ok {
+		keeper.SetHistoryWindow(config.GetUserHistoryWindow())
+	}
+	if keeper, ok := repo.(revisionKeeper); ok {
+		keeper.SetRevisionRetention(config.GetUserRevisionRetention())
+	}
+	return repo, operations, closeRepo, nil
+}
+
+// historyKeeper is implemented by repositories that keep past versions of
+// users for reads at a point in time.
+type historyKeeper interface {
+	SetHistoryWindow(window time.Duration)
+}
+
+// revisionKeeper is implemented by repositories that keep replaced revisions
+// of users.
+type revisionKeeper interface {
+	SetRevisionRetention(retention time.Duration)
+}
+
+// openUserRepository opens the user repository selected by configuration,
+// with an operation store that persists like it: in the same directory or
+// database.
+func openUserRepository(logger *slog.Logger) (port.UserRepository, port.OperationStore, func() error, error) {
+	switch store := config.GetUserStore(); store {
+	case config.UserStoreMemory:
+		operations := db.NewMemoryOperationStore()
+		if shards := config.GetUserStoreShards(); shards > 1 {
+			return db.NewShardedRepository(logger, shards), operations, func() error { return nil }, nil
+		}
+		return db.NewMemoryRepository(logger), operations, func() error { return nil }, nil
+	case config.UserStoreFile:
+		syncPolicy, err := db.ParseSyncPolicy(config.GetUserStoreSync())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		repo, err := db.NewFileRepository(logger, db.FileOptions{
+			Dir:              config.GetUserStoreDir(),
+			Sync:             syncPolicy,
+			SyncInterval:     config.GetUserStoreSyncInterval(),
+			SnapshotInterval: config.GetUserStoreSnapshotInterval(),
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		operations, err := db.NewFileOperationStore(filepath.Join(config.GetUserStoreDir(), operationsFileName))
+		if err != nil {
+			return nil, nil, nil, errors.Join(err, repo.Close())
+		}
+		return repo, operations, repo.Close, nil
+	case config.UserStoreSQLite, config.UserStorePostgres:
+		database, dialect, err := openUserDatabase()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		repo, err := db.NewSQLRepository(context.Background(), logger, database, dialect)
+		if err != nil {
+			_ = database.Close()
+			return nil, nil, nil, err
+		}
+		return repo, db.NewSQLOperationStore(database, dialect), repo.Close, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown user store: %q", store)
+	}
+}
+
+// operationsFileName is the file that operations are kept in, in the
+// directory of the file user store.
+const operationsFileName = "operations.json"
+
+// NewUserMigrator returns a migrator for the SQL user store selected by
+// configuration, and a function that closes its database.
+func NewUserMigrator(logger *slog.Logger) (*db.Migrator, func() error, error) {
+	database, dialect, err := openUserDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+	migrator, err := db.NewMigrator(logger, database, dialect)
+	if err != nil {
+		_ = database.Close()
+		return nil, nil, err
+	}
+	return migrator, database.Close, nil
+}
+
+// openUserDatabase opens the database of the SQL user store selected by
+// configuration, creating the directory of a SQLite database file.
+func openUserDatabase() (*sql.DB, db.Dialect, error) {
+	dialect, err := db.ParseDialect(config.GetUserStore())
+	if err != nil {
+		return nil, "", fmt.Errorf("user store is not a SQL database: %w", err)
+	}
+	dsn := config.GetUserStoreDSN()
+	if dialect == db.DialectSQLite && !strings.HasPrefix(dsn, "file:") && dsn != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(dsn), 0o700); err != nil {
+			return nil, "", fmt.Errorf("create database directory: %w", err)
+		}
+	}
+	database, err := db.OpenSQL(dialect, dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	return database, dialect, nil
+}
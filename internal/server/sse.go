@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventStreamType is the media type of Server-Sent Events.
+const eventStreamType = "text/event-stream"
+
+// sseMarshaler writes the responses of server-streaming methods as
+// Server-Sent Events, for requests that accept text/event-stream. Every
+// message is an event with the JSON of the message as data, and errors are
+// events of type "error". Watch responses carry their resume token as the
+// event ID, which browsers send back as Last-Event-ID when they reconnect.
+type sseMarshaler struct {
+	runtime.JSONPb
+}
+
+func newSSEMarshaler() *sseMarshaler {
+	return &sseMarshaler{JSONPb: runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}}
+}
+
+func (m *sseMarshaler) ContentType(_ interface{}) string {
+	return eventStreamType
+}
+
+// Marshal returns a complete event, so that errors written outside of a
+// stream are events as well.
+func (m *sseMarshaler) Marshal(v interface{}) ([]byte, error) {
+	eventType := ""
+	switch chunk := v.(type) {
+	case map[string]interface{}:
+		// A message of the stream
+		v = chunk["result"]
+	case map[string]proto.Message:
+		// An error that ended the stream
+		eventType, v = "error", chunk["error"]
+	case proto.Message:
+		// An error before the stream started
+		eventType = "error"
+	}
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if resp, ok := v.(*gomicroservicev1.WatchUsersResponse); ok && resp.GetResumeToken() != "" {
+		buf.WriteString("id: " + resp.GetResumeToken() + "\n")
+	}
+	if eventType != "" {
+		buf.WriteString("event: " + eventType + "\n")
+	}
+	// Data can't span lines without a field name on each line
+	for line := range bytes.Lines(data) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\n")))
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// Delimiter is empty, as every event ends itself.
+func (m *sseMarshaler) Delimiter() []byte {
+	return nil
+}
+
+// acceptsEventStream reports whether a request asks for Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), eventStreamType)
+}
+
+// lastEventIDToResumeToken passes the Last-Event-ID header of a reconnecting
+// event stream on as the resume_token query parameter, unless the request
+// already has one.
+func lastEventIDToResumeToken(r *http.Request) *http.Request {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	query := r.URL.Query()
+	if lastEventID == "" || query.Has("resume_token") {
+		return r
+	}
+	query.Set("resume_token", lastEventID)
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	return r
+}
+
+// serveEventStream serves a request for Server-Sent Events. The stream is
+// ended when the server shuts down, since it would otherwise never end.
+func serveEventStream(shutdown context.Context, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(shutdown, cancel)
+	defer stop()
+
+	// The gateway picks the marshaler by an exact match of the Accept header
+	r = r.Clone(ctx)
+	r.Header.Set("Accept", eventStreamType)
+	w.Header().Set("Cache-Control", "no-cache")
+	next.ServeHTTP(w, lastEventIDToResumeToken(r))
+}
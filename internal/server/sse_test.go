@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gomicroservicev1 "github.com/fredrikaverpil/go-microservice/internal/gen/gomicroservice/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+// sseEvent is an event of a stream of Server-Sent Events.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvent reads the next event of a stream, with the lines of its data
+// joined.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		assert.NilError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			event.data = strings.Join(data, "\n")
+			return event
+		}
+		field, value, found := strings.Cut(line, ": ")
+		assert.Assert(t, found, "line without a field: %q", line)
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			data = append(data, value)
+		default:
+			t.Fatalf("unexpected field: %q", line)
+		}
+	}
+}
+
+func TestSSEMarshaler(t *testing.T) {
+	t.Parallel()
+
+	created := &gomicroservicev1.WatchUsersResponse{
+		ChangeType:  gomicroservicev1.WatchUsersResponse_CREATED,
+		User:        &gomicroservicev1.User{Name: "users/ada-lovelace", DisplayName: "Ada Lovelace"},
+		ResumeToken: "token-1",
+	}
+	existing := &gomicroservicev1.WatchUsersResponse{
+		ChangeType: gomicroservicev1.WatchUsersResponse_EXISTING,
+		User:       &gomicroservicev1.User{Name: "users/ada-lovelace"},
+	}
+	failed := &status.Status{Code: int32(codes.InvalidArgument), Message: "invalid resume token"}
+	for _, tt := range []struct {
+		name      string
+		indent    string
+		value     any
+		want      sseEvent
+		wantValue proto.Message
+	}{
+		{
+			name:      "message with a resume token",
+			value:     map[string]any{"result": created},
+			want:      sseEvent{id: "token-1"},
+			wantValue: created,
+		},
+		{
+			name:      "message without a resume token",
+			value:     map[string]any{"result": existing},
+			wantValue: existing,
+		},
+		{
+			name:      "message over several lines",
+			indent:    "  ",
+			value:     map[string]any{"result": created},
+			want:      sseEvent{id: "token-1"},
+			wantValue: created,
+		},
+		{
+			name:      "error that ended the stream",
+			value:     map[string]proto.Message{"error": failed},
+			want:      sseEvent{event: "error"},
+			wantValue: failed,
+		},
+		{
+			name:      "error before the stream started",
+			value:     failed,
+			want:      sseEvent{event: "error"},
+			wantValue: failed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			marshaler := newSSEMarshaler()
+			marshaler.Indent = tt.indent
+			data, err := marshaler.Marshal(tt.value)
+			assert.NilError(t, err)
+			assert.Assert(t, strings.HasSuffix(string(data), "\n\n"), "event not ended: %q", data)
+			if tt.indent != "" {
+				assert.Assert(t, strings.Count(string(data), "data: ") > 1, "data on one line: %q", data)
+			}
+
+			got := readEvent(t, bufio.NewReader(strings.NewReader(string(data))))
+			assert.Equal(t, got.id, tt.want.id)
+			assert.Equal(t, got.event, tt.want.event)
+			gotValue := tt.wantValue.ProtoReflect().New().Interface()
+			assert.NilError(t, protojson.Unmarshal([]byte(got.data), gotValue))
+			assert.Assert(t, proto.Equal(gotValue, tt.wantValue), "got %v", gotValue)
+		})
+	}
+}
+
+func TestLastEventIDToResumeToken(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name, target, lastEventID string
+		want                      string
+	}{
+		{name: "without Last-Event-ID", target: "/v1/users:watch", want: ""},
+		{name: "with Last-Event-ID", target: "/v1/users:watch", lastEventID: "token-1", want: "token-1"},
+		{
+			name:        "with a resume token already",
+			target:      "/v1/users:watch?resume_token=token-2",
+			lastEventID: "token-1",
+			want:        "token-2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			got := lastEventIDToResumeToken(req)
+			assert.Equal(t, got.URL.Query().Get("resume_token"), tt.want)
+			// The request of the caller isn't changed
+			assert.Equal(t, req.URL.String(), tt.target)
+		})
+	}
+}
+
+func TestServeEventStream(t *testing.T) {
+	t.Parallel()
+
+	// watch starts a watch of users as Server-Sent Events, and returns its
+	// response, which is closed with the test.
+	watch := func(t *testing.T, url, lastEventID string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+		assert.NilError(t, err)
+		req.Header.Set("Accept", "text/event-stream, */*")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+	decodeChange := func(t *testing.T, event sseEvent) *gomicroservicev1.WatchUsersResponse {
+		t.Helper()
+		assert.Equal(t, event.event, "")
+		change := &gomicroservicev1.WatchUsersResponse{}
+		assert.NilError(t, protojson.Unmarshal([]byte(event.data), change))
+		return change
+	}
+
+	t.Run("streams changes, and resumes after Last-Event-ID", func(t *testing.T) {
+		t.Parallel()
+		gateway := newTestGateway(t)
+		server := httptest.NewServer(gateway)
+		t.Cleanup(server.Close)
+		createUser(t, gateway, "ada-lovelace")
+
+		resp := watch(t, server.URL+"/v1/users:watch", "")
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+		assert.Equal(t, resp.Header.Get("Content-Type"), "text/event-stream")
+		assert.Equal(t, resp.Header.Get("Cache-Control"), "no-cache")
+		events := bufio.NewReader(resp.Body)
+
+		// The users of the snapshot have no ID, as a watch can't resume in it
+		event := readEvent(t, events)
+		assert.Equal(t, event.id, "")
+		assert.Equal(t, decodeChange(t, event).GetUser().GetName(), "users/ada-lovelace")
+		event = readEvent(t, events)
+		assert.Equal(t, decodeChange(t, event).GetChangeType(), gomicroservicev1.WatchUsersResponse_SNAPSHOT_COMPLETE)
+		assert.Assert(t, event.id != "")
+
+		createUser(t, gateway, "alan-turing")
+		event = readEvent(t, events)
+		created := decodeChange(t, event)
+		assert.Equal(t, created.GetChangeType(), gomicroservicev1.WatchUsersResponse_CREATED)
+		assert.Equal(t, created.GetUser().GetName(), "users/alan-turing")
+		assert.Equal(t, event.id, created.GetResumeToken())
+
+		// A reconnecting browser gets the changes after the last event it got
+		createUser(t, gateway, "grace-hopper")
+		resumed := bufio.NewReader(watch(t, server.URL+"/v1/users:watch", event.id).Body)
+		event = readEvent(t, resumed)
+		created = decodeChange(t, event)
+		assert.Equal(t, created.GetChangeType(), gomicroservicev1.WatchUsersResponse_CREATED)
+		assert.Equal(t, created.GetUser().GetName(), "users/grace-hopper")
+		assert.Equal(t, event.id, created.GetResumeToken())
+	})
+
+	t.Run("streams errors as error events", func(t *testing.T) {
+		t.Parallel()
+		gateway := newTestGateway(t)
+		server := httptest.NewServer(gateway)
+		t.Cleanup(server.Close)
+
+		resp := watch(t, server.URL+"/v1/users:watch", "not-a-token")
+		event := readEvent(t, bufio.NewReader(resp.Body))
+		assert.Equal(t, event.event, "error")
+		var got status.Status
+		assert.NilError(t, protojson.Unmarshal([]byte(event.data), &got))
+		assert.Equal(t, codes.Code(got.GetCode()), codes.InvalidArgument)
+		_, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+	})
+
+	t.Run("ends streams on shutdown", func(t *testing.T) {
+		t.Parallel()
+		shutdown, cancel := context.WithCancel(context.Background())
+		ended := make(chan struct{})
+		next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			cancel()
+			<-r.Context().Done()
+			close(ended)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/v1/users:watch", nil)
+		serveEventStream(shutdown, next, httptest.NewRecorder(), req)
+		<-ended
+	})
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 
 	"github.com/bufbuild/protovalidate-go"
+	"github.com/fredrikaverpil/go-microservice/internal/config"
 	"github.com/fredrikaverpil/go-microservice/internal/core/service"
 	"github.com/fredrikaverpil/go-microservice/internal/inbound/handler/grpc/gomicroservice"
 	"github.com/fredrikaverpil/go-microservice/internal/outbound/db"
+	"github.com/fredrikaverpil/go-microservice/internal/outbound/event"
 )
 
 type fixture struct {
@@ -28,8 +30,18 @@ func newFixture() *fixture {
 	}
 
 	userRepo := db.NewMemoryRepository(logger)
-	userService := service.NewUserService(logger, userRepo)
-	userHandler := gomicroservice.NewGRPCHandler(userService, validator)
+	userFeed := event.NewFeed(config.DefaultUserWatchHistory)
+	userService := service.NewUserService(
+		logger,
+		userRepo,
+		userFeed,
+		service.NewOperations(logger, db.NewMemoryOperationStore(), service.OperationsOptions{
+			Concurrency: config.DefaultOperationConcurrency,
+			Retention:   config.DefaultOperationRetention,
+		}),
+		config.DefaultUserRetention,
+	)
+	userHandler := gomicroservice.NewGRPCHandler(userService, validator, config.DefaultUserBatchLimit)
 
 	return &fixture{
 		userHandler: userHandler,
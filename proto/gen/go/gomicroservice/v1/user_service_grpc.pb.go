@@ -7,6 +7,7 @@
 package gomicroservicev1
 
 import (
+	longrunningpb "cloud.google.com/go/longrunning/autogen/longrunningpb"
 	context "context"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -20,11 +21,21 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	UserService_CreateUser_FullMethodName = "/gomicroservice.v1.UserService/CreateUser"
-	UserService_GetUser_FullMethodName    = "/gomicroservice.v1.UserService/GetUser"
-	UserService_ListUsers_FullMethodName  = "/gomicroservice.v1.UserService/ListUsers"
-	UserService_UpdateUser_FullMethodName = "/gomicroservice.v1.UserService/UpdateUser"
-	UserService_DeleteUser_FullMethodName = "/gomicroservice.v1.UserService/DeleteUser"
+	UserService_CreateUser_FullMethodName        = "/gomicroservice.v1.UserService/CreateUser"
+	UserService_GetUser_FullMethodName           = "/gomicroservice.v1.UserService/GetUser"
+	UserService_BatchCreateUsers_FullMethodName  = "/gomicroservice.v1.UserService/BatchCreateUsers"
+	UserService_BatchGetUsers_FullMethodName     = "/gomicroservice.v1.UserService/BatchGetUsers"
+	UserService_ListUsers_FullMethodName         = "/gomicroservice.v1.UserService/ListUsers"
+	UserService_UpdateUser_FullMethodName        = "/gomicroservice.v1.UserService/UpdateUser"
+	UserService_BatchUpdateUsers_FullMethodName  = "/gomicroservice.v1.UserService/BatchUpdateUsers"
+	UserService_DeleteUser_FullMethodName        = "/gomicroservice.v1.UserService/DeleteUser"
+	UserService_BatchDeleteUsers_FullMethodName  = "/gomicroservice.v1.UserService/BatchDeleteUsers"
+	UserService_ImportUsers_FullMethodName       = "/gomicroservice.v1.UserService/ImportUsers"
+	UserService_PurgeUsers_FullMethodName        = "/gomicroservice.v1.UserService/PurgeUsers"
+	UserService_UndeleteUser_FullMethodName      = "/gomicroservice.v1.UserService/UndeleteUser"
+	UserService_ListUserRevisions_FullMethodName = "/gomicroservice.v1.UserService/ListUserRevisions"
+	UserService_RollbackUser_FullMethodName      = "/gomicroservice.v1.UserService/RollbackUser"
+	UserService_WatchUsers_FullMethodName        = "/gomicroservice.v1.UserService/WatchUsers"
 )
 
 // UserServiceClient is the client API for UserService service.
@@ -41,6 +52,20 @@ type UserServiceClient interface {
 	//
 	// This follows the AIP-131 standard for Get methods.
 	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Creates several users at once.
+	//
+	// This follows the AIP-233 standard for Batch Create methods. By default
+	// the batch is atomic: either all users are created, or the request fails
+	// with the error of the first user that couldn't be. With best_effort,
+	// every user that can be created is, and the response holds the status of
+	// each request.
+	BatchCreateUsers(ctx context.Context, in *BatchCreateUsersRequest, opts ...grpc.CallOption) (*BatchCreateUsersResponse, error)
+	// Gets several users at once.
+	//
+	// This follows the AIP-231 standard for Batch Get methods. The users are
+	// returned in the order of the names. If any user is missing the request
+	// fails with NOT_FOUND, unless skip_missing is set.
+	BatchGetUsers(ctx context.Context, in *BatchGetUsersRequest, opts ...grpc.CallOption) (*BatchGetUsersResponse, error)
 	// Lists users.
 	//
 	// This follows the AIP-132 standard for List methods.
@@ -49,10 +74,77 @@ type UserServiceClient interface {
 	//
 	// This follows the AIP-134 standard for Update methods.
 	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Updates several users at once.
+	//
+	// This follows the AIP-234 standard for Batch Update methods. Every request
+	// carries its own update_mask and etag. The batch is atomic: either all
+	// users are updated, or the request fails with the error of the first
+	// request that couldn't be applied.
+	BatchUpdateUsers(ctx context.Context, in *BatchUpdateUsersRequest, opts ...grpc.CallOption) (*BatchUpdateUsersResponse, error)
 	// Deletes a user.
 	//
-	// This follows the AIP-135 standard for Delete methods.
+	// This follows the AIP-135 standard for Delete methods. Users are soft
+	// deleted following AIP-164, and purged once their purge_time has passed.
 	DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Deletes several users at once.
+	//
+	// This follows the AIP-235 standard for Batch Delete methods. The batch is
+	// atomic: either all users are soft deleted, or the request fails with the
+	// error of the first request that couldn't be applied.
+	BatchDeleteUsers(ctx context.Context, in *BatchDeleteUsersRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Creates users from CSV or NDJSON data.
+	//
+	// The data is streamed in chunks, which are joined in the order they are
+	// sent. The format and validate_only are read from the first request. Every
+	// row is validated like the user of a CreateUser request, and the users
+	// are created in batches. Rows that fail don't stop the import, and the
+	// response lists their errors by line. With validate_only, nothing is
+	// written, and the response tells what the import would do.
+	//
+	// The HTTP gateway takes the data as the body of the request, or as the
+	// first file of a multipart/form-data body. The format is taken from the
+	// `format` query parameter, or else from the content type of the data:
+	// `text/csv` or `application/x-ndjson`.
+	ImportUsers(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImportUsersRequest, ImportUsersResponse], error)
+	// Permanently deletes the soft-deleted users that match a filter.
+	//
+	// This follows the AIP-165 standard for Criteria-based Delete methods.
+	// Unless force is set, nothing is deleted and the returned operation is
+	// done at once, with the number of users that would be purged and a sample
+	// of their names. With force, the users are purged in the background, and
+	// the metadata of the operation tracks the progress.
+	PurgeUsers(ctx context.Context, in *PurgeUsersRequest, opts ...grpc.CallOption) (*longrunningpb.Operation, error)
+	// Restores a soft-deleted user.
+	//
+	// This follows the AIP-164 standard for Undelete methods.
+	UndeleteUser(ctx context.Context, in *UndeleteUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Lists the revisions of a user, newest first.
+	//
+	// This follows the AIP-162 standard for resource revisions. Every change
+	// to a user creates a revision, named users/{user_id}@{revision_id}.
+	// Revisions are kept for a limited time after they were replaced, also
+	// once the user has been purged.
+	ListUserRevisions(ctx context.Context, in *ListUserRevisionsRequest, opts ...grpc.CallOption) (*ListUserRevisionsResponse, error)
+	// Restores the display name and email of a prior revision of a user, as a
+	// new revision.
+	//
+	// This follows the AIP-162 standard for Rollback methods.
+	RollbackUser(ctx context.Context, in *RollbackUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Watches users for changes.
+	//
+	// The stream starts with a snapshot: a response of type EXISTING for every
+	// user that isn't deleted, followed by one of type SNAPSHOT_COMPLETE. It
+	// then sends a response for every change to a user, in the order of the
+	// changes of each user. A change may be sent more than once, and the
+	// revision_id of the user tells repeats apart.
+	//
+	// Every change carries a resume token, which continues the watch after it
+	// once passed back as `resume_token`. Only recent changes are kept, and
+	// tokens issued before the server restarted can't be resumed from, so an
+	// expired token fails with FAILED_PRECONDITION and the watch has to start
+	// over with a snapshot. The HTTP gateway also serves the stream as
+	// Server-Sent Events, when the request accepts `text/event-stream`.
+	WatchUsers(ctx context.Context, in *WatchUsersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchUsersResponse], error)
 }
 
 type userServiceClient struct {
@@ -83,6 +175,26 @@ func (c *userServiceClient) GetUser(ctx context.Context, in *GetUserRequest, opt
 	return out, nil
 }
 
+func (c *userServiceClient) BatchCreateUsers(ctx context.Context, in *BatchCreateUsersRequest, opts ...grpc.CallOption) (*BatchCreateUsersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchCreateUsersResponse)
+	err := c.cc.Invoke(ctx, UserService_BatchCreateUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) BatchGetUsers(ctx context.Context, in *BatchGetUsersRequest, opts ...grpc.CallOption) (*BatchGetUsersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetUsersResponse)
+	err := c.cc.Invoke(ctx, UserService_BatchGetUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *userServiceClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(ListUsersResponse)
@@ -103,6 +215,16 @@ func (c *userServiceClient) UpdateUser(ctx context.Context, in *UpdateUserReques
 	return out, nil
 }
 
+func (c *userServiceClient) BatchUpdateUsers(ctx context.Context, in *BatchUpdateUsersRequest, opts ...grpc.CallOption) (*BatchUpdateUsersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchUpdateUsersResponse)
+	err := c.cc.Invoke(ctx, UserService_BatchUpdateUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *userServiceClient) DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(emptypb.Empty)
@@ -113,6 +235,88 @@ func (c *userServiceClient) DeleteUser(ctx context.Context, in *DeleteUserReques
 	return out, nil
 }
 
+func (c *userServiceClient) BatchDeleteUsers(ctx context.Context, in *BatchDeleteUsersRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, UserService_BatchDeleteUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ImportUsers(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImportUsersRequest, ImportUsersResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[0], UserService_ImportUsers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ImportUsersRequest, ImportUsersResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_ImportUsersClient = grpc.ClientStreamingClient[ImportUsersRequest, ImportUsersResponse]
+
+func (c *userServiceClient) PurgeUsers(ctx context.Context, in *PurgeUsersRequest, opts ...grpc.CallOption) (*longrunningpb.Operation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(longrunningpb.Operation)
+	err := c.cc.Invoke(ctx, UserService_PurgeUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) UndeleteUser(ctx context.Context, in *UndeleteUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, UserService_UndeleteUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ListUserRevisions(ctx context.Context, in *ListUserRevisionsRequest, opts ...grpc.CallOption) (*ListUserRevisionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListUserRevisionsResponse)
+	err := c.cc.Invoke(ctx, UserService_ListUserRevisions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) RollbackUser(ctx context.Context, in *RollbackUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, UserService_RollbackUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) WatchUsers(ctx context.Context, in *WatchUsersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchUsersResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[1], UserService_WatchUsers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchUsersRequest, WatchUsersResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_WatchUsersClient = grpc.ServerStreamingClient[WatchUsersResponse]
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility.
@@ -127,6 +331,20 @@ type UserServiceServer interface {
 	//
 	// This follows the AIP-131 standard for Get methods.
 	GetUser(context.Context, *GetUserRequest) (*User, error)
+	// Creates several users at once.
+	//
+	// This follows the AIP-233 standard for Batch Create methods. By default
+	// the batch is atomic: either all users are created, or the request fails
+	// with the error of the first user that couldn't be. With best_effort,
+	// every user that can be created is, and the response holds the status of
+	// each request.
+	BatchCreateUsers(context.Context, *BatchCreateUsersRequest) (*BatchCreateUsersResponse, error)
+	// Gets several users at once.
+	//
+	// This follows the AIP-231 standard for Batch Get methods. The users are
+	// returned in the order of the names. If any user is missing the request
+	// fails with NOT_FOUND, unless skip_missing is set.
+	BatchGetUsers(context.Context, *BatchGetUsersRequest) (*BatchGetUsersResponse, error)
 	// Lists users.
 	//
 	// This follows the AIP-132 standard for List methods.
@@ -135,10 +353,77 @@ type UserServiceServer interface {
 	//
 	// This follows the AIP-134 standard for Update methods.
 	UpdateUser(context.Context, *UpdateUserRequest) (*User, error)
+	// Updates several users at once.
+	//
+	// This follows the AIP-234 standard for Batch Update methods. Every request
+	// carries its own update_mask and etag. The batch is atomic: either all
+	// users are updated, or the request fails with the error of the first
+	// request that couldn't be applied.
+	BatchUpdateUsers(context.Context, *BatchUpdateUsersRequest) (*BatchUpdateUsersResponse, error)
 	// Deletes a user.
 	//
-	// This follows the AIP-135 standard for Delete methods.
+	// This follows the AIP-135 standard for Delete methods. Users are soft
+	// deleted following AIP-164, and purged once their purge_time has passed.
 	DeleteUser(context.Context, *DeleteUserRequest) (*emptypb.Empty, error)
+	// Deletes several users at once.
+	//
+	// This follows the AIP-235 standard for Batch Delete methods. The batch is
+	// atomic: either all users are soft deleted, or the request fails with the
+	// error of the first request that couldn't be applied.
+	BatchDeleteUsers(context.Context, *BatchDeleteUsersRequest) (*emptypb.Empty, error)
+	// Creates users from CSV or NDJSON data.
+	//
+	// The data is streamed in chunks, which are joined in the order they are
+	// sent. The format and validate_only are read from the first request. Every
+	// row is validated like the user of a CreateUser request, and the users
+	// are created in batches. Rows that fail don't stop the import, and the
+	// response lists their errors by line. With validate_only, nothing is
+	// written, and the response tells what the import would do.
+	//
+	// The HTTP gateway takes the data as the body of the request, or as the
+	// first file of a multipart/form-data body. The format is taken from the
+	// `format` query parameter, or else from the content type of the data:
+	// `text/csv` or `application/x-ndjson`.
+	ImportUsers(grpc.ClientStreamingServer[ImportUsersRequest, ImportUsersResponse]) error
+	// Permanently deletes the soft-deleted users that match a filter.
+	//
+	// This follows the AIP-165 standard for Criteria-based Delete methods.
+	// Unless force is set, nothing is deleted and the returned operation is
+	// done at once, with the number of users that would be purged and a sample
+	// of their names. With force, the users are purged in the background, and
+	// the metadata of the operation tracks the progress.
+	PurgeUsers(context.Context, *PurgeUsersRequest) (*longrunningpb.Operation, error)
+	// Restores a soft-deleted user.
+	//
+	// This follows the AIP-164 standard for Undelete methods.
+	UndeleteUser(context.Context, *UndeleteUserRequest) (*User, error)
+	// Lists the revisions of a user, newest first.
+	//
+	// This follows the AIP-162 standard for resource revisions. Every change
+	// to a user creates a revision, named users/{user_id}@{revision_id}.
+	// Revisions are kept for a limited time after they were replaced, also
+	// once the user has been purged.
+	ListUserRevisions(context.Context, *ListUserRevisionsRequest) (*ListUserRevisionsResponse, error)
+	// Restores the display name and email of a prior revision of a user, as a
+	// new revision.
+	//
+	// This follows the AIP-162 standard for Rollback methods.
+	RollbackUser(context.Context, *RollbackUserRequest) (*User, error)
+	// Watches users for changes.
+	//
+	// The stream starts with a snapshot: a response of type EXISTING for every
+	// user that isn't deleted, followed by one of type SNAPSHOT_COMPLETE. It
+	// then sends a response for every change to a user, in the order of the
+	// changes of each user. A change may be sent more than once, and the
+	// revision_id of the user tells repeats apart.
+	//
+	// Every change carries a resume token, which continues the watch after it
+	// once passed back as `resume_token`. Only recent changes are kept, and
+	// tokens issued before the server restarted can't be resumed from, so an
+	// expired token fails with FAILED_PRECONDITION and the watch has to start
+	// over with a snapshot. The HTTP gateway also serves the stream as
+	// Server-Sent Events, when the request accepts `text/event-stream`.
+	WatchUsers(*WatchUsersRequest, grpc.ServerStreamingServer[WatchUsersResponse]) error
 	mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -155,15 +440,45 @@ func (UnimplementedUserServiceServer) CreateUser(context.Context, *CreateUserReq
 func (UnimplementedUserServiceServer) GetUser(context.Context, *GetUserRequest) (*User, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
 }
+func (UnimplementedUserServiceServer) BatchCreateUsers(context.Context, *BatchCreateUsersRequest) (*BatchCreateUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCreateUsers not implemented")
+}
+func (UnimplementedUserServiceServer) BatchGetUsers(context.Context, *BatchGetUsersRequest) (*BatchGetUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetUsers not implemented")
+}
 func (UnimplementedUserServiceServer) ListUsers(context.Context, *ListUsersRequest) (*ListUsersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
 }
 func (UnimplementedUserServiceServer) UpdateUser(context.Context, *UpdateUserRequest) (*User, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
 }
+func (UnimplementedUserServiceServer) BatchUpdateUsers(context.Context, *BatchUpdateUsersRequest) (*BatchUpdateUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdateUsers not implemented")
+}
 func (UnimplementedUserServiceServer) DeleteUser(context.Context, *DeleteUserRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
 }
+func (UnimplementedUserServiceServer) BatchDeleteUsers(context.Context, *BatchDeleteUsersRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDeleteUsers not implemented")
+}
+func (UnimplementedUserServiceServer) ImportUsers(grpc.ClientStreamingServer[ImportUsersRequest, ImportUsersResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ImportUsers not implemented")
+}
+func (UnimplementedUserServiceServer) PurgeUsers(context.Context, *PurgeUsersRequest) (*longrunningpb.Operation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeUsers not implemented")
+}
+func (UnimplementedUserServiceServer) UndeleteUser(context.Context, *UndeleteUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UndeleteUser not implemented")
+}
+func (UnimplementedUserServiceServer) ListUserRevisions(context.Context, *ListUserRevisionsRequest) (*ListUserRevisionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUserRevisions not implemented")
+}
+func (UnimplementedUserServiceServer) RollbackUser(context.Context, *RollbackUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackUser not implemented")
+}
+func (UnimplementedUserServiceServer) WatchUsers(*WatchUsersRequest, grpc.ServerStreamingServer[WatchUsersResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchUsers not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 func (UnimplementedUserServiceServer) testEmbeddedByValue()                     {}
 
@@ -221,6 +536,42 @@ func _UserService_GetUser_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_BatchCreateUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCreateUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).BatchCreateUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_BatchCreateUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).BatchCreateUsers(ctx, req.(*BatchCreateUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_BatchGetUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).BatchGetUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_BatchGetUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).BatchGetUsers(ctx, req.(*BatchGetUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _UserService_ListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListUsersRequest)
 	if err := dec(in); err != nil {
@@ -257,6 +608,24 @@ func _UserService_UpdateUser_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_BatchUpdateUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchUpdateUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).BatchUpdateUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_BatchUpdateUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).BatchUpdateUsers(ctx, req.(*BatchUpdateUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _UserService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(DeleteUserRequest)
 	if err := dec(in); err != nil {
@@ -275,6 +644,114 @@ func _UserService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_BatchDeleteUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).BatchDeleteUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_BatchDeleteUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).BatchDeleteUsers(ctx, req.(*BatchDeleteUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ImportUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UserServiceServer).ImportUsers(&grpc.GenericServerStream[ImportUsersRequest, ImportUsersResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_ImportUsersServer = grpc.ClientStreamingServer[ImportUsersRequest, ImportUsersResponse]
+
+func _UserService_PurgeUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).PurgeUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_PurgeUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).PurgeUsers(ctx, req.(*PurgeUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_UndeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndeleteUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).UndeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_UndeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).UndeleteUser(ctx, req.(*UndeleteUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ListUserRevisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUserRevisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ListUserRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ListUserRevisions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ListUserRevisions(ctx, req.(*ListUserRevisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_RollbackUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).RollbackUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_RollbackUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).RollbackUser(ctx, req.(*RollbackUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_WatchUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchUsersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserServiceServer).WatchUsers(m, &grpc.GenericServerStream[WatchUsersRequest, WatchUsersResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_WatchUsersServer = grpc.ServerStreamingServer[WatchUsersResponse]
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -290,6 +767,14 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetUser",
 			Handler:    _UserService_GetUser_Handler,
 		},
+		{
+			MethodName: "BatchCreateUsers",
+			Handler:    _UserService_BatchCreateUsers_Handler,
+		},
+		{
+			MethodName: "BatchGetUsers",
+			Handler:    _UserService_BatchGetUsers_Handler,
+		},
 		{
 			MethodName: "ListUsers",
 			Handler:    _UserService_ListUsers_Handler,
@@ -298,11 +783,46 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateUser",
 			Handler:    _UserService_UpdateUser_Handler,
 		},
+		{
+			MethodName: "BatchUpdateUsers",
+			Handler:    _UserService_BatchUpdateUsers_Handler,
+		},
 		{
 			MethodName: "DeleteUser",
 			Handler:    _UserService_DeleteUser_Handler,
 		},
+		{
+			MethodName: "BatchDeleteUsers",
+			Handler:    _UserService_BatchDeleteUsers_Handler,
+		},
+		{
+			MethodName: "PurgeUsers",
+			Handler:    _UserService_PurgeUsers_Handler,
+		},
+		{
+			MethodName: "UndeleteUser",
+			Handler:    _UserService_UndeleteUser_Handler,
+		},
+		{
+			MethodName: "ListUserRevisions",
+			Handler:    _UserService_ListUserRevisions_Handler,
+		},
+		{
+			MethodName: "RollbackUser",
+			Handler:    _UserService_RollbackUser_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ImportUsers",
+			Handler:       _UserService_ImportUsers_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchUsers",
+			Handler:       _UserService_WatchUsers_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "gomicroservice/v1/user_service.proto",
 }